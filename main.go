@@ -6,13 +6,17 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"time"
 
 	"agentEino/pkg/agent"
 	"agentEino/pkg/api"
+	"agentEino/pkg/config"
 	"agentEino/pkg/llm"
 	"agentEino/pkg/logger"
 	"agentEino/pkg/tools"
+	"agentEino/pkg/tracing"
 
 	"github.com/joho/godotenv"
 )
@@ -24,9 +28,34 @@ func main() {
 		logger.Warn(".env 文件未找到，使用默认配置")
 	}
 
+	// 解析命令行参数
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "JSON配置文件路径（环境变量优先于文件中的值）")
+	webMode := flag.Bool("web", false, "启动Web模式")
+	cliMode := flag.Bool("cli", false, "启动CLI对话模式")
+	port := flag.String("port", "", "Web服务器端口（默认使用配置中的 server.port）")
+	replayID := flag.String("replay", "", "按当前配置回放指定会话的用户消息并输出新旧回复后退出")
+	quiet := flag.Bool("quiet", false, "对话模式下不输出欢迎语、思考中等状态提示，只输出回复与错误")
+	uiLang := flag.String("lang", os.Getenv("UI_LANG"), "CLI 与默认交互模式的提示语言（zh/en，默认 zh）")
+	turnTimeout := flag.Duration("timeout", 0, "单轮对话的最长执行时间（如 90s、2m），超时后回到输入提示；设置后覆盖 MAX_TURN_SECONDS")
+	flag.Parse()
+
+	// 加载配置
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		logger.Fatalf("加载配置失败: %v", err)
+	}
+	if *port != "" {
+		cfg.Server.Port = *port
+	}
+	if *turnTimeout < 0 {
+		logger.Fatalf("-timeout 不能为负数: %s", *turnTimeout)
+	}
+	if _, ok := uiTexts[*uiLang]; !ok && *uiLang != "" {
+		logger.Fatalf("-lang 不支持: %s（可选 zh、en）", *uiLang)
+	}
+
 	// 设置日志级别
-	logLevel := os.Getenv("LOG_LEVEL")
-	switch strings.ToUpper(logLevel) {
+	switch strings.ToUpper(cfg.Log.Level) {
 	case "DEBUG":
 		logger.SetLevel(logger.DEBUG)
 	case "INFO":
@@ -39,79 +68,144 @@ func main() {
 		logger.SetLevel(logger.INFO)
 	}
 
-	// 获取Ollama配置
-	ollamaURL := os.Getenv("OLLAMA_BASE_URL")
-	if ollamaURL == "" {
-		ollamaURL = "http://10.0.10.112:11434" // 默认Ollama URL
+	// 设置日志字段值最大长度（<=0 表示不截断）
+	logger.SetMaxFieldLength(cfg.Log.MaxFieldLength)
+
+	// 日志文件：设置后不再输出到标准输出，按大小轮转
+	if cfg.Log.File != "" {
+		logger.SetMaxBackups(cfg.Log.FileMaxBackups)
+		if err := logger.ToFile(cfg.Log.File, cfg.Log.FileMaxSizeMB); err != nil {
+			logger.Fatalf("打开日志文件失败: %v", err)
+		}
+	}
+
+	// 日志颜色：auto（默认，仅终端输出时启用）/true/false
+	switch strings.ToLower(cfg.Log.Color) {
+	case "true":
+		logger.SetColor(true)
+	case "false":
+		logger.SetColor(false)
 	}
 
-	ollamaModel := os.Getenv("OLLAMA_MODEL")
-	if ollamaModel == "" {
-		ollamaModel = "gpt-oss:20b" // 默认模型，使用更稳定的模型
+	// 日志格式：text（默认）/json，配置已校验过格式名称
+	if format, err := logger.ParseFormat(cfg.Log.Format); err == nil {
+		logger.SetFormat(format)
 	}
 
+	// 初始化OpenTelemetry追踪（未配置导出器时为no-op）
+	shutdownTracing, err := tracing.Init(cfg.Tracing.Exporter)
+	if err != nil {
+		logger.Fatalf("初始化追踪失败: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	logger.Info("加载配置", map[string]interface{}{
-		"ollama_url": ollamaURL,
-		"ollama_model": ollamaModel,
+		"config_file": *configPath,
+		"provider":    cfg.LLM.Provider,
+		"model":       cfg.LLM.Model,
 	})
 
-	// 创建LLM客户端 (Ollama)
-	llmClient := llm.NewOllamaClient(ollamaURL, ollamaModel, 1000)
+	// 创建Agent配置
+	agentConfig, err := cfg.AgentConfig()
+	if err != nil {
+		logger.Fatalf("Agent配置无效: %v", err)
+	}
+	if *turnTimeout > 0 {
+		agentConfig.MaxTurnDuration = *turnTimeout
+	}
+
+	// 向量记忆的嵌入模型（配置校验时已确认提供方与 API Key）
+	switch strings.ToLower(cfg.Memory.Embeddings) {
+	case "openai":
+		embedder := llm.NewOpenAIEmbedder(cfg.LLM.APIKey, cfg.Memory.EmbeddingModel)
+		agentConfig.MemoryConfig.Embedder = embedder
+		logger.Info("向量记忆使用 OpenAI 嵌入模型", map[string]interface{}{"model": embedder.Model()})
+	case "ollama":
+		embedder := llm.NewOllamaEmbedder(cfg.LLM.BaseURL, cfg.Memory.EmbeddingModel)
+		agentConfig.MemoryConfig.Embedder = embedder
+		logger.Info("向量记忆使用 Ollama 嵌入模型", map[string]interface{}{"model": embedder.Model()})
+	}
+
+	// 创建LLM客户端（按 provider 选择 Ollama 或 OpenAI）
+	llmClient, err := llm.NewClient(agentConfig.ModelConfig)
+	if err != nil {
+		logger.Fatalf("创建LLM客户端失败: %v", err)
+	}
+
+	// 第一轮工具决策使用独立的模型（同一提供方与参数）
+	if cfg.LLM.DecisionModel != "" && cfg.LLM.DecisionModel != cfg.LLM.Model {
+		decisionModel := agentConfig.ModelConfig
+		decisionModel.ModelName = cfg.LLM.DecisionModel
+		decisionClient, err := llm.NewClient(decisionModel)
+		if err != nil {
+			logger.Fatalf("创建决策模型客户端失败: %v", err)
+		}
+		agentConfig.Decision = agent.DecisionConfig{Client: decisionClient, ModelName: decisionModel.ModelName}
+		logger.Info("第一轮工具决策使用独立模型", map[string]interface{}{"model": decisionModel.ModelName})
+	}
 
 	// 创建工具管理器
 	toolManager := tools.NewToolManager()
+	toolManager.SetMaxConcurrency(cfg.Tools.MaxParallelTools)
 
-	// 注册一个简单的计算器工具
-	calculator := &CalculatorTool{}
+	// 注册计算器工具（算术表达式或单个运算）
+	calculator := tools.NewCalculatorTool()
 	toolManager.RegisterTool(calculator.Name(), calculator)
 
 	// 注册联网搜索工具
-	searchAPIKey := os.Getenv("SEARCH_API_KEY")
-	webSearch := tools.NewWebSearchTool(searchAPIKey)
+	webSearch := tools.NewWebSearchTool(cfg.Tools.SearchAPIKey)
+	// 显式指定搜索引擎时覆盖基于API密钥的自动选择（配置校验时已确认引擎名有效）
+	if cfg.Tools.SearchEngine != "" {
+		engineType, _ := tools.ParseSearchEngineType(cfg.Tools.SearchEngine)
+		webSearch = tools.NewWebSearchToolWithEngine(engineType, cfg.Tools.SearchAPIKey)
+		logger.Info("使用指定的搜索引擎", map[string]interface{}{"engine": engineType})
+	}
+	webSearch.SetLimits(time.Duration(cfg.Tools.SearchTimeoutSeconds)*time.Second, cfg.Tools.SearchMaxResults)
+	webSearch.SetEnrichment(cfg.Tools.SearchEnrichment,
+		time.Duration(cfg.Tools.SearchEnrichmentTimeoutSeconds)*time.Second,
+		cfg.Tools.SearchEnrichmentMaxChars)
+	// 密钥无效时改用备用引擎（配置校验时已确认名称有效）
+	authFallback, _ := tools.ParseSearchFallback(cfg.Tools.SearchAuthFallback)
+	webSearch.SetAuthFallback(authFallback, cfg.Tools.SearchAuthDisableAfter)
 	toolManager.RegisterTool(webSearch.Name(), webSearch)
 
 	// 注册本地知识库工具
-	knowledgeBasePath := os.Getenv("KNOWLEDGE_BASE_PATH")
-	if knowledgeBasePath == "" {
-		knowledgeBasePath = "./knowledge_base" // 默认知识库路径
-	}
-	knowledgeBase := tools.NewKnowledgeBaseTool(knowledgeBasePath)
+	knowledgeBase := tools.NewKnowledgeBaseTool(cfg.Tools.KnowledgeBasePath)
+	knowledgeBase.SetMaxDocumentBytes(cfg.Tools.KnowledgeBaseMaxDocumentBytes)
+	knowledgeBase.SetFuzzyNames(cfg.Tools.KnowledgeBaseFuzzyNames)
 	toolManager.RegisterTool(knowledgeBase.Name(), knowledgeBase)
 
-	// 获取Agent Prompt
-	agentPrompt := os.Getenv("AGENT_PROMPT")
-	if agentPrompt == "" {
-		agentPrompt = `你是一位智能AI助手。
-
-当需要使用工具时，请使用以下格式之一：
+	// 注册统计工具（可引用知识库中的CSV列）
+	stats := tools.NewStatsTool(cfg.Tools.KnowledgeBasePath)
+	toolManager.RegisterTool(stats.Name(), stats)
 
-方法1 - JSON格式（推荐）：
-{"tool":"tool_name","params":{"param1":"value1"}}
+	// 注册JSON工具（校验、格式化、按路径提取）
+	jsonTool := tools.NewJSONTool(tools.DefaultJSONMaxInputBytes)
+	toolManager.RegisterTool(jsonTool.Name(), jsonTool)
 
-方法2 - Markdown格式：
-` + "```tool:tool_name\n{\"param1\":\"value1\"}\n```" + `
+	// 注册随机值工具（UUID、随机令牌）
+	random := tools.NewRandomTool()
+	toolManager.RegisterTool(random.Name(), random)
 
-可用工具：
-1. web_search: 联网搜索
-2. knowledge_base: 本地知识库 (list/read/search)
-3. calculator: 计算器`
+	// 注册汇率换算工具（需显式开启，会访问外部汇率接口）
+	if cfg.Tools.Currency {
+		currency := tools.NewCurrencyTool(cfg.Tools.CurrencyAPIURL,
+			time.Duration(cfg.Tools.CurrencyCacheTTLSeconds)*time.Second)
+		toolManager.RegisterTool(currency.Name(), currency)
 	}
 
-	// 创建Agent配置
-	config := agent.Config{
-		Name:        "EinoAgent",
-		Description: "A simple AI agent built with Eino",
-		ModelConfig: agent.ModelConfig{
-			Provider:  "ollama",
-			ModelName: ollamaModel,
-			BaseURL:   ollamaURL,
-			MaxTokens: 1000,
-			Prompt:    agentPrompt,
-		},
+	// 录制/回放模式：工具结果写入录制文件，再次运行时直接回放
+	if cfg.Tools.Cassette != "" {
+		cassette, err := tools.NewCassette(cfg.Tools.Cassette)
+		if err != nil {
+			logger.Fatalf("加载工具录制文件失败: %v", err)
+		}
+		toolManager = tools.WrapWithCassette(toolManager, cassette)
+		logger.Info("启用工具录制/回放模式", map[string]interface{}{"cassette": cfg.Tools.Cassette})
 	}
 
 	// 创建Agent
-	myAgent := agent.NewEinoAgent(config)
+	myAgent := agent.NewEinoAgent(agentConfig)
 
 	// 初始化Agent
 	ctx := context.Background()
@@ -120,30 +214,54 @@ func main() {
 		logger.Fatalf("初始化Agent失败: %v", err)
 	}
 
-	// 解析命令行参数
-	webMode := flag.Bool("web", false, "启动Web模式")
-	cliMode := flag.Bool("cli", false, "启动CLI对话模式")
-	port := flag.String("port", "8080", "Web服务器端口")
-	flag.Parse()
-
-	if *webMode {
+	if *replayID != "" {
+		// 回放模式：在临时会话中重新生成每轮回复，便于比较提示词修改前后的回答
+		turns, err := myAgent.ReplayConversation(ctx, *replayID)
+		if err != nil {
+			logger.Fatalf("回放会话失败: %v", err)
+		}
+		changed := 0
+		for _, turn := range turns {
+			status := "相同"
+			if !turn.Identical {
+				status = "不同"
+				changed++
+			}
+			fmt.Printf("\n=== 第 %d 轮（%s）===\n> %s\n\n[原回复]\n%s\n\n[新回复]\n%s\n", turn.Index+1, status, turn.Input, turn.Original, turn.Replayed)
+			if turn.Error != "" {
+				fmt.Printf("[错误] %s\n", turn.Error)
+			}
+		}
+		fmt.Printf("\n共 %d 轮，%d 轮回复不同\n", len(turns), changed)
+	} else if *webMode {
 		// 启动Web服务器
-		logger.Infof("启动Web模式，服务器运行在 http://localhost:%s", *port)
+		logger.Infof("启动Web模式，服务器运行在 http://localhost:%s", cfg.Server.Port)
 		server := api.NewServer(myAgent)
-		server.Start(*port)
+		server.SetStreamWriteTimeout(time.Duration(cfg.Server.StreamWriteTimeoutSeconds) * time.Second)
+		server.SetConversationRateLimit(cfg.Server.ConversationRateLimit)
+		server.SetMaxActiveConversationsPerIP(cfg.Server.MaxActiveConversationsPerIP)
+		server.SetConversationPageSize(cfg.Server.ConversationPageSize)
+		server.SetMaxRequestBodyBytes(cfg.Server.MaxRequestBodyBytes)
+		server.SetKnowledgeBase(knowledgeBase)
+		server.SetAutoTitle(cfg.Server.TitleUseLLM, cfg.Server.TitleMessages)
+		if err := server.LoadConversations(ctx); err != nil {
+			logger.Warnf("恢复持久化会话失败: %v", err)
+		}
+		server.StartAutoArchive(ctx, time.Duration(cfg.Server.AutoArchiveAfterHours)*time.Hour)
+		server.Start(cfg.Server.Port)
 	} else if *cliMode {
-		// CLI对话模式 - 使用英文提示避免中文编码问题
-		fmt.Println("Welcome to Eino AI Assistant (type 'exit' to quit)")
-		fmt.Println("------------------------------")
+		// CLI对话模式，终端不支持中文时可用 -lang en 切换为英文提示
+		ui := newTerminalUI(os.Stdout, *uiLang, *quiet)
+		ui.Welcome()
 
 		reader := bufio.NewReader(os.Stdin)
 		for {
-			fmt.Print("\n> ")
+			ui.Prompt()
 			input, _ := reader.ReadString('\n')
 			input = strings.TrimSpace(input)
 
 			if input == "exit" {
-				fmt.Println("Goodbye!")
+				ui.Goodbye()
 				break
 			}
 
@@ -151,28 +269,42 @@ func main() {
 				continue
 			}
 
-			fmt.Println("Thinking...")
-			response, err := myAgent.Process(ctx, input)
+			if err := myAgent.ValidateInput(input); err != nil {
+				ui.Error(err)
+				continue
+			}
+
+			ui.Thinking()
+
+			// 生成期间按 Ctrl-C 只取消本次请求，回到输入提示而不是退出程序
+			reqCtx, stop := signal.NotifyContext(ctx, os.Interrupt)
+			response, err := myAgent.Process(reqCtx, input)
+			interrupted := reqCtx.Err() != nil
+			stop()
+			if interrupted {
+				ui.Cancelled()
+				continue
+			}
 			if err != nil {
-				fmt.Printf("Error: %v\n", err)
+				ui.Error(err)
 				continue
 			}
 
-			fmt.Println("\n" + response)
+			ui.Response(response)
 		}
 	} else {
 		// 命令行模式 - 改为交互式对话，使用流式处理：
-		fmt.Println("欢迎使用 Eino AI 助手 (输入 'exit' 退出)")
-		fmt.Println("------------------------------")
+		ui := newTerminalUI(os.Stdout, *uiLang, *quiet)
+		ui.Welcome()
 
 		reader := bufio.NewReader(os.Stdin)
 		for {
-			fmt.Print("\n> ")
+			ui.Prompt()
 			input, _ := reader.ReadString('\n')
 			input = strings.TrimSpace(input)
 
 			if input == "exit" {
-				fmt.Println("再见!")
+				ui.Goodbye()
 				break
 			}
 
@@ -180,73 +312,40 @@ func main() {
 				continue
 			}
 
-			fmt.Println("思考中...")
+			// 超长输入直接提示，不进入生成
+			if err := myAgent.ValidateInput(input); err != nil {
+				ui.Error(err)
+				continue
+			}
+
+			ui.Thinking()
+
+			// 生成期间按 Ctrl-C 只取消本次请求，回到输入提示而不是退出程序
+			reqCtx, stop := signal.NotifyContext(ctx, os.Interrupt)
 
-			// 使用流式处理
-			responseChan := make(chan string, 100)
+			// 使用类型化事件流，思维链事件作为状态行输出，不混入回复正文
+			events := make(chan agent.StreamEvent, 100)
+			errChan := make(chan error, 1)
 
-			// 启动goroutine来处理流式响应
+			// 启动goroutine来处理流式响应，ProcessStreamEvents 结束时会关闭 events
 			go func() {
-				err := myAgent.ProcessStream(ctx, input, responseChan)
-				if err != nil {
-					fmt.Printf("\n错误: %v\n", err)
-				}
+				errChan <- myAgent.ProcessStreamEvents(reqCtx, input, events)
 			}()
 
 			// 实时显示响应
-			fmt.Print("\n")
-			for chunk := range responseChan {
-				fmt.Print(chunk)
+			for ev := range events {
+				ui.Event(ev)
+			}
+			ui.EndResponse()
+
+			err := <-errChan
+			interrupted := reqCtx.Err() != nil
+			stop()
+			if interrupted {
+				ui.Cancelled()
+			} else if err != nil {
+				ui.Error(err)
 			}
-			fmt.Println() // 换行
-		}
-	}
-}
-
-// CalculatorTool 是一个简单的计算器工具
-type CalculatorTool struct{}
-
-func (t *CalculatorTool) Name() string {
-	return "calculator"
-}
-
-func (t *CalculatorTool) Description() string {
-	return "A simple calculator that can perform basic arithmetic operations"
-}
-
-func (t *CalculatorTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
-	// 这里简化实现，实际应用中需要更完善的逻辑
-	operation, ok := params["operation"].(string)
-	if !ok {
-		return nil, fmt.Errorf("operation parameter is required")
-	}
-
-	a, ok := params["a"].(float64)
-	if !ok {
-		return nil, fmt.Errorf("a parameter is required")
-	}
-
-	b, ok := params["b"].(float64)
-	if !ok {
-		return nil, fmt.Errorf("b parameter is required")
-	}
-
-	var result float64
-	switch operation {
-	case "add":
-		result = a + b
-	case "subtract":
-		result = a - b
-	case "multiply":
-		result = a * b
-	case "divide":
-		if b == 0 {
-			return nil, fmt.Errorf("division by zero")
 		}
-		result = a / b
-	default:
-		return nil, fmt.Errorf("unsupported operation: %s", operation)
 	}
-
-	return result, nil
 }
@@ -3,12 +3,23 @@ package agent
 import (
 	"agentEino/pkg/logger"
 	"agentEino/pkg/memory"
+	"agentEino/pkg/tokenizer"
 	"agentEino/pkg/tools"
+	"agentEino/pkg/tracing"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // LLMClient 定义了LLM客户端的接口
@@ -38,6 +49,16 @@ type Agent interface {
 	GetConversationID() string
 	// SetConversationID 切换当前Agent会话ID（如果记忆存在则同步历史）
 	SetConversationID(id string) error
+
+	// ListTools 列出已注册的工具
+	ListTools() []ToolInfo
+}
+
+// ToolInfo 已注册工具的名称、描述与参数定义（工具未声明参数时为空）
+type ToolInfo struct {
+	Name        string                     `json:"name"`
+	Description string                     `json:"description"`
+	Parameters  map[string]tools.ParamSpec `json:"parameters,omitempty"`
 }
 
 // Config 包含Agent的配置信息
@@ -47,37 +68,310 @@ type Config struct {
 	ModelConfig  ModelConfig
 	MemoryConfig MemoryConfig
 	ToolsConfig  ToolsConfig
+	Behavior     BehaviorConfig
+	History      HistoryConfig
+	// MaxTurnDuration 单轮对话（含所有生成与工具调用）的最长执行时间，<=0 表示不限制
+	MaxTurnDuration time.Duration
+	// RetryBudget 单轮对话内所有重试等待的累计上限，用完后直接失败；<=0 表示不限制
+	RetryBudget time.Duration
+	// MaxInputChars / MaxInputTokens 单条用户输入的字符数与估算 token 数上限，超过时在生成前返回 ErrInputTooLong；<=0 表示不限制
+	MaxInputChars  int
+	MaxInputTokens int
+	// Features 实验特性开关，未设置的特性使用默认值
+	Features Features
+	// Cache 按提示词缓存LLM回复，Cache.Cache 为 nil 时不缓存
+	Cache CacheConfig
+	// Decision 第一轮工具决策使用的模型，Decision.Client 为 nil 时使用主模型
+	Decision DecisionConfig
 }
 
+var (
+	// ErrTurnTimeout 单轮对话执行时间超过 MaxTurnDuration
+	ErrTurnTimeout = errors.New("本轮对话执行超时")
+	// ErrMaxToolIterations 单轮对话中工具调用次数达到 MaxToolIterations 上限
+	ErrMaxToolIterations = errors.New("工具调用次数达到上限")
+	// ErrToolCallCycle 模型在提示后仍反复以相同参数调用同一工具
+	ErrToolCallCycle = errors.New("检测到重复的工具调用")
+	// ErrToolResultMissing 注入的工具结果未出现在下一轮提示词中（ToolResultGuardStrict）
+	ErrToolResultMissing = errors.New("工具结果未进入提示词")
+)
+
 // ModelConfig 包含LLM模型的配置
 type ModelConfig struct {
 	Provider  string // "openai" 或 "ollama"
 	ModelName string
 	APIKey    string // 对于OpenAI需要，Ollama可选
 	BaseURL   string // Ollama服务器URL，例如 "http://localhost:11434"
-	MaxTokens int
+	MaxTokens int    // 最大生成 token 数，<=0 时使用提供方默认值
 	Prompt    string // Agent的系统提示词
+	// Temperature 与 TopP 采样参数，nil 时使用提供方默认值；温度为 0 时生成结果确定
+	Temperature *float64
+	TopP        *float64
+	// Tokenizer 用于统计 token 用量，nil 时按 ModelName 通过 tokenizer.ForModel 选择
+	Tokenizer tokenizer.Tokenizer
+	// Warmup 初始化时预加载模型，失败仅记录警告；客户端需实现 Warmer
+	Warmup bool
+	// KeepAlive 模型在内存中的保留时长（Ollama keep_alive，如 "5m"、"-1"），为空使用默认值
+	KeepAlive string
+	// OllamaMode Ollama 端点模式（chat/generate/auto），为空使用 chat
+	OllamaMode string
+	// 请求重试与超时（仅 Ollama），零值使用客户端默认值
+	MaxRetries     int           // 发送请求失败时的最大尝试次数
+	MaxLoadRetries int           // 模型加载中时的最大重试次数
+	RequestTimeout time.Duration // 单次生成的超时时间
+	LoadWait       time.Duration // 模型加载中时重试前的等待时间
+	RetryBackoff   time.Duration // 请求失败后的退避基数
+}
+
+// ToolSpec 描述一个提供给原生函数调用API的工具
+type ToolSpec struct {
+	Name        string
+	Description string
+	// Parameters 工具声明的参数定义（见 tools.ParameterizedTool），为空时不限制参数
+	Parameters map[string]tools.ParamSpec
+}
+
+// ToolCall 结构化的工具调用
+type ToolCall struct {
+	Name   string
+	Params map[string]interface{}
+}
+
+// FunctionCaller 可选接口：支持原生函数调用（如 OpenAI tools API）的LLM客户端
+// calls 非空表示模型请求调用工具（可同时请求多个，作为一批执行），否则 content 即为普通回复；未实现时 Agent 退回文本解析
+type FunctionCaller interface {
+	GenerateWithTools(ctx context.Context, prompt string, tools []ToolSpec) (content string, calls []ToolCall, err error)
+}
+
+// GenerationUsage 单次或多次生成的用量：提示词与回复的字符数，以及模型服务实际统计的 token 数
+// PromptEvalCount/EvalCount 对应 Ollama 的 prompt_eval_count/eval_count（OpenAI 为 usage 中的 token 数），未返回时为 0
+type GenerationUsage struct {
+	PromptChars     int `json:"prompt_chars"`
+	CompletionChars int `json:"completion_chars"`
+	PromptEvalCount int `json:"prompt_eval_count"`
+	EvalCount       int `json:"eval_count"`
+}
+
+// Add 累加另一次生成的用量
+func (u *GenerationUsage) Add(other GenerationUsage) {
+	u.PromptChars += other.PromptChars
+	u.CompletionChars += other.CompletionChars
+	u.PromptEvalCount += other.PromptEvalCount
+	u.EvalCount += other.EvalCount
+}
+
+// UsageGenerator 可选接口：非流式生成时一并返回用量的LLM客户端
+type UsageGenerator interface {
+	GenerateWithUsage(ctx context.Context, prompt string) (string, GenerationUsage, error)
+}
+
+// MessageClient 可选接口：直接接收按角色划分的消息列表的LLM客户端
+// 实现后 Agent 不再把提示词拼接为 "role: content" 文本，也不追加结尾的 "assistant: " 提示，
+// 客户端无需再从文本中解析角色，用户输入中形如 "assistant:" 的行也不会被误认为角色切换
+type MessageClient interface {
+	GenerateMessages(ctx context.Context, messages []Message) (string, GenerationUsage, error)
+	GenerateMessagesStream(ctx context.Context, messages []Message, responseChan chan<- string) error
+}
+
+// MessageFunctionCaller 可选接口：按消息列表进行原生函数调用的LLM客户端，优先于 FunctionCaller
+type MessageFunctionCaller interface {
+	GenerateMessagesWithTools(ctx context.Context, messages []Message, tools []ToolSpec) (content string, calls []ToolCall, err error)
+}
+
+// Warmer 可选接口：支持预加载模型的LLM客户端
+type Warmer interface {
+	Warmup(ctx context.Context) error
+}
+
+// DefaultWarmupTimeout 预加载模型的超时时间
+const DefaultWarmupTimeout = 2 * time.Minute
+
+// ToolCallRecord 本轮一次工具调用的记录
+type ToolCallRecord struct {
+	Iteration int                    `json:"iteration"`         // 第几轮工具调用（从1开始）
+	Tool      string                 `json:"tool"`              // 工具名称
+	Params    map[string]interface{} `json:"params"`            // 调用参数
+	Result    interface{}            `json:"result,omitempty"`  // 工具返回结果
+	Error     string                 `json:"error,omitempty"`   // 执行失败时的错误信息
+	Skipped   bool                   `json:"skipped,omitempty"` // 与之前的调用重复而未执行
+}
+
+// ProcessResult ProcessDetailed 的返回值，在最终回复之外记录工具决策过程
+type ProcessResult struct {
+	Response  string           `json:"response"`             // 最终回复
+	Decision  string           `json:"decision,omitempty"`   // 第一轮生成的原始文本（工具决策）
+	ToolCalls []ToolCallRecord `json:"tool_calls,omitempty"` // 按顺序记录的工具调用
+	// CitationMissing 引用模式为 verify 时，本轮有搜索结果但回复未标注来源
+	CitationMissing bool `json:"citation_missing,omitempty"`
+}
+
+// Usage 本轮对话的 token 用量（由 Tokenizer 估算，包含工具决策、重试在内的全部生成）
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
 }
 
 // MemoryConfig 包含记忆系统的配置
 type MemoryConfig struct {
-	MemoryType string
-	DBPath     string
+	MemoryType  string
+	DBPath      string
+	MaxMessages int // 每个对话持久化的最大消息数，<=0 表示不限制
+	// DedupeWindow 连续重复消息的去重时间窗口，<=0 表示不去重
+	DedupeWindow time.Duration
+	// ConversationIDPattern 会话ID格式，nil 表示使用 memory.DefaultConversationIDPattern
+	ConversationIDPattern *regexp.Regexp
+	// Embedder 向量记忆使用的嵌入模型，nil 表示使用占位向量与关键词匹配（仅 vector 类型生效）
+	Embedder memory.Embedder
+	// SessionIdleTTL 会话状态在内存中缓存的空闲时长，超过后释放，再次访问时从记忆重新加载
+	// <=0 时使用 DefaultSessionIdleTTL
+	SessionIdleTTL time.Duration
 }
 
+// DefaultSessionIdleTTL 默认的会话状态空闲释放时长
+const DefaultSessionIdleTTL = 30 * time.Minute
+
 // ToolsConfig 包含工具的配置
 type ToolsConfig struct {
+	// EnabledTools 启用的工具名称，为空表示启用全部已注册的工具
 	EnabledTools []string
+	// ParamDefaults 工具名 -> 参数名 -> 默认值，调用缺少该参数时自动填入
+	ParamDefaults map[string]map[string]interface{}
 }
 
+// HistoryConfig 控制注入提示词的对话历史窗口，超出任一上限时从最早的消息开始省略
+type HistoryConfig struct {
+	// MaxMessages 最多保留的最近消息数，<=0 时使用 DefaultHistoryMaxMessages
+	MaxMessages int
+	// MaxTokens 整个提示词的 token 预算（估算），<=0 表示不按 token 限制
+	// 系统提示词始终保留，最新一条消息即使超出预算也会保留
+	MaxTokens int
+	// EstimateTokens 估算文本的 token 数，nil 时使用 ModelConfig.Tokenizer
+	EstimateTokens func(text string) int
+}
+
+// 默认的工具调用标记
+const (
+	DefaultToolSentinelStart = "<<TOOL>>"
+	DefaultToolSentinelEnd   = "<<END>>"
+)
+
+// DefaultHistoryMaxMessages 默认保留的最近历史消息数
+const DefaultHistoryMaxMessages = 10
+
+// BehaviorConfig 包含Agent运行行为的可选配置
+type BehaviorConfig struct {
+	// StreamDecisionThinking 在流式模式下将工具决策阶段的模型输出作为思考事件实时推送
+	StreamDecisionThinking bool
+	// MaxSearchResults 注入上下文的搜索结果最大条数，<=0 时使用 DefaultMaxSearchResults
+	MaxSearchResults int
+	// EmptyResponseMessage LLM返回空响应时使用的回退消息，为空时使用 DefaultEmptyResponseMessage
+	EmptyResponseMessage string
+	// RetryOnEmpty LLM返回空响应时追加提示重试一次
+	RetryOnEmpty bool
+	// PersistPartialResponses 流式生成中客户端断开时，仍将已生成的部分保存到对话并标记为未完成；
+	// 关闭时丢弃。超时中断的回复始终保存
+	PersistPartialResponses bool
+	// MinResponseChars 回复至少包含的非空白字符数，不足时视为空响应；<=0 时仅拒绝全空白回复
+	MinResponseChars int
+	// ToolSentinelStart/ToolSentinelEnd 均非空时启用标记模式：提示模型把工具调用写在两个标记之间，
+	// 解析时只识别标记内的调用，不再猜测 JSON 或 Markdown 格式
+	ToolSentinelStart string
+	ToolSentinelEnd   string
+	// ToolSentinelInstruction 标记模式下注入提示词的说明，为空时按标记自动生成
+	ToolSentinelInstruction string
+	// StrictTools 强制工具规则：输入匹配规则时必须调用对应工具
+	StrictTools []StrictToolRule
+	// MaxStrictRetries 模型未按规则调用工具时的最大重试次数，<=0 时使用 DefaultMaxStrictRetries
+	MaxStrictRetries int
+	// MaxToolIterations 单轮对话中工具调用的最大次数，<=0 时使用 DefaultMaxToolIterations
+	MaxToolIterations int
+	// KnowledgeContext 每轮自动检索知识库，将相关片段（带来源编号）注入提示词，无需模型调用工具
+	KnowledgeContext bool
+	// KnowledgeContextMaxSnippets 注入的最大片段数，<=0 时使用 DefaultKnowledgeContextMaxSnippets
+	KnowledgeContextMaxSnippets int
+	// KnowledgeContextMaxChars 注入内容的最大字节数，<=0 时使用 DefaultKnowledgeContextMaxChars
+	KnowledgeContextMaxChars int
+	// CitationMode 使用搜索结果后的来源标注要求：CitationModeOff（默认）/CitationModeInstruct/CitationModeVerify
+	CitationMode string
+	// ToolResultGuard 注入工具结果后的下一轮提示词缺少这些结果时的处理：
+	// ToolResultGuardRepair（默认，为空时同）/ToolResultGuardStrict/ToolResultGuardOff
+	ToolResultGuard string
+}
+
+// DefaultMaxToolIterations 默认的单轮工具调用次数上限
+const DefaultMaxToolIterations = 5
+
+// 自动注入知识库上下文的默认上限
+const (
+	DefaultKnowledgeContextMaxSnippets = 3
+	DefaultKnowledgeContextMaxChars    = 1500
+)
+
+// StrictToolRule 表示一条强制工具规则
+type StrictToolRule struct {
+	Tool    string
+	Pattern *regexp.Regexp
+}
+
+// DefaultMaxStrictRetries 默认的强制工具重试次数
+const DefaultMaxStrictRetries = 2
+
+// ParseStrictToolRules 解析JSON格式的强制工具规则，格式为 {"工具名":"正则表达式"}
+// 多条规则同时命中时取第一条，规则按正则长度降序、再按工具名排序，更具体的规则优先且顺序在重启间保持稳定
+func ParseStrictToolRules(spec string) ([]StrictToolRule, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	var raw map[string]string
+	if err := json.Unmarshal([]byte(spec), &raw); err != nil {
+		return nil, fmt.Errorf("解析强制工具规则失败: %w", err)
+	}
+	rules := make([]StrictToolRule, 0, len(raw))
+	for tool, pattern := range raw {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("工具 %s 的规则正则无效: %w", tool, err)
+		}
+		rules = append(rules, StrictToolRule{Tool: tool, Pattern: re})
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		pi, pj := rules[i].Pattern.String(), rules[j].Pattern.String()
+		if len(pi) != len(pj) {
+			return len(pi) > len(pj)
+		}
+		return rules[i].Tool < rules[j].Tool
+	})
+	return rules, nil
+}
+
+// DefaultEmptyResponseMessage 默认的空响应回退消息
+const DefaultEmptyResponseMessage = "抱歉，我无法生成有效的响应。请重新尝试您的问题。"
+
+// emptyResponseNudge 空响应重试时追加的提示
+const emptyResponseNudge = "你上一次的回复为空，请直接针对用户的最后一个问题给出回答。"
+
+// DefaultMaxSearchResults 默认注入上下文的搜索结果条数
+const DefaultMaxSearchResults = 3
+
 // EinoAgent 实现了Agent接口
 type EinoAgent struct {
-	config                Config
-	llmClient             LLMClient
-	memory                Memory
-	tools                 *tools.ToolManager
-	currentConversationID string    // 当前对话ID
-	messageHistory        []Message // 消息历史
+	config    Config
+	llmClient LLMClient
+	memory    Memory
+	tools     *tools.ToolManager
+
+	tokenizer tokenizer.Tokenizer // token 计数器
+
+	// mu 保护 sessions 与 current；各会话的状态由 session.mu 保护，只在读写字段时短暂持有，不跨越LLM生成、工具执行或记忆读写
+	mu        sync.Mutex
+	sessions  map[string]*session // 按会话ID缓存的会话状态，空闲超过 SessionIdleTTL 后释放
+	current   *session            // 上下文未绑定会话时使用的当前会话（CLI 与 SetConversationID）
+	lastSweep time.Time           // 上次检查空闲会话的时间
+}
+
+// knowledgeSearcher 可选接口：能按查询返回相关片段的知识库工具
+type knowledgeSearcher interface {
+	Snippets(query string, limit int) ([]tools.Snippet, error)
 }
 
 // Message 表示对话中的一条消息
@@ -86,6 +380,39 @@ type Message struct {
 	Content string `json:"content"`
 }
 
+// StoredConversation 记忆层中持久化的对话
+type StoredConversation struct {
+	ID           string
+	Title        string
+	SystemPrompt string // 对话专属的系统提示词，为空时使用全局提示词
+	Archived     bool   // 已归档，默认不出现在会话列表中
+	Messages     []StoredMessage
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// StoredMessage 记忆层中持久化的消息，角色包括 user/assistant/system/tool
+type StoredMessage struct {
+	Role      string
+	Content   string
+	Timestamp time.Time
+	Partial   bool // 生成中断时保存的不完整回复
+}
+
+// ConversationStore 可选接口：通过记忆层持久化对话，供 Web 层在重启后恢复会话列表
+type ConversationStore interface {
+	// NewConversation 在记忆层创建对话，不切换当前会话
+	NewConversation(ctx context.Context, title string) (string, error)
+	// StoredConversations 返回记忆层中的全部对话
+	StoredConversations(ctx context.Context) ([]StoredConversation, error)
+	// StoredConversation 返回记忆层中的单个对话
+	StoredConversation(ctx context.Context, id string) (*StoredConversation, error)
+	// DeleteConversation 删除对话及其持久化文件
+	DeleteConversation(ctx context.Context, id string) error
+	// RenameConversation 修改对话标题
+	RenameConversation(ctx context.Context, id, title string) error
+}
+
 // 注意：LLMClient 接口已在文件顶部定义
 
 // Memory 是记忆系统的接口
@@ -97,8 +424,23 @@ type Memory interface {
 	// 对话管理方法
 	CreateConversation(ctx context.Context, title string) (string, error)
 	AddMessageToConversation(ctx context.Context, conversationID string, role string, content string) error
+	// AddPartialMessageToConversation 添加一条标记为未完成的消息（生成中断时保存已生成的部分）
+	AddPartialMessageToConversation(ctx context.Context, conversationID string, role string, content string) error
 	GetConversation(ctx context.Context, conversationID string) (interface{}, error)
 	ListConversations(ctx context.Context, limit int) ([]interface{}, error)
+
+	// StoreConversationEntry 存储来自对话的条目（如反馈），向量内存会附带元数据以便检索和过滤
+	StoreConversationEntry(ctx context.Context, conversationID, role, entryType, content string) error
+
+	// PersistenceEnabled 对话是否会持久化到磁盘（数据目录不可写时为 false）
+	PersistenceEnabled() bool
+
+	// LoadConversations 从磁盘加载已持久化的对话
+	LoadConversations(ctx context.Context) error
+	SetConversationTitle(ctx context.Context, conversationID, title string) error
+	SetConversationSystemPrompt(ctx context.Context, conversationID, prompt string) error
+	SetConversationArchived(ctx context.Context, conversationID string, archived bool) error
+	DeleteConversation(ctx context.Context, conversationID string) error
 }
 
 // MemoryAdapter 适配器，将memory包中的实现适配到Memory接口
@@ -118,6 +460,19 @@ func (m *MemoryAdapter) Store(ctx context.Context, key string, value interface{}
 	return fmt.Errorf("未初始化内存系统")
 }
 
+// StoreConversationEntry 存储来自对话的条目
+// 向量内存写入带元数据的向量条目，简单内存退回到键值存储
+func (m *MemoryAdapter) StoreConversationEntry(ctx context.Context, conversationID, role, entryType, content string) error {
+	if m.vectorMem != nil {
+		_, err := m.vectorMem.AddConversationEntry(ctx, conversationID, role, entryType, content)
+		return err
+	}
+	if m.simpleMem != nil {
+		return m.simpleMem.Store(ctx, fmt.Sprintf("%s_%d", entryType, time.Now().UnixNano()), content)
+	}
+	return fmt.Errorf("未初始化内存系统")
+}
+
 // Retrieve 检索数据
 func (m *MemoryAdapter) Retrieve(ctx context.Context, key string) (interface{}, error) {
 	if m.vectorMem != nil {
@@ -155,11 +510,25 @@ func (m *MemoryAdapter) CreateConversation(ctx context.Context, title string) (s
 
 // AddMessageToConversation 添加消息到对话
 func (m *MemoryAdapter) AddMessageToConversation(ctx context.Context, conversationID string, role string, content string) error {
-	msg := memory.Message{
+	return m.addMessage(ctx, conversationID, memory.Message{
 		Role:      role,
 		Content:   content,
 		Timestamp: time.Now(),
-	}
+	})
+}
+
+// AddPartialMessageToConversation 添加一条标记为未完成的消息
+func (m *MemoryAdapter) AddPartialMessageToConversation(ctx context.Context, conversationID string, role string, content string) error {
+	return m.addMessage(ctx, conversationID, memory.Message{
+		Role:      role,
+		Content:   content,
+		Timestamp: time.Now(),
+		Partial:   true,
+	})
+}
+
+// addMessage 将消息写入底层内存
+func (m *MemoryAdapter) addMessage(ctx context.Context, conversationID string, msg memory.Message) error {
 	if m.simpleMem != nil {
 		return m.simpleMem.AddMessage(ctx, conversationID, msg)
 	}
@@ -180,6 +549,65 @@ func (m *MemoryAdapter) GetConversation(ctx context.Context, conversationID stri
 	return nil, fmt.Errorf("未初始化内存系统")
 }
 
+// PersistenceEnabled 对话是否会持久化到磁盘
+func (m *MemoryAdapter) PersistenceEnabled() bool {
+	if m.simpleMem != nil {
+		return m.simpleMem.PersistenceEnabled()
+	}
+	if m.vectorMem != nil {
+		return m.vectorMem.PersistenceEnabled()
+	}
+	return false
+}
+
+// simple 返回底层的简单内存（向量内存内嵌了简单内存）
+func (m *MemoryAdapter) simple() *memory.SimpleMemory {
+	if m.vectorMem != nil {
+		return &m.vectorMem.SimpleMemory
+	}
+	return m.simpleMem
+}
+
+// LoadConversations 从磁盘加载已持久化的对话
+func (m *MemoryAdapter) LoadConversations(ctx context.Context) error {
+	if mem := m.simple(); mem != nil {
+		return mem.LoadAllConversations(ctx)
+	}
+	return fmt.Errorf("未初始化内存系统")
+}
+
+// SetConversationTitle 修改对话标题
+func (m *MemoryAdapter) SetConversationTitle(ctx context.Context, conversationID, title string) error {
+	if mem := m.simple(); mem != nil {
+		return mem.SetConversationTitle(ctx, conversationID, title)
+	}
+	return fmt.Errorf("未初始化内存系统")
+}
+
+// SetConversationSystemPrompt 修改对话专属的系统提示词
+func (m *MemoryAdapter) SetConversationSystemPrompt(ctx context.Context, conversationID, prompt string) error {
+	if mem := m.simple(); mem != nil {
+		return mem.SetConversationSystemPrompt(ctx, conversationID, prompt)
+	}
+	return fmt.Errorf("未初始化内存系统")
+}
+
+// SetConversationArchived 设置对话的归档状态
+func (m *MemoryAdapter) SetConversationArchived(ctx context.Context, conversationID string, archived bool) error {
+	if mem := m.simple(); mem != nil {
+		return mem.SetConversationArchived(ctx, conversationID, archived)
+	}
+	return fmt.Errorf("未初始化内存系统")
+}
+
+// DeleteConversation 删除对话
+func (m *MemoryAdapter) DeleteConversation(ctx context.Context, conversationID string) error {
+	if mem := m.simple(); mem != nil {
+		return mem.DeleteConversation(ctx, conversationID)
+	}
+	return fmt.Errorf("未初始化内存系统")
+}
+
 // ListConversations 列出对话
 func (m *MemoryAdapter) ListConversations(ctx context.Context, limit int) ([]interface{}, error) {
 	if m.simpleMem != nil {
@@ -209,9 +637,15 @@ func (m *MemoryAdapter) ListConversations(ctx context.Context, limit int) ([]int
 
 // NewEinoAgent 创建一个新的EinoAgent实例
 func NewEinoAgent(config Config) *EinoAgent {
+	tk := config.ModelConfig.Tokenizer
+	if tk == nil {
+		tk = tokenizer.ForModel(config.ModelConfig.ModelName)
+	}
 	return &EinoAgent{
-		config:         config,
-		messageHistory: make([]Message, 0),
+		config:    config,
+		tokenizer: tk,
+		sessions:  make(map[string]*session),
+		current:   newSession(""),
 	}
 }
 
@@ -223,66 +657,311 @@ func (a *EinoAgent) Initialize(ctx context.Context, llmClient LLMClient, toolMan
 	// 设置工具管理器
 	a.tools = toolManager
 
-	logger.Info("初始化Agent", map[string]interface{}{
-		"name": a.config.Name,
+	logger.FromContext(ctx).Info("初始化Agent", map[string]interface{}{
+		"name":     a.config.Name,
 		"provider": a.config.ModelConfig.Provider,
-		"model": a.config.ModelConfig.ModelName,
+		"model":    a.config.ModelConfig.ModelName,
 	})
 
+	// 按配置限制可用的工具
+	if toolManager != nil && len(a.config.ToolsConfig.EnabledTools) > 0 {
+		a.applyEnabledTools(toolManager)
+	}
+	if toolManager != nil {
+		for name, params := range a.config.ToolsConfig.ParamDefaults {
+			toolManager.SetParamDefaults(name, paramDefaults(params)...)
+		}
+	}
+
+	// 未知的特性开关只提示，不影响启动
+	if unknown := a.config.Features.Unknown(); len(unknown) > 0 {
+		logger.FromContext(ctx).Warn("忽略未知的特性开关", map[string]interface{}{
+			"features": strings.Join(unknown, ","),
+			"known":    strings.Join(KnownFeatures(), ","),
+		})
+	}
+
+	// 预加载模型（可选，失败不影响启动）
+	if a.config.ModelConfig.Warmup {
+		a.warmup(ctx)
+	}
+
 	// 初始化内存系统
 	memory, err := initializeMemory(ctx, a.config.MemoryConfig)
 	if err != nil {
-		logger.Error("初始化内存系统失败", map[string]interface{}{"error": err.Error()})
+		logger.FromContext(ctx).Error("初始化内存系统失败", map[string]interface{}{"error": err.Error()})
 		return fmt.Errorf("初始化内存系统失败: %w", err)
 	}
 	a.memory = memory
+	if !memory.PersistenceEnabled() {
+		logger.FromContext(ctx).Warn("⚠️ 数据目录不可写，对话持久化已禁用，所有会话仅保存在内存中，重启后丢失", map[string]interface{}{
+			"data_dir": a.config.MemoryConfig.DBPath,
+		})
+	}
+
+	// 加载已持久化的对话，失败不影响启动
+	if err := a.memory.LoadConversations(ctx); err != nil {
+		logger.FromContext(ctx).Warn("加载历史对话失败", map[string]interface{}{"error": err.Error()})
+	}
 
 	// 创建新对话
 	conversationID, err := a.memory.CreateConversation(ctx, "新对话")
 	if err != nil {
-		logger.Error("创建对话失败", map[string]interface{}{"error": err.Error()})
+		logger.FromContext(ctx).Error("创建对话失败", map[string]interface{}{"error": err.Error()})
 		return fmt.Errorf("创建对话失败: %w", err)
 	}
-	a.currentConversationID = conversationID
-	logger.Debug("创建新对话", map[string]interface{}{"conversation_id": conversationID})
+	a.mu.Lock()
+	a.current = newSession(conversationID)
+	a.sessions[conversationID] = a.current
+	a.mu.Unlock()
+	logger.FromContext(ctx).Debug("创建新对话", map[string]interface{}{"conversation_id": conversationID})
 
 	return nil
 }
 
 // GetConversationID 获取当前会话ID
 func (a *EinoAgent) GetConversationID() string {
-	return a.currentConversationID
+	return a.currentSession().id
 }
 
-// SetConversationID 切换当前会话ID，并尝试同步历史
+// SetConversationID 切换当前会话ID，并从记忆重新加载该会话的历史
 func (a *EinoAgent) SetConversationID(id string) error {
-	if strings.TrimSpace(id) == "" {
-		return fmt.Errorf("会话ID不能为空")
+	// 会话ID最终会用作记忆文件名，必须先校验格式
+	id, err := memory.NormalizeConversationID(id, a.config.MemoryConfig.ConversationIDPattern)
+	if err != nil {
+		return err
 	}
-	a.currentConversationID = id
-	// 尝试从记忆加载历史到 messageHistory
-	if a.memory != nil {
-		if convIface, err := a.memory.GetConversation(context.Background(), id); err == nil {
-			if conv, ok := convIface.(*memory.Conversation); ok && conv != nil {
-				a.messageHistory = make([]Message, 0, len(conv.Messages))
-				for _, m := range conv.Messages {
-					a.messageHistory = append(a.messageHistory, Message{Role: m.Role, Content: m.Content})
-				}
-			}
+	// 系统提示词跟随会话，记忆中没有该会话时恢复使用全局提示词
+	loaded := a.loadSession(id)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sessions[id] = loaded
+	a.current = loaded
+	return nil
+}
+
+// NewConversation 在记忆层创建对话，不切换当前会话
+func (a *EinoAgent) NewConversation(ctx context.Context, title string) (string, error) {
+	if a.memory == nil {
+		return "", fmt.Errorf("未初始化内存系统")
+	}
+	return a.memory.CreateConversation(ctx, title)
+}
+
+// StoredConversations 返回记忆层中的全部对话
+func (a *EinoAgent) StoredConversations(ctx context.Context) ([]StoredConversation, error) {
+	if a.memory == nil {
+		return nil, fmt.Errorf("未初始化内存系统")
+	}
+	items, err := a.memory.ListConversations(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	stored := make([]StoredConversation, 0, len(items))
+	for _, item := range items {
+		conv, ok := item.(*memory.Conversation)
+		if !ok || conv == nil {
+			continue
+		}
+		stored = append(stored, toStoredConversation(conv))
+	}
+	return stored, nil
+}
+
+// StoredConversation 返回记忆层中的单个对话
+func (a *EinoAgent) StoredConversation(ctx context.Context, id string) (*StoredConversation, error) {
+	if a.memory == nil {
+		return nil, fmt.Errorf("未初始化内存系统")
+	}
+	item, err := a.memory.GetConversation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	conv, ok := item.(*memory.Conversation)
+	if !ok || conv == nil {
+		return nil, fmt.Errorf("对话不存在: %s", id)
+	}
+	sc := toStoredConversation(conv)
+	return &sc, nil
+}
+
+// toStoredConversation 复制记忆层对话，避免调用方持有内部切片
+func toStoredConversation(conv *memory.Conversation) StoredConversation {
+	sc := StoredConversation{
+		ID:           conv.ID,
+		Title:        conv.Title,
+		SystemPrompt: conv.SystemPrompt,
+		Archived:     conv.Archived,
+		Messages:     make([]StoredMessage, 0, len(conv.Messages)),
+		CreatedAt:    conv.CreatedAt,
+		UpdatedAt:    conv.UpdatedAt,
+	}
+	for _, m := range conv.Messages {
+		sc.Messages = append(sc.Messages, StoredMessage{
+			Role:      m.Role,
+			Content:   m.Content,
+			Timestamp: m.Timestamp,
+			Partial:   m.Partial,
+		})
+	}
+	return sc
+}
+
+// DeleteConversation 删除对话及其持久化文件
+func (a *EinoAgent) DeleteConversation(ctx context.Context, id string) error {
+	if a.memory == nil {
+		return fmt.Errorf("未初始化内存系统")
+	}
+	if err := a.memory.DeleteConversation(ctx, id); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	delete(a.sessions, id)
+	a.mu.Unlock()
+	return nil
+}
+
+// RenameConversation 修改对话标题
+func (a *EinoAgent) RenameConversation(ctx context.Context, id, title string) error {
+	if a.memory == nil {
+		return fmt.Errorf("未初始化内存系统")
+	}
+	return a.memory.SetConversationTitle(ctx, id, title)
+}
+
+// ArchiveConversation 设置对话的归档状态并持久化
+// 归档时释放缓存的会话状态（当前会话与进行中的会话除外），之后再访问该会话时从记忆重新加载
+func (a *EinoAgent) ArchiveConversation(ctx context.Context, id string, archived bool) error {
+	if a.memory == nil {
+		return fmt.Errorf("未初始化内存系统")
+	}
+	if err := a.memory.SetConversationArchived(ctx, id, archived); err != nil {
+		return err
+	}
+	if archived {
+		a.mu.Lock()
+		if s := a.sessions[id]; s != nil && s != a.current && s.activeTurns == 0 {
+			delete(a.sessions, id)
 		}
+		a.mu.Unlock()
+	}
+	return nil
+}
+
+// SetConversationSystemPrompt 设置对话专属的系统提示词并持久化，空字符串表示恢复使用全局提示词
+// 对该会话的下一轮立即生效
+func (a *EinoAgent) SetConversationSystemPrompt(ctx context.Context, id, prompt string) error {
+	if a.memory == nil {
+		return fmt.Errorf("未初始化内存系统")
+	}
+	if err := a.memory.SetConversationSystemPrompt(ctx, id, prompt); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	sess := a.sessions[id]
+	a.mu.Unlock()
+	if sess != nil {
+		sess.mu.Lock()
+		sess.prompt = prompt
+		sess.mu.Unlock()
 	}
 	return nil
 }
 
+// systemPrompt 返回本轮使用的系统提示词：会话设置了专属提示词时优先使用
+// 调用方需持有 s.mu
+func (a *EinoAgent) systemPrompt(s *session) string {
+	if s.prompt != "" {
+		return s.prompt
+	}
+	return a.config.ModelConfig.Prompt
+}
+
+// applyEnabledTools 只启用 EnabledTools 中列出的工具，未注册的名称只提示，不影响启动
+func (a *EinoAgent) applyEnabledTools(tm *tools.ToolManager) {
+	tm.SetEnabledTools(a.config.ToolsConfig.EnabledTools)
+
+	registered := make(map[string]bool)
+	for _, name := range append(tm.ListTools(), tm.DisabledTools()...) {
+		registered[name] = true
+	}
+	var unknown []string
+	for _, name := range a.config.ToolsConfig.EnabledTools {
+		if !registered[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		logger.Warn("启用列表中的工具未注册", map[string]interface{}{"tools": strings.Join(unknown, ",")})
+	}
+	if disabled := tm.DisabledTools(); len(disabled) > 0 {
+		sort.Strings(disabled)
+		logger.Info("已禁用未在启用列表中的工具", map[string]interface{}{"tools": strings.Join(disabled, ",")})
+	}
+}
+
+// paramDefaults 将配置中的参数默认值转换为按参数名排序的列表
+func paramDefaults(params map[string]interface{}) []tools.ParamDefault {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	defaults := make([]tools.ParamDefault, 0, len(names))
+	for _, name := range names {
+		defaults = append(defaults, tools.ParamDefault{Param: name, Value: params[name]})
+	}
+	return defaults
+}
+
+// warmup 调用客户端的 Warmup 预加载模型，客户端不支持或失败时只记录日志
+func (a *EinoAgent) warmup(ctx context.Context) {
+	warmer, ok := a.llmClient.(Warmer)
+	if !ok {
+		logger.FromContext(ctx).Debug("LLM客户端不支持预加载，跳过", map[string]interface{}{"provider": a.config.ModelConfig.Provider})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, DefaultWarmupTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := warmer.Warmup(ctx); err != nil {
+		logger.FromContext(ctx).Warn("模型预加载失败，首个请求可能较慢", map[string]interface{}{
+			"model": a.config.ModelConfig.ModelName,
+			"error": err.Error(),
+		})
+		return
+	}
+	logger.FromContext(ctx).Info("模型预加载完成", map[string]interface{}{
+		"model":       a.config.ModelConfig.ModelName,
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+}
+
 // initializeMemory 根据配置初始化内存系统
 func initializeMemory(ctx context.Context, config MemoryConfig) (Memory, error) {
 	// 使用内存模块
 
+	dataDir := config.DBPath
+	if dataDir == "" {
+		dataDir = memory.DefaultDataDir
+	}
+
 	// 根据配置创建不同类型的内存系统
 	switch config.MemoryType {
 	case "vector":
 		// 创建向量内存
-		vectorMem := memory.NewVectorMemoryWithDataDir(config.DBPath, config.DBPath+"/vectors/vectors.json")
+		vectorMem := memory.NewVectorMemoryWithDataDir(dataDir, filepath.Join(dataDir, "vectors", "vectors.json"))
+		vectorMem.SetMaxMessages(config.MaxMessages)
+		vectorMem.SetConversationIDPattern(config.ConversationIDPattern)
+		vectorMem.SetDedupeWindow(config.DedupeWindow)
+		if config.Embedder != nil {
+			vectorMem.SetEmbedder(config.Embedder)
+		}
+		if err := vectorMem.LoadVectors(ctx); err != nil {
+			logger.FromContext(ctx).Warn("加载向量数据失败", map[string]interface{}{"error": err.Error()})
+		}
 
 		// 创建内存适配器
 		memAdapter := &MemoryAdapter{
@@ -294,22 +973,27 @@ func initializeMemory(ctx context.Context, config MemoryConfig) (Memory, error)
 		fallthrough
 	default:
 		// 默认使用简单内存
-		simpleMem := memory.NewSimpleMemoryWithDataDir(config.DBPath)
+		simpleMem := memory.NewSimpleMemoryWithDataDir(dataDir)
+		simpleMem.SetMaxMessages(config.MaxMessages)
+		simpleMem.SetConversationIDPattern(config.ConversationIDPattern)
+		simpleMem.SetDedupeWindow(config.DedupeWindow)
 
 		// 创建内存适配器
 		memAdapter := &MemoryAdapter{
 			simpleMem: simpleMem,
 		}
 
-		// 暂时不加载历史对话，需要实现LoadConversations方法
-		// TODO: 实现加载历史对话功能
-
 		return memAdapter, nil
 	}
 }
 
 // extractToolCall 从响应中提取工具调用
 func (a *EinoAgent) extractToolCall(response string) (string, string) {
+	// 标记模式：只识别标记内的调用
+	if a.sentinelEnabled() {
+		return a.extractSentinelToolCall(response)
+	}
+
 	// 方法1: 检查 JSON 格式的 Function Calling
 	// 格式: {"tool":"tool_name","params":{...}}
 	if strings.Contains(response, `"tool"`) && strings.Contains(response, `"params"`) {
@@ -346,20 +1030,107 @@ func (a *EinoAgent) extractToolCall(response string) (string, string) {
 		}
 	}
 
-	// 方法3: 简单实现：检查是否包含工具调用标记（兼容旧格式）
-	if strings.Contains(response, "使用工具:") {
-		parts := strings.Split(response, "使用工具:")
-		if len(parts) > 1 {
-			toolParts := strings.SplitN(strings.TrimSpace(parts[1]), " ", 2)
-			if len(toolParts) > 1 {
-				return toolParts[0], strings.TrimSpace(toolParts[1])
-			}
-			return toolParts[0], ""
+	// 方法3: 兼容旧格式，"使用工具:" 须位于行首，句中提到的不视为调用
+	for offset := 0; offset < len(response); {
+		i := strings.Index(response[offset:], "使用工具:")
+		if i == -1 {
+			break
+		}
+		pos := offset + i
+		offset = pos + len("使用工具:")
+		lineStart := strings.LastIndex(response[:pos], "\n") + 1
+		if strings.TrimSpace(response[lineStart:pos]) != "" {
+			continue
 		}
+		toolParts := strings.SplitN(strings.TrimSpace(response[offset:]), " ", 2)
+		if len(toolParts) > 1 {
+			return toolParts[0], strings.TrimSpace(toolParts[1])
+		}
+		return toolParts[0], ""
 	}
 	return "", ""
 }
 
+// insideCode 判断 text 中 idx 位置是否位于 ``` 代码块或 ` 行内代码之内
+func insideCode(text string, idx int) bool {
+	prefix := text[:idx]
+	if strings.Count(prefix, "```")%2 == 1 {
+		return true
+	}
+	return strings.Count(strings.ReplaceAll(prefix, "```", ""), "`")%2 == 1
+}
+
+// sentinelEnabled 是否启用工具调用标记模式
+func (a *EinoAgent) sentinelEnabled() bool {
+	return a.config.Behavior.ToolSentinelStart != "" && a.config.Behavior.ToolSentinelEnd != ""
+}
+
+// extractSentinelToolCall 解析第一对标记之间的工具调用，标记前后的文字忽略
+// 位于代码块或行内代码中的标记视为引用的示例，不会触发调用
+// 标记内支持 {"tool":"name","params":{...}} 或 "name" 换行后跟参数两种写法
+func (a *EinoAgent) extractSentinelToolCall(response string) (string, string) {
+	startMark, endMark := a.config.Behavior.ToolSentinelStart, a.config.Behavior.ToolSentinelEnd
+	start := -1
+	for offset := 0; offset < len(response); {
+		i := strings.Index(response[offset:], startMark)
+		if i == -1 {
+			break
+		}
+		if !insideCode(response, offset+i) {
+			start = offset + i
+			break
+		}
+		offset += i + len(startMark)
+	}
+	if start == -1 {
+		return "", ""
+	}
+	body := response[start+len(startMark):]
+	end := strings.Index(body, endMark)
+	if end == -1 {
+		return "", ""
+	}
+	body = strings.TrimSpace(body[:end])
+
+	if strings.HasPrefix(body, "{") {
+		var toolCall struct {
+			Tool   string                 `json:"tool"`
+			Params map[string]interface{} `json:"params"`
+		}
+		if err := json.Unmarshal([]byte(body), &toolCall); err != nil || toolCall.Tool == "" {
+			return "", ""
+		}
+		paramsJSON, _ := json.Marshal(toolCall.Params)
+		return toolCall.Tool, string(paramsJSON)
+	}
+
+	lines := strings.SplitN(body, "\n", 2)
+	toolName := strings.TrimSpace(lines[0])
+	params := ""
+	if len(lines) > 1 {
+		params = strings.TrimSpace(lines[1])
+	}
+	return toolName, params
+}
+
+// toolCallExample 返回提示中使用的工具调用示例，标记模式下带上标记
+func (a *EinoAgent) toolCallExample(tool string) string {
+	example := fmt.Sprintf(`{"tool":"%s","params":{...}}`, tool)
+	if a.sentinelEnabled() {
+		return a.config.Behavior.ToolSentinelStart + example + a.config.Behavior.ToolSentinelEnd
+	}
+	return example
+}
+
+// sentinelInstruction 返回标记模式下注入提示词的说明
+func (a *EinoAgent) sentinelInstruction() string {
+	if a.config.Behavior.ToolSentinelInstruction != "" {
+		return a.config.Behavior.ToolSentinelInstruction
+	}
+	return fmt.Sprintf("调用工具时必须把调用完整地写在 %s 和 %s 之间，例如：%s。标记之外的 JSON 或代码块不会被当作工具调用。",
+		a.config.Behavior.ToolSentinelStart, a.config.Behavior.ToolSentinelEnd, a.toolCallExample("tool_name"))
+}
+
 // ExecuteTool 执行工具调用
 func (a *EinoAgent) ExecuteTool(ctx context.Context, toolName string, params map[string]interface{}) (interface{}, error) {
 	if a.tools == nil {
@@ -370,156 +1141,223 @@ func (a *EinoAgent) ExecuteTool(ctx context.Context, toolName string, params map
 
 // Process 处理用户输入
 func (a *EinoAgent) Process(ctx context.Context, input string) (string, error) {
-	// 如果上层上下文提供了会话ID，则尝试绑定
-	if cid, ok := ctx.Value("conversation_id").(string); ok && strings.TrimSpace(cid) != "" {
-		_ = a.SetConversationID(cid)
+	result, err := a.ProcessDetailed(ctx, input)
+	if err != nil {
+		return "", err
 	}
-	// 如果是第一次对话，创建对话ID
-	if a.currentConversationID == "" {
-		a.currentConversationID = fmt.Sprintf("conv_%d", time.Now().UnixNano())
-		fmt.Printf("创建新对话ID: %s\n", a.currentConversationID)
+	return result.Response, nil
+}
+
+// ProcessDetailed 与 Process 相同，但额外返回第一轮的工具决策文本及本轮的工具调用记录，用于调试
+func (a *EinoAgent) ProcessDetailed(ctx context.Context, input string) (*ProcessResult, error) {
+	// 超长输入在写入历史和调用模型之前拒绝
+	if err := a.rejectLongInput(ctx, input); err != nil {
+		return nil, err
 	}
+	ctx, span := tracing.StartSpan(ctx, "agent.process")
+	defer span.End()
+	ctx, cancel := a.withTurnTimeout(ctx)
+	defer cancel()
 
-	// 将用户输入添加到消息历史
-	a.messageHistory = append(a.messageHistory, Message{
-		Role:    "user",
-		Content: input,
-	})
+	// 上下文通过 WithConversationID 绑定了会话时在该会话上执行，否则使用当前会话
+	ctx, sess, err := a.beginTurn(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	defer a.endTurn(sess)
+	convID := sess.id
+	span.SetAttributes(attribute.String("conversation.id", convID))
 
 	// 将用户消息添加到当前对话
-	if a.memory != nil && a.currentConversationID != "" {
-		if err := a.memory.AddMessageToConversation(ctx, a.currentConversationID, "user", input); err != nil {
+	if a.memory != nil {
+		if err := a.memory.AddMessageToConversation(ctx, convID, "user", input); err != nil {
 			fmt.Printf("警告: 保存用户消息到对话失败: %v\n", err)
 		}
 	}
 
+	// 自动检索知识库（开启 KnowledgeContext 时）
+	a.loadKnowledgeContext(ctx, sess, input)
+
 	// 构建完整提示词，使用更清晰的对话格式
-	fullPrompt := a.buildPrompt()
+	fullPrompt := a.buildPrompt(sess)
 
-	// 第一轮生成：用于解析是否需要工具
-	preResp, err := a.llmClient.Generate(ctx, fullPrompt)
+	// 第一轮生成：用于解析是否需要工具，配置了决策模型时由决策模型生成
+	decisionCtx := a.decisionContext(ctx)
+	preResp, calls, err := a.decide(decisionCtx, fullPrompt)
 	if err != nil {
-		return "", fmt.Errorf("生成响应失败: %w", err)
+		return nil, a.turnError(ctx, "生成响应失败", err)
 	}
-
-	// 提取工具调用（若存在）
-	toolName, toolParamsText := a.extractToolCall(preResp)
-	if toolName != "" {
-		logger.Info("检测到工具调用", map[string]interface{}{
-			"tool": toolName,
-			"conversation_id": a.currentConversationID,
-		})
-		// 解析参数
-		params := parseParams(toolParamsText)
-		// 执行工具
-		toolResult, err := a.ExecuteTool(ctx, toolName, params)
-		if err != nil {
-			logger.Error("工具执行失败", map[string]interface{}{
-				"tool": toolName,
-				"error": err.Error(),
-			})
-			toolResult = fmt.Sprintf("工具 %s 执行失败: %v", toolName, err)
-		} else {
-			logger.Debug("工具执行成功", map[string]interface{}{"tool": toolName})
-		}
-		// 将工具结果注入为系统消息，参与下一轮生成
-		a.messageHistory = append(a.messageHistory, Message{Role: "system", Content: fmt.Sprintf("工具(%s)输出: %v", toolName, toolResult)})
-		// 重新构建提示并进行最终生成
-		fullPrompt = a.buildPrompt()
-		finalResp, err := a.llmClient.Generate(ctx, fullPrompt)
+	if len(calls) == 0 {
+		preResp, err = a.enforceStrictTool(decisionCtx, input, fullPrompt, preResp)
 		if err != nil {
-			return "", fmt.Errorf("二次生成失败: %w", err)
+			return nil, a.turnError(ctx, "生成响应失败", err)
 		}
-		if finalResp == "" {
-			finalResp = "抱歉，我无法生成有效的响应。请重试。"
-		}
-		// 将助手响应添加到消息历史
-		a.messageHistory = append(a.messageHistory, Message{Role: "assistant", Content: finalResp})
-		// 将助手响应添加到当前对话
-		if a.memory != nil && a.currentConversationID != "" {
-			if err := a.memory.AddMessageToConversation(ctx, a.currentConversationID, "assistant", finalResp); err != nil {
-				fmt.Printf("警告: 保存助手响应到对话失败: %v\n", err)
-			}
+	}
+
+	decision := preResp
+
+	// 工具调用循环：每次生成后都检查工具调用，直到模型不再调用工具或达到迭代上限
+	// 超时时已注入的工具结果保留在消息历史中，下一轮对话仍可使用
+	toolsUsed := false
+	response, err := a.runToolLoop(ctx, preResp, calls, nil, func(prompt Prompt) (string, []ToolCall, error) {
+		toolsUsed = true
+		return a.decide(ctx, prompt)
+	})
+	if err != nil {
+		return nil, a.turnError(ctx, "工具调用失败", err)
+	}
+	if !toolsUsed && a.separateDecision() {
+		// 决策模型未调用工具：回复由主模型生成
+		response, err = a.generate(ctx, fullPrompt)
+		if err != nil {
+			return nil, a.turnError(ctx, "生成响应失败", err)
 		}
-		return finalResp, nil
 	}
 
-	// 无工具调用时，直接采用预响应
-	response := preResp
-	if response == "" {
-		response = "抱歉，我无法生成有效的响应。请重新尝试您的问题。"
-		fmt.Println("警告: LLM返回空响应，使用默认消息")
+	if !a.hasMinContent(response) {
+		response = a.emptyResponseMessage()
+		logger.FromContext(ctx).Warn("LLM返回空响应，使用默认消息", map[string]interface{}{"conversation_id": convID})
 	}
 
+	genUsage := sess.generationUsage()
+	logger.FromContext(ctx).Debug("本轮生成用量", map[string]interface{}{
+		"conversation_id":   convID,
+		"prompt_chars":      genUsage.PromptChars,
+		"completion_chars":  genUsage.CompletionChars,
+		"prompt_eval_count": genUsage.PromptEvalCount,
+		"eval_count":        genUsage.EvalCount,
+	})
+
 	// 将助手响应添加到消息历史
-	a.messageHistory = append(a.messageHistory, Message{
+	sess.appendHistory(Message{
 		Role:    "assistant",
 		Content: response,
 	})
 
 	// 将助手响应添加到当前对话
-	if a.memory != nil && a.currentConversationID != "" {
-		if err := a.memory.AddMessageToConversation(ctx, a.currentConversationID, "assistant", response); err != nil {
+	if a.memory != nil {
+		if err := a.memory.AddMessageToConversation(ctx, convID, "assistant", response); err != nil {
 			fmt.Printf("警告: 保存助手响应到对话失败: %v\n", err)
 		}
 	}
 
-	return response, nil
+	return &ProcessResult{
+		Response:        response,
+		Decision:        decision,
+		ToolCalls:       sess.stats().ToolCalls,
+		CitationMissing: a.checkCitations(ctx, sess, response),
+	}, nil
 }
 
-// ProcessStream 处理用户输入并返回流式响应
-func (a *EinoAgent) ProcessStream(ctx context.Context, input string, responseChan chan<- string) error {
-	// 如果上层上下文提供了会话ID，则尝试绑定
-	if cid, ok := ctx.Value("conversation_id").(string); ok && strings.TrimSpace(cid) != "" {
-		_ = a.SetConversationID(cid)
-	}
-	// 如果是第一次对话，创建对话ID
-	if a.currentConversationID == "" {
-		a.currentConversationID = fmt.Sprintf("conv_%d", time.Now().UnixNano())
-		fmt.Printf("创建新对话ID: %s\n", a.currentConversationID)
+// ProcessStreamEvents 处理用户输入并以类型化事件返回流式响应：正文片段为 StreamEventContent，其余为思考事件
+// 结束时关闭 events
+func (a *EinoAgent) ProcessStreamEvents(ctx context.Context, input string, events chan<- StreamEvent) (retErr error) {
+	// 超长输入在写入历史和调用模型之前拒绝，调用方仍依赖通道关闭结束读取
+	if err := a.rejectLongInput(ctx, input); err != nil {
+		close(events)
+		return err
 	}
+	// span 与超时上下文在流式响应全部转发完成后结束
+	ctx, span := tracing.StartSpan(ctx, "agent.process_stream")
+	ctx, cancel := a.withTurnTimeout(ctx)
 
-	// 将用户输入添加到消息历史
-	a.messageHistory = append(a.messageHistory, Message{
-		Role:    "user",
-		Content: input,
-	})
+	// 上下文通过 WithConversationID 绑定了会话时在该会话上执行，否则使用当前会话
+	ctx, sess, err := a.beginTurn(ctx, input)
+	if err != nil {
+		span.End()
+		cancel()
+		close(events)
+		return err
+	}
+	convID := sess.id
+	span.SetAttributes(attribute.String("conversation.id", convID))
 
 	// 将用户消息添加到当前对话
-	if a.memory != nil && a.currentConversationID != "" {
-		if err := a.memory.AddMessageToConversation(ctx, a.currentConversationID, "user", input); err != nil {
+	if a.memory != nil {
+		if err := a.memory.AddMessageToConversation(ctx, convID, "user", input); err != nil {
 			fmt.Printf("警告: 保存用户消息到对话失败: %v\n", err)
 		}
 	}
 
+	// 自动检索知识库（开启 KnowledgeContext 时）
+	a.loadKnowledgeContext(ctx, sess, input)
+
 	// 构建完整提示词
-	fullPrompt := a.buildPrompt()
+	fullPrompt := a.buildPrompt(sess)
 
 	// 创建内部通道来收集完整响应
 	internalChan := make(chan string, 100)
 	var fullResponse strings.Builder
 
-	// 启动goroutine来处理最终流式响应
+	// 启动goroutine来处理最终流式响应，ProcessStreamEvents 返回时关闭内部通道
+	// streamErr 在关闭通道前写入，转发协程读完通道后即可看到本轮的错误
+	var streamErr error
+	defer close(internalChan)
+	defer func() { streamErr = retErr }()
 	go func() {
-		defer close(responseChan)
+		defer span.End()
+		defer cancel()
+		defer close(events)
+		defer a.endTurn(sess)
 
 		for chunk := range internalChan {
 			fullResponse.WriteString(chunk)
-			responseChan <- chunk
+			events <- StreamEvent{Kind: StreamEventContent, Data: chunk}
+		}
+
+		// 超时时通知客户端回复被截断，已生成的部分照常保存
+		if errors.Is(context.Cause(ctx), ErrTurnTimeout) {
+			a.sendThinkingEvent(events, "timeout", fmt.Sprintf("本轮执行超过 %s 上限，回复可能不完整", a.config.MaxTurnDuration))
 		}
 
 		// 流式响应完成后，保存完整响应到历史和对话
+		// 内容不足的回复不会被转发（见 streamGenerate），此时推送回退消息
 		response := fullResponse.String()
+		interrupted := ctx.Err() != nil
+		if streamErr != nil && !interrupted {
+			// 生成失败：通知客户端，不推送回退消息也不保存本轮回复
+			a.sendThinkingEvent(events, "error", streamErr.Error())
+			logger.FromContext(ctx).Error("流式响应失败", map[string]interface{}{
+				"conversation_id": convID,
+				"error":           streamErr.Error(),
+			})
+			return
+		}
+		if !a.hasMinContent(response) && !interrupted {
+			// 空响应时推送回退消息
+			response = a.emptyResponseMessage()
+			events <- StreamEvent{Kind: StreamEventContent, Data: response}
+		}
+		if !interrupted && a.checkCitations(ctx, sess, response) {
+			a.sendThinkingEvent(events, "citation_missing", "回复使用了搜索结果但未标注来源，请注意核实")
+		}
+		if interrupted && !errors.Is(context.Cause(ctx), ErrTurnTimeout) && !a.config.Behavior.PersistPartialResponses {
+			// 客户端断开且未开启 PersistPartialResponses：丢弃未完成的回复
+			if response != "" {
+				logger.FromContext(ctx).Info("客户端已断开，丢弃未完成的回复", map[string]interface{}{
+					"conversation_id": convID,
+					"length":          len(response),
+				})
+			}
+			return
+		}
 		if response != "" {
 			// 将助手响应添加到消息历史
-			a.messageHistory = append(a.messageHistory, Message{
+			sess.appendHistory(Message{
 				Role:    "assistant",
 				Content: response,
 			})
 
-			// 将助手响应添加到当前对话
-			if a.memory != nil && a.currentConversationID != "" {
-				if err := a.memory.AddMessageToConversation(ctx, a.currentConversationID, "assistant", response); err != nil {
+			// 将助手响应添加到当前对话，中断的回复标记为未完成
+			// 此时 ctx 已取消，保存时使用不可取消的上下文
+			if a.memory != nil {
+				var err error
+				if interrupted {
+					err = a.memory.AddPartialMessageToConversation(context.WithoutCancel(ctx), convID, "assistant", response)
+				} else {
+					err = a.memory.AddMessageToConversation(ctx, convID, "assistant", response)
+				}
+				if err != nil {
 					fmt.Printf("警告: 保存助手响应到对话失败: %v\n", err)
 				}
 			}
@@ -527,68 +1365,834 @@ func (a *EinoAgent) ProcessStream(ctx context.Context, input string, responseCha
 	}()
 
 	// 发送思考事件
-	a.sendThinkingEvent(responseChan, "analyzing", "正在分析您的问题...")
+	a.sendThinkingEvent(events, "analyzing", "正在分析您的问题...")
+	if trimmed := sess.stats().HistoryTrimmed; trimmed > 0 {
+		a.sendThinkingEvent(events, "history_trimmed", fmt.Sprintf("对话较长，本轮已省略最早的 %d 条历史消息", trimmed))
+	}
 
-	// 第一轮非流式生成，仅用于解析工具调用
-	preResp, err := a.llmClient.Generate(ctx, fullPrompt)
+	// 第一轮生成，仅用于解析工具调用
+	// 客户端支持原生函数调用时从结构化字段识别工具调用，无工具调用时其内容直接作为回复
+	var preResp string
+	var calls []ToolCall
+	native := false
+	decisionCtx := a.decisionContext(ctx)
+	if a.config.Behavior.StreamDecisionThinking {
+		preResp, err = a.generateDecisionStream(decisionCtx, fullPrompt, events)
+	} else {
+		_, native = a.functionCaller(decisionCtx)
+		preResp, calls, err = a.decide(decisionCtx, fullPrompt)
+	}
+	if err == nil && len(calls) == 0 {
+		preResp, err = a.enforceStrictTool(decisionCtx, input, fullPrompt, preResp)
+	}
 	if err != nil {
-		return fmt.Errorf("生成响应失败: %w", err)
-	}
-	
-	toolName, toolParamsText := a.extractToolCall(preResp)
-	if toolName != "" {
-		// 发送工具调用事件
-		a.sendThinkingEvent(responseChan, "tool_call", fmt.Sprintf("准备调用工具: %s", toolName))
-		
-		params := parseParams(toolParamsText)
-		toolResult, err := a.ExecuteTool(ctx, toolName, params)
-		if err != nil {
-			toolResult = fmt.Sprintf("工具 %s 执行失败: %v", toolName, err)
-			a.sendThinkingEvent(responseChan, "tool_error", fmt.Sprintf("工具执行失败: %v", err))
-		} else {
-			// 发送工具结果事件
-			a.sendThinkingEvent(responseChan, "tool_result", fmt.Sprintf("工具返回结果，正在生成最终回复..."))
-		}
-		
-		// 注入工具输出
-		a.messageHistory = append(a.messageHistory, Message{Role: "system", Content: fmt.Sprintf("工具(%s)输出: %v", toolName, toolResult)})
-		// 重新构建提示后进行流式最终生成
-		finalPrompt := a.buildPrompt()
-		a.sendThinkingEvent(responseChan, "generating", "正在生成回复...")
-		return a.llmClient.GenerateStream(ctx, finalPrompt, internalChan)
-	}
-	
+		err = a.turnError(ctx, "生成响应失败", err)
+		tracing.RecordError(span, err)
+		return err
+	}
+
+	// 工具调用循环：注入工具结果后的每轮生成可能再次调用工具，整条缓冲到确认不含工具调用后再转发
+	toolsUsed := false
+	_, err = a.runToolLoop(ctx, preResp, calls, events, func(prompt Prompt) (string, []ToolCall, error) {
+		toolsUsed = true
+		a.sendThinkingEvent(events, "generating", "正在生成回复...")
+		resp, err := a.streamAnswer(ctx, prompt, internalChan, true)
+		return resp, nil, err
+	})
+	if err != nil {
+		err = a.turnError(ctx, "工具调用失败", err)
+		tracing.RecordError(span, err)
+		return err
+	}
+	if toolsUsed {
+		// 最后一轮生成已作为最终回复转发
+		return nil
+	}
+
+	// 原生函数调用的回复已是最终答案，直接转发，省去一次生成；决策模型的回复不作为最终答案
+	a.sendThinkingEvent(events, "generating", "正在生成回复...")
+	if native && !a.separateDecision() && a.hasMinContent(preResp) {
+		internalChan <- preResp
+		return nil
+	}
+
 	// 无工具调用时直接流式生成
-	a.sendThinkingEvent(responseChan, "generating", "正在生成回复...")
-	return a.llmClient.GenerateStream(ctx, fullPrompt, internalChan)
+	if _, err := a.streamAnswer(ctx, fullPrompt, internalChan, false); err != nil {
+		err = a.turnError(ctx, "流式生成失败", err)
+		tracing.RecordError(span, err)
+		return err
+	}
+	return nil
+}
+
+// runToolLoop 执行多步工具调用循环：响应中包含工具调用时执行工具、将结果作为系统消息注入，
+// 再通过 next 生成下一轮响应，直到响应不再包含工具调用（返回该响应）或达到 MaxToolIterations
+// 一轮响应可包含多个相互独立的调用（JSON 数组），通过 ToolManager.ExecuteBatch 并发执行，结果按调用顺序注入
+// 模型以相同参数重复调用同一工具时不再执行，先提示其直接回答，再次重复则视为死循环返回错误
+// native 为原生函数调用返回的结构化调用（为空时解析响应文本）；events 非空时推送工具相关的思维链事件
+func (a *EinoAgent) runToolLoop(ctx context.Context, response string, native []ToolCall, events chan<- StreamEvent, next func(prompt Prompt) (string, []ToolCall, error)) (string, error) {
+	maxIterations := a.maxToolIterations()
+	sess := a.session(ctx)
+	convID := sess.id
+	executed := make(map[string]bool)
+	warned := make(map[string]bool)
+	for iteration := 0; ; iteration++ {
+		calls := a.resolveToolCalls(response, native)
+		if len(calls) == 0 {
+			return response, nil
+		}
+		if iteration >= maxIterations {
+			logger.FromContext(ctx).Warn("工具调用次数达到上限，停止继续调用", map[string]interface{}{
+				"tool":            calls[0].Name,
+				"max_iterations":  maxIterations,
+				"conversation_id": convID,
+			})
+			return "", fmt.Errorf("%w: 已执行 %d 轮工具调用（上限 %d），模型仍请求调用 %s",
+				ErrMaxToolIterations, iteration, maxIterations, calls[0].Name)
+		}
+
+		var pending []ToolCall
+		var outputs []string
+		for _, c := range calls {
+			// json.Marshal 对 map 键排序，可作为参数的稳定签名
+			signature, _ := json.Marshal(c.Params)
+			callKey := c.Name + ":" + string(signature)
+
+			if executed[callKey] {
+				if warned[callKey] {
+					return "", fmt.Errorf("%w: %s（第 %d 轮）", ErrToolCallCycle, c.Name, iteration+1)
+				}
+				warned[callKey] = true
+				sess.recordToolCall(ToolCallRecord{Iteration: iteration + 1, Tool: c.Name, Params: c.Params, Skipped: true})
+				logger.FromContext(ctx).Warn("模型重复调用相同的工具与参数，提示其直接回答", map[string]interface{}{
+					"tool":            c.Name,
+					"iteration":       iteration + 1,
+					"conversation_id": convID,
+				})
+				sess.appendHistory(Message{
+					Role:    "system",
+					Content: fmt.Sprintf("工具 %s 已使用相同参数调用过，结果见上文。请不要重复调用，直接基于已有结果回答。", c.Name),
+				})
+				continue
+			}
+			executed[callKey] = true
+			logger.FromContext(ctx).Info("检测到工具调用", map[string]interface{}{
+				"tool":            c.Name,
+				"iteration":       iteration + 1,
+				"conversation_id": convID,
+			})
+			if events != nil {
+				a.sendThinkingEvent(events, "tool_call", fmt.Sprintf("准备调用工具: %s", c.Name))
+			}
+			pending = append(pending, c)
+		}
+
+		for i, result := range a.executeToolCalls(ctx, pending) {
+			c := pending[i]
+			toolResult := result.Result
+			record := ToolCallRecord{Iteration: iteration + 1, Tool: c.Name, Params: c.Params, Result: toolResult}
+			if result.Err != nil {
+				record.Error = result.Err.Error()
+				logger.FromContext(ctx).Error("工具执行失败", map[string]interface{}{
+					"tool":  c.Name,
+					"error": result.Err.Error(),
+				})
+				toolResult = fmt.Sprintf("工具 %s 执行失败: %v", c.Name, result.Err)
+				if events != nil {
+					a.sendThinkingEvent(events, "tool_error", fmt.Sprintf("工具执行失败: %v", result.Err))
+				}
+			} else if events != nil {
+				a.sendThinkingEvent(events, "tool_result", "工具返回结果，正在生成回复...")
+			}
+			sess.recordToolCall(record)
+			// 将工具结果注入为系统消息，参与下一轮生成
+			output := a.formatToolOutput(sess, c.Name, toolResult)
+			sess.appendHistory(Message{Role: "system", Content: output})
+			outputs = append(outputs, output)
+			// 工具结果以 tool 角色保存到对话，导出记录时可以看到
+			if a.memory != nil && convID != "" {
+				if err := a.memory.AddMessageToConversation(ctx, convID, memory.RoleTool, output); err != nil {
+					logger.FromContext(ctx).Warn("保存工具结果到对话失败", map[string]interface{}{
+						"conversation_id": convID,
+						"tool":            c.Name,
+						"error":           err.Error(),
+					})
+				}
+			}
+		}
+
+		// 重新构建提示并再次生成，新的响应同样会被检查是否包含工具调用
+		// 生成前确认本轮的工具结果都在提示词中，模型不会在看到结果之前作答
+		prompt, err := a.guardToolResults(ctx, sess, a.buildPrompt(sess), outputs)
+		if err != nil {
+			return "", err
+		}
+		response, native, err = next(prompt)
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// executeToolCalls 执行一轮中的工具调用，结果顺序与 calls 一致；多个调用时交给 ToolManager.ExecuteBatch 并发执行
+func (a *EinoAgent) executeToolCalls(ctx context.Context, calls []ToolCall) []tools.ToolResult {
+	if len(calls) > 1 && a.tools != nil {
+		batch := make([]tools.ToolCall, len(calls))
+		for i, c := range calls {
+			batch[i] = tools.ToolCall{Name: c.Name, Params: c.Params}
+		}
+		return a.tools.ExecuteBatch(ctx, batch)
+	}
+	results := make([]tools.ToolResult, len(calls))
+	for i, c := range calls {
+		result, err := a.ExecuteTool(ctx, c.Name, c.Params)
+		results[i] = tools.ToolResult{Result: result, Err: err}
+	}
+	return results
+}
+
+// resolveToolCalls 返回本轮的全部工具调用：优先使用原生函数调用返回的结构化调用，
+// 否则解析响应文本中的 JSON 数组（多个独立调用），再否则按单个调用解析
+func (a *EinoAgent) resolveToolCalls(response string, native []ToolCall) []ToolCall {
+	if len(native) > 0 {
+		calls := make([]ToolCall, 0, len(native))
+		for _, c := range native {
+			if c.Name == "" {
+				continue
+			}
+			params := c.Params
+			if params == nil {
+				params = make(map[string]interface{})
+			}
+			calls = append(calls, ToolCall{Name: c.Name, Params: params})
+		}
+		if len(calls) > 0 {
+			return calls
+		}
+	}
+	if !a.sentinelEnabled() {
+		if calls := parseToolCallArray(response); len(calls) > 0 {
+			return calls
+		}
+	}
+	toolName, toolParamsText := a.extractToolCall(response)
+	if toolName == "" {
+		return nil
+	}
+	return []ToolCall{{Name: toolName, Params: parseParams(toolParamsText)}}
+}
+
+// parseToolCallArray 解析 [{"tool":"a","params":{...}}, ...] 格式的多个工具调用，格式不符时返回 nil
+func parseToolCallArray(response string) []ToolCall {
+	trimmed := strings.TrimSpace(response)
+	if !strings.HasPrefix(trimmed, "[") {
+		return nil
+	}
+	var raw []struct {
+		Tool   string                 `json:"tool"`
+		Params map[string]interface{} `json:"params"`
+	}
+	if err := json.Unmarshal([]byte(trimmed), &raw); err != nil {
+		return nil
+	}
+	calls := make([]ToolCall, 0, len(raw))
+	for _, r := range raw {
+		if r.Tool == "" {
+			return nil
+		}
+		params := r.Params
+		if params == nil {
+			params = make(map[string]interface{})
+		}
+		calls = append(calls, ToolCall{Name: r.Tool, Params: params})
+	}
+	return calls
+}
+
+// featureEnabled 判断实验特性是否开启
+func (a *EinoAgent) featureEnabled(name string) bool {
+	return a.config.Features.Enabled(name)
+}
+
+// functionCaller 返回本次生成使用的客户端（见 clientFor）是否支持原生函数调用，关闭 FeatureNativeTools 时返回 false
+func (a *EinoAgent) functionCaller(ctx context.Context) (FunctionCaller, bool) {
+	if !a.featureEnabled(FeatureNativeTools) {
+		return nil, false
+	}
+	client, _ := a.clientFor(ctx)
+	fc, ok := client.(FunctionCaller)
+	return fc, ok
+}
+
+// decide 生成一轮用于工具决策的响应：客户端实现 FunctionCaller 时使用原生函数调用，否则走文本生成
+func (a *EinoAgent) decide(ctx context.Context, prompt Prompt) (string, []ToolCall, error) {
+	fc, ok := a.functionCaller(ctx)
+	if !ok {
+		resp, err := a.generate(ctx, prompt)
+		return resp, nil, err
+	}
+
+	_, model := a.clientFor(ctx)
+	ctx, span := tracing.StartSpan(ctx, "llm.generate_with_tools")
+	text := prompt.String()
+	promptTokens := a.tokenizer.CountTokens(text)
+	span.SetAttributes(
+		attribute.String("llm.model", model),
+		attribute.Int("llm.prompt_tokens", promptTokens),
+	)
+	var content string
+	var calls []ToolCall
+	var err error
+	if mfc, ok := fc.(MessageFunctionCaller); ok {
+		content, calls, err = mfc.GenerateMessagesWithTools(ctx, prompt.Messages(), a.toolSpecs())
+	} else {
+		content, calls, err = fc.GenerateWithTools(ctx, text, a.toolSpecs())
+	}
+	a.session(ctx).addUsage(promptTokens, a.tokenizer.CountTokens(content), GenerationUsage{
+		PromptChars:     utf8.RuneCountInString(text),
+		CompletionChars: utf8.RuneCountInString(content),
+	})
+	if len(calls) > 0 {
+		span.SetAttributes(attribute.String("llm.tool_call", calls[0].Name), attribute.Int("llm.tool_calls", len(calls)))
+	}
+	tracing.EndSpan(span, err)
+	return content, calls, err
+}
+
+// toolSpecs 返回已注册工具的描述，供原生函数调用使用
+func (a *EinoAgent) toolSpecs() []ToolSpec {
+	var specs []ToolSpec
+	for _, info := range a.ListTools() {
+		specs = append(specs, ToolSpec{Name: info.Name, Description: info.Description, Parameters: info.Parameters})
+	}
+	return specs
+}
+
+// ListTools 列出已注册的工具，按名称排序
+func (a *EinoAgent) ListTools() []ToolInfo {
+	if a.tools == nil {
+		return nil
+	}
+	names := a.tools.ListTools()
+	sort.Strings(names)
+	infos := make([]ToolInfo, 0, len(names))
+	for _, name := range names {
+		if tool, ok := a.tools.GetTool(name); ok {
+			info := ToolInfo{Name: name, Description: tool.Description()}
+			if pt, ok := tool.(tools.ParameterizedTool); ok {
+				info.Parameters = pt.Parameters()
+			}
+			infos = append(infos, info)
+		}
+	}
+	return infos
 }
 
-// buildPrompt 构建完整的提示词
-func (a *EinoAgent) buildPrompt() string {
-	var fullPrompt string
+// BuildToolPrompt 根据已注册的工具生成系统提示词中的工具目录，按名称排序
+// 工具声明了参数时一并列出参数名、类型与说明；没有注册工具时返回空字符串
+func BuildToolPrompt(tm *tools.ToolManager) string {
+	if tm == nil {
+		return ""
+	}
+	names := tm.ListTools()
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("可用工具：")
+	n := 0
+	for _, name := range names {
+		tool, ok := tm.GetTool(name)
+		if !ok {
+			continue
+		}
+		n++
+		fmt.Fprintf(&b, "\n%d. %s: %s", n, name, tool.Description())
+		pt, ok := tool.(tools.ParameterizedTool)
+		if !ok {
+			continue
+		}
+		params := pt.Parameters()
+		paramNames := make([]string, 0, len(params))
+		for p := range params {
+			paramNames = append(paramNames, p)
+		}
+		sort.Strings(paramNames)
+		for _, p := range paramNames {
+			b.WriteString("\n   - " + formatParamSpec(p, params[p]))
+		}
+	}
+	if n == 0 {
+		return ""
+	}
+	return b.String()
+}
+
+// formatParamSpec 返回单个参数在工具目录中的描述，如 "query (string，必填): 搜索关键词"
+func formatParamSpec(name string, spec tools.ParamSpec) string {
+	var attrs []string
+	if spec.Type != "" {
+		attrs = append(attrs, spec.Type)
+	}
+	if spec.Required {
+		attrs = append(attrs, "必填")
+	}
+	line := name
+	if len(attrs) > 0 {
+		line += " (" + strings.Join(attrs, "，") + ")"
+	}
+	if spec.Description != "" {
+		line += ": " + spec.Description
+	}
+	return line
+}
+
+// streamAnswer 流式生成回复，开启 RetryOnEmpty 时对内容不足的回复追加提示重试一次
+func (a *EinoAgent) streamAnswer(ctx context.Context, prompt Prompt, out chan<- string, detectTool bool) (string, error) {
+	resp, err := a.streamGenerate(ctx, prompt, out, detectTool)
+	if err != nil || a.hasMinContent(resp) || !a.config.Behavior.RetryOnEmpty || ctx.Err() != nil {
+		return resp, err
+	}
+
+	logger.FromContext(ctx).Warn("LLM返回空响应，追加提示后重试", map[string]interface{}{"conversation_id": a.conversationID(ctx)})
+	return a.streamGenerate(ctx, withSystemHint(prompt, emptyResponseNudge), out, detectTool)
+}
+
+// streamGenerate 流式生成并将正文转发到 out，返回完整响应
+// 内容达到 MinResponseChars 之前先缓冲，生成结束仍不足时不转发，由调用方重试或回退
+// detectTool 为 true 时响应中任意位置都可能出现工具调用（如说明文字后跟代码块），整条响应缓冲到生成结束，
+// 确认不包含工具调用后再转发；包含工具调用时调用及其前后的文字都不转发，由工具循环继续生成
+func (a *EinoAgent) streamGenerate(ctx context.Context, prompt Prompt, out chan<- string, detectTool bool) (string, error) {
+	chunks := make(chan string, 100)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- a.llmGenerateStream(ctx, prompt, chunks)
+	}()
+
+	var full strings.Builder
+	var pending []string
+	forwarding := false
+	for chunk := range chunks {
+		full.WriteString(chunk)
+		if forwarding {
+			out <- chunk
+			continue
+		}
+		pending = append(pending, chunk)
+		if detectTool || !a.hasMinContent(full.String()) {
+			continue
+		}
+		forwarding = true
+		for _, p := range pending {
+			out <- p
+		}
+		pending = nil
+	}
+
+	response := full.String()
+	a.session(ctx).addUsage(0, a.tokenizer.CountTokens(response), GenerationUsage{})
+	if detectTool && a.hasMinContent(response) && len(a.resolveToolCalls(response, nil)) == 0 {
+		for _, p := range pending {
+			out <- p
+		}
+	}
+	return response, <-errChan
+}
+
+// withTurnTimeout 按 MaxTurnDuration 为单轮对话创建超时上下文，未配置时仅可取消
+// 配置了 RetryBudget 时同时附加本轮共享的重试预算
+func (a *EinoAgent) withTurnTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if a.config.RetryBudget > 0 {
+		ctx = WithRetryBudget(ctx, NewRetryBudget(a.config.RetryBudget))
+	}
+	if a.config.MaxTurnDuration <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, a.config.MaxTurnDuration, ErrTurnTimeout)
+}
+
+// turnError 本轮已超时时返回 ErrTurnTimeout，否则按 msg 包装原始错误
+func (a *EinoAgent) turnError(ctx context.Context, msg string, err error) error {
+	if errors.Is(context.Cause(ctx), ErrTurnTimeout) {
+		return fmt.Errorf("%w（上限 %s）", ErrTurnTimeout, a.config.MaxTurnDuration)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// generateDecisionStream 流式执行工具决策阶段的生成，并将每个片段作为 decision 思考事件推送
+func (a *EinoAgent) generateDecisionStream(ctx context.Context, prompt Prompt, events chan<- StreamEvent) (string, error) {
+	decisionChan := make(chan string, 100)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- a.llmGenerateStream(ctx, prompt, decisionChan)
+	}()
+
+	var decision strings.Builder
+	for chunk := range decisionChan {
+		decision.WriteString(chunk)
+		a.sendThinkingEvent(events, "decision", chunk)
+	}
+	if err := <-errChan; err != nil {
+		return "", err
+	}
+	a.session(ctx).addUsage(0, a.tokenizer.CountTokens(decision.String()), GenerationUsage{})
+	return decision.String(), nil
+}
+
+// formatToolOutput 将工具结果格式化为注入上下文的系统消息内容
+// 搜索结果只保留前 MaxSearchResults 条的标题、摘要和链接，完整结果保存在会话的 lastSources 中
+func (a *EinoAgent) formatToolOutput(sess *session, toolName string, toolResult interface{}) string {
+	results, ok := toolResult.([]map[string]string)
+	if !ok {
+		return fmt.Sprintf("工具(%s)输出: %v", toolName, toolResult)
+	}
+	sess.setLastSources(results)
+
+	limit := a.config.Behavior.MaxSearchResults
+	if limit <= 0 {
+		limit = DefaultMaxSearchResults
+	}
+	if limit > len(results) {
+		limit = len(results)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("工具(%s)输出（共 %d 条结果，展示前 %d 条）:\n", toolName, len(results), limit))
+	for i, r := range results[:limit] {
+		sb.WriteString(fmt.Sprintf("%d. %s\n   %s\n   链接: %s\n", i+1, r["title"], r["description"], r["link"]))
+		if excerpt := r["excerpt"]; excerpt != "" {
+			sb.WriteString(fmt.Sprintf("   页面摘录: %s\n", excerpt))
+		}
+	}
+	if a.citationsEnabled() {
+		sb.WriteString(citationInstruction)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// PersistenceEnabled 返回对话是否会持久化到磁盘
+func (a *EinoAgent) PersistenceEnabled() bool {
+	return a.memory != nil && a.memory.PersistenceEnabled()
+}
+
+// loadKnowledgeContext 按用户输入检索知识库，设置本轮的知识库上下文
+// 未开启、未注册知识库工具或没有命中时清空本轮的知识库上下文
+func (a *EinoAgent) loadKnowledgeContext(ctx context.Context, sess *session, input string) {
+	sess.setKnowledgeContext(a.knowledgeContextFor(ctx, sess.id, input))
+}
+
+// knowledgeContextFor 按用户输入检索知识库，将最相关的片段格式化为带来源编号的参考资料
+// 未开启、未注册知识库工具或没有命中时返回空字符串
+func (a *EinoAgent) knowledgeContextFor(ctx context.Context, convID, input string) string {
+	if (!a.config.Behavior.KnowledgeContext && !a.featureEnabled(FeatureRAG)) || a.tools == nil {
+		return ""
+	}
+	tool, ok := a.tools.GetTool("knowledge_base")
+	if !ok {
+		return ""
+	}
+	searcher, ok := tool.(knowledgeSearcher)
+	if !ok {
+		logger.FromContext(ctx).Debug("知识库工具不支持片段检索，跳过自动注入", map[string]interface{}{"tool": tool.Name()})
+		return ""
+	}
+
+	limit := a.config.Behavior.KnowledgeContextMaxSnippets
+	if limit <= 0 {
+		limit = DefaultKnowledgeContextMaxSnippets
+	}
+	maxChars := a.config.Behavior.KnowledgeContextMaxChars
+	if maxChars <= 0 {
+		maxChars = DefaultKnowledgeContextMaxChars
+	}
+
+	snippets, err := searcher.Snippets(input, limit)
+	if err != nil {
+		logger.FromContext(ctx).Warn("检索知识库失败", map[string]interface{}{"error": err.Error()})
+		return ""
+	}
+	if len(snippets) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("以下是知识库中与问题相关的资料，引用时请标注来源编号，如 [1]：\n")
+	used := 0
+	for i, sn := range snippets {
+		line := fmt.Sprintf("[%d] %s 第%d行: %s\n", i+1, sn.Document, sn.Line, sn.Text)
+		if used > 0 && sb.Len()+len(line) > maxChars {
+			break
+		}
+		sb.WriteString(line)
+		used++
+	}
+	logger.FromContext(ctx).Debug("注入知识库上下文", map[string]interface{}{
+		"snippets":        used,
+		"conversation_id": convID,
+	})
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// generate 调用LLM生成响应，开启 RetryOnEmpty 时对空响应追加提示重试一次
+func (a *EinoAgent) generate(ctx context.Context, prompt Prompt) (string, error) {
+	resp, err := a.llmGenerate(ctx, prompt)
+	if err != nil || a.hasMinContent(resp) || !a.config.Behavior.RetryOnEmpty {
+		return resp, err
+	}
+
+	logger.FromContext(ctx).Warn("LLM返回空响应，追加提示后重试", map[string]interface{}{"conversation_id": a.conversationID(ctx)})
+	return a.llmGenerate(ctx, withSystemHint(prompt, emptyResponseNudge))
+}
+
+// maxToolIterations 返回单轮对话的工具调用次数上限
+func (a *EinoAgent) maxToolIterations() int {
+	if a.config.Behavior.MaxToolIterations > 0 {
+		return a.config.Behavior.MaxToolIterations
+	}
+	return DefaultMaxToolIterations
+}
+
+// requiredTool 返回输入命中的强制工具名，未命中返回空字符串
+func (a *EinoAgent) requiredTool(input string) string {
+	for _, rule := range a.config.Behavior.StrictTools {
+		if rule.Pattern != nil && rule.Pattern.MatchString(input) {
+			return rule.Tool
+		}
+	}
+	return ""
+}
+
+// enforceStrictTool 输入命中强制工具规则但模型未调用该工具时，追加提示重新生成
+// 重试次数受 MaxStrictRetries 限制，用尽后返回最后一次的响应
+func (a *EinoAgent) enforceStrictTool(ctx context.Context, input string, prompt Prompt, preResp string) (string, error) {
+	tool := a.requiredTool(input)
+	if tool == "" {
+		return preResp, nil
+	}
+
+	maxRetries := a.config.Behavior.MaxStrictRetries
+	if maxRetries <= 0 {
+		maxRetries = DefaultMaxStrictRetries
+	}
+	hint := fmt.Sprintf("这个问题必须使用工具 %s 处理，不要直接回答。请只输出工具调用，例如：%s", tool, a.toolCallExample(tool))
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		if name, _ := a.extractToolCall(preResp); name == tool {
+			return preResp, nil
+		}
+		logger.FromContext(ctx).Warn("模型未按强制规则调用工具，重新生成", map[string]interface{}{
+			"tool":    tool,
+			"attempt": attempt,
+		})
+		resp, err := a.generate(ctx, withSystemHint(prompt, hint))
+		if err != nil {
+			return "", err
+		}
+		preResp = resp
+	}
+	if name, _ := a.extractToolCall(preResp); name != tool {
+		logger.FromContext(ctx).Warn("强制工具重试次数已用尽", map[string]interface{}{"tool": tool})
+	}
+	return preResp, nil
+}
+
+// llmGenerate 调用LLM非流式生成，并记录 llm.generate span
+// 客户端实现 MessageClient 时直接传递消息列表，否则传递渲染后的文本
+func (a *EinoAgent) llmGenerate(ctx context.Context, prompt Prompt) (string, error) {
+	llmClient, model := a.clientFor(ctx)
+	ctx, span := tracing.StartSpan(ctx, "llm.generate")
+	text := prompt.String()
+	promptTokens := a.tokenizer.CountTokens(text)
+	span.SetAttributes(
+		attribute.String("llm.model", model),
+		attribute.Int("llm.prompt_chars", len(text)),
+		attribute.Int("llm.prompt_tokens", promptTokens),
+	)
+	// 相同的确定性提示词直接返回缓存的回复，不调用模型
+	cacheKey := a.responseCacheKey(llmClient, model, prompt)
+	if resp, ok := a.cachedResponse(span, cacheKey); ok {
+		tracing.EndSpan(span, nil)
+		return resp, nil
+	}
+	var resp string
+	var err error
+	var u GenerationUsage
+	var reported bool
+	switch client := llmClient.(type) {
+	case MessageClient:
+		resp, u, err = client.GenerateMessages(ctx, prompt.Messages())
+		reported = true
+	case UsageGenerator:
+		resp, u, err = client.GenerateWithUsage(ctx, text)
+		reported = true
+	default:
+		resp, err = llmClient.Generate(ctx, text)
+		u = GenerationUsage{
+			PromptChars:     utf8.RuneCountInString(text),
+			CompletionChars: utf8.RuneCountInString(resp),
+		}
+	}
+	completionTokens := a.tokenizer.CountTokens(resp)
+	a.session(ctx).addUsage(promptTokens, completionTokens, u)
+	if reported {
+		span.SetAttributes(
+			attribute.Int("llm.prompt_eval_count", u.PromptEvalCount),
+			attribute.Int("llm.eval_count", u.EvalCount),
+		)
+	}
+	span.SetAttributes(
+		attribute.Int("llm.response_chars", len(resp)),
+		attribute.Int("llm.completion_tokens", completionTokens),
+	)
+	if cacheKey != "" && err == nil && resp != "" {
+		a.config.Cache.Cache.Put(cacheKey, resp)
+	}
+	tracing.EndSpan(span, err)
+	return resp, err
+}
+
+// llmGenerateStream 调用LLM流式生成，并记录 llm.generate_stream span（生成结束时关闭）
+func (a *EinoAgent) llmGenerateStream(ctx context.Context, prompt Prompt, responseChan chan<- string) error {
+	llmClient, model := a.clientFor(ctx)
+	ctx, span := tracing.StartSpan(ctx, "llm.generate_stream")
+	text := prompt.String()
+	promptTokens := a.tokenizer.CountTokens(text)
+	a.session(ctx).addUsage(promptTokens, 0, GenerationUsage{})
+	span.SetAttributes(
+		attribute.String("llm.model", model),
+		attribute.Int("llm.prompt_chars", len(text)),
+		attribute.Int("llm.prompt_tokens", promptTokens),
+	)
+	generate := func(out chan<- string) error {
+		if mc, ok := llmClient.(MessageClient); ok {
+			return mc.GenerateMessagesStream(ctx, prompt.Messages(), out)
+		}
+		return llmClient.GenerateStream(ctx, text, out)
+	}
+
+	var err error
+	cacheKey := a.responseCacheKey(llmClient, model, prompt)
+	if resp, ok := a.cachedResponse(span, cacheKey); ok {
+		// 命中缓存时整段回复作为一个数据块返回
+		responseChan <- resp
+		close(responseChan)
+	} else if cacheKey != "" {
+		err = a.streamCached(ctx, cacheKey, responseChan, generate)
+	} else {
+		err = generate(responseChan)
+	}
+	tracing.EndSpan(span, err)
+	return err
+}
+
+// hasMinContent 判断回复的非空白字符数是否达到 MinResponseChars（至少为 1）
+func (a *EinoAgent) hasMinContent(s string) bool {
+	need := a.config.Behavior.MinResponseChars
+	if need < 1 {
+		need = 1
+	}
+	n := 0
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			n++
+			if n >= need {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// emptyResponseMessage 返回空响应时的回退消息
+func (a *EinoAgent) emptyResponseMessage() string {
+	if a.config.Behavior.EmptyResponseMessage != "" {
+		return a.config.Behavior.EmptyResponseMessage
+	}
+	return DefaultEmptyResponseMessage
+}
+
+// buildPrompt 以当前消息历史与本轮的知识库上下文构建完整的提示词，并记录本轮省略的历史消息数
+func (a *EinoAgent) buildPrompt(sess *session) Prompt {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	prompt, startIdx := a.promptFrom(sess, sess.history, sess.knowledgeContext)
+	if startIdx > sess.trimmedMessages {
+		sess.trimmedMessages = startIdx
+	}
+	return prompt
+}
+
+// promptFrom 构建完整的提示词：系统消息在前，其后为 history 中历史窗口内的消息；同时返回省略的最早历史消息数
+// 系统提示词取自 sess，调用方需持有 sess.mu
+func (a *EinoAgent) promptFrom(sess *session, history []Message, knowledgeContext string) (Prompt, int) {
+	var prompt Prompt
+	system := func(content string) {
+		prompt = append(prompt, Message{Role: "system", Content: content})
+	}
 
 	// 添加系统消息
-	if a.config.ModelConfig.Prompt != "" {
-		fullPrompt += "system: " + a.config.ModelConfig.Prompt + "\n\n"
+	if prompt := a.systemPrompt(sess); prompt != "" {
+		system(prompt)
+	}
+
+	// 添加由已注册工具生成的工具目录
+	if a.featureEnabled(FeatureToolCatalog) {
+		if catalog := BuildToolPrompt(a.tools); catalog != "" {
+			system(catalog)
+		}
 	}
 
-	// 添加历史消息上下文（最多保留最近10条消息）
-	maxHistoryMessages := 10
-	startIdx := 0
-	if len(a.messageHistory) > maxHistoryMessages {
-		startIdx = len(a.messageHistory) - maxHistoryMessages
+	// 标记模式下说明工具调用的写法
+	if a.sentinelEnabled() {
+		system(a.sentinelInstruction())
 	}
 
-	// 添加对话历史
-	for i := startIdx; i < len(a.messageHistory); i++ {
-		msg := a.messageHistory[i]
-		fullPrompt += fmt.Sprintf("%s: %s\n\n", msg.Role, msg.Content)
+	// 添加本轮自动检索的知识库资料
+	if knowledgeContext != "" {
+		system(knowledgeContext)
 	}
 
-	// 添加明确的助手提示
-	fullPrompt += "assistant: "
+	// 添加历史消息上下文：按条数与 token 预算保留最近的消息
+	startIdx := a.historyStart(history, prompt)
+	return append(prompt, history[startIdx:]...), startIdx
+}
+
+// formatHistoryMessage 返回单条历史消息在提示词中的文本
+func formatHistoryMessage(msg Message) string {
+	return fmt.Sprintf("%s: %s\n\n", msg.Role, msg.Content)
+}
 
-	return fullPrompt
+// historyStart 返回本轮注入提示词的第一条历史消息下标
+// 从最新消息向前累加，超过 MaxMessages 或 MaxTokens（扣除 header 已占用的部分）时停止
+func (a *EinoAgent) historyStart(history []Message, header Prompt) int {
+	maxMessages := a.config.History.MaxMessages
+	if maxMessages <= 0 {
+		maxMessages = DefaultHistoryMaxMessages
+	}
+	start := len(history) - maxMessages
+	if start < 0 {
+		start = 0
+	}
+
+	maxTokens := a.config.History.MaxTokens
+	if maxTokens <= 0 {
+		return start
+	}
+	estimate := a.config.History.EstimateTokens
+	if estimate == nil {
+		estimate = a.tokenizer.CountTokens
+	}
+	// header 的渲染结果已包含结尾的 "assistant: " 提示
+	used := estimate(header.String())
+	for i := len(history) - 1; i >= start; i-- {
+		used += estimate(formatHistoryMessage(history[i]))
+		// 最新一条消息（通常是本轮用户输入）始终保留
+		if used > maxTokens && i < len(history)-1 {
+			return i + 1
+		}
+	}
+	return start
 }
 
 // Learn 从反馈中学习
@@ -601,15 +2205,16 @@ func (a *EinoAgent) Learn(ctx context.Context, feedback string) error {
 	// 创建反馈消息
 	feedbackMsg := fmt.Sprintf("反馈 (%s): %s", time.Now().Format("2006-01-02 15:04:05"), feedback)
 
-	// 将反馈添加到当前对话
-	if a.currentConversationID != "" {
-		if err := a.memory.AddMessageToConversation(ctx, a.currentConversationID, "system", feedbackMsg); err != nil {
+	// 将反馈添加到 ctx 所属的对话（见 WithConversationID），未绑定时为当前对话
+	convID := a.conversationID(ctx)
+	if convID != "" {
+		if err := a.memory.AddMessageToConversation(ctx, convID, "system", feedbackMsg); err != nil {
 			return fmt.Errorf("添加反馈到对话失败: %w", err)
 		}
 	}
 
-	// 存储反馈到向量存储（如果支持）
-	if err := a.memory.Store(ctx, fmt.Sprintf("feedback_%d", time.Now().Unix()), feedbackMsg); err != nil {
+	// 存储反馈到向量存储（如果支持），附带对话ID等元数据以便按对话检索
+	if err := a.memory.StoreConversationEntry(ctx, convID, "system", memory.EntryTypeFeedback, feedbackMsg); err != nil {
 		return fmt.Errorf("存储反馈失败: %w", err)
 	}
 
@@ -640,8 +2245,6 @@ func parseParams(text string) map[string]interface{} {
 }
 
 // sendThinkingEvent 发送思维链事件（仅在流式模式下）
-func (a *EinoAgent) sendThinkingEvent(responseChan chan<- string, eventType, message string) {
-	// 发送特殊格式的事件标记
-	eventData := fmt.Sprintf("[THINKING:%s:%s]", eventType, message)
-	responseChan <- eventData
+func (a *EinoAgent) sendThinkingEvent(events chan<- StreamEvent, eventType, message string) {
+	events <- StreamEvent{Kind: eventType, Data: message}
 }
@@ -0,0 +1,1273 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"agentEino/pkg/memory"
+	"agentEino/pkg/tools"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fakeLLM 按顺序返回预设回复的 LLM 客户端，Generate 与 GenerateStream 共用同一回复序列，
+// 用完后重复最后一条；记录收到的全部提示词
+type fakeLLM struct {
+	mu        sync.Mutex
+	replies   []string
+	prompts   []string
+	chunkSize int // 流式输出时每块的字符数，<=0 时整条回复作为一块
+}
+
+func newFakeLLM(replies ...string) *fakeLLM {
+	return &fakeLLM{replies: replies}
+}
+
+// next 记录提示词并返回下一条回复
+func (f *fakeLLM) next(prompt string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.prompts = append(f.prompts, prompt)
+	if len(f.replies) == 0 {
+		return ""
+	}
+	reply := f.replies[0]
+	if len(f.replies) > 1 {
+		f.replies = f.replies[1:]
+	}
+	return reply
+}
+
+// calls 返回已收到的生成请求数
+func (f *fakeLLM) calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.prompts)
+}
+
+// lastPrompt 返回最近一次生成请求的提示词
+func (f *fakeLLM) lastPrompt() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.prompts) == 0 {
+		return ""
+	}
+	return f.prompts[len(f.prompts)-1]
+}
+
+func (f *fakeLLM) Generate(ctx context.Context, prompt string) (string, error) {
+	return f.next(prompt), nil
+}
+
+func (f *fakeLLM) GenerateStream(ctx context.Context, prompt string, responseChan chan<- string) error {
+	defer close(responseChan)
+	reply := []rune(f.next(prompt))
+	size := f.chunkSize
+	if size <= 0 {
+		size = len(reply)
+	}
+	for len(reply) > 0 {
+		n := size
+		if n > len(reply) {
+			n = len(reply)
+		}
+		select {
+		case responseChan <- string(reply[:n]):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		reply = reply[n:]
+	}
+	return nil
+}
+
+// newTestAgent 创建使用临时数据目录的 Agent，tm 为 nil 时不注册工具
+func newTestAgent(t *testing.T, config Config, llm LLMClient, tm *tools.ToolManager) *EinoAgent {
+	t.Helper()
+	if config.MemoryConfig.DBPath == "" {
+		config.MemoryConfig.DBPath = t.TempDir()
+	}
+	a := NewEinoAgent(config)
+	if err := a.Initialize(context.Background(), llm, tm); err != nil {
+		t.Fatalf("初始化 Agent 失败: %v", err)
+	}
+	return a
+}
+
+// streamResult 一次 ProcessStream 的输出
+type streamResult struct {
+	chunks []string // 正文数据块
+	events []string // 思维链事件（原始 [THINKING:type:msg] 字符串）
+	err    error
+}
+
+// text 返回拼接后的正文
+func (r streamResult) text() string {
+	return strings.Join(r.chunks, "")
+}
+
+// hasEvent 判断是否收到指定类型的思维链事件
+func (r streamResult) hasEvent(eventType string) bool {
+	for _, e := range r.events {
+		if strings.HasPrefix(e, "[THINKING:"+eventType+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// runStream 执行 ProcessStream 并收集全部输出
+func runStream(ctx context.Context, a *EinoAgent, input string) streamResult {
+	ch := make(chan string, 100)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- a.ProcessStream(ctx, input, ch)
+	}()
+	var r streamResult
+	for chunk := range ch {
+		if strings.HasPrefix(chunk, "[THINKING:") {
+			r.events = append(r.events, chunk)
+		} else {
+			r.chunks = append(r.chunks, chunk)
+		}
+	}
+	r.err = <-errChan
+	return r
+}
+
+func TestStreamDecisionThinkingEmitsDecisionEvents(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		llm := newFakeLLM("我可以直接回答这个问题", "这是最终回复")
+		llm.chunkSize = 3
+		a := newTestAgent(t, Config{Behavior: BehaviorConfig{StreamDecisionThinking: enabled}}, llm, nil)
+
+		r := runStream(context.Background(), a, "你好")
+		if r.err != nil {
+			t.Fatalf("enabled=%v: ProcessStream 失败: %v", enabled, r.err)
+		}
+
+		var decision strings.Builder
+		for _, e := range r.events {
+			if msg, ok := strings.CutPrefix(e, "[THINKING:decision:"); ok {
+				decision.WriteString(strings.TrimSuffix(msg, "]"))
+			}
+		}
+		if enabled && decision.String() != "我可以直接回答这个问题" {
+			t.Errorf("开启时决策事件拼接结果 = %q", decision.String())
+		}
+		if !enabled && r.hasEvent("decision") {
+			t.Errorf("关闭时不应推送决策事件: %v", r.events)
+		}
+	}
+}
+
+// funcTool 以函数实现的测试工具
+type funcTool struct {
+	name string
+	fn   func(ctx context.Context, params map[string]interface{}) (interface{}, error)
+}
+
+func (t *funcTool) Name() string        { return t.name }
+func (t *funcTool) Description() string { return "测试工具 " + t.name }
+func (t *funcTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	return t.fn(ctx, params)
+}
+
+// newToolManager 注册给定工具的工具管理器
+func newToolManager(t *testing.T, ts ...tools.Tool) *tools.ToolManager {
+	t.Helper()
+	tm := tools.NewToolManager()
+	for _, tool := range ts {
+		if err := tm.RegisterTool(tool.Name(), tool); err != nil {
+			t.Fatalf("注册工具 %s 失败: %v", tool.Name(), err)
+		}
+	}
+	return tm
+}
+
+func TestEnabledToolsLimitsCallableTools(t *testing.T) {
+	echo := func(name string) *funcTool {
+		return &funcTool{name: name, fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+			return name, nil
+		}}
+	}
+
+	llm := newFakeLLM("好的")
+	tm := newToolManager(t, echo("calculator"), echo("web_search"))
+	a := newTestAgent(t, Config{ToolsConfig: ToolsConfig{EnabledTools: []string{"calculator", "weather"}}}, llm, tm)
+
+	if _, err := a.ExecuteTool(context.Background(), "web_search", nil); !errors.Is(err, tools.ErrToolDisabled) {
+		t.Errorf("调用未启用的工具应返回 ErrToolDisabled，实际 %v", err)
+	}
+	if got, err := a.ExecuteTool(context.Background(), "calculator", nil); err != nil || got != "calculator" {
+		t.Errorf("启用的工具应可调用: %v, %v", got, err)
+	}
+	if _, err := a.Process(context.Background(), "你好"); err != nil {
+		t.Fatal(err)
+	}
+	if p := llm.lastPrompt(); strings.Contains(p, "web_search") || !strings.Contains(p, "calculator") {
+		t.Errorf("工具目录应只包含启用的工具，实际:\n%s", p)
+	}
+
+	// 启用列表为空时保持全部可用
+	all := newTestAgent(t, Config{}, newFakeLLM("好的"), newToolManager(t, echo("calculator"), echo("web_search")))
+	if _, err := all.ExecuteTool(context.Background(), "web_search", nil); err != nil {
+		t.Errorf("未配置启用列表时所有工具都应可用: %v", err)
+	}
+}
+
+func TestParamDefaultsConfigAppliedOnInitialize(t *testing.T) {
+	var got map[string]interface{}
+	search := &funcTool{name: "web_search", fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		got = params
+		return nil, nil
+	}}
+	config := Config{ToolsConfig: ToolsConfig{ParamDefaults: map[string]map[string]interface{}{
+		"web_search": {"num": float64(5), "lang": "zh"},
+	}}}
+	a := newTestAgent(t, config, newFakeLLM("好的"), newToolManager(t, search))
+
+	if _, err := a.ExecuteTool(context.Background(), "web_search", map[string]interface{}{"query": "天气", "lang": "en"}); err != nil {
+		t.Fatal(err)
+	}
+	if got["num"] != float64(5) || got["lang"] != "en" {
+		t.Errorf("应只补全缺少的参数，实际 %v", got)
+	}
+}
+
+func TestMaxSearchResultsLimitsInjectedResults(t *testing.T) {
+	search := &funcTool{name: "web_search", fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		var results []map[string]string
+		for i := 1; i <= 5; i++ {
+			results = append(results, map[string]string{
+				"title":       fmt.Sprintf("结果标题%d", i),
+				"description": "摘要",
+				"link":        fmt.Sprintf("https://example.com/%d", i),
+			})
+		}
+		return results, nil
+	}}
+	llm := newFakeLLM(`{"tool":"web_search","params":{"query":"go"}}`, "根据搜索结果回答")
+	a := newTestAgent(t, Config{Behavior: BehaviorConfig{MaxSearchResults: 2}}, llm, newToolManager(t, search))
+
+	if _, err := a.Process(context.Background(), "搜索 go"); err != nil {
+		t.Fatalf("Process 失败: %v", err)
+	}
+
+	prompt := llm.lastPrompt()
+	for i := 1; i <= 5; i++ {
+		title := fmt.Sprintf("结果标题%d", i)
+		if got, want := strings.Contains(prompt, title), i <= 2; got != want {
+			t.Errorf("提示词中包含 %s = %v，期望 %v", title, got, want)
+		}
+	}
+	if !strings.Contains(prompt, "共 5 条结果，展示前 2 条") {
+		t.Errorf("提示词应说明结果条数: %s", prompt)
+	}
+	if n := len(a.GetLastSources()); n != 5 {
+		t.Errorf("引用来源应保留全部 5 条结果，实际 %d", n)
+	}
+}
+
+func TestEmptyResponseRetriesWithNudge(t *testing.T) {
+	llm := newFakeLLM("", "重试后的回复")
+	a := newTestAgent(t, Config{Behavior: BehaviorConfig{RetryOnEmpty: true}}, llm, nil)
+
+	resp, err := a.Process(context.Background(), "你好")
+	if err != nil {
+		t.Fatalf("Process 失败: %v", err)
+	}
+	if resp != "重试后的回复" {
+		t.Errorf("回复 = %q，期望重试后的回复", resp)
+	}
+	if !strings.Contains(llm.lastPrompt(), emptyResponseNudge) {
+		t.Errorf("重试的提示词应包含追加提示: %s", llm.lastPrompt())
+	}
+}
+
+func TestPersistentEmptyResponseUsesConfiguredFallback(t *testing.T) {
+	const fallback = "Sorry, no answer this time."
+	for _, retry := range []bool{true, false} {
+		llm := newFakeLLM("")
+		a := newTestAgent(t, Config{Behavior: BehaviorConfig{RetryOnEmpty: retry, EmptyResponseMessage: fallback}}, llm, nil)
+
+		r := runStream(context.Background(), a, "你好")
+		if r.err != nil {
+			t.Fatalf("retry=%v: ProcessStream 失败: %v", retry, r.err)
+		}
+		if r.text() != fallback {
+			t.Errorf("retry=%v: 回复 = %q，期望配置的回退消息", retry, r.text())
+		}
+		// 决策一次，最终生成一次；开启重试时两次生成各多一次
+		want := 2
+		if retry {
+			want = 4
+		}
+		if llm.calls() != want {
+			t.Errorf("retry=%v: 生成次数 = %d，期望 %d", retry, llm.calls(), want)
+		}
+	}
+}
+
+func TestWhitespaceStreamStoresFallbackInsteadOfEmptyAnswer(t *testing.T) {
+	const fallback = "Sorry, no answer this time."
+	cases := []struct {
+		name     string
+		reply    string
+		minChars int
+	}{
+		{"全空白", " \n\t  \n", 0},
+		{"低于最小长度", "  嗯 ", 3},
+	}
+	for _, c := range cases {
+		llm := newFakeLLM(c.reply)
+		llm.chunkSize = 1
+		a := newTestAgent(t, Config{Behavior: BehaviorConfig{
+			RetryOnEmpty:         true,
+			EmptyResponseMessage: fallback,
+			MinResponseChars:     c.minChars,
+		}}, llm, nil)
+
+		r := runStream(context.Background(), a, "你好")
+		if r.err != nil {
+			t.Fatalf("%s: ProcessStream 失败: %v", c.name, r.err)
+		}
+		if r.text() != fallback {
+			t.Errorf("%s: 回复 = %q，期望回退消息且不转发空白片段", c.name, r.text())
+		}
+		var stored []string
+		for _, m := range a.currentSession().messages() {
+			if m.Role == "assistant" {
+				stored = append(stored, m.Content)
+			}
+		}
+		if len(stored) != 1 || stored[0] != fallback {
+			t.Errorf("%s: 保存的助手消息 = %q，期望仅保存回退消息", c.name, stored)
+		}
+	}
+}
+
+// failingLLM 总是返回错误的 LLM 客户端
+type failingLLM struct{ err error }
+
+func (f failingLLM) Generate(ctx context.Context, prompt string) (string, error) {
+	return "", f.err
+}
+
+func (f failingLLM) GenerateStream(ctx context.Context, prompt string, responseChan chan<- string) error {
+	close(responseChan)
+	return f.err
+}
+
+func TestStreamErrorSkipsFallbackAndPersistence(t *testing.T) {
+	a := newTestAgent(t, Config{}, failingLLM{err: errors.New("模型不可用")}, nil)
+
+	r := runStream(context.Background(), a, "你好")
+	if r.err == nil {
+		t.Fatal("LLM 失败时 ProcessStream 应返回错误")
+	}
+	if r.text() != "" {
+		t.Errorf("失败时不应推送回退消息，实际 %q", r.text())
+	}
+	if !r.hasEvent("error") {
+		t.Errorf("失败时应推送 error 事件: %v", r.events)
+	}
+	for _, m := range a.currentSession().messages() {
+		if m.Role == "assistant" {
+			t.Errorf("失败时不应保存助手回复: %q", m.Content)
+		}
+	}
+}
+
+func TestProcessRecordsSpanHierarchy(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	echo := &funcTool{name: "echo", fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return "pong", nil
+	}}
+	llm := newFakeLLM(`{"tool":"echo","params":{}}`, "工具返回了 pong")
+	config := Config{ModelConfig: ModelConfig{ModelName: "test-model"}}
+	a := newTestAgent(t, config, llm, newToolManager(t, echo))
+
+	if _, err := a.Process(context.Background(), "调用 echo"); err != nil {
+		t.Fatalf("Process 失败: %v", err)
+	}
+
+	var root sdktrace.ReadOnlySpan
+	byName := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, s := range recorder.Ended() {
+		byName[s.Name()] = append(byName[s.Name()], s)
+		if s.Name() == "agent.process" {
+			root = s
+		}
+	}
+	if root == nil {
+		t.Fatalf("缺少 agent.process span，实际 %v", byName)
+	}
+	if root.Parent().IsValid() {
+		t.Errorf("agent.process 应为根 span")
+	}
+
+	attr := func(s sdktrace.ReadOnlySpan, key string) string {
+		for _, kv := range s.Attributes() {
+			if string(kv.Key) == key {
+				return kv.Value.Emit()
+			}
+		}
+		return ""
+	}
+	if len(byName["llm.generate"]) != 2 {
+		t.Fatalf("应记录 2 个 llm.generate span，实际 %d", len(byName["llm.generate"]))
+	}
+	for _, s := range byName["llm.generate"] {
+		if s.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("llm.generate 的父 span 应为 agent.process")
+		}
+		if got := attr(s, "llm.model"); got != "test-model" {
+			t.Errorf("llm.model = %q", got)
+		}
+		if attr(s, "llm.prompt_tokens") == "" {
+			t.Errorf("llm.generate 缺少 llm.prompt_tokens 属性")
+		}
+	}
+	toolSpans := byName["tool.execute"]
+	if len(toolSpans) != 1 {
+		t.Fatalf("应记录 1 个 tool.execute span，实际 %d", len(toolSpans))
+	}
+	if toolSpans[0].Parent().SpanID() != root.SpanContext().SpanID() {
+		t.Errorf("tool.execute 的父 span 应为 agent.process")
+	}
+	if got := attr(toolSpans[0], "tool.name"); got != "echo" {
+		t.Errorf("tool.name = %q", got)
+	}
+}
+
+func TestStrictToolsRoutesMathThroughCalculator(t *testing.T) {
+	rules, err := ParseStrictToolRules(`{"calculator":"\\d+\\s*[-+*/]\\s*\\d+"}`)
+	if err != nil {
+		t.Fatalf("解析强制工具规则失败: %v", err)
+	}
+	var calls int
+	calculator := &funcTool{name: "calculator", fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		calls++
+		return "42", nil
+	}}
+	// 模型先直接作答，被要求重试后才调用计算器
+	llm := newFakeLLM("答案是 42", `{"tool":"calculator","params":{"expression":"6*7"}}`, "6*7 = 42")
+	a := newTestAgent(t, Config{Behavior: BehaviorConfig{StrictTools: rules}}, llm, newToolManager(t, calculator))
+
+	resp, err := a.Process(context.Background(), "6 * 7 等于多少")
+	if err != nil {
+		t.Fatalf("Process 失败: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("计算器应被调用 1 次，实际 %d", calls)
+	}
+	if resp != "6*7 = 42" {
+		t.Errorf("回复 = %q", resp)
+	}
+}
+
+func TestStrictToolRulesPreferMoreSpecificPattern(t *testing.T) {
+	// 多次解析以覆盖 map 遍历顺序的随机性
+	for i := 0; i < 20; i++ {
+		rules, err := ParseStrictToolRules(`{"web_search":"天气","weather":"北京天气","forecast":"上海天气"}`)
+		if err != nil {
+			t.Fatalf("解析强制工具规则失败: %v", err)
+		}
+		a := &EinoAgent{config: Config{Behavior: BehaviorConfig{StrictTools: rules}}}
+		if got := a.requiredTool("北京天气怎么样"); got != "weather" {
+			t.Fatalf("重叠规则应优先命中更具体的规则，实际 %q", got)
+		}
+		if got := a.requiredTool("明天天气"); got != "web_search" {
+			t.Fatalf("只命中通用规则时应返回 web_search，实际 %q", got)
+		}
+		var order []string
+		for _, r := range rules {
+			order = append(order, r.Tool)
+		}
+		if strings.Join(order, ",") != "forecast,weather,web_search" {
+			t.Fatalf("规则顺序 = %v，期望按正则长度降序、工具名升序", order)
+		}
+	}
+}
+
+func TestStrictToolsRetriesAreBounded(t *testing.T) {
+	rules, _ := ParseStrictToolRules(`{"calculator":"\\d+\\s*[-+*/]\\s*\\d+"}`)
+	llm := newFakeLLM("答案是 42")
+	config := Config{Behavior: BehaviorConfig{StrictTools: rules, MaxStrictRetries: 2}}
+	a := newTestAgent(t, config, llm, nil)
+
+	if _, err := a.Process(context.Background(), "6 * 7 等于多少"); err != nil {
+		t.Fatalf("Process 失败: %v", err)
+	}
+	// 决策一次、重试两次，无工具调用时最后一次响应即为回复
+	if llm.calls() != 3 {
+		t.Errorf("生成次数 = %d，期望 3", llm.calls())
+	}
+
+	// 不匹配规则的输入不受影响
+	llm = newFakeLLM("你好")
+	a = newTestAgent(t, config, llm, nil)
+	if _, err := a.Process(context.Background(), "你好"); err != nil {
+		t.Fatalf("Process 失败: %v", err)
+	}
+	if llm.calls() != 1 {
+		t.Errorf("未命中规则时不应重试，实际生成 %d 次", llm.calls())
+	}
+}
+
+func TestPostToolGenerationCanChainSecondTool(t *testing.T) {
+	var order []string
+	record := func(name string) *funcTool {
+		return &funcTool{name: name, fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+			order = append(order, name)
+			return name + " 的结果", nil
+		}}
+	}
+	llm := newFakeLLM(
+		`{"tool":"first","params":{}}`,
+		`{"tool":"second","params":{}}`,
+		"两个工具都已完成",
+	)
+	a := newTestAgent(t, Config{}, llm, newToolManager(t, record("first"), record("second")))
+
+	resp, err := a.Process(context.Background(), "依次调用两个工具")
+	if err != nil {
+		t.Fatalf("Process 失败: %v", err)
+	}
+	if strings.Join(order, ",") != "first,second" {
+		t.Errorf("工具执行顺序 = %v，期望 first,second", order)
+	}
+	if resp != "两个工具都已完成" {
+		t.Errorf("回复 = %q", resp)
+	}
+	if !strings.Contains(llm.lastPrompt(), "second 的结果") {
+		t.Errorf("最终生成的提示词应包含第二个工具的结果")
+	}
+}
+
+func TestStreamHidesToolCallAfterProse(t *testing.T) {
+	weather := &funcTool{name: "weather", fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return "晴，25度", nil
+	}}
+	search := &funcTool{name: "search", fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return "搜索结果", nil
+	}}
+	// 工具结果注入后的生成先输出说明文字，再输出代码块形式的工具调用
+	llm := newFakeLLM(`{"tool":"search","params":{}}`, "再查一下天气。\n```tool:weather\n{}\n```", "最终回答")
+	llm.chunkSize = 3
+	a := newTestAgent(t, Config{}, llm, newToolManager(t, weather, search))
+
+	r := runStream(context.Background(), a, "北京天气")
+	if r.err != nil {
+		t.Fatalf("ProcessStream 失败: %v", r.err)
+	}
+	if got := strings.Join(r.chunks, ""); got != "最终回答" {
+		t.Errorf("客户端收到 %q，期望只有最终回答", got)
+	}
+
+	conv, err := a.memory.GetConversation(context.Background(), a.GetConversationID())
+	if err != nil {
+		t.Fatalf("读取对话失败: %v", err)
+	}
+	var saved []string
+	for _, m := range conv.(*memory.Conversation).Messages {
+		if m.Role == "assistant" {
+			saved = append(saved, m.Content)
+		}
+	}
+	if len(saved) != 1 || saved[0] != "最终回答" {
+		t.Errorf("保存的助手消息 = %q，期望只有最终回答", saved)
+	}
+}
+
+// nativeLLM 实现 FunctionCaller，首次请求返回 pending 中的工具调用，之后只返回 fakeLLM 的回复
+type nativeLLM struct {
+	*fakeLLM
+	pending []ToolCall
+}
+
+func (n *nativeLLM) GenerateWithTools(ctx context.Context, prompt string, specs []ToolSpec) (string, []ToolCall, error) {
+	content := n.next(prompt)
+	calls := n.pending
+	n.pending = nil
+	return content, calls, nil
+}
+
+func TestNativeParallelToolCallsRunAsOneBatch(t *testing.T) {
+	var mu sync.Mutex
+	var executed []string
+	record := func(name string) *funcTool {
+		return &funcTool{name: name, fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+			mu.Lock()
+			executed = append(executed, fmt.Sprintf("%s:%v", name, params["city"]))
+			mu.Unlock()
+			return name + " 的结果", nil
+		}}
+	}
+	llm := &nativeLLM{
+		fakeLLM: newFakeLLM("", "两个城市都查好了"),
+		pending: []ToolCall{
+			{Name: "weather", Params: map[string]interface{}{"city": "北京"}},
+			{Name: "air", Params: map[string]interface{}{"city": "上海"}},
+		},
+	}
+	a := newTestAgent(t, Config{}, llm, newToolManager(t, record("weather"), record("air")))
+
+	resp, err := a.Process(context.Background(), "北京天气和上海空气")
+	if err != nil {
+		t.Fatalf("Process 失败: %v", err)
+	}
+	sort.Strings(executed)
+	if strings.Join(executed, ",") != "air:上海,weather:北京" {
+		t.Errorf("应执行全部并行调用，实际 %v", executed)
+	}
+	calls := a.LastToolCalls()
+	if len(calls) != 2 || calls[0].Iteration != 1 || calls[1].Iteration != 1 {
+		t.Errorf("并行调用应在同一轮执行: %+v", calls)
+	}
+	if resp != "两个城市都查好了" || llm.calls() != 2 {
+		t.Errorf("回复 = %q，生成次数 %d，期望一次工具轮后直接回答", resp, llm.calls())
+	}
+}
+
+func TestChainedToolCallsRespectIterationBudget(t *testing.T) {
+	echo := &funcTool{name: "echo", fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return params["n"], nil
+	}}
+	llm := newFakeLLM(`{"tool":"echo","params":{"n":"1"}}`, `{"tool":"echo","params":{"n":"2"}}`, `{"tool":"echo","params":{"n":"3"}}`)
+	a := newTestAgent(t, Config{Behavior: BehaviorConfig{MaxToolIterations: 2}}, llm, newToolManager(t, echo))
+
+	_, err := a.Process(context.Background(), "不停调用工具")
+	if !errors.Is(err, ErrMaxToolIterations) {
+		t.Errorf("超过工具调用上限应返回 ErrMaxToolIterations，实际 %v", err)
+	}
+}
+
+func TestSetConversationIDRejectsMaliciousID(t *testing.T) {
+	a := newTestAgent(t, Config{}, newFakeLLM("你好"), nil)
+	before := a.GetConversationID()
+	if err := a.SetConversationID("../../etc/x"); err == nil {
+		t.Fatal("含路径穿越的会话ID应被拒绝")
+	}
+	if a.GetConversationID() != before {
+		t.Errorf("拒绝后不应切换会话，当前 %q", a.GetConversationID())
+	}
+	if err := a.SetConversationID("conv_ok"); err != nil {
+		t.Errorf("合法会话ID应被接受: %v", err)
+	}
+}
+
+func TestConversationSystemPromptFollowsConversation(t *testing.T) {
+	ctx := context.Background()
+	llm := newFakeLLM("回复一", "回复二", "回复三")
+	a := newTestAgent(t, Config{ModelConfig: ModelConfig{Prompt: "你是通用助手"}}, llm, nil)
+
+	custom, err := a.NewConversation(ctx, "翻译")
+	if err != nil {
+		t.Fatalf("创建对话失败: %v", err)
+	}
+	if err := a.SetConversationSystemPrompt(ctx, custom, "你是英文翻译"); err != nil {
+		t.Fatalf("设置对话提示词失败: %v", err)
+	}
+
+	// 修改其他会话不影响当前会话
+	if _, err := a.Process(ctx, "你好"); err != nil {
+		t.Fatal(err)
+	}
+	if p := llm.lastPrompt(); !strings.Contains(p, "你是通用助手") || strings.Contains(p, "你是英文翻译") {
+		t.Errorf("当前会话应使用全局提示词，实际:\n%s", p)
+	}
+	general := a.GetConversationID()
+
+	if err := a.SetConversationID(custom); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Process(ctx, "早上好"); err != nil {
+		t.Fatal(err)
+	}
+	if p := llm.lastPrompt(); !strings.Contains(p, "你是英文翻译") || strings.Contains(p, "你是通用助手") {
+		t.Errorf("切换后应使用对话专属提示词替代全局提示词，实际:\n%s", p)
+	}
+
+	if err := a.SetConversationID(general); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Process(ctx, "再见"); err != nil {
+		t.Fatal(err)
+	}
+	if p := llm.lastPrompt(); !strings.Contains(p, "你是通用助手") || strings.Contains(p, "你是英文翻译") {
+		t.Errorf("切回后应恢复全局提示词，实际:\n%s", p)
+	}
+
+	if err := a.SetConversationSystemPrompt(ctx, "missing", "x"); err == nil {
+		t.Error("对话不存在时应返回错误")
+	}
+}
+
+// unwritableDir 返回一个无法创建的数据目录（父路径是普通文件），root 用户下同样不可写
+func unwritableDir(t *testing.T) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "readonly")
+	if err := os.WriteFile(file, nil, 0444); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(file, "conversations")
+}
+
+func TestChatWorksWithoutPersistenceWhenDataDirIsReadOnly(t *testing.T) {
+	dir := unwritableDir(t)
+	llm := newFakeLLM("第一轮回复", "第二轮回复")
+	a := newTestAgent(t, Config{MemoryConfig: MemoryConfig{DBPath: dir}}, llm, nil)
+
+	if a.PersistenceEnabled() {
+		t.Fatal("数据目录不可写时应关闭持久化")
+	}
+	if resp, err := a.Process(context.Background(), "你好"); err != nil || resp != "第一轮回复" {
+		t.Fatalf("第一轮对话失败: %q, %v", resp, err)
+	}
+	r := runStream(context.Background(), a, "继续")
+	if r.err != nil || r.text() != "第二轮回复" {
+		t.Fatalf("第二轮流式对话失败: %q, %v", r.text(), r.err)
+	}
+	// 历史仍保存在内存中
+	if !strings.Contains(llm.lastPrompt(), "第一轮回复") {
+		t.Errorf("第二轮提示词应包含内存中的历史")
+	}
+}
+
+// blockingLLM 在上下文取消前一直阻塞的 LLM 客户端，流式生成时先输出 partial
+type blockingLLM struct{ partial string }
+
+func (b blockingLLM) Generate(ctx context.Context, prompt string) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func (b blockingLLM) GenerateStream(ctx context.Context, prompt string, responseChan chan<- string) error {
+	defer close(responseChan)
+	if b.partial != "" {
+		responseChan <- b.partial
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestTurnExceedingBudgetReturnsTimeoutError(t *testing.T) {
+	config := Config{MaxTurnDuration: 50 * time.Millisecond}
+	a := newTestAgent(t, config, blockingLLM{}, nil)
+
+	start := time.Now()
+	_, err := a.Process(context.Background(), "你好")
+	if !errors.Is(err, ErrTurnTimeout) {
+		t.Fatalf("超时应返回 ErrTurnTimeout，实际 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("超时后应尽快返回，实际耗时 %s", elapsed)
+	}
+}
+
+func TestStreamTurnTimeoutKeepsPartialAnswer(t *testing.T) {
+	// 决策阶段正常返回，最终生成输出部分内容后阻塞直到超时
+	llm := &scriptedLLM{
+		generate: func(ctx context.Context, prompt string) (string, error) { return "直接回答", nil },
+		stream:   blockingLLM{partial: "部分回答"}.GenerateStream,
+	}
+	config := Config{MaxTurnDuration: 50 * time.Millisecond}
+	a := newTestAgent(t, config, llm, nil)
+
+	r := runStream(context.Background(), a, "你好")
+	if !errors.Is(r.err, ErrTurnTimeout) {
+		t.Fatalf("超时应返回 ErrTurnTimeout，实际 %v", r.err)
+	}
+	if !r.hasEvent("timeout") {
+		t.Errorf("超时应推送 timeout 事件: %v", r.events)
+	}
+	if r.hasEvent("error") {
+		t.Errorf("超时不应推送 error 事件: %v", r.events)
+	}
+	if r.text() != "部分回答" {
+		t.Errorf("已生成的部分应照常转发，实际 %q", r.text())
+	}
+	history := a.currentSession().messages()
+	last := history[len(history)-1]
+	if last.Role != "assistant" || last.Content != "部分回答" {
+		t.Errorf("超时时应保存已生成的部分，实际 %+v", last)
+	}
+}
+
+// scriptedLLM 以函数实现 Generate 与 GenerateStream 的 LLM 客户端
+type scriptedLLM struct {
+	generate func(ctx context.Context, prompt string) (string, error)
+	stream   func(ctx context.Context, prompt string, responseChan chan<- string) error
+}
+
+func (s *scriptedLLM) Generate(ctx context.Context, prompt string) (string, error) {
+	return s.generate(ctx, prompt)
+}
+
+func (s *scriptedLLM) GenerateStream(ctx context.Context, prompt string, responseChan chan<- string) error {
+	return s.stream(ctx, prompt, responseChan)
+}
+
+func TestTrimmedHistoryEmitsNoticeEvent(t *testing.T) {
+	llm := newFakeLLM("回复")
+	a := newTestAgent(t, Config{History: HistoryConfig{MaxMessages: 2}}, llm, nil)
+
+	r := runStream(context.Background(), a, "第一个问题")
+	if r.hasEvent("history_trimmed") || a.HistoryTrimmed() != 0 {
+		t.Fatalf("历史未超出窗口时不应推送裁剪事件: %v", r.events)
+	}
+
+	a.Process(context.Background(), "第二个问题")
+	r = runStream(context.Background(), a, "第三个问题")
+	if !r.hasEvent("history_trimmed") {
+		t.Fatalf("历史超出窗口时应推送 history_trimmed 事件: %v", r.events)
+	}
+	if a.HistoryTrimmed() == 0 {
+		t.Error("HistoryTrimmed 应返回本轮省略的消息数")
+	}
+	if strings.Contains(llm.lastPrompt(), "第一个问题") {
+		t.Error("被裁剪的历史不应出现在提示词中")
+	}
+}
+
+// seedKnowledgeBase 创建包含给定文档的知识库目录
+func seedKnowledgeBase(t *testing.T, docs map[string]string) *tools.KnowledgeBaseTool {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range docs {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tools.NewKnowledgeBaseTool(dir)
+}
+
+func TestKnowledgeContextInjectsRelevantSnippet(t *testing.T) {
+	kb := seedKnowledgeBase(t, map[string]string{
+		"policy.md": "# 公司制度\n年假天数为每年十五天\n报销需在三十天内提交\n",
+		"menu.txt":  "食堂周一供应饺子\n",
+	})
+	for _, enabled := range []bool{true, false} {
+		llm := newFakeLLM("根据资料，年假为十五天")
+		config := Config{Behavior: BehaviorConfig{KnowledgeContext: enabled, KnowledgeContextMaxSnippets: 1}}
+		a := newTestAgent(t, config, llm, newToolManager(t, kb))
+
+		if _, err := a.Process(context.Background(), "年假有几天？"); err != nil {
+			t.Fatalf("Process 失败: %v", err)
+		}
+		prompt := llm.lastPrompt()
+		injected := strings.Contains(prompt, "[1] policy.md 第2行: 年假天数为每年十五天")
+		if injected != enabled {
+			t.Errorf("enabled=%v: 提示词中注入相关片段 = %v\n%s", enabled, injected, prompt)
+		}
+		if strings.Contains(prompt, "饺子") || strings.Contains(prompt, "报销") {
+			t.Errorf("enabled=%v: 不应注入无关或超出上限的片段", enabled)
+		}
+	}
+}
+
+func TestKnowledgeContextSurvivesCassetteWrapping(t *testing.T) {
+	kb := seedKnowledgeBase(t, map[string]string{"policy.md": "年假天数为每年十五天\n"})
+	cassette, err := tools.NewCassette(filepath.Join(t.TempDir(), "cassette.json"))
+	if err != nil {
+		t.Fatalf("创建录制文件失败: %v", err)
+	}
+	llm := newFakeLLM("根据资料，年假为十五天")
+	config := Config{Behavior: BehaviorConfig{KnowledgeContext: true}}
+	a := newTestAgent(t, config, llm, tools.WrapWithCassette(newToolManager(t, kb), cassette))
+
+	if _, err := a.Process(context.Background(), "年假有几天？"); err != nil {
+		t.Fatalf("Process 失败: %v", err)
+	}
+	if prompt := llm.lastPrompt(); !strings.Contains(prompt, "[1] policy.md 第1行: 年假天数为每年十五天") {
+		t.Errorf("录制模式下知识库片段应注入提示词:\n%s", prompt)
+	}
+}
+
+// warmingLLM 记录预加载调用的 LLM 客户端
+type warmingLLM struct {
+	*fakeLLM
+	warmups int
+	err     error
+}
+
+func (w *warmingLLM) Warmup(ctx context.Context) error {
+	w.warmups++
+	return w.err
+}
+
+func TestInitializeWarmsUpModelWhenEnabled(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		llm := &warmingLLM{fakeLLM: newFakeLLM("你好")}
+		newTestAgent(t, Config{ModelConfig: ModelConfig{Warmup: enabled}}, llm, nil)
+		want := 0
+		if enabled {
+			want = 1
+		}
+		if llm.warmups != want {
+			t.Errorf("enabled=%v: 预加载次数 = %d，期望 %d", enabled, llm.warmups, want)
+		}
+		if llm.calls() != 0 {
+			t.Errorf("enabled=%v: 预加载不应发起生成请求", enabled)
+		}
+	}
+
+	// 预加载失败不影响初始化与后续对话
+	llm := &warmingLLM{fakeLLM: newFakeLLM("你好"), err: errors.New("模型加载失败")}
+	a := newTestAgent(t, Config{ModelConfig: ModelConfig{Warmup: true}}, llm, nil)
+	if _, err := a.Process(context.Background(), "你好"); err != nil {
+		t.Errorf("预加载失败后对话应照常进行: %v", err)
+	}
+}
+
+func TestLearnStoresFeedbackForFilteredVectorSearch(t *testing.T) {
+	a := newTestAgent(t, Config{MemoryConfig: MemoryConfig{MemoryType: "vector"}}, newFakeLLM("好的"), nil)
+	ctx := context.Background()
+
+	var convIDs []string
+	for _, feedback := range []string{"回答太长了，请简短一些", "回答太长了，需要更多例子"} {
+		id, err := a.NewConversation(ctx, "测试")
+		if err != nil {
+			t.Fatalf("创建对话失败: %v", err)
+		}
+		if err := a.SetConversationID(id); err != nil {
+			t.Fatalf("切换对话失败: %v", err)
+		}
+		if err := a.Learn(ctx, feedback); err != nil {
+			t.Fatalf("Learn 失败: %v", err)
+		}
+		convIDs = append(convIDs, id)
+	}
+
+	vm := a.memory.(*MemoryAdapter).vectorMem
+	results, err := vm.SearchVectorFiltered(ctx, "回答太长", map[string]interface{}{
+		memory.MetadataConversationID: convIDs[0],
+		memory.MetadataType:           memory.EntryTypeFeedback,
+	}, 10)
+	if err != nil {
+		t.Fatalf("检索失败: %v", err)
+	}
+	if len(results) != 1 || !strings.Contains(results[0].Content, "请简短一些") {
+		t.Fatalf("按对话过滤应只返回该对话的反馈，实际 %d 条", len(results))
+	}
+	meta := results[0].Metadata
+	if meta[memory.MetadataRole] != "system" || meta[memory.MetadataTimestamp] == "" {
+		t.Errorf("反馈条目缺少角色或时间戳元数据: %v", meta)
+	}
+}
+
+func TestToolCallArrayRunsAsConcurrentBatch(t *testing.T) {
+	slow := func(name string) *funcTool {
+		return &funcTool{name: name, fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+			time.Sleep(200 * time.Millisecond)
+			return name + " 的结果", nil
+		}}
+	}
+	batch := `[{"tool":"slow_a","params":{}},{"tool":"slow_b","params":{}}]`
+	for _, stream := range []bool{false, true} {
+		llm := newFakeLLM(batch, "汇总两个结果")
+		a := newTestAgent(t, Config{}, llm, newToolManager(t, slow("slow_a"), slow("slow_b")))
+
+		start := time.Now()
+		var resp string
+		if stream {
+			r := runStream(context.Background(), a, "同时查两样")
+			if r.err != nil {
+				t.Fatalf("ProcessStream 失败: %v", r.err)
+			}
+			resp = r.text()
+		} else {
+			var err error
+			if resp, err = a.Process(context.Background(), "同时查两样"); err != nil {
+				t.Fatalf("Process 失败: %v", err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed >= 400*time.Millisecond {
+			t.Errorf("stream=%v: 同一轮的独立调用应并发执行，耗时 %s", stream, elapsed)
+		}
+		if resp != "汇总两个结果" {
+			t.Errorf("stream=%v: 回复 = %q，工具调用数组不应作为回复输出", stream, resp)
+		}
+		prompt := llm.lastPrompt()
+		ia, ib := strings.Index(prompt, "slow_a 的结果"), strings.Index(prompt, "slow_b 的结果")
+		if ia == -1 || ib == -1 || ia > ib {
+			t.Errorf("stream=%v: 两个结果应按调用顺序注入提示词", stream)
+		}
+		calls := a.LastToolCalls()
+		if len(calls) != 2 || calls[0].Tool != "slow_a" || calls[1].Tool != "slow_b" || calls[0].Iteration != 1 || calls[1].Iteration != 1 {
+			t.Errorf("stream=%v: 工具调用记录 = %+v", stream, calls)
+		}
+	}
+}
+
+func TestSentinelToolCallExtractedAmidProse(t *testing.T) {
+	a := NewEinoAgent(Config{Behavior: BehaviorConfig{
+		ToolSentinelStart: DefaultToolSentinelStart,
+		ToolSentinelEnd:   DefaultToolSentinelEnd,
+	}})
+	cases := []struct {
+		name, response, tool, params string
+	}{
+		{"前后有说明文字", "好的，我先查一下天气。\n<<TOOL>>{\"tool\":\"weather\",\"params\":{\"city\":\"北京\"}}<<END>>\n稍等片刻。", "weather", `{"city":"北京"}`},
+		{"标记外的JSON被忽略", "示例格式是 {\"tool\":\"calculator\",\"params\":{}}，现在调用：<<TOOL>>{\"tool\":\"weather\",\"params\":{}}<<END>>", "weather", `{}`},
+		{"标记外的代码块被忽略", "```tool:calculator\n{}\n```\n<<TOOL>>weather\n{\"city\":\"上海\"}<<END>>", "weather", `{"city":"上海"}`},
+		{"只取第一对标记", "<<TOOL>>{\"tool\":\"a\",\"params\":{}}<<END>> 然后 <<TOOL>>{\"tool\":\"b\",\"params\":{}}<<END>>", "a", `{}`},
+		{"没有标记时不识别", "{\"tool\":\"weather\",\"params\":{}}", "", ""},
+		{"缺少结束标记", "<<TOOL>>{\"tool\":\"weather\",\"params\":{}}", "", ""},
+	}
+	for _, c := range cases {
+		tool, params := a.extractToolCall(c.response)
+		if tool != c.tool || params != c.params {
+			t.Errorf("%s: 解析结果 = (%q, %q)，期望 (%q, %q)", c.name, tool, params, c.tool, c.params)
+		}
+	}
+}
+
+func TestQuotedToolCallSyntaxIsNotExtracted(t *testing.T) {
+	sentinel := NewEinoAgent(Config{Behavior: BehaviorConfig{
+		ToolSentinelStart: DefaultToolSentinelStart,
+		ToolSentinelEnd:   DefaultToolSentinelEnd,
+	}})
+	plain := NewEinoAgent(Config{})
+	cases := []struct {
+		name     string
+		a        *EinoAgent
+		response string
+		tool     string
+	}{
+		{"行内代码中的标记", sentinel, "调用格式为 `<<TOOL>>{\"tool\":\"weather\",\"params\":{}}<<END>>`，请参考。", ""},
+		{"代码块中的标记", sentinel, "示例：\n```\n<<TOOL>>weather\n{}<<END>>\n```\n以上是格式说明。", ""},
+		{"引用示例后的真实调用", sentinel, "格式是 `<<TOOL>>name<<END>>`。\n<<TOOL>>{\"tool\":\"weather\",\"params\":{}}<<END>>", "weather"},
+		{"句中提到使用工具", plain, "你可以这样写：使用工具: weather 北京", ""},
+		{"行首的使用工具", plain, "我来查一下。\n使用工具: weather 北京", "weather"},
+	}
+	for _, c := range cases {
+		if tool, _ := c.a.extractToolCall(c.response); tool != c.tool {
+			t.Errorf("%s: 解析出工具 %q，期望 %q", c.name, tool, c.tool)
+		}
+	}
+}
+
+func TestSentinelToolCallAmidProseIsExecuted(t *testing.T) {
+	var got map[string]interface{}
+	weather := &funcTool{name: "weather", fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		got = params
+		return "晴，25度", nil
+	}}
+	llm := newFakeLLM("让我查一下。<<TOOL>>{\"tool\":\"weather\",\"params\":{\"city\":\"北京\"}}<<END>>谢谢等待", "北京今天晴，25度")
+	a := newTestAgent(t, Config{Behavior: BehaviorConfig{
+		ToolSentinelStart: DefaultToolSentinelStart,
+		ToolSentinelEnd:   DefaultToolSentinelEnd,
+	}}, llm, newToolManager(t, weather))
+
+	resp, err := a.Process(context.Background(), "北京天气怎么样")
+	if err != nil {
+		t.Fatalf("Process 失败: %v", err)
+	}
+	if got["city"] != "北京" {
+		t.Errorf("工具参数 = %v，期望 city=北京", got)
+	}
+	if resp != "北京今天晴，25度" {
+		t.Errorf("回复 = %q，期望基于工具结果的回答", resp)
+	}
+	if !strings.Contains(llm.prompts[0], DefaultToolSentinelStart) {
+		t.Error("标记模式下提示词应包含标记说明")
+	}
+}
+
+func TestClientDisconnectPersistsPartialAnswerWhenEnabled(t *testing.T) {
+	for _, persist := range []bool{true, false} {
+		// 决策阶段正常返回，最终生成输出部分内容后阻塞，直到客户端断开
+		llm := &scriptedLLM{
+			generate: func(ctx context.Context, prompt string) (string, error) { return "直接回答", nil },
+			stream:   blockingLLM{partial: "写到一半的回答"}.GenerateStream,
+		}
+		a := newTestAgent(t, Config{Behavior: BehaviorConfig{PersistPartialResponses: persist}}, llm, nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		ch := make(chan string, 100)
+		done := make(chan struct{})
+		go func() {
+			a.ProcessStream(ctx, "写一篇长文", ch)
+			close(done)
+		}()
+		for chunk := range ch {
+			if chunk == "写到一半的回答" {
+				cancel() // 模拟客户端在流式输出中途断开
+			}
+		}
+		<-done
+
+		conv, err := a.memory.GetConversation(context.Background(), a.GetConversationID())
+		if err != nil {
+			t.Fatalf("persist=%v: 读取对话失败: %v", persist, err)
+		}
+		var saved []memory.Message
+		for _, m := range conv.(*memory.Conversation).Messages {
+			if m.Role == "assistant" {
+				saved = append(saved, m)
+			}
+		}
+		if !persist {
+			if len(saved) != 0 {
+				t.Errorf("未开启时不应保存中断的回复: %+v", saved)
+			}
+			continue
+		}
+		if len(saved) != 1 || saved[0].Content != "写到一半的回答" || !saved[0].Partial {
+			t.Errorf("开启后应保存已生成的部分并标记为未完成: %+v", saved)
+		}
+	}
+}
+
+func TestToolResultsArePersistedAsToolMessages(t *testing.T) {
+	weather := &funcTool{name: "weather", fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return "晴，25度", nil
+	}}
+	llm := newFakeLLM(`{"tool":"weather","params":{}}`, "北京今天晴")
+	a := newTestAgent(t, Config{}, llm, newToolManager(t, weather))
+	if _, err := a.Process(context.Background(), "北京天气"); err != nil {
+		t.Fatalf("Process 失败: %v", err)
+	}
+
+	stored, err := a.StoredConversation(context.Background(), a.GetConversationID())
+	if err != nil {
+		t.Fatalf("读取对话失败: %v", err)
+	}
+	var roles []string
+	for _, m := range stored.Messages {
+		roles = append(roles, m.Role)
+	}
+	if strings.Join(roles, ",") != "user,tool,assistant" {
+		t.Fatalf("保存的消息角色 = %v，期望 user,tool,assistant", roles)
+	}
+	if !strings.Contains(stored.Messages[1].Content, "晴，25度") {
+		t.Errorf("工具消息应包含工具结果: %q", stored.Messages[1].Content)
+	}
+
+	// 恢复会话时工具结果与生成时一样作为系统消息注入
+	if err := a.SetConversationID(a.GetConversationID()); err != nil {
+		t.Fatalf("切换会话失败: %v", err)
+	}
+	if got := a.currentSession().messages()[1]; got.Role != "system" || got.Content != stored.Messages[1].Content {
+		t.Errorf("恢复后的工具结果 = %+v，期望系统消息", got)
+	}
+}
+
+func TestProcessDetailedReportsToolCalls(t *testing.T) {
+	calc := &funcTool{name: "calculator", fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return 4, nil
+	}}
+	decision := `{"tool":"calculator","params":{"expression":"2+2"}}`
+	a := newTestAgent(t, Config{}, newFakeLLM(decision, "2+2 等于 4"), newToolManager(t, calc))
+
+	result, err := a.ProcessDetailed(context.Background(), "2+2 等于几")
+	if err != nil {
+		t.Fatalf("ProcessDetailed 失败: %v", err)
+	}
+	if result.Response != "2+2 等于 4" || result.Decision != decision {
+		t.Errorf("回复 = %q，决策 = %q", result.Response, result.Decision)
+	}
+	if len(result.ToolCalls) != 1 {
+		t.Fatalf("工具调用记录 = %+v，期望 1 条", result.ToolCalls)
+	}
+	call := result.ToolCalls[0]
+	if call.Iteration != 1 || call.Tool != "calculator" || call.Params["expression"] != "2+2" || call.Result != 4 || call.Error != "" {
+		t.Errorf("工具调用记录 = %+v", call)
+	}
+
+	// 默认的 Process 仍只返回最终回复
+	b := newTestAgent(t, Config{}, newFakeLLM(decision, "2+2 等于 4"), newToolManager(t, calc))
+	if resp, err := b.Process(context.Background(), "2+2 等于几"); err != nil || resp != "2+2 等于 4" {
+		t.Errorf("Process = %q, %v", resp, err)
+	}
+}
+
+func TestCancelledTurnReturnsPromptlyAndNextTurnWorks(t *testing.T) {
+	// 第一轮阻塞直到上下文取消（模拟命令行中按 Ctrl-C），之后的生成正常返回
+	var blocked atomic.Bool
+	llm := &scriptedLLM{generate: func(ctx context.Context, prompt string) (string, error) {
+		if blocked.CompareAndSwap(false, true) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}
+		return "正常回复", nil
+	}}
+	a := newTestAgent(t, Config{}, llm, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := a.Process(ctx, "很慢的问题")
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrTurnTimeout) {
+		t.Fatalf("取消应返回 context.Canceled，实际 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("取消后应尽快返回，实际耗时 %s", elapsed)
+	}
+	for _, m := range a.currentSession().messages() {
+		if m.Role == "assistant" {
+			t.Errorf("取消的轮次不应保存助手回复: %+v", m)
+		}
+	}
+
+	if resp, err := a.Process(context.Background(), "你好"); err != nil || resp != "正常回复" {
+		t.Errorf("取消后下一轮应正常处理: %q, %v", resp, err)
+	}
+}
+
+func TestConcurrentTurnsOnOneAgent(t *testing.T) {
+	a := newTestAgent(t, Config{}, newFakeLLM("好的"), nil)
+
+	const turns = 8
+	var wg sync.WaitGroup
+	for i := 0; i < turns; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			input := fmt.Sprintf("问题%d", i)
+			if i%2 == 0 {
+				if _, err := a.Process(context.Background(), input); err != nil {
+					t.Errorf("Process 失败: %v", err)
+				}
+				return
+			}
+			if r := runStream(context.Background(), a, input); r.err != nil {
+				t.Errorf("ProcessStream 失败: %v", r.err)
+			}
+		}(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = a.GetConversationID()
+			_ = a.LastUsage()
+			_ = a.LastToolCalls()
+			_ = a.GetLastSources()
+			_ = a.HistoryTrimmed()
+			_ = a.CitationMissing()
+		}()
+	}
+	wg.Wait()
+
+	if got := len(a.currentSession().messages()); got != 2*turns {
+		t.Fatalf("消息历史应包含 %d 条消息，实际 %d 条", 2*turns, got)
+	}
+}
@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"agentEino/pkg/logger"
+)
+
+// 引用模式，控制使用搜索结果后是否要求回复标注来源
+const (
+	// CitationModeOff 不要求标注来源（默认）
+	CitationModeOff = "off"
+	// CitationModeInstruct 注入搜索结果时提示模型用 [编号] 标注来源，不做检查
+	CitationModeInstruct = "instruct"
+	// CitationModeVerify 在 instruct 基础上检查最终回复，本轮有搜索结果但回复未标注来源时标记 CitationMissing
+	CitationModeVerify = "verify"
+)
+
+// citationInstruction 注入在搜索结果之后的来源标注提示
+const citationInstruction = "回答中使用以上搜索结果的内容时，必须在对应内容后用 [编号] 标注来源（编号为上方结果序号，如 [1]），或直接给出来源链接。"
+
+// citationPattern 匹配回复中的 [编号] 引用
+var citationPattern = regexp.MustCompile(`\[(\d+)\]`)
+
+// citationsEnabled 是否在注入搜索结果时提示模型标注来源
+func (a *EinoAgent) citationsEnabled() bool {
+	switch a.config.Behavior.CitationMode {
+	case CitationModeInstruct, CitationModeVerify:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkCitations verify 模式下检查回复是否引用了本轮的搜索结果，有可引用的结果但未引用时记录警告并返回 true
+func (a *EinoAgent) checkCitations(ctx context.Context, sess *session, response string) bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sess.citationMissing = false
+	if a.config.Behavior.CitationMode != CitationModeVerify || len(sess.lastSources) == 0 {
+		return false
+	}
+	if hasCitation(response, sess.lastSources) {
+		return false
+	}
+	sess.citationMissing = true
+	logger.FromContext(ctx).Warn("回复未标注搜索结果来源", map[string]interface{}{
+		"conversation_id": sess.id,
+		"sources":         len(sess.lastSources),
+	})
+	return true
+}
+
+// hasCitation 回复中包含有效的 [编号]（1 到来源数）或任一来源链接时视为已标注来源
+func hasCitation(response string, sources []map[string]string) bool {
+	for _, m := range citationPattern.FindAllStringSubmatch(response, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n >= 1 && n <= len(sources) {
+			return true
+		}
+	}
+	for _, source := range sources {
+		if link := source["link"]; link != "" && strings.Contains(response, link) {
+			return true
+		}
+	}
+	return false
+}
+
+// CitationMissing 报告当前会话最近一轮的回复是否在 verify 模式下缺少来源标注
+func (a *EinoAgent) CitationMissing() bool {
+	return a.currentSession().stats().CitationMissing
+}
@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// citationSearchTool 返回两条搜索结果的 web_search 工具
+func citationSearchTool() *funcTool {
+	return &funcTool{name: "web_search", fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return []map[string]string{
+			{"title": "Go 1.22 发布", "description": "摘要", "link": "https://go.dev/blog/go1.22"},
+			{"title": "Go 发布历史", "description": "摘要", "link": "https://go.dev/doc/devel/release"},
+		}, nil
+	}}
+}
+
+func TestCitationsRequiredFlagsUncitedSearchAnswer(t *testing.T) {
+	llm := newFakeLLM(`{"tool":"web_search","params":{"query":"go 最新版本"}}`, "Go 的最新版本是 1.22。")
+	a := newTestAgent(t, Config{Behavior: BehaviorConfig{CitationMode: CitationModeVerify}}, llm, newToolManager(t, citationSearchTool()))
+
+	result, err := a.ProcessDetailed(context.Background(), "Go 最新版本是多少")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.CitationMissing || !a.CitationMissing() {
+		t.Errorf("使用搜索结果但未标注来源的回复应被标记: %+v", result)
+	}
+	if prompt := llm.lastPrompt(); !strings.Contains(prompt, citationInstruction) {
+		t.Errorf("注入搜索结果后应提示模型标注来源: %s", prompt)
+	}
+}
+
+func TestCitationsRequiredAcceptsCitedAnswers(t *testing.T) {
+	for _, answer := range []string{
+		"Go 的最新版本是 1.22 [1]。",
+		"Go 的最新版本是 1.22，见 https://go.dev/blog/go1.22",
+	} {
+		llm := newFakeLLM(`{"tool":"web_search","params":{"query":"go"}}`, answer)
+		a := newTestAgent(t, Config{Behavior: BehaviorConfig{CitationMode: CitationModeVerify}}, llm, newToolManager(t, citationSearchTool()))
+		result, err := a.ProcessDetailed(context.Background(), "Go 最新版本是多少")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.CitationMissing {
+			t.Errorf("已标注来源的回复不应被标记: %q", answer)
+		}
+	}
+
+	// 编号超出结果范围不算有效引用
+	if hasCitation("见 [3]", []map[string]string{{"link": "a"}, {"link": "b"}}) {
+		t.Error("[3] 超出 2 条结果的范围，不应视为引用")
+	}
+}
+
+func TestCitationsNotCheckedWithoutSearchOrOutsideVerifyMode(t *testing.T) {
+	// 本轮没有搜索结果时不要求引用
+	a := newTestAgent(t, Config{Behavior: BehaviorConfig{CitationMode: CitationModeVerify}}, newFakeLLM("你好！"), newToolManager(t))
+	if result, err := a.ProcessDetailed(context.Background(), "你好"); err != nil || result.CitationMissing {
+		t.Errorf("无搜索结果时不应标记: %+v, %v", result, err)
+	}
+
+	// instruct 模式只提示不检查
+	llm := newFakeLLM(`{"tool":"web_search","params":{"query":"go"}}`, "Go 的最新版本是 1.22。")
+	a = newTestAgent(t, Config{Behavior: BehaviorConfig{CitationMode: CitationModeInstruct}}, llm, newToolManager(t, citationSearchTool()))
+	result, err := a.ProcessDetailed(context.Background(), "Go 最新版本是多少")
+	if err != nil || result.CitationMissing {
+		t.Errorf("instruct 模式不应标记: %+v, %v", result, err)
+	}
+	if !strings.Contains(llm.lastPrompt(), citationInstruction) {
+		t.Error("instruct 模式应提示模型标注来源")
+	}
+
+	// 默认关闭时不注入提示
+	llm = newFakeLLM(`{"tool":"web_search","params":{"query":"go"}}`, "Go 的最新版本是 1.22。")
+	a = newTestAgent(t, Config{}, llm, newToolManager(t, citationSearchTool()))
+	if _, err := a.Process(context.Background(), "Go 最新版本是多少"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(llm.lastPrompt(), citationInstruction) {
+		t.Error("默认模式不应注入来源标注提示")
+	}
+}
+
+func TestCitationsRequiredStreamSendsEvent(t *testing.T) {
+	llm := newFakeLLM(`{"tool":"web_search","params":{"query":"go"}}`, "Go 的最新版本是 1.22。")
+	a := newTestAgent(t, Config{Behavior: BehaviorConfig{CitationMode: CitationModeVerify}}, llm, newToolManager(t, citationSearchTool()))
+
+	r := runStream(context.Background(), a, "Go 最新版本是多少")
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if !r.hasEvent("citation_missing") {
+		t.Errorf("流式回复未标注来源时应推送 citation_missing 事件: %v", r.events)
+	}
+}
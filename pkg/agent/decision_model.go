@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"context"
+)
+
+// DecisionConfig 第一轮工具决策使用的模型：可用更小更快的模型判断是否调用工具，最终回复仍由主模型生成
+type DecisionConfig struct {
+	// Client 决策模型的客户端，nil 时第一轮同样使用主模型
+	Client LLMClient
+	// ModelName 决策模型名称，用于追踪与响应缓存键
+	ModelName string
+}
+
+// decisionPassKey 标记第一轮工具决策的上下文键
+type decisionPassKey struct{}
+
+// separateDecision 报告是否配置了独立的决策模型
+func (a *EinoAgent) separateDecision() bool {
+	return a.config.Decision.Client != nil
+}
+
+// decisionContext 标记 ctx 内的生成属于第一轮工具决策，配置了决策模型时这些生成改用决策模型
+func (a *EinoAgent) decisionContext(ctx context.Context) context.Context {
+	if !a.separateDecision() {
+		return ctx
+	}
+	return context.WithValue(ctx, decisionPassKey{}, true)
+}
+
+// clientFor 返回本次生成使用的客户端与模型名称：第一轮工具决策使用决策模型，其余使用主模型
+func (a *EinoAgent) clientFor(ctx context.Context) (LLMClient, string) {
+	if decision, _ := ctx.Value(decisionPassKey{}).(bool); decision && a.separateDecision() {
+		return a.config.Decision.Client, a.config.Decision.ModelName
+	}
+	return a.llmClient, a.config.ModelConfig.ModelName
+}
@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDecisionModelDecidesAndMainModelAnswers(t *testing.T) {
+	calculator := &funcTool{name: "calculator", fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return "42", nil
+	}}
+	decision := newFakeLLM(`{"tool":"calculator","params":{"expression":"6*7"}}`)
+	main := newFakeLLM("6*7 = 42")
+	config := Config{Decision: DecisionConfig{Client: decision, ModelName: "small"}}
+	a := newTestAgent(t, config, main, newToolManager(t, calculator))
+
+	result, err := a.ProcessDetailed(context.Background(), "6 * 7 等于多少")
+	if err != nil {
+		t.Fatalf("ProcessDetailed 失败: %v", err)
+	}
+	if decision.calls() != 1 || main.calls() != 1 {
+		t.Fatalf("决策模型应生成 1 次、主模型 1 次，实际 %d、%d", decision.calls(), main.calls())
+	}
+	if len(result.ToolCalls) != 1 || result.ToolCalls[0].Tool != "calculator" {
+		t.Errorf("工具调用 = %+v，期望决策模型选择的 calculator", result.ToolCalls)
+	}
+	if result.Response != "6*7 = 42" {
+		t.Errorf("回复应由主模型生成，实际 %q", result.Response)
+	}
+	if !strings.Contains(main.lastPrompt(), "42") {
+		t.Error("主模型的提示词应包含工具结果")
+	}
+}
+
+func TestDecisionModelWithoutToolCallLetsMainModelAnswer(t *testing.T) {
+	decision := newFakeLLM("决策模型的草稿")
+	main := newFakeLLM("主模型的回答")
+	config := Config{Decision: DecisionConfig{Client: decision, ModelName: "small"}}
+
+	a := newTestAgent(t, config, main, nil)
+	resp, err := a.Process(context.Background(), "你好")
+	if err != nil {
+		t.Fatalf("Process 失败: %v", err)
+	}
+	if resp != "主模型的回答" {
+		t.Errorf("未调用工具时回复应由主模型生成，实际 %q", resp)
+	}
+	if decision.calls() != 1 || main.calls() != 1 {
+		t.Errorf("决策模型应生成 1 次、主模型 1 次，实际 %d、%d", decision.calls(), main.calls())
+	}
+
+	decision, main = newFakeLLM("决策模型的草稿"), newFakeLLM("主模型的流式回答")
+	config.Decision.Client = decision
+	a = newTestAgent(t, config, main, nil)
+	r := runStream(context.Background(), a, "你好")
+	if r.err != nil {
+		t.Fatalf("ProcessStream 失败: %v", r.err)
+	}
+	if r.text() != "主模型的流式回答" {
+		t.Errorf("流式回复应由主模型生成，实际 %q", r.text())
+	}
+	if decision.calls() != 1 || main.calls() != 1 {
+		t.Errorf("流式时决策模型应生成 1 次、主模型 1 次，实际 %d、%d", decision.calls(), main.calls())
+	}
+}
+
+func TestNoDecisionModelUsesMainModelForBothPasses(t *testing.T) {
+	main := newFakeLLM("直接回答")
+	a := newTestAgent(t, Config{}, main, nil)
+
+	resp, err := a.Process(context.Background(), "你好")
+	if err != nil {
+		t.Fatalf("Process 失败: %v", err)
+	}
+	if resp != "直接回答" || main.calls() != 1 {
+		t.Errorf("未配置决策模型时第一轮回复即为最终回复，实际 %q，生成 %d 次", resp, main.calls())
+	}
+}
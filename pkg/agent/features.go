@@ -0,0 +1,53 @@
+package agent
+
+import "sort"
+
+// 实验特性开关名称
+const (
+	// FeatureRAG 每轮自动检索知识库并注入提示词，与 BehaviorConfig.KnowledgeContext 任一开启即生效
+	FeatureRAG = "rag"
+	// FeatureNativeTools 客户端支持时使用原生函数调用识别工具调用，关闭后统一按文本解析
+	FeatureNativeTools = "native_tools"
+	// FeatureToolCatalog 在系统提示词中附加由已注册工具生成的工具目录
+	FeatureToolCatalog = "tool_catalog"
+)
+
+// knownFeatures 已知特性及其默认值
+var knownFeatures = map[string]bool{
+	FeatureRAG:         false,
+	FeatureNativeTools: true,
+	FeatureToolCatalog: true,
+}
+
+// Features 实验特性开关，未设置的特性使用默认值
+type Features map[string]bool
+
+// Enabled 判断特性是否开启，nil 或未设置时返回该特性的默认值（未知特性为 false）
+func (f Features) Enabled(name string) bool {
+	if v, ok := f[name]; ok {
+		return v
+	}
+	return knownFeatures[name]
+}
+
+// Unknown 返回未知的特性名称，按名称排序
+func (f Features) Unknown() []string {
+	var unknown []string
+	for name := range f {
+		if _, ok := knownFeatures[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// KnownFeatures 返回全部已知特性名称，按名称排序
+func KnownFeatures() []string {
+	names := make([]string, 0, len(knownFeatures))
+	for name := range knownFeatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
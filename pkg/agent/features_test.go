@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestFeaturesEnabledFallsBackToDefaults(t *testing.T) {
+	var none Features
+	if none.Enabled(FeatureRAG) || !none.Enabled(FeatureNativeTools) || !none.Enabled(FeatureToolCatalog) {
+		t.Error("未设置时应使用各特性的默认值")
+	}
+	f := Features{FeatureRAG: true, FeatureToolCatalog: false, "time_travel": true}
+	if !f.Enabled(FeatureRAG) || f.Enabled(FeatureToolCatalog) {
+		t.Error("显式设置应覆盖默认值")
+	}
+	if got := f.Unknown(); len(got) != 1 || got[0] != "time_travel" {
+		t.Errorf("Unknown() = %v，期望 [time_travel]", got)
+	}
+}
+
+func TestFeatureFlagsToggleBehavior(t *testing.T) {
+	kb := seedKnowledgeBase(t, map[string]string{"policy.md": "年假天数为每年十五天\n"})
+	weather := &funcTool{name: "weather", fn: nil}
+
+	for _, enabled := range []bool{true, false} {
+		// 未知特性只警告，不影响初始化
+		features := Features{FeatureRAG: enabled, FeatureToolCatalog: enabled, "time_travel": true}
+		llm := newFakeLLM("年假为十五天")
+		a := newTestAgent(t, Config{Features: features}, llm, newToolManager(t, kb, weather))
+
+		if _, err := a.Process(context.Background(), "年假有几天？"); err != nil {
+			t.Fatalf("enabled=%v: Process 失败: %v", enabled, err)
+		}
+		prompt := llm.lastPrompt()
+		if got := strings.Contains(prompt, "年假天数为每年十五天"); got != enabled {
+			t.Errorf("enabled=%v: rag 注入知识库片段 = %v", enabled, got)
+		}
+		if got := strings.Contains(prompt, weather.Description()); got != enabled {
+			t.Errorf("enabled=%v: tool_catalog 附加工具目录 = %v", enabled, got)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"context"
+	"time"
+)
+
+// Pinger 可选接口：能以轻量请求检查后端是否可达的LLM客户端
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// DefaultHealthCheckTimeout 检查LLM后端连通性的超时时间
+const DefaultHealthCheckTimeout = 2 * time.Second
+
+// LLMHealth LLM后端的连通性检查结果
+type LLMHealth struct {
+	Provider  string `json:"provider"`
+	Model     string `json:"model"`
+	Checked   bool   `json:"checked"`   // 客户端不支持检查时为 false，此时 Reachable 无意义
+	Reachable bool   `json:"reachable"` // 后端可达且模型可用
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// CheckLLMHealth 以 DefaultHealthCheckTimeout 为上限检查LLM后端是否可达
+func (a *EinoAgent) CheckLLMHealth(ctx context.Context) LLMHealth {
+	health := LLMHealth{
+		Provider: a.config.ModelConfig.Provider,
+		Model:    a.config.ModelConfig.ModelName,
+	}
+	pinger, ok := a.llmClient.(Pinger)
+	if !ok {
+		return health
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, DefaultHealthCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	err := pinger.Ping(ctx)
+	health.Checked = true
+	health.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	health.Reachable = true
+	return health
+}
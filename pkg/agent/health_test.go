@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// pingLLM 以固定错误响应 Ping 的 fakeLLM
+type pingLLM struct {
+	*fakeLLM
+	err error
+}
+
+func (p *pingLLM) Ping(ctx context.Context) error {
+	return p.err
+}
+
+func TestCheckLLMHealth(t *testing.T) {
+	config := Config{ModelConfig: ModelConfig{Provider: "ollama", ModelName: "llama3.1"}}
+
+	h := newTestAgent(t, config, &pingLLM{fakeLLM: newFakeLLM()}, nil).CheckLLMHealth(context.Background())
+	if !h.Checked || !h.Reachable || h.Error != "" || h.Provider != "ollama" || h.Model != "llama3.1" {
+		t.Errorf("后端可达时 = %+v", h)
+	}
+
+	h = newTestAgent(t, config, &pingLLM{fakeLLM: newFakeLLM(), err: errors.New("connection refused")}, nil).CheckLLMHealth(context.Background())
+	if !h.Checked || h.Reachable || h.Error != "connection refused" {
+		t.Errorf("后端不可达时 = %+v", h)
+	}
+
+	h = newTestAgent(t, config, newFakeLLM(), nil).CheckLLMHealth(context.Background())
+	if h.Checked || h.Model != "llama3.1" {
+		t.Errorf("客户端不支持 Ping 时不应检查，实际 %+v", h)
+	}
+}
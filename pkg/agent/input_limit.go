@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"agentEino/pkg/logger"
+)
+
+// DefaultMaxInputChars 配置文件未指定时单条用户输入的最大字符数
+const DefaultMaxInputChars = 20000
+
+// ErrInputTooLong 单条用户输入超过 MaxInputChars 或 MaxInputTokens 上限
+var ErrInputTooLong = errors.New("输入内容过长")
+
+// InputValidator 可选接口：在生成前校验用户输入，API 借此在开始流式响应前拒绝超长输入
+type InputValidator interface {
+	ValidateInput(input string) error
+}
+
+// ValidateInput 检查单条用户输入的字符数与估算 token 数，超过上限时返回包装了 ErrInputTooLong 的错误
+func (a *EinoAgent) ValidateInput(input string) error {
+	if limit := a.config.MaxInputChars; limit > 0 {
+		if n := utf8.RuneCountInString(input); n > limit {
+			return fmt.Errorf("%w: 本条消息 %d 个字符，上限为 %d 个字符，请精简内容或分多次发送", ErrInputTooLong, n, limit)
+		}
+	}
+	if limit := a.config.MaxInputTokens; limit > 0 {
+		if n := a.tokenizer.CountTokens(input); n > limit {
+			return fmt.Errorf("%w: 本条消息约 %d 个 token，上限为 %d 个 token，请精简内容或分多次发送", ErrInputTooLong, n, limit)
+		}
+	}
+	return nil
+}
+
+// rejectLongInput 校验输入并在超长时记录警告，返回的错误可直接作为本轮结果
+func (a *EinoAgent) rejectLongInput(ctx context.Context, input string) error {
+	err := a.ValidateInput(input)
+	if err != nil {
+		logger.FromContext(ctx).Warn("拒绝超长输入", map[string]interface{}{
+			"conversation_id": a.conversationID(ctx),
+			"input_chars":     utf8.RuneCountInString(input),
+			"error":           err.Error(),
+		})
+	}
+	return err
+}
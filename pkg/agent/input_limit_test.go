@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestProcessRejectsOverLimitInput(t *testing.T) {
+	llm := newFakeLLM("好的")
+	a := newTestAgent(t, Config{MaxInputChars: 10}, llm, newToolManager(t))
+
+	_, err := a.Process(context.Background(), strings.Repeat("长", 11))
+	if !errors.Is(err, ErrInputTooLong) {
+		t.Fatalf("超长输入应返回 ErrInputTooLong，实际 %v", err)
+	}
+	if want := "本条消息 11 个字符，上限为 10 个字符"; !strings.Contains(err.Error(), want) {
+		t.Errorf("错误信息 = %q，应包含 %q", err.Error(), want)
+	}
+	if len(llm.prompts) != 0 || len(a.currentSession().messages()) != 0 {
+		t.Errorf("超长输入不应调用模型或写入历史: prompts=%d history=%d", len(llm.prompts), len(a.currentSession().messages()))
+	}
+
+	// 恰好达到上限的输入正常处理（按字符而不是字节计数）
+	if resp, err := a.Process(context.Background(), strings.Repeat("长", 10)); err != nil || resp != "好的" {
+		t.Fatalf("上限内的输入 = %q, %v", resp, err)
+	}
+}
+
+func TestProcessStreamRejectsOverLimitInput(t *testing.T) {
+	llm := newFakeLLM("好的")
+	a := newTestAgent(t, Config{MaxInputChars: 5}, llm, newToolManager(t))
+
+	r := runStream(context.Background(), a, "这条消息超过了上限")
+	if !errors.Is(r.err, ErrInputTooLong) {
+		t.Fatalf("超长输入应返回 ErrInputTooLong，实际 %v", r.err)
+	}
+	if len(r.chunks) != 0 || len(llm.prompts) != 0 {
+		t.Errorf("超长输入不应生成内容: chunks=%v prompts=%d", r.chunks, len(llm.prompts))
+	}
+}
+
+func TestValidateInputTokenLimit(t *testing.T) {
+	a := newTestAgent(t, Config{MaxInputTokens: 5}, newFakeLLM(), newToolManager(t))
+	if err := a.ValidateInput("hi"); err != nil {
+		t.Errorf("短输入不应被拒绝: %v", err)
+	}
+	err := a.ValidateInput(strings.Repeat("word ", 50))
+	if !errors.Is(err, ErrInputTooLong) || !strings.Contains(err.Error(), "上限为 5 个 token") {
+		t.Errorf("超过 token 上限应被拒绝，实际 %v", err)
+	}
+
+	// 未配置上限时不限制
+	unlimited := newTestAgent(t, Config{}, newFakeLLM(), newToolManager(t))
+	if err := unlimited.ValidateInput(strings.Repeat("长", 100000)); err != nil {
+		t.Errorf("未配置上限时不应拒绝: %v", err)
+	}
+}
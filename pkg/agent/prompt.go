@@ -0,0 +1,30 @@
+package agent
+
+import "strings"
+
+// Prompt 发送给 LLM 的提示词：按角色划分的消息列表
+// 实现 MessageClient 的客户端直接接收消息列表；只支持文本的客户端使用 String 渲染后的文本
+type Prompt []Message
+
+// promptCue 文本提示词结尾的助手提示，引导只支持文本补全的模型以助手身份续写
+const promptCue = "assistant: "
+
+// String 将消息渲染为 "role: content" 段落，并以 "assistant: " 结尾
+func (p Prompt) String() string {
+	var b strings.Builder
+	for _, msg := range p {
+		b.WriteString(formatHistoryMessage(msg))
+	}
+	b.WriteString(promptCue)
+	return b.String()
+}
+
+// Messages 返回消息列表的副本
+func (p Prompt) Messages() []Message {
+	return append([]Message(nil), p...)
+}
+
+// withSystemHint 在提示词末尾追加一条系统提示，不修改原提示词
+func withSystemHint(prompt Prompt, hint string) Prompt {
+	return append(prompt.Messages(), Message{Role: "system", Content: hint})
+}
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"agentEino/pkg/logger"
+)
+
+// ReplayTurn 回放中的一轮：原会话的用户输入、当时的回复与按当前配置重新生成的回复
+type ReplayTurn struct {
+	Index     int    `json:"index"`
+	Input     string `json:"input"`
+	Original  string `json:"original"`        // 原会话中该轮的助手回复，没有回复时为空
+	Replayed  string `json:"replayed"`        // 重新生成的回复
+	Error     string `json:"error,omitempty"` // 该轮生成失败时的错误信息
+	Identical bool   `json:"identical"`       // 重新生成的回复与原回复完全一致
+}
+
+// ConversationReplayer 可选接口：按当前配置回放已保存的会话，用于比较提示词或模型修改前后的回答
+type ConversationReplayer interface {
+	ReplayConversation(ctx context.Context, id string) ([]ReplayTurn, error)
+}
+
+// ReplayConversation 将已保存会话中的用户消息依次发送给 Agent，在临时会话中生成新回复
+// 临时会话在回放结束后删除，原会话与当前会话都不会被修改
+// 某一轮生成失败时记录错误并继续后续轮次；ctx 取消时停止回放并返回已完成的轮次与错误
+func (a *EinoAgent) ReplayConversation(ctx context.Context, id string) ([]ReplayTurn, error) {
+	source, err := a.StoredConversation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	turns := replayTurns(source.Messages)
+	if len(turns) == 0 {
+		return nil, fmt.Errorf("对话中没有可回放的用户消息: %s", id)
+	}
+
+	tempID, err := a.NewConversation(ctx, "回放: "+id)
+	if err != nil {
+		return nil, fmt.Errorf("创建回放会话失败: %w", err)
+	}
+	defer func() {
+		if err := a.DeleteConversation(context.Background(), tempID); err != nil {
+			logger.FromContext(ctx).Warn("删除回放会话失败", map[string]interface{}{"conversation_id": tempID, "error": err.Error()})
+		}
+	}()
+	// 通过上下文绑定临时会话，不切换当前会话，回放期间其他会话的对话不受影响
+	ctx = WithConversationID(ctx, tempID)
+
+	logger.FromContext(ctx).Info("开始回放对话", map[string]interface{}{"conversation_id": id, "turns": len(turns)})
+	for i := range turns {
+		if err := ctx.Err(); err != nil {
+			return turns[:i], err
+		}
+		response, err := a.Process(ctx, turns[i].Input)
+		if err != nil {
+			turns[i].Error = err.Error()
+			continue
+		}
+		turns[i].Replayed = response
+		turns[i].Identical = response == turns[i].Original
+	}
+	return turns, nil
+}
+
+// replayTurns 按用户消息切分轮次，每轮的原回复取其后第一条完整的助手消息
+func replayTurns(messages []StoredMessage) []ReplayTurn {
+	var turns []ReplayTurn
+	for _, m := range messages {
+		switch m.Role {
+		case "user":
+			turns = append(turns, ReplayTurn{Index: len(turns), Input: m.Content})
+		case "assistant":
+			if n := len(turns); n > 0 && turns[n-1].Original == "" && !m.Partial {
+				turns[n-1].Original = m.Content
+			}
+		}
+	}
+	return turns
+}
@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReplayConversationUsesFreshEphemeralConversation(t *testing.T) {
+	llm := newFakeLLM("旧回复一", "旧回复二")
+	a := newTestAgent(t, Config{}, llm, nil)
+	ctx := context.Background()
+
+	for _, input := range []string{"第一个问题", "第二个问题"} {
+		if _, err := a.Process(ctx, input); err != nil {
+			t.Fatalf("Process 失败: %v", err)
+		}
+	}
+	sourceID := a.GetConversationID()
+	before, err := a.StoredConversation(ctx, sourceID)
+	if err != nil {
+		t.Fatalf("读取对话失败: %v", err)
+	}
+	storedBefore, _ := a.StoredConversations(ctx)
+
+	// 模拟修改提示词后模型给出不同的回答
+	llm.replies = []string{"新回复一", "旧回复二"}
+	turns, err := a.ReplayConversation(ctx, sourceID)
+	if err != nil {
+		t.Fatalf("ReplayConversation 失败: %v", err)
+	}
+
+	want := []ReplayTurn{
+		{Index: 0, Input: "第一个问题", Original: "旧回复一", Replayed: "新回复一"},
+		{Index: 1, Input: "第二个问题", Original: "旧回复二", Replayed: "旧回复二", Identical: true},
+	}
+	if !reflect.DeepEqual(turns, want) {
+		t.Errorf("回放结果 = %+v\n期望 %+v", turns, want)
+	}
+	// 第二轮在临时会话中应能看到第一轮重新生成的回复
+	prompt := llm.lastPrompt()
+	for _, s := range []string{"第一个问题", "新回复一", "第二个问题"} {
+		if !strings.Contains(prompt, s) {
+			t.Errorf("回放第二轮的提示词应包含临时会话的历史 %q: %q", s, prompt)
+		}
+	}
+
+	after, err := a.StoredConversation(ctx, sourceID)
+	if err != nil {
+		t.Fatalf("读取对话失败: %v", err)
+	}
+	if !reflect.DeepEqual(after.Messages, before.Messages) {
+		t.Errorf("回放不应修改原会话: %+v", after.Messages)
+	}
+	if a.GetConversationID() != sourceID {
+		t.Errorf("回放后应切回原当前会话，实际 %q", a.GetConversationID())
+	}
+	if storedAfter, _ := a.StoredConversations(ctx); len(storedAfter) != len(storedBefore) {
+		t.Errorf("回放结束后应删除临时会话: 回放前 %d 个，回放后 %d 个", len(storedBefore), len(storedAfter))
+	}
+}
+
+func TestReplayConversationRejectsMissingOrEmptyConversation(t *testing.T) {
+	a := newTestAgent(t, Config{}, newFakeLLM("好"), nil)
+	ctx := context.Background()
+
+	if _, err := a.ReplayConversation(ctx, "missing"); err == nil {
+		t.Error("不存在的对话应返回错误")
+	}
+	id, err := a.NewConversation(ctx, "空对话")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ReplayConversation(ctx, id); err == nil {
+		t.Error("没有用户消息的对话应返回错误")
+	}
+}
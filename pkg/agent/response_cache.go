@@ -0,0 +1,187 @@
+package agent
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Sampling 客户端生成时使用的采样参数
+type Sampling struct {
+	Temperature float64 `json:"temperature"`
+	TopP        float64 `json:"top_p,omitempty"`
+	MaxTokens   int     `json:"max_tokens,omitempty"`
+}
+
+// Sampler 可选接口：报告生成时使用的采样参数，响应缓存据此生成键并判断结果是否确定
+// 未实现时视为采样参数未知，默认不缓存
+type Sampler interface {
+	Sampling() Sampling
+}
+
+// ResponseCache 按提示词缓存LLM回复
+type ResponseCache interface {
+	Get(key string) (string, bool)
+	Put(key, response string)
+	// Clear 清空全部缓存
+	Clear()
+	// Len 当前缓存的条目数
+	Len() int
+}
+
+// DefaultResponseCacheSize 响应缓存的默认最大条目数
+const DefaultResponseCacheSize = 256
+
+// CacheConfig 响应缓存配置
+type CacheConfig struct {
+	// Cache 缓存实现，nil 表示不缓存
+	Cache ResponseCache
+	// AnyTemperature 温度不为 0 或未知时也缓存（结果不再随机），默认只缓存温度为 0 的确定性生成
+	AnyTemperature bool
+}
+
+// LRUResponseCache 内存中的 LRU 响应缓存，超过容量时淘汰最久未使用的条目，可并发使用
+type LRUResponseCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // 最近使用的在前
+	entries  map[string]*list.Element
+}
+
+// lruEntry LRU 链表中的一个条目
+type lruEntry struct {
+	key      string
+	response string
+}
+
+// NewLRUResponseCache 创建最多保存 capacity 条回复的缓存，capacity<=0 时使用 DefaultResponseCacheSize
+func NewLRUResponseCache(capacity int) *LRUResponseCache {
+	if capacity <= 0 {
+		capacity = DefaultResponseCacheSize
+	}
+	return &LRUResponseCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Get 返回缓存的回复，命中时标记为最近使用
+func (c *LRUResponseCache) Get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*lruEntry).response, true
+}
+
+// Put 保存回复，超过容量时淘汰最久未使用的条目
+func (c *LRUResponseCache) Put(key, response string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*lruEntry).response = response
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, response: response})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// Clear 清空全部缓存
+func (c *LRUResponseCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+// Len 当前缓存的条目数
+func (c *LRUResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// ClearResponseCache 清空响应缓存，未启用缓存时不做任何事
+func (a *EinoAgent) ClearResponseCache() {
+	if a.config.Cache.Cache != nil {
+		a.config.Cache.Cache.Clear()
+	}
+}
+
+// responseCacheKey 返回本次生成的缓存键，不应缓存时返回空字符串
+// 键为提供方、模型、采样参数与完整消息列表的 SHA-256；client 与 model 为本次生成使用的客户端与模型名称
+func (a *EinoAgent) responseCacheKey(client LLMClient, model string, prompt Prompt) string {
+	if a.config.Cache.Cache == nil {
+		return ""
+	}
+	var sampling *Sampling
+	if s, ok := client.(Sampler); ok {
+		v := s.Sampling()
+		sampling = &v
+	}
+	deterministic := sampling != nil && sampling.Temperature == 0
+	if !deterministic && !a.config.Cache.AnyTemperature {
+		return ""
+	}
+
+	data, err := json.Marshal(struct {
+		Provider string    `json:"provider"`
+		Model    string    `json:"model"`
+		Sampling *Sampling `json:"sampling"`
+		Messages []Message `json:"messages"`
+	}{a.config.ModelConfig.Provider, model, sampling, prompt.Messages()})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedResponse 查找缓存的回复，并在 span 上记录是否命中
+func (a *EinoAgent) cachedResponse(span trace.Span, key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	resp, ok := a.config.Cache.Cache.Get(key)
+	span.SetAttributes(attribute.Bool("llm.cache_hit", ok))
+	return resp, ok
+}
+
+// streamCached 在缓存未命中时转发流式生成的数据块，生成成功后保存完整回复
+// 与客户端一致，结束时关闭 responseChan
+func (a *EinoAgent) streamCached(ctx context.Context, key string, responseChan chan<- string, generate func(chan<- string) error) error {
+	chunks := make(chan string, 100)
+	done := make(chan string)
+	go func() {
+		defer close(responseChan)
+		var full []byte
+		for chunk := range chunks {
+			full = append(full, chunk...)
+			responseChan <- chunk
+		}
+		done <- string(full)
+	}()
+	err := generate(chunks)
+	full := <-done
+	if err == nil && ctx.Err() == nil && full != "" {
+		a.config.Cache.Cache.Put(key, full)
+	}
+	return err
+}
@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"testing"
+)
+
+// samplingLLM 报告固定温度的 fakeLLM
+type samplingLLM struct {
+	*fakeLLM
+	temperature float64
+}
+
+func (s *samplingLLM) Sampling() Sampling {
+	return Sampling{Temperature: s.temperature}
+}
+
+func TestResponseCacheSkipsBackendForIdenticalDeterministicPrompt(t *testing.T) {
+	ctx := context.Background()
+	llm := &samplingLLM{fakeLLM: newFakeLLM("第一次", "第二次")}
+	config := Config{Cache: CacheConfig{Cache: NewLRUResponseCache(8)}}
+
+	// 两个新会话的提示词完全相同：系统提示词加同一条用户消息
+	first := newTestAgent(t, config, llm, nil)
+	if resp, err := first.Process(ctx, "你好"); err != nil || resp != "第一次" {
+		t.Fatalf("首次生成 = %q, %v", resp, err)
+	}
+	second := newTestAgent(t, config, llm, nil)
+	if resp, err := second.Process(ctx, "你好"); err != nil || resp != "第一次" {
+		t.Fatalf("相同提示词应返回缓存的回复，实际 %q, %v", resp, err)
+	}
+	if llm.calls() != 1 {
+		t.Errorf("命中缓存时不应调用模型，实际调用 %d 次", llm.calls())
+	}
+
+	// 流式生成同样命中缓存
+	r := runStream(ctx, newTestAgent(t, config, llm, nil), "你好")
+	if r.err != nil || r.text() != "第一次" || llm.calls() != 1 {
+		t.Errorf("流式生成应命中缓存: %q, %v, 调用 %d 次", r.text(), r.err, llm.calls())
+	}
+
+	// 提示词不同时调用模型
+	if resp, _ := newTestAgent(t, config, llm, nil).Process(ctx, "再见"); resp != "第二次" || llm.calls() != 2 {
+		t.Errorf("不同提示词应调用模型: %q, 调用 %d 次", resp, llm.calls())
+	}
+
+	// 清空后重新调用模型
+	first.ClearResponseCache()
+	if n := config.Cache.Cache.Len(); n != 0 {
+		t.Fatalf("清空后仍有 %d 条缓存", n)
+	}
+	newTestAgent(t, config, llm, nil).Process(ctx, "你好")
+	if llm.calls() != 3 {
+		t.Errorf("清空缓存后应调用模型，实际调用 %d 次", llm.calls())
+	}
+}
+
+func TestResponseCacheStoresStreamedResponse(t *testing.T) {
+	ctx := context.Background()
+	llm := &samplingLLM{fakeLLM: newFakeLLM("流式回复", "不应出现")}
+	llm.chunkSize = 2
+	config := Config{Cache: CacheConfig{Cache: NewLRUResponseCache(8)}}
+
+	if r := runStream(ctx, newTestAgent(t, config, llm, nil), "你好"); r.err != nil || r.text() != "流式回复" {
+		t.Fatalf("流式生成 = %q, %v", r.text(), r.err)
+	}
+	if resp, err := newTestAgent(t, config, llm, nil).Process(ctx, "你好"); err != nil || resp != "流式回复" || llm.calls() != 1 {
+		t.Errorf("流式生成的完整回复应写入缓存: %q, %v, 调用 %d 次", resp, err, llm.calls())
+	}
+}
+
+func TestResponseCacheRespectsTemperature(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		name           string
+		llm            LLMClient
+		anyTemperature bool
+		wantCalls      int
+	}{
+		{"温度不为 0 时默认不缓存", &samplingLLM{fakeLLM: newFakeLLM("a", "b"), temperature: 0.7}, false, 2},
+		{"未报告采样参数时默认不缓存", newFakeLLM("a", "b"), false, 2},
+		{"AnyTemperature 时缓存", &samplingLLM{fakeLLM: newFakeLLM("a", "b"), temperature: 0.7}, true, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := Config{Cache: CacheConfig{Cache: NewLRUResponseCache(8), AnyTemperature: tc.anyTemperature}}
+			for i := 0; i < 2; i++ {
+				if _, err := newTestAgent(t, config, tc.llm, nil).Process(ctx, "你好"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var calls int
+			switch c := tc.llm.(type) {
+			case *samplingLLM:
+				calls = c.calls()
+			case *fakeLLM:
+				calls = c.calls()
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("调用模型 %d 次，期望 %d 次", calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestLRUResponseCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRUResponseCache(2)
+	c.Put("a", "1")
+	c.Put("b", "2")
+	c.Get("a")
+	c.Put("c", "3")
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("超过容量时应淘汰最久未使用的条目")
+	}
+	if v, ok := c.Get("a"); !ok || v != "1" {
+		t.Errorf("最近使用的条目应保留，实际 %q, %v", v, ok)
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len = %d，期望 2", c.Len())
+	}
+}
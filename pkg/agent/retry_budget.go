@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultRetryBudget 默认的单轮重试等待预算
+const DefaultRetryBudget = 30 * time.Second
+
+// ErrRetryBudgetExhausted 本轮累计的重试等待时间已用完
+var ErrRetryBudgetExhausted = errors.New("本轮重试等待预算已用完")
+
+// RetryBudget 单轮对话内所有重试等待（模型加载等待、请求失败退避等）共享的时间预算
+// 各次生成的重试相互独立时，一轮对话可能累计等待数分钟；预算用完后不再等待，直接失败
+type RetryBudget struct {
+	mu        sync.Mutex
+	total     time.Duration
+	remaining time.Duration
+}
+
+// NewRetryBudget 创建总额为 total 的重试预算
+func NewRetryBudget(total time.Duration) *RetryBudget {
+	return &RetryBudget{total: total, remaining: total}
+}
+
+// Reserve 为一次重试预留 d 的等待时间；剩余预算不足时不扣减并返回 ErrRetryBudgetExhausted
+func (b *RetryBudget) Reserve(d time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d > b.remaining {
+		return fmt.Errorf("%w（总额 %s，剩余 %s，需要 %s）", ErrRetryBudgetExhausted, b.total, b.remaining, d)
+	}
+	b.remaining -= d
+	return nil
+}
+
+// Remaining 返回剩余的等待预算
+func (b *RetryBudget) Remaining() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.remaining
+}
+
+type retryBudgetKey struct{}
+
+// WithRetryBudget 将重试预算附加到上下文，LLM 客户端在重试等待前从中扣减
+func WithRetryBudget(ctx context.Context, b *RetryBudget) context.Context {
+	return context.WithValue(ctx, retryBudgetKey{}, b)
+}
+
+// RetryBudgetFromContext 返回上下文中的重试预算，未设置时返回 nil（不限制）
+func RetryBudgetFromContext(ctx context.Context) *RetryBudget {
+	b, _ := ctx.Value(retryBudgetKey{}).(*RetryBudget)
+	return b
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryBudgetReserve(t *testing.T) {
+	b := NewRetryBudget(100 * time.Millisecond)
+	if err := b.Reserve(60 * time.Millisecond); err != nil {
+		t.Fatalf("预算充足时预留失败: %v", err)
+	}
+	if err := b.Reserve(60 * time.Millisecond); !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Fatalf("预算不足时应返回 ErrRetryBudgetExhausted，实际 %v", err)
+	}
+	// 失败的预留不扣减，剩余预算仍可用于更短的等待
+	if got := b.Remaining(); got != 40*time.Millisecond {
+		t.Errorf("剩余预算 = %s，期望 40ms", got)
+	}
+	if err := b.Reserve(40 * time.Millisecond); err != nil {
+		t.Errorf("恰好用完剩余预算应成功: %v", err)
+	}
+}
+
+func TestTurnSharesOneRetryBudgetAcrossGenerations(t *testing.T) {
+	var budgets []*RetryBudget
+	llm := &scriptedLLM{
+		generate: func(ctx context.Context, prompt string) (string, error) {
+			budgets = append(budgets, RetryBudgetFromContext(ctx))
+			if len(budgets) == 1 {
+				return `{"tool":"echo","params":{}}`, nil
+			}
+			return "完成", nil
+		},
+	}
+	tm := newToolManager(t, &funcTool{name: "echo", fn: func(context.Context, map[string]interface{}) (interface{}, error) { return "ok", nil }})
+	a := newTestAgent(t, Config{RetryBudget: time.Second}, llm, tm)
+
+	if _, err := a.Process(context.Background(), "调用工具"); err != nil {
+		t.Fatalf("处理失败: %v", err)
+	}
+	if len(budgets) < 2 {
+		t.Fatalf("本轮应至少生成两次，实际 %d 次", len(budgets))
+	}
+	for i, b := range budgets {
+		if b == nil || b != budgets[0] {
+			t.Fatalf("第 %d 次生成的重试预算 = %p，期望本轮共享同一预算 %p", i+1, b, budgets[0])
+		}
+	}
+
+	budgets = nil
+	a.Process(context.Background(), "下一轮")
+	if len(budgets) == 0 || budgets[0] == nil || budgets[0].Remaining() != time.Second {
+		t.Error("每轮应创建新的重试预算")
+	}
+
+	// 未配置时不附加预算
+	budgets = nil
+	unlimited := newTestAgent(t, Config{}, llm, tm)
+	unlimited.Process(context.Background(), "调用工具")
+	if len(budgets) == 0 || budgets[0] != nil {
+		t.Error("RetryBudget<=0 时不应附加重试预算")
+	}
+}
@@ -0,0 +1,320 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"agentEino/pkg/memory"
+)
+
+// session 单个会话的对话状态：消息历史、会话专属的系统提示词与最近一轮的统计
+// 各会话的状态相互独立，不同会话的轮次可以并发执行；id 创建后不再修改
+type session struct {
+	id string
+
+	// 以下两个字段由 EinoAgent.mu 保护，用于释放空闲的会话
+	activeTurns int       // 进行中的轮次数，大于 0 时不会释放
+	lastUsed    time.Time // 最近一次访问或结束轮次的时间
+
+	mu               sync.Mutex
+	prompt           string              // 会话专属的系统提示词，为空时使用全局提示词
+	history          []Message           // 消息历史
+	lastSources      []map[string]string // 最近一次搜索的完整结果，作为引用来源
+	trimmedMessages  int                 // 本轮构建提示词时省略的最早历史消息数
+	usage            Usage               // 本轮 token 用量
+	genUsage         GenerationUsage     // 本轮非流式生成的字符数与模型返回的 token 数
+	knowledgeContext string              // 本轮自动注入的知识库片段
+	toolCalls        []ToolCallRecord    // 本轮的工具调用记录
+	citationMissing  bool                // 本轮回复在 verify 模式下缺少来源标注
+}
+
+// TurnStats 会话最近一轮的统计
+type TurnStats struct {
+	Usage           Usage
+	HistoryTrimmed  int                 // 构建提示词时省略的最早历史消息数
+	CitationMissing bool                // verify 模式下回复缺少来源标注
+	Sources         []map[string]string // 本轮搜索的完整结果
+	ToolCalls       []ToolCallRecord
+}
+
+// TurnReporter 可选接口：按会话ID返回该会话最近一轮的统计，多个会话并发时不会读到其他会话的结果
+type TurnReporter interface {
+	LastTurn(conversationID string) (TurnStats, bool)
+}
+
+// conversationIDKey 上下文中绑定的会话ID
+type conversationIDKey struct{}
+
+// sessionKey 上下文中本轮使用的会话状态
+type sessionKey struct{}
+
+// WithConversationID 返回绑定会话ID的上下文：Process、ProcessStream 等在该会话的历史上执行本轮，
+// 不切换 Agent 的当前会话，适合多个会话共用一个 Agent 的场景（如 Web 服务）
+func WithConversationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, conversationIDKey{}, id)
+}
+
+func newSession(id string) *session {
+	return &session{id: id, history: make([]Message, 0)}
+}
+
+// loadSession 从记忆加载会话的历史与系统提示词，记忆中没有该会话时返回空会话
+func (a *EinoAgent) loadSession(id string) *session {
+	s := newSession(id)
+	if a.memory == nil {
+		return s
+	}
+	convIface, err := a.memory.GetConversation(context.Background(), id)
+	if err != nil {
+		return s
+	}
+	conv, ok := convIface.(*memory.Conversation)
+	if !ok || conv == nil {
+		return s
+	}
+	s.prompt = conv.SystemPrompt
+	s.history = make([]Message, 0, len(conv.Messages))
+	for _, m := range conv.Messages {
+		role := m.Role
+		if role == memory.RoleTool {
+			// 工具结果在生成时以系统消息注入，恢复历史时保持一致
+			role = "system"
+		}
+		s.history = append(s.history, Message{Role: role, Content: m.Content})
+	}
+	return s
+}
+
+// sessionByID 返回会话ID对应的状态，未缓存时从记忆加载；读取记忆时不持有锁
+func (a *EinoAgent) sessionByID(id string) (*session, error) {
+	// 会话ID最终会用作记忆文件名，必须先校验格式
+	id, err := memory.NormalizeConversationID(id, a.config.MemoryConfig.ConversationIDPattern)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	a.evictIdleSessions(time.Now())
+	s := a.sessions[id]
+	if s != nil {
+		s.lastUsed = time.Now()
+	}
+	a.mu.Unlock()
+	if s != nil {
+		return s, nil
+	}
+
+	loaded := a.loadSession(id)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if s := a.sessions[id]; s != nil {
+		s.lastUsed = time.Now()
+		return s, nil
+	}
+	loaded.lastUsed = time.Now()
+	a.sessions[id] = loaded
+	return loaded, nil
+}
+
+// sessionSweepInterval 检查空闲会话的最小间隔
+const sessionSweepInterval = time.Minute
+
+// evictIdleSessions 释放空闲超过 SessionIdleTTL 的会话状态，当前会话与进行中的会话除外
+// 被释放的会话再次访问时由 sessionByID 从记忆重新加载；调用方需持有 a.mu
+func (a *EinoAgent) evictIdleSessions(now time.Time) {
+	if now.Sub(a.lastSweep) < sessionSweepInterval {
+		return
+	}
+	a.lastSweep = now
+	ttl := a.config.MemoryConfig.SessionIdleTTL
+	if ttl <= 0 {
+		ttl = DefaultSessionIdleTTL
+	}
+	for id, s := range a.sessions {
+		if s == a.current || s.activeTurns > 0 || now.Sub(s.lastUsed) < ttl {
+			continue
+		}
+		delete(a.sessions, id)
+	}
+}
+
+// currentSession 返回当前会话
+func (a *EinoAgent) currentSession() *session {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.current
+}
+
+// session 返回 ctx 所属轮次的会话，不在轮次中时返回当前会话
+func (a *EinoAgent) session(ctx context.Context) *session {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		return s
+	}
+	return a.currentSession()
+}
+
+// turnSession 返回本轮使用的会话：上下文通过 WithConversationID 绑定了会话时使用该会话，否则使用当前会话
+func (a *EinoAgent) turnSession(ctx context.Context) (*session, error) {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		return s, nil
+	}
+	if id, ok := ctx.Value(conversationIDKey{}).(string); ok && strings.TrimSpace(id) != "" {
+		return a.sessionByID(id)
+	}
+	return a.currentSession(), nil
+}
+
+// beginTurn 开始新一轮对话：确定本轮的会话（当前会话还没有ID时创建），重置本轮统计并将用户输入追加到消息历史
+// 返回绑定了该会话的上下文，本轮后续的生成与工具调用都记录到该会话
+func (a *EinoAgent) beginTurn(ctx context.Context, input string) (context.Context, *session, error) {
+	s, err := a.turnSession(ctx)
+	if err != nil {
+		return ctx, nil, err
+	}
+	a.mu.Lock()
+	if s.id == "" {
+		// 如果是第一次对话，创建对话ID
+		if a.current.id == "" {
+			a.current = newSession(fmt.Sprintf("conv_%d", time.Now().UnixNano()))
+			a.sessions[a.current.id] = a.current
+			fmt.Printf("创建新对话ID: %s\n", a.current.id)
+		}
+		s = a.current
+	}
+	s.activeTurns++
+	s.lastUsed = time.Now()
+	a.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 来源列表、历史裁剪数与用量只反映本轮
+	s.lastSources = nil
+	s.citationMissing = false
+	s.trimmedMessages = 0
+	s.usage = Usage{}
+	s.genUsage = GenerationUsage{}
+	s.toolCalls = nil
+	s.knowledgeContext = ""
+
+	s.history = append(s.history, Message{
+		Role:    "user",
+		Content: input,
+	})
+	return context.WithValue(ctx, sessionKey{}, s), s, nil
+}
+
+// endTurn 结束 beginTurn 开始的一轮，之后该会话空闲超过 SessionIdleTTL 时可被释放
+func (a *EinoAgent) endTurn(s *session) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s.activeTurns--
+	s.lastUsed = time.Now()
+}
+
+// appendHistory 将消息追加到消息历史
+func (s *session) appendHistory(msgs ...Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = append(s.history, msgs...)
+}
+
+// messages 返回消息历史的副本
+func (s *session) messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.history...)
+}
+
+// recordToolCall 记录本轮的一次工具调用
+func (s *session) recordToolCall(r ToolCallRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.toolCalls = append(s.toolCalls, r)
+}
+
+// setLastSources 保存本轮搜索的完整结果
+func (s *session) setLastSources(sources []map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSources = sources
+}
+
+// setKnowledgeContext 设置本轮自动注入的知识库片段
+func (s *session) setKnowledgeContext(knowledgeContext string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.knowledgeContext = knowledgeContext
+}
+
+// addUsage 累加本轮的 token 用量与生成用量
+func (s *session) addUsage(promptTokens, completionTokens int, gen GenerationUsage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage.PromptTokens += promptTokens
+	s.usage.CompletionTokens += completionTokens
+	s.genUsage.Add(gen)
+}
+
+// generationUsage 返回本轮非流式生成的用量
+func (s *session) generationUsage() GenerationUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.genUsage
+}
+
+// stats 返回最近一轮的统计
+func (s *session) stats() TurnStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return TurnStats{
+		Usage:           s.usage,
+		HistoryTrimmed:  s.trimmedMessages,
+		CitationMissing: s.citationMissing,
+		Sources:         s.lastSources,
+		ToolCalls:       append([]ToolCallRecord(nil), s.toolCalls...),
+	}
+}
+
+// LastTurn 返回指定会话最近一轮的统计，该会话还没有在本进程中执行过对话（或空闲后已被释放）时返回 false
+func (a *EinoAgent) LastTurn(conversationID string) (TurnStats, bool) {
+	a.mu.Lock()
+	s := a.sessions[conversationID]
+	a.mu.Unlock()
+	if s == nil {
+		return TurnStats{}, false
+	}
+	return s.stats(), true
+}
+
+// LastToolCalls 返回当前会话最近一轮的工具调用记录
+func (a *EinoAgent) LastToolCalls() []ToolCallRecord {
+	return a.currentSession().stats().ToolCalls
+}
+
+// LastUsage 返回当前会话最近一轮的 token 用量（估算值）
+func (a *EinoAgent) LastUsage() Usage {
+	return a.currentSession().stats().Usage
+}
+
+// HistoryTrimmed 返回当前会话最近一轮构建提示词时省略的最早历史消息数，0 表示未裁剪
+func (a *EinoAgent) HistoryTrimmed() int {
+	return a.currentSession().stats().HistoryTrimmed
+}
+
+// GetLastSources 返回当前会话最近一次搜索的完整结果列表
+func (a *EinoAgent) GetLastSources() []map[string]string {
+	return a.currentSession().stats().Sources
+}
+
+// conversationID 返回 ctx 所属会话的ID：本轮的会话或 WithConversationID 绑定的会话，否则为当前会话
+func (a *EinoAgent) conversationID(ctx context.Context) string {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		return s.id
+	}
+	if id, ok := ctx.Value(conversationIDKey{}).(string); ok && strings.TrimSpace(id) != "" {
+		return id
+	}
+	return a.GetConversationID()
+}
@@ -0,0 +1,195 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConversationsBoundByContextKeepSeparateHistories(t *testing.T) {
+	llm := newFakeLLM("好的")
+	a := newTestAgent(t, Config{}, llm, nil)
+	ctx := context.Background()
+	current := a.GetConversationID()
+
+	ids := map[string]string{}
+	for _, marker := range []string{"甲", "乙"} {
+		id, err := a.NewConversation(ctx, marker)
+		if err != nil {
+			t.Fatalf("创建会话失败: %v", err)
+		}
+		ids[marker] = id
+	}
+
+	const turns = 5
+	var wg sync.WaitGroup
+	for marker, id := range ids {
+		for i := 0; i < turns; i++ {
+			wg.Add(1)
+			go func(marker, id string, i int) {
+				defer wg.Done()
+				turnCtx := WithConversationID(ctx, id)
+				input := fmt.Sprintf("%s-%d", marker, i)
+				if i%2 == 0 {
+					if _, err := a.Process(turnCtx, input); err != nil {
+						t.Errorf("Process 失败: %v", err)
+					}
+				} else if r := runStream(turnCtx, a, input); r.err != nil {
+					t.Errorf("ProcessStream 失败: %v", r.err)
+				}
+			}(marker, id, i)
+		}
+	}
+	wg.Wait()
+
+	for _, p := range llm.prompts {
+		if strings.Contains(p, "甲-") && strings.Contains(p, "乙-") {
+			t.Fatalf("提示词混入了另一个会话的消息:\n%s", p)
+		}
+	}
+	for marker, id := range ids {
+		other := "乙-"
+		if marker == "乙" {
+			other = "甲-"
+		}
+		s, err := a.sessionByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		history := s.messages()
+		if len(history) != 2*turns {
+			t.Errorf("%s: 消息历史应有 %d 条，实际 %d 条", marker, 2*turns, len(history))
+		}
+		for _, m := range history {
+			if strings.Contains(m.Content, other) {
+				t.Errorf("%s: 消息历史混入了另一个会话的消息 %q", marker, m.Content)
+			}
+		}
+		stored, err := a.StoredConversation(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range stored.Messages {
+			if strings.Contains(m.Content, other) {
+				t.Errorf("%s: 记忆中混入了另一个会话的消息 %q", marker, m.Content)
+			}
+		}
+		if stats, ok := a.LastTurn(id); !ok || stats.Usage.PromptTokens == 0 {
+			t.Errorf("%s: LastTurn 应返回该会话最近一轮的用量，实际 %+v, %v", marker, stats, ok)
+		}
+	}
+	if got := a.GetConversationID(); got != current {
+		t.Errorf("通过上下文绑定会话不应切换当前会话，实际 %q，期望 %q", got, current)
+	}
+}
+
+func TestLastTurnUnknownConversation(t *testing.T) {
+	a := newTestAgent(t, Config{}, newFakeLLM("好的"), nil)
+	if _, ok := a.LastTurn("conv_missing"); ok {
+		t.Error("未执行过对话的会话不应返回统计")
+	}
+}
+
+func TestArchivedSessionIsEvictedAndReloaded(t *testing.T) {
+	llm := newFakeLLM("好的")
+	a := newTestAgent(t, Config{}, llm, nil)
+	ctx := context.Background()
+
+	id, err := a.NewConversation(ctx, "归档")
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	turnCtx := WithConversationID(ctx, id)
+	if _, err := a.Process(turnCtx, "第一轮问题"); err != nil {
+		t.Fatalf("Process 失败: %v", err)
+	}
+
+	if err := a.ArchiveConversation(ctx, id, true); err != nil {
+		t.Fatalf("归档失败: %v", err)
+	}
+	a.mu.Lock()
+	_, cached := a.sessions[id]
+	a.mu.Unlock()
+	if cached {
+		t.Fatal("归档后应释放缓存的会话状态")
+	}
+
+	// 再次访问时从记忆重新加载历史
+	if _, err := a.Process(turnCtx, "第二轮问题"); err != nil {
+		t.Fatalf("Process 失败: %v", err)
+	}
+	if prompt := llm.lastPrompt(); !strings.Contains(prompt, "第一轮问题") {
+		t.Errorf("重新加载的会话应包含归档前的历史:\n%s", prompt)
+	}
+
+	// 当前会话归档后仍保留
+	current := a.GetConversationID()
+	if err := a.ArchiveConversation(ctx, current, true); err != nil {
+		t.Fatalf("归档当前会话失败: %v", err)
+	}
+	a.mu.Lock()
+	_, cached = a.sessions[current]
+	a.mu.Unlock()
+	if !cached {
+		t.Error("当前会话不应被释放")
+	}
+}
+
+func TestIdleSessionIsEvictedAndReloaded(t *testing.T) {
+	llm := newFakeLLM("好的")
+	a := newTestAgent(t, Config{MemoryConfig: MemoryConfig{SessionIdleTTL: time.Minute}}, llm, nil)
+	ctx := context.Background()
+
+	idle, err := a.NewConversation(ctx, "空闲")
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	if _, err := a.Process(WithConversationID(ctx, idle), "空闲前的问题"); err != nil {
+		t.Fatalf("Process 失败: %v", err)
+	}
+	busy, err := a.sessionByID("conv_busy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.mu.Lock()
+	a.sessions[idle].lastUsed = time.Now().Add(-2 * time.Minute)
+	busy.lastUsed = time.Now().Add(-2 * time.Minute)
+	busy.activeTurns = 1 // 模拟进行中的轮次
+	a.current.lastUsed = time.Now().Add(-2 * time.Minute)
+	a.lastSweep = time.Time{}
+	a.evictIdleSessions(time.Now())
+	_, idleCached := a.sessions[idle]
+	_, busyCached := a.sessions["conv_busy"]
+	_, currentCached := a.sessions[a.current.id]
+	a.mu.Unlock()
+
+	if idleCached {
+		t.Error("空闲超过上限的会话应被释放")
+	}
+	if !busyCached || !currentCached {
+		t.Errorf("进行中的会话与当前会话不应被释放: busy=%v current=%v", busyCached, currentCached)
+	}
+
+	// 再次访问时从记忆重新加载历史
+	if _, err := a.Process(WithConversationID(ctx, idle), "空闲后的问题"); err != nil {
+		t.Fatalf("Process 失败: %v", err)
+	}
+	if prompt := llm.lastPrompt(); !strings.Contains(prompt, "空闲前的问题") {
+		t.Errorf("重新加载的会话应包含释放前的历史:\n%s", prompt)
+	}
+
+	// 轮次结束后不再计为进行中，流式轮次同样如此
+	if r := runStream(WithConversationID(ctx, idle), a, "流式问题"); r.err != nil {
+		t.Fatalf("ProcessStream 失败: %v", r.err)
+	}
+	a.mu.Lock()
+	active := a.sessions[idle].activeTurns
+	a.mu.Unlock()
+	if active != 0 {
+		t.Errorf("轮次结束后进行中的轮次数 = %d，期望 0", active)
+	}
+}
@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// StreamEventContent 回复正文片段的事件类型，其余类型均为思考事件（analyzing、tool_call、error 等）
+const StreamEventContent = "content"
+
+// StreamEvent 流式处理中的一条事件：回复正文片段或思考事件
+type StreamEvent struct {
+	Kind string `json:"kind"`
+	Data string `json:"data"`
+}
+
+// IsContent 判断事件是否为回复正文
+func (e StreamEvent) IsContent() bool {
+	return e.Kind == StreamEventContent
+}
+
+// String 按文本协议渲染事件：正文原样返回，思考事件渲染为 [THINKING:type:message]
+func (e StreamEvent) String() string {
+	if e.IsContent() {
+		return e.Data
+	}
+	return fmt.Sprintf("[THINKING:%s:%s]", e.Kind, e.Data)
+}
+
+// ParseStreamChunk 将文本协议的数据块还原为事件，供只实现 ProcessStream 的 Agent 使用
+func ParseStreamChunk(chunk string) StreamEvent {
+	if inner, ok := strings.CutPrefix(chunk, "[THINKING:"); ok && strings.HasSuffix(inner, "]") {
+		if kind, data, ok := strings.Cut(strings.TrimSuffix(inner, "]"), ":"); ok && kind != "" {
+			return StreamEvent{Kind: kind, Data: data}
+		}
+	}
+	return StreamEvent{Kind: StreamEventContent, Data: chunk}
+}
+
+// EventStreamer 可选接口：以类型化事件返回流式响应，调用方无需从正文中解析思考事件标记
+type EventStreamer interface {
+	ProcessStreamEvents(ctx context.Context, input string, events chan<- StreamEvent) error
+}
+
+// ProcessStream 处理用户输入并返回流式响应，思考事件以 [THINKING:type:message] 文本与正文共用同一通道
+// 结束时关闭 responseChan；需要区分正文与思考事件时使用 ProcessStreamEvents
+func (a *EinoAgent) ProcessStream(ctx context.Context, input string, responseChan chan<- string) error {
+	events := make(chan StreamEvent, 100)
+	go func() {
+		defer close(responseChan)
+		for event := range events {
+			responseChan <- event.String()
+		}
+	}()
+	return a.ProcessStreamEvents(ctx, input, events)
+}
@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestProcessStreamEventsSeparatesThinkingFromContent(t *testing.T) {
+	a := newTestAgent(t, Config{}, newFakeLLM("你好，这是回答。"), newToolManager(t))
+
+	events := make(chan StreamEvent, 100)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- a.ProcessStreamEvents(context.Background(), "你好", events)
+	}()
+	var content strings.Builder
+	var kinds []string
+	for e := range events {
+		if e.IsContent() {
+			content.WriteString(e.Data)
+			continue
+		}
+		if strings.HasPrefix(e.Data, "[THINKING:") {
+			t.Errorf("思考事件不应包含文本标记: %+v", e)
+		}
+		kinds = append(kinds, e.Kind)
+	}
+	if err := <-errChan; err != nil {
+		t.Fatal(err)
+	}
+	if content.String() != "你好，这是回答。" {
+		t.Errorf("正文 = %q", content.String())
+	}
+	if strings.Join(kinds, ",") != "analyzing,generating" {
+		t.Errorf("思考事件 = %v，期望 analyzing,generating", kinds)
+	}
+}
+
+func TestStreamEventTextProtocolRoundTrip(t *testing.T) {
+	for _, e := range []StreamEvent{
+		{Kind: StreamEventContent, Data: "普通正文"},
+		{Kind: "tool_call", Data: "准备调用工具: web_search"},
+		{Kind: "error", Data: "生成失败: 连接被拒绝: a:b"},
+	} {
+		if got := ParseStreamChunk(e.String()); got != e {
+			t.Errorf("ParseStreamChunk(%q) = %+v，期望 %+v", e.String(), got, e)
+		}
+	}
+	if got := ParseStreamChunk("[THINKING:]"); !got.IsContent() {
+		t.Errorf("格式不完整的标记应视为正文: %+v", got)
+	}
+}
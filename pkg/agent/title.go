@@ -0,0 +1,82 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxTitleChars 生成的会话标题的最大字符数，超出时截断
+const MaxTitleChars = 30
+
+// titleMessageChars 生成标题时每条消息最多使用的字符数，避免长回答占满提示词
+const titleMessageChars = 500
+
+// titlePromptTemplate 生成会话标题的提示词，%d 为标题字数上限，%s 为对话内容
+const titlePromptTemplate = `请为下面的对话生成一个简短的标题，同时概括用户的问题和得到的回答，不超过%d个字。
+只输出标题本身，不要加引号、前缀或句末标点。
+
+%s`
+
+// TitleGenerator 可选接口：根据会话最早的几条消息生成标题
+type TitleGenerator interface {
+	GenerateTitle(ctx context.Context, messages []Message) (string, error)
+}
+
+// GenerateTitle 用主模型概括 messages（通常是第一轮问答）生成会话标题，结果不超过 MaxTitleChars 个字符
+// 不写入任何会话的历史或用量；模型没有返回可用的标题时返回错误，调用方应回退到默认标题
+func (a *EinoAgent) GenerateTitle(ctx context.Context, messages []Message) (string, error) {
+	if a.llmClient == nil {
+		return "", fmt.Errorf("LLM客户端未初始化")
+	}
+	var sb strings.Builder
+	for _, m := range messages {
+		label := "用户"
+		if m.Role == "assistant" {
+			label = "助手"
+		}
+		content := strings.TrimSpace(m.Content)
+		if runes := []rune(content); len(runes) > titleMessageChars {
+			content = string(runes[:titleMessageChars]) + "..."
+		}
+		fmt.Fprintf(&sb, "%s: %s\n", label, content)
+	}
+	if sb.Len() == 0 {
+		return "", errors.New("没有可用于生成标题的消息")
+	}
+
+	ctx, cancel := a.withTurnTimeout(ctx)
+	defer cancel()
+	raw, err := a.llmClient.Generate(ctx, fmt.Sprintf(titlePromptTemplate, MaxTitleChars, sb.String()))
+	if err != nil {
+		return "", fmt.Errorf("生成标题失败: %w", err)
+	}
+	title := cleanTitle(raw)
+	if title == "" {
+		return "", errors.New("模型未返回标题")
+	}
+	return title, nil
+}
+
+// cleanTitle 取模型输出的第一行非空内容，去掉“标题：”前缀、引号与句末标点，并截断到 MaxTitleChars 个字符
+func cleanTitle(raw string) string {
+	var title string
+	for _, line := range strings.Split(raw, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			title = line
+			break
+		}
+	}
+	for _, prefix := range []string{"标题：", "标题:", "Title:"} {
+		title = strings.TrimSpace(strings.TrimPrefix(title, prefix))
+	}
+	// 左侧同时去掉 Markdown 标题符号，右侧保留 #（如 C#）
+	const quotes = "\"'“”‘’「」《》* "
+	title = strings.TrimLeft(title, quotes+"#")
+	title = strings.TrimRight(title, quotes+"。.！!？?")
+	if runes := []rune(title); len(runes) > MaxTitleChars {
+		title = string(runes[:MaxTitleChars])
+	}
+	return title
+}
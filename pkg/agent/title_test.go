@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestGenerateTitleUsesQuestionAndAnswer(t *testing.T) {
+	llm := newFakeLLM("标题：“Go 切片扩容规则”。\n多余的解释")
+	a := newTestAgent(t, Config{}, llm, nil)
+	history := a.currentSession().messages()
+
+	title, err := a.GenerateTitle(context.Background(), []Message{
+		{Role: "user", Content: "append 之后为什么容量变了"},
+		{Role: "assistant", Content: "切片容量不足时 append 会按扩容规则分配新数组"},
+	})
+	if err != nil {
+		t.Fatalf("GenerateTitle 失败: %v", err)
+	}
+	if title != "Go 切片扩容规则" {
+		t.Errorf("标题 = %q，期望去掉前缀、引号与句末标点", title)
+	}
+	prompt := llm.lastPrompt()
+	if !strings.Contains(prompt, "append 之后为什么容量变了") || !strings.Contains(prompt, "按扩容规则分配新数组") {
+		t.Errorf("提示词应同时包含问题与回答:\n%s", prompt)
+	}
+	if got := a.currentSession().messages(); len(got) != len(history) {
+		t.Errorf("生成标题不应写入消息历史，实际 %d 条", len(got))
+	}
+}
+
+func TestGenerateTitleCapsLengthAndRejectsEmpty(t *testing.T) {
+	a := newTestAgent(t, Config{}, newFakeLLM(strings.Repeat("长", 50)), nil)
+	title, err := a.GenerateTitle(context.Background(), []Message{{Role: "user", Content: "你好"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len([]rune(title)); n != MaxTitleChars {
+		t.Errorf("标题应截断到 %d 个字符，实际 %d", MaxTitleChars, n)
+	}
+
+	a = newTestAgent(t, Config{}, newFakeLLM("  \n "), nil)
+	if _, err := a.GenerateTitle(context.Background(), []Message{{Role: "user", Content: "你好"}}); err == nil {
+		t.Error("模型未返回标题时应返回错误")
+	}
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"context"
+)
+
+// ToolDecisionNone 第一轮生成未请求工具时 ToolDecision.Tool 的取值
+const ToolDecisionNone = "none"
+
+// DecidedToolCall 工具决策中解析出的一个工具调用
+type DecidedToolCall struct {
+	Name   string                 `json:"name"`
+	Params map[string]interface{} `json:"params"`
+}
+
+// ToolDecision 第一轮生成的工具决策：原始文本与按当前解析规则得到的工具调用
+type ToolDecision struct {
+	Input    string `json:"input"`
+	Decision string `json:"decision"` // 第一轮生成的原始文本，原生函数调用时为模型返回的正文
+	// Tool 解析出的第一个工具名，未调用工具时为 ToolDecisionNone
+	Tool      string            `json:"tool"`
+	ToolCalls []DecidedToolCall `json:"tool_calls,omitempty"`
+	Native    bool              `json:"native"` // 工具调用来自原生函数调用而非文本解析
+}
+
+// ToolDecisionExplainer 可选接口：只运行第一轮生成并返回工具决策，用于排查工具为何被调用或未被调用
+type ToolDecisionExplainer interface {
+	ExplainToolDecision(ctx context.Context, input string) (*ToolDecision, error)
+}
+
+// ExplainToolDecision 以本轮会话（见 WithConversationID，未绑定时为当前会话）的历史加上 input 构建提示词，只运行第一轮生成并解析工具调用
+// 不执行工具、不写入消息历史或记忆；本轮用量在返回前恢复
+func (a *EinoAgent) ExplainToolDecision(ctx context.Context, input string) (*ToolDecision, error) {
+	if err := a.rejectLongInput(ctx, input); err != nil {
+		return nil, err
+	}
+	sess, err := a.turnSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, sessionKey{}, sess)
+	ctx, cancel := a.withTurnTimeout(ctx)
+	defer cancel()
+
+	knowledgeContext := a.knowledgeContextFor(ctx, sess.id, input)
+	sess.mu.Lock()
+	// 追加到副本，避免写入原历史的底层数组
+	history := sess.history[:len(sess.history):len(sess.history)]
+	prompt, _ := a.promptFrom(sess, append(history, Message{Role: "user", Content: input}), knowledgeContext)
+	usage, genUsage := sess.usage, sess.genUsage
+	sess.mu.Unlock()
+	defer func() {
+		sess.mu.Lock()
+		sess.usage, sess.genUsage = usage, genUsage
+		sess.mu.Unlock()
+	}()
+
+	response, calls, err := a.decide(a.decisionContext(ctx), prompt)
+	if err != nil {
+		return nil, a.turnError(ctx, "生成响应失败", err)
+	}
+
+	decision := &ToolDecision{
+		Input:    input,
+		Decision: response,
+		Tool:     ToolDecisionNone,
+		Native:   len(calls) > 0,
+	}
+	for _, c := range a.resolveToolCalls(response, calls) {
+		decision.ToolCalls = append(decision.ToolCalls, DecidedToolCall{Name: c.Name, Params: c.Params})
+	}
+	if len(decision.ToolCalls) > 0 {
+		decision.Tool = decision.ToolCalls[0].Name
+	}
+	return decision, nil
+}
@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"context"
+	"testing"
+)
+
+func TestExplainToolDecision(t *testing.T) {
+	executed := 0
+	search := &funcTool{name: "web_search", fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		executed++
+		return "结果", nil
+	}}
+	llm := newFakeLLM(`{"tool":"web_search","params":{"query":"go"}}`, "我可以直接回答")
+	a := newTestAgent(t, Config{}, llm, newToolManager(t, search))
+
+	d, err := a.ExplainToolDecision(context.Background(), "搜索 go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Decision != `{"tool":"web_search","params":{"query":"go"}}` || d.Tool != "web_search" || d.Native {
+		t.Errorf("工具决策 = %+v", d)
+	}
+	if len(d.ToolCalls) != 1 || d.ToolCalls[0].Params["query"] != "go" {
+		t.Errorf("应解析出工具参数，实际 %+v", d.ToolCalls)
+	}
+	if executed != 0 {
+		t.Errorf("只解析工具决策，不应执行工具，实际执行 %d 次", executed)
+	}
+
+	d, err = a.ExplainToolDecision(context.Background(), "你好")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Tool != ToolDecisionNone || len(d.ToolCalls) != 0 || d.Decision != "我可以直接回答" {
+		t.Errorf("未调用工具时应返回 none，实际 %+v", d)
+	}
+	if llm.calls() != 2 {
+		t.Errorf("每次只应运行第一轮生成，实际调用模型 %d 次", llm.calls())
+	}
+	if len(a.currentSession().messages()) != 0 {
+		t.Errorf("不应写入消息历史，实际 %d 条", len(a.currentSession().messages()))
+	}
+	if conv, err := a.StoredConversation(context.Background(), a.GetConversationID()); err == nil && len(conv.Messages) != 0 {
+		t.Errorf("不应写入记忆，实际 %d 条消息", len(conv.Messages))
+	}
+}
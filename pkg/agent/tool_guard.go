@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"context"
+
+	"agentEino/pkg/logger"
+)
+
+// 工具结果守卫，控制注入工具结果后的下一轮提示词缺少这些结果时的处理方式
+const (
+	// ToolResultGuardRepair 将缺失的工具结果补在提示词末尾并记录警告（默认）
+	ToolResultGuardRepair = "repair"
+	// ToolResultGuardStrict 缺失时返回 ErrToolResultMissing，不基于缺少工具结果的提示词生成回答
+	ToolResultGuardStrict = "strict"
+	// ToolResultGuardOff 不检查
+	ToolResultGuardOff = "off"
+)
+
+// guardToolResults 确认本轮注入的工具结果 outputs 都出现在即将用于生成的 prompt 中
+// 历史窗口按 token 预算裁剪时可能只保留最新一条消息，同一轮的多个工具结果会被省略，
+// 此时按 ToolResultGuard 补齐或返回错误，避免模型在没有看到工具结果的情况下作答
+func (a *EinoAgent) guardToolResults(ctx context.Context, sess *session, prompt Prompt, outputs []string) (Prompt, error) {
+	mode := a.config.Behavior.ToolResultGuard
+	if mode == "" {
+		mode = ToolResultGuardRepair
+	}
+	if mode == ToolResultGuardOff || len(outputs) == 0 {
+		return prompt, nil
+	}
+	missing := missingToolResults(prompt, outputs)
+	if len(missing) == 0 {
+		return prompt, nil
+	}
+	logger.FromContext(ctx).Warn("工具结果未进入下一轮提示词", map[string]interface{}{
+		"conversation_id": sess.id,
+		"missing":         len(missing),
+		"outputs":         len(outputs),
+		"mode":            mode,
+	})
+	if mode == ToolResultGuardStrict {
+		return nil, ErrToolResultMissing
+	}
+	repaired := make(Prompt, 0, len(prompt)+len(missing))
+	repaired = append(repaired, prompt...)
+	for _, output := range missing {
+		repaired = append(repaired, Message{Role: "system", Content: output})
+	}
+	return repaired, nil
+}
+
+// missingToolResults 从 prompt 末尾向前按顺序匹配 outputs 中的系统消息，返回未匹配到的部分（保持原顺序）
+// 从末尾匹配可避免误用历史中内容相同的旧工具结果
+func missingToolResults(prompt Prompt, outputs []string) []string {
+	j := len(outputs) - 1
+	for i := len(prompt) - 1; i >= 0 && j >= 0; i-- {
+		if prompt[i].Role == "system" && prompt[i].Content == outputs[j] {
+			j--
+		}
+	}
+	return outputs[:j+1]
+}
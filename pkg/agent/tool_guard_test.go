@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// constTool 返回固定结果的测试工具
+func constTool(name, result string) *funcTool {
+	return &funcTool{name: name, fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return result, nil
+	}}
+}
+
+func TestFinalStreamPromptContainsToolOutput(t *testing.T) {
+	llm := newFakeLLM(`{"tool":"lookup","params":{}}`, "根据查询结果回答")
+	a := newTestAgent(t, Config{}, llm, newToolManager(t, constTool("lookup", "LOOKUP-RESULT-42")))
+
+	r := runStream(context.Background(), a, "查一下")
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if llm.calls() != 2 {
+		t.Fatalf("应先决策再生成最终回答，实际调用 %d 次", llm.calls())
+	}
+	if !strings.Contains(llm.lastPrompt(), "LOOKUP-RESULT-42") {
+		t.Errorf("最终回答的提示词应包含工具结果:\n%s", llm.lastPrompt())
+	}
+	if r.text() != "根据查询结果回答" {
+		t.Errorf("回复 = %q", r.text())
+	}
+}
+
+// tightHistory 历史窗口的 token 预算只够保留最新一条消息
+var tightHistory = HistoryConfig{MaxTokens: 1, EstimateTokens: func(text string) int { return len(text) }}
+
+func TestToolResultGuardRestoresTrimmedResults(t *testing.T) {
+	batch := `[{"tool":"first","params":{}},{"tool":"second","params":{}}]`
+	tm := newToolManager(t, constTool("first", "FIRST-RESULT"), constTool("second", "SECOND-RESULT"))
+
+	for _, mode := range []string{"", ToolResultGuardRepair} {
+		llm := newFakeLLM(batch, "两个结果都看到了")
+		a := newTestAgent(t, Config{History: tightHistory, Behavior: BehaviorConfig{ToolResultGuard: mode}}, llm, tm)
+
+		r := runStream(context.Background(), a, "同时查两项")
+		if r.err != nil {
+			t.Fatalf("mode=%q: %v", mode, r.err)
+		}
+		prompt := llm.lastPrompt()
+		if !strings.Contains(prompt, "FIRST-RESULT") || !strings.Contains(prompt, "SECOND-RESULT") {
+			t.Errorf("mode=%q: 历史被裁剪后最终提示词仍应包含全部工具结果:\n%s", mode, prompt)
+		}
+	}
+
+	// off：不检查，裁剪掉的结果不会补回（用于确认上面的场景确实发生了裁剪）
+	llm := newFakeLLM(batch, "只看到一个")
+	a := newTestAgent(t, Config{History: tightHistory, Behavior: BehaviorConfig{ToolResultGuard: ToolResultGuardOff}}, llm, tm)
+	if r := runStream(context.Background(), a, "同时查两项"); r.err != nil {
+		t.Fatal(r.err)
+	}
+	if strings.Contains(llm.lastPrompt(), "FIRST-RESULT") {
+		t.Error("off 模式下不应补回被裁剪的工具结果")
+	}
+}
+
+func TestToolResultGuardStrictRefusesToAnswer(t *testing.T) {
+	batch := `[{"tool":"first","params":{}},{"tool":"second","params":{}}]`
+	llm := newFakeLLM(batch, "不应生成")
+	tm := newToolManager(t, constTool("first", "FIRST-RESULT"), constTool("second", "SECOND-RESULT"))
+	a := newTestAgent(t, Config{History: tightHistory, Behavior: BehaviorConfig{ToolResultGuard: ToolResultGuardStrict}}, llm, tm)
+
+	r := runStream(context.Background(), a, "同时查两项")
+	if !errors.Is(r.err, ErrToolResultMissing) {
+		t.Fatalf("strict 模式下应返回 ErrToolResultMissing，实际 %v", r.err)
+	}
+	if llm.calls() != 1 {
+		t.Errorf("缺少工具结果时不应生成回答，实际调用模型 %d 次", llm.calls())
+	}
+}
+
+func TestMissingToolResults(t *testing.T) {
+	prompt := Prompt{
+		{Role: "system", Content: "A"},
+		{Role: "user", Content: "问题"},
+		{Role: "system", Content: "B"},
+	}
+	if got := missingToolResults(prompt, []string{"A", "B"}); len(got) != 0 {
+		t.Errorf("全部存在时不应缺失，实际 %v", got)
+	}
+	// 历史中较早的同名结果不算作本轮结果
+	if got := missingToolResults(prompt, []string{"B", "A"}); len(got) != 1 || got[0] != "B" {
+		t.Errorf("缺失 = %v，期望 [B]", got)
+	}
+	if got := missingToolResults(prompt, []string{"问题"}); len(got) != 1 {
+		t.Errorf("非系统消息不应视为工具结果，实际缺失 %v", got)
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"agentEino/pkg/agent"
+	"agentEino/pkg/logger"
+)
+
+// handleToolDecision 只运行第一轮生成，返回原始决策文本与解析出的工具调用
+// 不执行工具，也不写入会话；指定 conversation_id 时使用该会话的历史
+func (s *Server) handleToolDecision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	explainer, ok := s.agent.(agent.ToolDecisionExplainer)
+	if !ok {
+		http.Error(w, "Tool decision not supported", http.StatusNotImplemented)
+		return
+	}
+
+	var req ChatRequest
+	if !s.decodeChatRequest(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		http.Error(w, "message is required", http.StatusBadRequest)
+		return
+	}
+	if s.rejectLongInput(w, r, req.Message) {
+		return
+	}
+
+	var agentConvID string
+	s.mu.Lock()
+	if req.ConversationID != "" {
+		if _, exists := s.conversations[req.ConversationID]; !exists {
+			s.mu.Unlock()
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return
+		}
+		agentConvID = s.agentConvMap[req.ConversationID]
+	}
+	s.mu.Unlock()
+
+	decision, err := explainer.ExplainToolDecision(withAgentConversation(r.Context(), agentConvID), req.Message)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("生成工具决策失败", map[string]interface{}{"error": err.Error()})
+		http.Error(w, "Failed to generate tool decision", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(decision)
+}
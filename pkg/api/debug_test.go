@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"agentEino/pkg/agent"
+)
+
+// decisionAgent 根据输入返回预设的工具决策
+type decisionAgent struct {
+	*stubAgent
+	inputs []string
+}
+
+func (a *decisionAgent) ExplainToolDecision(ctx context.Context, input string) (*agent.ToolDecision, error) {
+	a.inputs = append(a.inputs, input)
+	if strings.Contains(input, "天气") {
+		return &agent.ToolDecision{
+			Input:     input,
+			Decision:  `{"tool":"weather","params":{"city":"北京"}}`,
+			Tool:      "weather",
+			ToolCalls: []agent.DecidedToolCall{{Name: "weather", Params: map[string]interface{}{"city": "北京"}}},
+		}, nil
+	}
+	return &agent.ToolDecision{Input: input, Decision: "你好！", Tool: agent.ToolDecisionNone}, nil
+}
+
+func TestToolDecisionEndpoint(t *testing.T) {
+	da := &decisionAgent{stubAgent: &stubAgent{}}
+	s := NewServer(da)
+
+	decide := func(body string) (*httptest.ResponseRecorder, agent.ToolDecision) {
+		w := httptest.NewRecorder()
+		s.handleToolDecision(w, httptest.NewRequest(http.MethodPost, "/api/debug/tool-decision", strings.NewReader(body)))
+		var d agent.ToolDecision
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&d); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w, d
+	}
+
+	w, d := decide(`{"message":"北京天气怎么样"}`)
+	if w.Code != http.StatusOK || d.Tool != "weather" || len(d.ToolCalls) != 1 || d.ToolCalls[0].Params["city"] != "北京" {
+		t.Errorf("调用工具的决策: %d %+v", w.Code, d)
+	}
+	if !strings.Contains(d.Decision, `"tool":"weather"`) {
+		t.Errorf("应返回原始决策文本，实际 %q", d.Decision)
+	}
+
+	w, d = decide(`{"message":"你好"}`)
+	if w.Code != http.StatusOK || d.Tool != agent.ToolDecisionNone || len(d.ToolCalls) != 0 || d.Decision != "你好！" {
+		t.Errorf("不调用工具的决策: %d %+v", w.Code, d)
+	}
+	if len(s.conversations) != 0 {
+		t.Errorf("不应创建会话，实际 %d 个", len(s.conversations))
+	}
+
+	for _, c := range []struct {
+		body string
+		want int
+	}{
+		{`{"message":"  "}`, http.StatusBadRequest},
+		{`{"message":"你好","conversation_id":"missing"}`, http.StatusNotFound},
+	} {
+		if w, _ := decide(c.body); w.Code != c.want {
+			t.Errorf("%s 状态码 = %d，期望 %d", c.body, w.Code, c.want)
+		}
+	}
+	if len(da.inputs) != 2 {
+		t.Errorf("无效请求不应生成决策，实际生成 %d 次", len(da.inputs))
+	}
+
+	w = httptest.NewRecorder()
+	s.handleToolDecision(w, httptest.NewRequest(http.MethodGet, "/api/debug/tool-decision", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET 状态码 = %d，期望 405", w.Code)
+	}
+	w = httptest.NewRecorder()
+	NewServer(&stubAgent{}).handleToolDecision(w, httptest.NewRequest(http.MethodPost, "/api/debug/tool-decision", strings.NewReader(`{"message":"你好"}`)))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("不支持的 Agent 状态码 = %d，期望 501", w.Code)
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"agentEino/pkg/agent"
+	"agentEino/pkg/logger"
+)
+
+// markdownTimeLayout 导出 Markdown 中时间戳的格式
+const markdownTimeLayout = "2006-01-02 15:04:05"
+
+// markdownRoleTitles 各角色在导出 Markdown 中的标题
+var markdownRoleTitles = map[string]string{
+	"user":      "用户",
+	"assistant": "助手",
+	"system":    "系统",
+	"tool":      "工具",
+}
+
+// handleExportMarkdown 将会话导出为 Markdown 文本
+// 默认只包含用户与助手消息，include_internal=true 时一并导出系统与工具消息
+func (s *Server) handleExportMarkdown(w http.ResponseWriter, r *http.Request, convID string) {
+	includeInternal := false
+	if v := r.URL.Query().Get("include_internal"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Invalid include_internal", http.StatusBadRequest)
+			return
+		}
+		includeInternal = b
+	}
+
+	s.mu.Lock()
+	conv, exists := s.conversations[convID]
+	var stored *agent.StoredConversation
+	if exists {
+		stored = s.transcript(r, conv)
+	}
+	s.mu.Unlock()
+	if !exists {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", convID+".md"))
+	w.Write([]byte(renderMarkdown(stored, includeInternal)))
+}
+
+// transcript 返回用于导出的会话记录，调用方需持有 s.mu
+// 会话拥有独立的记忆会话时使用记忆层数据（含时间戳与内部消息），否则使用页面上的消息
+func (s *Server) transcript(r *http.Request, conv *Conversation) *agent.StoredConversation {
+	if store, ok := s.agent.(conversationStore); ok && s.agentConvMap[conv.ID] == conv.ID {
+		stored, err := store.StoredConversation(r.Context(), conv.ID)
+		if err == nil {
+			if stored.Title == "" {
+				stored.Title = conv.Title
+			}
+			return stored
+		}
+		logger.FromContext(r.Context()).Warn("读取记忆会话失败，使用页面会话导出", map[string]interface{}{"conversation_id": conv.ID, "error": err.Error()})
+	}
+
+	stored := &agent.StoredConversation{
+		ID:        conv.ID,
+		Title:     conv.Title,
+		Messages:  make([]agent.StoredMessage, 0, len(conv.Messages)),
+		CreatedAt: time.Unix(0, conv.CreatedAt),
+	}
+	for _, m := range conv.Messages {
+		stored.Messages = append(stored.Messages, agent.StoredMessage{Role: m.Role, Content: m.Content})
+	}
+	return stored
+}
+
+// renderMarkdown 将会话渲染为 Markdown：每条消息一个角色标题（带时间戳），系统与工具消息放在代码块中
+func renderMarkdown(conv *agent.StoredConversation, includeInternal bool) string {
+	var b strings.Builder
+
+	title := conv.Title
+	if title == "" {
+		title = "新对话"
+		for _, m := range conv.Messages {
+			if m.Role == "user" {
+				title = m.Content
+				break
+			}
+		}
+	}
+	fmt.Fprintf(&b, "# %s\n\n", strings.TrimSpace(strings.ReplaceAll(title, "\n", " ")))
+	fmt.Fprintf(&b, "- 会话ID: `%s`\n", conv.ID)
+	if !conv.CreatedAt.IsZero() {
+		fmt.Fprintf(&b, "- 创建时间: %s\n", conv.CreatedAt.Format(markdownTimeLayout))
+	}
+
+	for _, m := range conv.Messages {
+		internal := m.Role != "user" && m.Role != "assistant"
+		if internal && !includeInternal {
+			continue
+		}
+
+		heading, ok := markdownRoleTitles[m.Role]
+		if !ok {
+			heading = m.Role
+		}
+		if !m.Timestamp.IsZero() {
+			heading += " · " + m.Timestamp.Format(markdownTimeLayout)
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n", heading)
+
+		content := strings.TrimRight(m.Content, "\n")
+		if internal {
+			fence := codeFence(content)
+			fmt.Fprintf(&b, "%s\n%s\n%s\n", fence, content, fence)
+		} else {
+			b.WriteString(content + "\n")
+		}
+		if m.Partial {
+			b.WriteString("\n_（回复未完成）_\n")
+		}
+	}
+	return b.String()
+}
+
+// codeFence 返回比内容中最长的连续反引号更长的代码块围栏，避免内容提前结束代码块
+func codeFence(content string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
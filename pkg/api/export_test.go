@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"agentEino/pkg/agent"
+)
+
+func TestRenderMarkdownRoleSections(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	conv := &agent.StoredConversation{
+		ID:        "conv_1",
+		Title:     "天气查询",
+		CreatedAt: at,
+		Messages: []agent.StoredMessage{
+			{Role: "user", Content: "北京天气怎么样", Timestamp: at},
+			{Role: "tool", Content: "工具(weather)输出: 晴，25度", Timestamp: at.Add(time.Second)},
+			{Role: "system", Content: "内部说明"},
+			{Role: "assistant", Content: "北京今天晴，25度", Timestamp: at.Add(2 * time.Second)},
+			{Role: "assistant", Content: "写到一半", Partial: true},
+		},
+	}
+
+	md := renderMarkdown(conv, false)
+	for _, want := range []string{
+		"# 天气查询\n",
+		"- 会话ID: `conv_1`\n",
+		"\n## 用户 · 2024-05-01 10:30:00\n\n北京天气怎么样\n",
+		"\n## 助手 · 2024-05-01 10:30:02\n\n北京今天晴，25度\n",
+		"\n## 助手\n\n写到一半\n\n_（回复未完成）_\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("默认导出缺少 %q:\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, "## 工具") || strings.Contains(md, "## 系统") {
+		t.Errorf("默认导出不应包含内部消息:\n%s", md)
+	}
+
+	md = renderMarkdown(conv, true)
+	for _, want := range []string{
+		"\n## 工具 · 2024-05-01 10:30:01\n\n```\n工具(weather)输出: 晴，25度\n```\n",
+		"\n## 系统\n\n```\n内部说明\n```\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("include_internal 导出缺少 %q:\n%s", want, md)
+		}
+	}
+	if strings.Index(md, "## 用户") > strings.Index(md, "## 工具") || strings.Index(md, "## 工具") > strings.Index(md, "## 助手") {
+		t.Errorf("消息应按对话顺序导出:\n%s", md)
+	}
+}
+
+func TestCodeFenceOutlastsBackticksInContent(t *testing.T) {
+	if got := codeFence("普通输出"); got != "```" {
+		t.Errorf("codeFence = %q，期望 ```", got)
+	}
+	if got := codeFence("含有 ```go 代码块"); got != "````" {
+		t.Errorf("codeFence = %q，期望比内容中的反引号更长", got)
+	}
+}
+
+func TestExportMarkdownEndpoint(t *testing.T) {
+	s := NewServer(nil)
+	addTestConversation(s, "a", "你好", "你好！")
+
+	w := httptest.NewRecorder()
+	s.handleExportMarkdown(w, httptest.NewRequest(http.MethodGet, "/api/conversations/a/export.md", nil), "a")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/markdown") {
+		t.Fatalf("状态码 = %d，Content-Type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if body := w.Body.String(); !strings.Contains(body, "## 用户\n\n你好\n") || !strings.Contains(body, "## 助手\n\n你好！\n") {
+		t.Errorf("导出内容缺少角色段落:\n%s", body)
+	}
+
+	for query, code := range map[string]int{"": http.StatusNotFound, "?include_internal=maybe": http.StatusBadRequest} {
+		id := "a"
+		if query == "" {
+			id = "missing"
+		}
+		w := httptest.NewRecorder()
+		s.handleExportMarkdown(w, httptest.NewRequest(http.MethodGet, "/api/conversations/"+id+"/export.md"+query, nil), id)
+		if w.Code != code {
+			t.Errorf("%s%s: 状态码 = %d，期望 %d", id, query, w.Code, code)
+		}
+	}
+}
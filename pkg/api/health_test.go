@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"agentEino/pkg/agent"
+)
+
+// healthAgent 返回预设的LLM连通性并记录检查次数
+type healthAgent struct {
+	*stubAgent
+	health agent.LLMHealth
+	checks int
+}
+
+func (a *healthAgent) CheckLLMHealth(ctx context.Context) agent.LLMHealth {
+	a.checks++
+	return a.health
+}
+
+func getHealth(t *testing.T, s *Server) map[string]interface{} {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.handleHealth(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("/health 状态码 = %d", w.Code)
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestHealthReportsLLMConnectivity(t *testing.T) {
+	captureLogs(t)
+	ha := &healthAgent{stubAgent: &stubAgent{}, health: agent.LLMHealth{Provider: "ollama", Model: "llama3.1", Checked: true, Reachable: true}}
+	s := NewServer(ha)
+
+	body := getHealth(t, s)
+	if body["status"] != "healthy" || body["provider"] != "ollama" || body["model"] != "llama3.1" {
+		t.Errorf("后端可达时 = %v", body)
+	}
+
+	// 缓存有效期内复用上一次的结果，不重复请求后端
+	getHealth(t, s)
+	if ha.checks != 1 {
+		t.Errorf("缓存有效期内应只检查一次，实际 %d 次", ha.checks)
+	}
+
+	down := &healthAgent{stubAgent: &stubAgent{}, health: agent.LLMHealth{Provider: "openai", Model: "gpt-4o-mini", Checked: true, Error: "connection refused"}}
+	body = getHealth(t, NewServer(down))
+	if body["status"] != "degraded" || body["error"] != "connection refused" || body["model"] != "gpt-4o-mini" {
+		t.Errorf("后端不可达时 = %v", body)
+	}
+
+	// 不支持检查的客户端保持 healthy
+	unchecked := &healthAgent{stubAgent: &stubAgent{}, health: agent.LLMHealth{Provider: "ollama", Model: "llama3.1"}}
+	if body = getHealth(t, NewServer(unchecked)); body["status"] != "healthy" {
+		t.Errorf("未检查时 = %v", body)
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"agentEino/pkg/logger"
+	"agentEino/pkg/tools"
+)
+
+// maxUploadFormMemory 解析上传表单时保存在内存中的最大字节数，超出部分写入临时文件
+const maxUploadFormMemory = 1 << 20
+
+// handleKnowledgeUpload 接收 multipart 上传的文档并写入知识库目录
+// 表单字段：file（文档内容，必填）、filename（可选，默认使用上传文件名）、overwrite（可选，true 时覆盖同名文档）
+func (s *Server) handleKnowledgeUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.knowledge == nil {
+		http.Error(w, "Knowledge base not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	// 为表单中的其他字段预留少量空间
+	r.Body = http.MaxBytesReader(w, r.Body, int64(s.knowledge.MaxDocumentBytes()+maxUploadFormMemory))
+	if err := r.ParseMultipartForm(maxUploadFormMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Document too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid multipart form", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "File required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	name := r.FormValue("filename")
+	if name == "" {
+		name = header.Filename
+	}
+	overwrite := false
+	if v := r.FormValue("overwrite"); v != "" {
+		overwrite, err = strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Invalid overwrite", http.StatusBadRequest)
+			return
+		}
+	}
+
+	content, err := io.ReadAll(io.LimitReader(file, int64(s.knowledge.MaxDocumentBytes())+1))
+	if err != nil {
+		http.Error(w, "Failed to read file", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.knowledge.SaveDocument(name, content, overwrite); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, tools.ErrInvalidDocumentName):
+			status = http.StatusBadRequest
+		case errors.Is(err, tools.ErrDocumentExists):
+			status = http.StatusConflict
+		case errors.Is(err, tools.ErrDocumentTooLarge):
+			status = http.StatusRequestEntityTooLarge
+		case errors.Is(err, tools.ErrKnowledgeBaseNotDir):
+			status = http.StatusServiceUnavailable
+			logger.FromContext(r.Context()).Error("知识库路径配置错误", map[string]interface{}{"error": err.Error()})
+		default:
+			logger.FromContext(r.Context()).Error("保存知识库文档失败", map[string]interface{}{"document": name, "error": err.Error()})
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("已上传知识库文档", map[string]interface{}{"document": name, "size": len(content)})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"document": name,
+		"size":     len(content),
+	})
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agentEino/pkg/tools"
+)
+
+// uploadRequest 构造上传文档的 multipart 请求
+func uploadRequest(t *testing.T, filename, content string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte(content))
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/api/knowledge", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestKnowledgeUploadSavesDocument(t *testing.T) {
+	dir := t.TempDir()
+	s := NewServer(nil)
+	s.SetKnowledgeBase(tools.NewKnowledgeBaseTool(dir))
+
+	w := httptest.NewRecorder()
+	s.handleKnowledgeUpload(w, uploadRequest(t, "faq.md", "# 常见问题"))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("状态码 = %d: %s", w.Code, w.Body.String())
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "faq.md")); err != nil || string(data) != "# 常见问题" {
+		t.Errorf("文档未写入知识库: %q, %v", data, err)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleKnowledgeUpload(w, uploadRequest(t, "faq.md", "重复"))
+	if w.Code != http.StatusConflict {
+		t.Errorf("同名文档状态码 = %d，期望 409", w.Code)
+	}
+}
+
+func TestKnowledgeUploadReportsPathThatIsAFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kb")
+	if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(nil)
+	s.SetKnowledgeBase(tools.NewKnowledgeBaseTool(path))
+
+	w := httptest.NewRecorder()
+	s.handleKnowledgeUpload(w, uploadRequest(t, "faq.md", "# 常见问题"))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("状态码 = %d，期望 503", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "知识库路径不是目录") {
+		t.Errorf("响应应说明配置错误: %s", w.Body.String())
+	}
+}
+
+func TestKnowledgeUploadRejectsDocumentOverConfiguredLimit(t *testing.T) {
+	dir := t.TempDir()
+	kb := tools.NewKnowledgeBaseTool(dir)
+	kb.SetMaxDocumentBytes(16)
+	s := NewServer(nil)
+	s.SetKnowledgeBase(kb)
+
+	w := httptest.NewRecorder()
+	s.handleKnowledgeUpload(w, uploadRequest(t, "big.txt", strings.Repeat("x", 17)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("状态码 = %d，期望 413: %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "big.txt")); !os.IsNotExist(err) {
+		t.Error("超限文档不应写入知识库")
+	}
+
+	w = httptest.NewRecorder()
+	s.handleKnowledgeUpload(w, uploadRequest(t, "ok.txt", strings.Repeat("x", 16)))
+	if w.Code != http.StatusCreated {
+		t.Errorf("未超限文档状态码 = %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"agentEino/pkg/logger"
+)
+
+// Middleware 包装 http.Handler，为所有路由添加横切逻辑
+type Middleware func(http.Handler) http.Handler
+
+// Chain 依次应用中间件，第一个中间件位于最外层
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// statusRecorder 记录响应状态码与写入的字节数
+// 实现 Flush 与 Unwrap，SSE 刷新和 http.ResponseController 设置写超时不受影响
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Flush 转发到底层 ResponseWriter，不支持时忽略
+func (r *statusRecorder) Flush() {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 访问底层 ResponseWriter
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// wrapRecorder 复用外层中间件创建的 statusRecorder，避免重复包装
+func wrapRecorder(w http.ResponseWriter) *statusRecorder {
+	if rec, ok := w.(*statusRecorder); ok {
+		return rec
+	}
+	return &statusRecorder{ResponseWriter: w}
+}
+
+// RequestIDHeader 携带请求ID的请求头与响应头
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID 接受客户端或网关传入的请求ID的格式，不符合时重新生成
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestIDMiddleware 为每个请求分配请求ID（沿用合法的 X-Request-ID 请求头，否则生成），写入响应头，
+// 并将带 request_id 字段的日志记录器放入请求上下文：通过 logger.FromContext 输出的日志都带上该ID
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = "req_" + randomString(12)
+		}
+		w.Header().Set(RequestIDHeader, id)
+		ctx := logger.NewContext(r.Context(), logger.FromContext(r.Context()).With(map[string]interface{}{"request_id": id}))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// LoggingMiddleware 记录每个请求的方法、路径、状态码与耗时，5xx 以警告级别记录
+func LoggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := wrapRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		fields := map[string]interface{}{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      status,
+			"bytes":       rec.bytes,
+			"duration_ms": time.Since(start).Milliseconds(),
+		}
+		log := logger.FromContext(r.Context())
+		if status >= http.StatusInternalServerError {
+			log.Warn("HTTP请求", fields)
+		} else {
+			log.Info("HTTP请求", fields)
+		}
+	})
+}
+
+// RecoveryMiddleware 捕获处理函数中的 panic 并返回 500，避免单个请求导致整个服务退出
+// 已开始写入响应时无法再修改状态码，只记录日志；http.ErrAbortHandler 按约定继续向上抛出
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := wrapRecorder(w)
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			logger.FromContext(r.Context()).Error("处理请求时发生 panic", map[string]interface{}{
+				"method": r.Method,
+				"path":   r.URL.Path,
+				"panic":  fmt.Sprint(v),
+				"stack":  string(debug.Stack()),
+			})
+			if rec.status == 0 {
+				http.Error(rec, "Internal server error", http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"agentEino/pkg/logger"
+)
+
+// captureLogs 将默认日志输出重定向到缓冲区，测试结束时恢复
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	logger.SetOutput(&buf)
+	t.Cleanup(func() { logger.SetOutput(os.Stdout) })
+	return &buf
+}
+
+func TestRecoveryMiddlewareTurnsPanicInto500(t *testing.T) {
+	logs := captureLogs(t)
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), LoggingMiddleware, RecoveryMiddleware)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tools", nil))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "Internal server error") {
+		t.Fatalf("panic 应返回 500，实际 %d %q", w.Code, w.Body.String())
+	}
+	out := logs.String()
+	if !strings.Contains(out, "boom") {
+		t.Errorf("应记录 panic 信息，实际:\n%s", out)
+	}
+	if !strings.Contains(out, "HTTP请求") || !strings.Contains(out, "500") {
+		t.Errorf("请求日志应记录 500 状态码，实际:\n%s", out)
+	}
+}
+
+func TestLoggingMiddlewareRecordsRequest(t *testing.T) {
+	logs := captureLogs(t)
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+	}), LoggingMiddleware, RecoveryMiddleware)
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/api/conversations/missing", nil))
+	out := logs.String()
+	for _, want := range []string{"DELETE", "/api/conversations/missing", "404", "duration_ms"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("请求日志缺少 %q，实际:\n%s", want, out)
+		}
+	}
+}
+
+func TestMiddlewareKeepsFlusherAndResponseController(t *testing.T) {
+	captureLogs(t)
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("包装后的 ResponseWriter 应支持 Flush，SSE 依赖它")
+		}
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("ResponseController 应能访问底层 ResponseWriter: %v", err)
+		}
+		w.Write([]byte("data: ok\n\n"))
+	}), LoggingMiddleware, RecoveryMiddleware)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/chat/stream", nil))
+	if !w.Flushed || w.Body.String() != "data: ok\n\n" {
+		t.Errorf("刷新或写入未转发到底层: flushed=%v body=%q", w.Flushed, w.Body.String())
+	}
+}
+
+func TestServerHandlersAreIsolated(t *testing.T) {
+	captureLogs(t)
+	// 每个 Server 使用独立的 ServeMux，多次创建不会因重复注册路由而 panic
+	for i := 0; i < 2; i++ {
+		ts := httptest.NewServer(NewServer(nil).Handler())
+		resp, err := http.Get(ts.URL + "/health")
+		if err != nil {
+			ts.Close()
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		ts.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("第 %d 个服务 /health 状态码 = %d", i+1, resp.StatusCode)
+		}
+	}
+}
+
+func TestRequestIDIsAttachedToEveryLogLine(t *testing.T) {
+	logs := captureLogs(t)
+	s := NewServer(&stubAgent{process: func(ctx context.Context, input string) (string, error) {
+		logger.FromContext(ctx).Info("Agent 内部日志")
+		return "好的", nil
+	}})
+	h := s.Handler()
+
+	body, _ := json.Marshal(ChatRequest{Message: "你好"})
+	r := httptest.NewRequest(http.MethodPost, "/api/chat", bytes.NewReader(body))
+	r.Header.Set(RequestIDHeader, "req-from-gateway")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get(RequestIDHeader) != "req-from-gateway" {
+		t.Fatalf("应沿用请求头中的请求ID，实际 %d %q", w.Code, w.Header().Get(RequestIDHeader))
+	}
+	var resp ChatResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	var agentLine, accessLine string
+	for _, line := range strings.Split(logs.String(), "\n") {
+		switch {
+		case strings.Contains(line, "Agent 内部日志"):
+			agentLine = line
+		case strings.Contains(line, "HTTP请求"):
+			accessLine = line
+		}
+	}
+	if !strings.Contains(agentLine, "request_id=req-from-gateway") || !strings.Contains(agentLine, "conversation_id="+resp.ConversationID) {
+		t.Errorf("Agent 日志应带上请求ID与会话ID: %q", agentLine)
+	}
+	if !strings.Contains(accessLine, "request_id=req-from-gateway") {
+		t.Errorf("请求日志应带上请求ID: %q", accessLine)
+	}
+
+	// 不合法或缺失的请求ID重新生成，每个请求不同
+	ids := map[string]bool{}
+	for _, header := range []string{"", "bad id\n"} {
+		r := httptest.NewRequest(http.MethodGet, "/health", nil)
+		if header != "" {
+			r.Header.Set(RequestIDHeader, header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		id := w.Header().Get(RequestIDHeader)
+		if !strings.HasPrefix(id, "req_") || ids[id] {
+			t.Errorf("应生成新的请求ID，实际 %q", id)
+		}
+		ids[id] = true
+	}
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter 基于滑动窗口的按键限流器，例如按会话ID限制每分钟的对话轮数
+// 窗口内没有请求的键会在之后的 Allow 中被清理（每个窗口最多清理一次），避免记录无限增长
+type rateLimiter struct {
+	limit     int
+	window    time.Duration
+	hits      map[string][]time.Time
+	lastSweep time.Time
+	now       func() time.Time // 当前时间，测试中可替换
+	mu        sync.Mutex
+}
+
+// newRateLimiter 创建限流器：每个键在 window 时间内最多允许 limit 次
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:     limit,
+		window:    window,
+		hits:      make(map[string][]time.Time),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Allow 记录一次请求并返回是否允许；nil 限流器始终允许
+func (l *rateLimiter) Allow(key string) bool {
+	if l == nil || l.limit <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	cutoff := now.Add(-l.window)
+	if now.Sub(l.lastSweep) >= l.window {
+		l.sweep(cutoff)
+		l.lastSweep = now
+	}
+
+	recent := l.hits[key][:0]
+	for _, t := range l.hits[key] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= l.limit {
+		l.hits[key] = recent
+		return false
+	}
+	l.hits[key] = append(recent, now)
+	return true
+}
+
+// sweep 删除最近一次请求早于 cutoff 的键，调用方需持有锁
+func (l *rateLimiter) sweep(cutoff time.Time) {
+	for key, times := range l.hits {
+		if len(times) == 0 || !times[len(times)-1].After(cutoff) {
+			delete(l.hits, key)
+		}
+	}
+}
+
+// Forget 删除某个键的限流记录
+func (l *rateLimiter) Forget(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.hits, key)
+}
+
+// activeLimiter 限制每个客户端同时进行中的会话数：键为客户端IP，值为各会话进行中的请求数
+// 同一会话的并发请求只占用一个名额，请求结束（包括客户端断开）后释放
+type activeLimiter struct {
+	limit  int
+	active map[string]map[string]int
+	mu     sync.Mutex
+}
+
+// newActiveLimiter 创建限制器：每个客户端最多同时有 limit 个进行中的会话
+func newActiveLimiter(limit int) *activeLimiter {
+	return &activeLimiter{limit: limit, active: make(map[string]map[string]int)}
+}
+
+// Allow 判断客户端能否在会话 convID 上开始新请求：convID 已在进行中（同一会话继续）或未达到上限时允许
+// convID 为空表示将要创建新会话；nil 限制器始终允许
+func (l *activeLimiter) Allow(client, convID string) bool {
+	if l == nil || l.limit <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	convs := l.active[client]
+	if convID != "" && convs[convID] > 0 {
+		return true
+	}
+	return len(convs) < l.limit
+}
+
+// Acquire 记录客户端在会话 convID 上开始一次请求，返回请求结束时调用的释放函数（只生效一次）
+// 不检查上限，调用方应先调用 Allow，并在同一把锁内完成 Allow 与 Acquire
+func (l *activeLimiter) Acquire(client, convID string) (release func()) {
+	if l == nil || l.limit <= 0 {
+		return func() {}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[client] == nil {
+		l.active[client] = make(map[string]int)
+	}
+	l.active[client][convID]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			convs := l.active[client]
+			if convs[convID]--; convs[convID] <= 0 {
+				delete(convs, convID)
+			}
+			if len(convs) == 0 {
+				delete(l.active, client)
+			}
+		})
+	}
+}
+
+// Active 返回客户端进行中的会话数
+func (l *activeLimiter) Active(client string) int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.active[client])
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeClock 可手动推进的时钟
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+func newLimiterWithClock(limit int, window time.Duration) (*rateLimiter, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	l := newRateLimiter(limit, window)
+	l.now = clock.now
+	l.lastSweep = clock.t
+	return l, clock
+}
+
+func TestRateLimiterThrottlesPerKey(t *testing.T) {
+	l, clock := newLimiterWithClock(2, time.Minute)
+
+	if !l.Allow("a") || !l.Allow("a") {
+		t.Fatal("窗口内前 2 次请求应被允许")
+	}
+	if l.Allow("a") {
+		t.Error("超过上限的请求应被拒绝")
+	}
+	if !l.Allow("b") {
+		t.Error("不同的键应独立计数")
+	}
+
+	clock.advance(time.Minute)
+	if !l.Allow("a") {
+		t.Error("窗口过去后应重新允许")
+	}
+
+	var nilLimiter *rateLimiter
+	if !nilLimiter.Allow("a") {
+		t.Error("nil 限流器应始终允许")
+	}
+}
+
+func TestRateLimiterEvictsIdleKeys(t *testing.T) {
+	l, clock := newLimiterWithClock(5, time.Minute)
+	for i := 0; i < 100; i++ {
+		l.Allow(fmt.Sprintf("conv_%d", i))
+	}
+	if len(l.hits) != 100 {
+		t.Fatalf("应记录 100 个键，实际 %d", len(l.hits))
+	}
+
+	clock.advance(30 * time.Second)
+	l.Allow("conv_0")
+	if len(l.hits) != 100 {
+		t.Errorf("窗口未过期时不应清理，实际 %d 个键", len(l.hits))
+	}
+
+	clock.advance(31 * time.Second)
+	l.Allow("active")
+	// conv_0 在 30 秒时仍有请求，其余键的记录均已过期
+	if len(l.hits) != 2 {
+		t.Errorf("窗口过期后应清理空闲的键，剩余 %d 个", len(l.hits))
+	}
+	if _, ok := l.hits["conv_0"]; !ok {
+		t.Error("窗口内仍有请求的键不应被清理")
+	}
+}
+
+func TestActiveLimiterCountsConversationsPerClient(t *testing.T) {
+	l := newActiveLimiter(1)
+	release := l.Acquire("10.0.0.1", "conv_a")
+	if !l.Allow("10.0.0.1", "conv_a") {
+		t.Error("同一会话的并发请求不应占用新名额")
+	}
+	if l.Allow("10.0.0.1", "conv_b") || l.Allow("10.0.0.1", "") {
+		t.Error("达到上限后应拒绝其他会话")
+	}
+	if !l.Allow("10.0.0.2", "") {
+		t.Error("其他客户端不受影响")
+	}
+
+	// 同一会话的两个请求都结束后才释放
+	releaseAgain := l.Acquire("10.0.0.1", "conv_a")
+	release()
+	release()
+	if l.Allow("10.0.0.1", "conv_b") {
+		t.Error("会话仍有进行中的请求时不应释放名额")
+	}
+	releaseAgain()
+	if !l.Allow("10.0.0.1", "conv_b") || l.Active("10.0.0.1") != 0 {
+		t.Error("全部请求结束后应释放名额")
+	}
+
+	var unlimited *activeLimiter
+	unlimited.Acquire("10.0.0.1", "x")()
+	if !unlimited.Allow("10.0.0.1", "y") {
+		t.Error("nil 限制器应始终允许")
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"agentEino/pkg/agent"
+	"agentEino/pkg/logger"
+)
+
+// handleReplayConversation 按当前配置回放会话中的用户消息，返回每轮的原回复与新回复
+// 回放在临时记忆会话中进行，不修改原会话，也不会出现在会话列表中
+func (s *Server) handleReplayConversation(w http.ResponseWriter, r *http.Request, convID string) {
+	replayer, ok := s.agent.(agent.ConversationReplayer)
+	if !ok {
+		http.Error(w, "Replay not supported", http.StatusNotImplemented)
+		return
+	}
+
+	s.mu.Lock()
+	_, exists := s.conversations[convID]
+	agentConvID := s.agentConvMap[convID]
+	s.mu.Unlock()
+	if !exists {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+	if agentConvID == "" {
+		agentConvID = convID
+	}
+
+	turns, err := replayer.ReplayConversation(r.Context(), agentConvID)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("回放会话失败", map[string]interface{}{"conversation_id": convID, "error": err.Error()})
+		http.Error(w, "Failed to replay conversation", http.StatusInternalServerError)
+		return
+	}
+
+	changed := 0
+	for _, turn := range turns {
+		if !turn.Identical {
+			changed++
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(map[string]interface{}{
+		"conversation_id": convID,
+		"turns":           turns,
+		"changed":         changed,
+	})
+}
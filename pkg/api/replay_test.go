@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"agentEino/pkg/agent"
+)
+
+// replayAgent 记录回放请求的会话ID并返回预设结果
+type replayAgent struct {
+	*stubAgent
+	replayed []string
+	turns    []agent.ReplayTurn
+}
+
+func (a *replayAgent) ReplayConversation(ctx context.Context, id string) ([]agent.ReplayTurn, error) {
+	a.replayed = append(a.replayed, id)
+	return a.turns, nil
+}
+
+func TestReplayConversationEndpoint(t *testing.T) {
+	ra := &replayAgent{stubAgent: &stubAgent{}, turns: []agent.ReplayTurn{
+		{Index: 0, Input: "你好", Original: "你好！", Replayed: "你好！", Identical: true},
+		{Index: 1, Input: "1+1=?", Original: "2", Replayed: "等于 2"},
+	}}
+	s := NewServer(ra)
+	addTestConversation(s, "web_1", "你好", "你好！", "1+1=?", "2")
+	s.agentConvMap["web_1"] = "mem_1"
+
+	w := httptest.NewRecorder()
+	s.handleConversationDetail(w, httptest.NewRequest(http.MethodPost, "/api/conversations/web_1/replay", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		ConversationID string             `json:"conversation_id"`
+		Turns          []agent.ReplayTurn `json:"turns"`
+		Changed        int                `json:"changed"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ConversationID != "web_1" || len(resp.Turns) != 2 || resp.Changed != 1 || resp.Turns[1].Replayed != "等于 2" {
+		t.Errorf("响应 = %+v", resp)
+	}
+	if len(ra.replayed) != 1 || ra.replayed[0] != "mem_1" {
+		t.Errorf("应按绑定的记忆会话ID回放，实际 %v", ra.replayed)
+	}
+	if got := len(s.conversations["web_1"].Messages); got != 4 || len(s.conversations) != 1 {
+		t.Errorf("回放不应修改或新增页面会话: 消息数 %d，会话数 %d", got, len(s.conversations))
+	}
+
+	for _, c := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/conversations/web_1/replay", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/conversations/missing/replay", http.StatusNotFound},
+		{http.MethodPost, "/api/conversations//replay", http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		s.handleConversationDetail(w, httptest.NewRequest(c.method, c.path, nil))
+		if w.Code != c.want {
+			t.Errorf("%s %s 状态码 = %d，期望 %d", c.method, c.path, w.Code, c.want)
+		}
+	}
+
+	plain := NewServer(&stubAgent{})
+	addTestConversation(plain, "web_1", "你好")
+	w = httptest.NewRecorder()
+	plain.handleConversationDetail(w, httptest.NewRequest(http.MethodPost, "/api/conversations/web_1/replay", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("不支持回放的 Agent 状态码 = %d，期望 501", w.Code)
+	}
+}
@@ -3,11 +3,17 @@ package api
 import (
 	"agentEino/pkg/agent"
 	"agentEino/pkg/logger"
+	"agentEino/pkg/tools"
+	"agentEino/pkg/tracing"
 	"context"
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"math/big"
+	"net"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -19,15 +25,63 @@ type Server struct {
 	conversations map[string]*Conversation
 	// 将 Web 层的 conversation_id 映射到 Agent 层的记忆会话ID
 	agentConvMap map[string]string
-	mu           sync.Mutex
+	// SSE 单次写入的超时时间，超时视为客户端卡住并取消生成
+	streamWriteTimeout time.Duration
+	// 按会话ID限制每分钟的对话轮数，nil 表示不限制
+	convLimiter *rateLimiter
+	// activeConvs 每个客户端IP同时进行中的会话数上限，nil 表示不限制
+	activeConvs *activeLimiter
+	// 会话列表未指定 limit 时返回的数量
+	conversationPageSize int
+	// 接收上传文档的知识库，nil 时 /api/knowledge 不可用
+	knowledge *tools.KnowledgeBaseTool
+	// 聊天请求JSON请求体的最大字节数
+	maxRequestBodyBytes int
+	// 会话消息数达到 titleMessages 后用 LLM 生成标题，见 SetAutoTitle
+	titleUseLLM   bool
+	titleMessages int
+	mu            sync.Mutex
+	// 最近一次LLM连通性检查的结果，healthMu 同时保证同一时刻只有一个检查在进行
+	healthMu    sync.Mutex
+	llmHealth   agent.LLMHealth
+	llmHealthAt time.Time
 }
 
+// DefaultStreamWriteTimeout 默认的SSE写入超时时间
+const DefaultStreamWriteTimeout = 30 * time.Second
+
+// HealthCheckCacheTTL 复用LLM连通性检查结果的时长，负载均衡频繁探测 /health 时不会每次都请求后端
+const HealthCheckCacheTTL = 5 * time.Second
+
+// DefaultMaxRequestBodyBytes 默认的聊天请求体大小上限（1MB）
+const DefaultMaxRequestBodyBytes = 1 << 20
+
+// 会话列表分页参数
+const (
+	// DefaultConversationPageSize 未指定 limit 时每页返回的会话数，可通过 SetConversationPageSize 修改
+	DefaultConversationPageSize = 20
+	// MaxConversationPageSize limit 的上限，超出时按上限返回
+	MaxConversationPageSize = 100
+)
+
+// DefaultAutoArchiveCheckInterval 自动归档任务检查不活跃会话的最长间隔
+const DefaultAutoArchiveCheckInterval = 10 * time.Minute
+
 // Conversation 表示一个对话会话
 type Conversation struct {
-	ID        string
-	Messages  []Message
+	ID    string
+	Title string // 为空时使用第一条用户消息作为标题
+	// SystemPrompt 会话专属的系统提示词，为空时使用全局提示词
+	SystemPrompt string
+	Messages     []Message
+	// UpdatedAt 最近一次收到用户消息的时间（纳秒），为 0 时按 CreatedAt 计算不活跃时长
+	UpdatedAt int64
+	// Archived 已归档：默认不出现在会话列表中，仍可按ID读取，收到新消息时取消归档
+	Archived  bool
 	Context   context.Context
 	CreatedAt int64
+	// titleRequested 已尝试自动生成标题，每个会话只尝试一次
+	titleRequested bool
 }
 
 // Message 表示对话中的一条消息
@@ -38,59 +92,347 @@ type Message struct {
 
 // ChatRequest 表示聊天请求
 type ChatRequest struct {
-	ConversationID string `json:"conversation_id,omitempty"`
-	Message        string `json:"message"`
+	ConversationID   string `json:"conversation_id,omitempty"`
+	Message          string `json:"message"`
+	IncludeToolCalls bool   `json:"include_tool_calls,omitempty"` // 为 true 时在响应中附带工具决策与调用记录
 }
 
 // ChatResponse 表示聊天响应
 type ChatResponse struct {
-	ConversationID string  `json:"conversation_id"`
-	Message        Message `json:"message"`
+	ConversationID string       `json:"conversation_id"`
+	Message        Message      `json:"message"`
+	HistoryTrimmed int          `json:"history_trimmed,omitempty"` // 本轮省略的最早历史消息数
+	Usage          *agent.Usage `json:"usage,omitempty"`           // 本轮 token 用量（估算）
+	// CitationMissing 引用模式为 verify 时，回复使用了搜索结果但未标注来源
+	CitationMissing bool `json:"citation_missing,omitempty"`
+	// 以下字段仅在请求 include_tool_calls 时返回
+	Decision  string                 `json:"decision,omitempty"`   // 第一轮生成的原始文本（工具决策）
+	ToolCalls []agent.ToolCallRecord `json:"tool_calls,omitempty"` // 本轮的工具调用记录
+}
+
+// StreamJSONResponse 流式接口以单个JSON返回时的响应（?format=json 或 Accept: application/json）
+type StreamJSONResponse struct {
+	ConversationID      string              `json:"conversation_id"`
+	AgentConversationID string              `json:"agent_conversation_id"`
+	Message             Message             `json:"message"`
+	Sources             []map[string]string `json:"sources,omitempty"`
+	HistoryTrimmed      int                 `json:"history_trimmed,omitempty"`
+	CitationMissing     bool                `json:"citation_missing,omitempty"`
+	Usage               StreamUsage         `json:"usage"`
+}
+
+// StreamUsage 汇总一次流式生成的统计信息
+type StreamUsage struct {
+	Chunks         int   `json:"chunks"`          // 正文数据块数量
+	ThinkingEvents int   `json:"thinking_events"` // 思维链事件数量
+	Characters     int   `json:"characters"`      // 正文字符数
+	DurationMs     int64 `json:"duration_ms"`     // 总耗时（毫秒）
+	// token 用量（估算，包含工具决策等全部生成）
+	PromptTokens     int `json:"prompt_tokens,omitempty"`
+	CompletionTokens int `json:"completion_tokens,omitempty"`
+}
+
+// persistenceReporter 可选接口：报告对话是否持久化
+type persistenceReporter interface {
+	PersistenceEnabled() bool
+}
+
+// usageReporter 可选接口：报告本轮 token 用量
+type usageReporter interface {
+	LastUsage() agent.Usage
+}
+
+// historyTrimReporter 可选接口：报告本轮省略的历史消息数
+type historyTrimReporter interface {
+	HistoryTrimmed() int
+}
+
+// citationReporter 可选接口：报告本轮回复是否缺少来源标注
+type citationReporter interface {
+	CitationMissing() bool
+}
+
+// conversationStore 可选接口：通过记忆层持久化 Web 会话
+type conversationStore interface {
+	NewConversation(ctx context.Context, title string) (string, error)
+	StoredConversations(ctx context.Context) ([]agent.StoredConversation, error)
+	StoredConversation(ctx context.Context, id string) (*agent.StoredConversation, error)
+	DeleteConversation(ctx context.Context, id string) error
+	RenameConversation(ctx context.Context, id, title string) error
+}
+
+// systemPromptStore 可选接口：为单个会话设置专属的系统提示词
+type systemPromptStore interface {
+	SetConversationSystemPrompt(ctx context.Context, id, prompt string) error
+}
+
+// conversationArchiver 可选接口：持久化会话的归档状态
+type conversationArchiver interface {
+	ArchiveConversation(ctx context.Context, id string, archived bool) error
+}
+
+// llmHealthChecker 可选接口：检查LLM后端是否可达
+type llmHealthChecker interface {
+	CheckLLMHealth(ctx context.Context) agent.LLMHealth
+}
+
+// cacheClearer 可选接口：清空LLM响应缓存
+type cacheClearer interface {
+	ClearResponseCache()
+}
+
+// detailedProcessor 可选接口：返回包含工具调用记录的处理结果
+type detailedProcessor interface {
+	ProcessDetailed(ctx context.Context, input string) (*agent.ProcessResult, error)
+}
+
+// sourcesProvider 可选接口：返回最近一次搜索的来源列表
+type sourcesProvider interface {
+	GetLastSources() []map[string]string
 }
 
 // NewServer 创建一个新的API服务器
 func NewServer(agent agent.Agent) *Server {
 	return &Server{
-		agent:         agent,
-		conversations: make(map[string]*Conversation),
-		agentConvMap:  make(map[string]string),
+		agent:                agent,
+		conversations:        make(map[string]*Conversation),
+		agentConvMap:         make(map[string]string),
+		streamWriteTimeout:   DefaultStreamWriteTimeout,
+		conversationPageSize: DefaultConversationPageSize,
+		maxRequestBodyBytes:  DefaultMaxRequestBodyBytes,
+		titleUseLLM:          true,
+		titleMessages:        DefaultTitleMessages,
 	}
 }
 
-// Start 启动Web服务器
-func (s *Server) Start(port string) {
-	// 设置静态文件服务
-	fs := http.FileServer(http.Dir("./web/static"))
-	http.Handle("/", fs)
+// LoadConversations 从记忆层恢复已持久化的会话，Agent 不支持持久化时不做任何事
+// 恢复的会话与记忆会话使用相同ID，agentConvMap 按ID一一对应重建
+func (s *Server) LoadConversations(ctx context.Context) error {
+	store, ok := s.agent.(conversationStore)
+	if !ok {
+		return nil
+	}
+	stored, err := store.StoredConversations(ctx)
+	if err != nil {
+		return err
+	}
 
-	// API路由
-	http.HandleFunc("/api/chat", s.handleChat)
-	http.HandleFunc("/api/chat/stream", s.handleChatStream)
-	http.HandleFunc("/api/conversations", s.handleConversations)
-	http.HandleFunc("/api/conversations/", s.handleConversationDetail)
-	http.HandleFunc("/health", s.handleHealth)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sc := range stored {
+		conv := &Conversation{
+			ID:           sc.ID,
+			Title:        sc.Title,
+			SystemPrompt: sc.SystemPrompt,
+			Archived:     sc.Archived,
+			Messages:     []Message{},
+			Context:      context.Background(),
+			CreatedAt:    sc.CreatedAt.UnixNano(),
+		}
+		// 只恢复用户与助手消息，反馈、工具结果等不在页面上展示
+		for _, m := range sc.Messages {
+			if m.Role == "user" || m.Role == "assistant" {
+				conv.Messages = append(conv.Messages, Message{Role: m.Role, Content: m.Content})
+			}
+		}
+		// 跳过没有对话内容的会话（如启动时创建的空会话）
+		if len(conv.Messages) == 0 {
+			continue
+		}
+		if !sc.UpdatedAt.IsZero() {
+			conv.UpdatedAt = sc.UpdatedAt.UnixNano()
+		}
+		s.conversations[conv.ID] = conv
+		s.agentConvMap[conv.ID] = conv.ID
+	}
+	logger.Info("已恢复持久化会话", map[string]interface{}{"count": len(s.conversations)})
+	return nil
+}
+
+// newConversation 创建会话并绑定记忆会话，调用方需持有 s.mu
+// Agent 支持持久化时为每个会话创建独立的记忆会话并复用其ID，否则绑定到 Agent 当前会话
+func (s *Server) newConversation() *Conversation {
+	conv := &Conversation{
+		ID:        generateID(),
+		Messages:  []Message{},
+		Context:   context.Background(),
+		CreatedAt: currentTimestamp(),
+	}
+	if s.agent == nil {
+		return conv
+	}
+	if store, ok := s.agent.(conversationStore); ok {
+		id, err := store.NewConversation(conv.Context, "")
+		if err == nil {
+			conv.ID = id
+			s.agentConvMap[conv.ID] = id
+			return conv
+		}
+		logger.Warn("创建记忆会话失败，使用当前Agent会话", map[string]interface{}{"error": err.Error()})
+	}
+	s.agentConvMap[conv.ID] = s.agent.GetConversationID()
+	return conv
+}
+
+// discardConversation 撤销本次请求新建的会话（含其记忆会话），用于请求被拒绝时不留下空会话
+// 调用方需持有 s.mu
+func (s *Server) discardConversation(ctx context.Context, convID string) {
+	if store, ok := s.agent.(conversationStore); ok && s.agentConvMap[convID] == convID {
+		if err := store.DeleteConversation(ctx, convID); err != nil {
+			logger.FromContext(ctx).Warn("删除记忆会话失败", map[string]interface{}{"conversation_id": convID, "error": err.Error()})
+		}
+	}
+	delete(s.conversations, convID)
+	delete(s.agentConvMap, convID)
+	s.convLimiter.Forget(convID)
+}
+
+// SetConversationRateLimit 设置单个会话每分钟允许的最大对话轮数，<=0 表示不限制
+func (s *Server) SetConversationRateLimit(perMinute int) {
+	if perMinute <= 0 {
+		s.convLimiter = nil
+		return
+	}
+	s.convLimiter = newRateLimiter(perMinute, time.Minute)
+}
+
+// SetMaxActiveConversationsPerIP 设置每个客户端IP同时进行中（正在生成回复）的会话数上限，<=0 表示不限制
+// 达到上限时该客户端在其他会话上的新请求返回 429，已在进行中的会话不受影响
+func (s *Server) SetMaxActiveConversationsPerIP(n int) {
+	if n <= 0 {
+		s.activeConvs = nil
+		return
+	}
+	s.activeConvs = newActiveLimiter(n)
+}
+
+// existingID 返回已存在会话的ID，conv 为 nil（将创建新会话）时返回空字符串
+func existingID(conv *Conversation) string {
+	if conv == nil {
+		return ""
+	}
+	return conv.ID
+}
+
+// clientIP 返回请求的客户端IP（取自连接地址，不信任 X-Forwarded-For 等可伪造的请求头）
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rejectTooManyActive 客户端进行中的会话数已达上限且 convID 不在其中时返回 429，调用方需持有 s.mu
+func (s *Server) rejectTooManyActive(w http.ResponseWriter, r *http.Request, convID string) bool {
+	ip := clientIP(r)
+	if s.activeConvs.Allow(ip, convID) {
+		return false
+	}
+	logger.FromContext(r.Context()).Warn("客户端进行中的会话数达到上限", map[string]interface{}{
+		"remote_addr":     r.RemoteAddr,
+		"conversation_id": convID,
+		"active":          s.activeConvs.Active(ip),
+	})
+	http.Error(w, "Too many active conversations from this client", http.StatusTooManyRequests)
+	return true
+}
+
+// SetConversationPageSize 设置会话列表未指定 limit 时返回的数量，<=0 时使用默认值，超过 MaxConversationPageSize 时按上限
+func (s *Server) SetConversationPageSize(n int) {
+	if n <= 0 {
+		n = DefaultConversationPageSize
+	}
+	s.conversationPageSize = min(n, MaxConversationPageSize)
+}
+
+// SetStreamWriteTimeout 设置SSE写入超时时间，<=0 表示不限制
+func (s *Server) SetStreamWriteTimeout(d time.Duration) {
+	s.streamWriteTimeout = d
+}
+
+// SetMaxRequestBodyBytes 设置 POST /api/chat 与 POST /api/chat/stream 请求体的最大字节数，<=0 时使用默认值
+func (s *Server) SetMaxRequestBodyBytes(n int) {
+	if n <= 0 {
+		n = DefaultMaxRequestBodyBytes
+	}
+	s.maxRequestBodyBytes = n
+}
+
+// decodeChatRequest 在请求体大小限制内解析 ChatRequest，失败时写入 413 或 400 并返回 false
+func (s *Server) decodeChatRequest(w http.ResponseWriter, r *http.Request, req *ChatRequest) bool {
+	return s.decodeJSONBody(w, r, req)
+}
 
+// decodeJSONBody 在请求体大小限制内解析 JSON 请求体，失败时写入 413 或 400 并返回 false
+// 须在获取 s.mu 之前调用，避免慢速或超大的请求体阻塞其他请求
+func (s *Server) decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, int64(s.maxRequestBodyBytes))
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		logger.FromContext(r.Context()).Error("解析请求失败", map[string]interface{}{"error": err.Error()})
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return false
+		}
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// SetKnowledgeBase 设置接收上传文档的知识库
+func (s *Server) SetKnowledgeBase(kb *tools.KnowledgeBaseTool) {
+	s.knowledge = kb
+}
+
+// Start 启动Web服务器
+func (s *Server) Start(port string) {
 	logger.Info("启动Web服务器", map[string]interface{}{
-		"port": port,
-		"endpoints": []string{"/api/chat", "/api/chat/stream", "/api/conversations", "/health"},
+		"port":      port,
+		"endpoints": []string{"/api/chat", "/api/chat/stream", "/api/conversations", "/api/conversations/compare", "/api/tools", "/api/knowledge", "/api/cache", "/api/debug/tool-decision", "/health"},
 	})
 	logger.Fatal("服务器停止", map[string]interface{}{
-		"error": http.ListenAndServe(":"+port, nil),
+		"error": http.ListenAndServe(":"+port, s.Handler()),
 	})
 }
 
+// Handler 返回注册了全部路由的 http.Handler，使用独立的 ServeMux，
+// 并统一应用请求日志与 panic 恢复中间件
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	// 设置静态文件服务
+	mux.Handle("/", http.FileServer(http.Dir("./web/static")))
+
+	// API路由
+	mux.HandleFunc("/api/chat", s.handleChat)
+	mux.HandleFunc("/api/chat/stream", s.handleChatStream)
+	mux.HandleFunc("/api/conversations", s.handleConversations)
+	mux.HandleFunc("/api/conversations/compare", s.handleCompareConversations)
+	mux.HandleFunc("/api/conversations/", s.handleConversationDetail)
+	mux.HandleFunc("/api/tools", s.handleTools)
+	mux.HandleFunc("/api/knowledge", s.handleKnowledgeUpload)
+	mux.HandleFunc("/api/cache", s.handleCache)
+	mux.HandleFunc("/api/debug/tool-decision", s.handleToolDecision)
+	mux.HandleFunc("/health", s.handleHealth)
+
+	return Chain(mux, RequestIDMiddleware, LoggingMiddleware, RecoveryMiddleware)
+}
+
 // handleChat 处理聊天请求
 func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		logger.Warn("不允许的请求方法", map[string]interface{}{"method": r.Method, "path": r.URL.Path})
+		logger.FromContext(r.Context()).Warn("不允许的请求方法", map[string]interface{}{"method": r.Method, "path": r.URL.Path})
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req ChatRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		logger.Error("解析请求失败", map[string]interface{}{"error": err.Error()})
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	if !s.decodeChatRequest(w, r, &req) {
+		return
+	}
+	if s.rejectLongInput(w, r, req.Message) {
 		return
 	}
 
@@ -102,47 +444,76 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 	if req.ConversationID != "" {
 		conv, exists = s.conversations[req.ConversationID]
 	}
+	// 在创建新对话之前检查客户端进行中的会话数，被拒绝的请求不会留下空会话
+	if s.rejectTooManyActive(w, r, existingID(conv)) {
+		s.mu.Unlock()
+		return
+	}
 
 	if !exists {
 		// 创建新对话
-		conv = &Conversation{
-			ID:        generateID(),
-			Messages:  []Message{},
-			Context:   context.Background(),
-			CreatedAt: currentTimestamp(),
-		}
+		conv = s.newConversation()
 		s.conversations[conv.ID] = conv
-		// 绑定到当前 Agent 的会话ID
-		if s.agent != nil {
-			s.agentConvMap[conv.ID] = s.agent.GetConversationID()
-		}
 	}
-	// 确保 Agent 切换到该会话对应的记忆ID
-	if s.agent != nil {
-		if aid, ok := s.agentConvMap[conv.ID]; ok && aid != "" {
-			_ = s.agent.SetConversationID(aid)
+	if !s.convLimiter.Allow(conv.ID) {
+		if !exists {
+			s.discardConversation(r.Context(), conv.ID)
 		}
+		s.mu.Unlock()
+		logger.FromContext(r.Context()).Warn("会话请求过于频繁", map[string]interface{}{"conversation_id": conv.ID})
+		http.Error(w, "Too many requests for this conversation", http.StatusTooManyRequests)
+		return
 	}
-	s.mu.Unlock()
-
+	release := s.activeConvs.Acquire(clientIP(r), conv.ID)
+	defer release()
+	// 本轮在该会话对应的记忆会话上执行，不切换 Agent 的当前会话
+	agentConvID := s.agentConvMap[conv.ID]
 	// 添加用户消息
 	userMsg := Message{
 		Role:    "user",
 		Content: req.Message,
 	}
 	conv.Messages = append(conv.Messages, userMsg)
+	touchConversation(conv)
+	s.mu.Unlock()
+
+	// 本轮的日志（含 Agent 内部的日志）都带上请求ID与会话ID
+	r = r.WithContext(logger.WithContextFields(r.Context(), map[string]interface{}{"conversation_id": conv.ID}))
+	log := logger.FromContext(r.Context())
 
 	// 处理消息并获取响应
-	logger.Debug("处理消息", map[string]interface{}{
-		"conversation_id": conv.ID,
+	log.Debug("处理消息", map[string]interface{}{
 		"message_length": len(req.Message),
 	})
-	response, err := s.agent.Process(conv.Context, req.Message)
+	ctx, span := tracing.StartSpan(logger.NewContext(withAgentConversation(conv.Context, agentConvID), log), "chat.request")
+	defer span.End()
+	var detail *agent.ProcessResult
+	var response string
+	var err error
+	if dp, ok := s.agent.(detailedProcessor); ok && req.IncludeToolCalls {
+		detail, err = dp.ProcessDetailed(ctx, req.Message)
+		if detail != nil {
+			response = detail.Response
+		}
+	} else {
+		response, err = s.agent.Process(ctx, req.Message)
+	}
 	if err != nil {
-		logger.Error("处理消息失败", map[string]interface{}{
+		tracing.EndSpan(span, err)
+		logger.FromContext(r.Context()).Error("处理消息失败", map[string]interface{}{
 			"conversation_id": conv.ID,
-			"error": err.Error(),
+			"error":           err.Error(),
 		})
+		if errors.Is(err, agent.ErrInputTooLong) {
+			// 被拒绝的输入不留下本次新建的空会话
+			if !exists {
+				s.mu.Lock()
+				s.discardConversation(r.Context(), conv.ID)
+				s.mu.Unlock()
+			}
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, "Failed to process message", http.StatusInternalServerError)
 		return
 	}
@@ -152,12 +523,25 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 		Role:    "assistant",
 		Content: response,
 	}
+	s.mu.Lock()
 	conv.Messages = append(conv.Messages, assistantMsg)
+	s.maybeGenerateTitle(conv)
+	s.mu.Unlock()
 
 	// 返回响应
+	stats := s.turnStats(agentConvID)
 	resp := ChatResponse{
-		ConversationID: conv.ID,
-		Message:        assistantMsg,
+		ConversationID:  conv.ID,
+		Message:         assistantMsg,
+		HistoryTrimmed:  stats.HistoryTrimmed,
+		CitationMissing: stats.CitationMissing,
+	}
+	if _, ok := s.agent.(usageReporter); ok {
+		resp.Usage = &stats.Usage
+	}
+	if detail != nil {
+		resp.Decision = detail.Decision
+		resp.ToolCalls = detail.ToolCalls
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -167,25 +551,43 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleChatStream 处理SSE流式聊天
+// POST 从 JSON 请求体（与 /api/chat 相同的 ChatRequest）读取消息，推荐使用；GET 从查询参数读取，供只能发起 GET 的 EventSource 客户端使用
 func (s *Server) handleChatStream(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	var conversationID, message string
+	switch r.Method {
+	case http.MethodPost:
+		var req ChatRequest
+		if !s.decodeChatRequest(w, r, &req) {
+			return
+		}
+		conversationID, message = req.ConversationID, req.Message
+	case http.MethodGet:
+		conversationID = r.URL.Query().Get("conversation_id")
+		message = r.URL.Query().Get("message")
+	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-
-	// 解析查询参数
-	conversationID := r.URL.Query().Get("conversation_id")
-	message := r.URL.Query().Get("message")
 	if strings.TrimSpace(message) == "" {
-		logger.Warn("消息为空", map[string]interface{}{"remote_addr": r.RemoteAddr})
+		logger.FromContext(r.Context()).Warn("消息为空", map[string]interface{}{"remote_addr": r.RemoteAddr})
 		http.Error(w, "message is required", http.StatusBadRequest)
 		return
 	}
+	// 超长输入在建立 SSE 连接前拒绝，客户端可直接拿到状态码与原因
+	if s.rejectLongInput(w, r, message) {
+		return
+	}
+	encoding, ok := parseStreamEncoding(r)
+	if !ok {
+		http.Error(w, "Invalid stream encoding (expected raw or json)", http.StatusBadRequest)
+		return
+	}
 
-	logger.Debug("SSE流式请求", map[string]interface{}{
+	logger.FromContext(r.Context()).Debug("SSE流式请求", map[string]interface{}{
 		"conversation_id": conversationID,
-		"message_length": len(message),
-		"remote_addr": r.RemoteAddr,
+		"message_length":  len(message),
+		"encoding":        string(encoding),
+		"remote_addr":     r.RemoteAddr,
 	})
 
 	// 获取或创建对话
@@ -195,25 +597,31 @@ func (s *Server) handleChatStream(w http.ResponseWriter, r *http.Request) {
 	if conversationID != "" {
 		conv, exists = s.conversations[conversationID]
 	}
+	if s.rejectTooManyActive(w, r, existingID(conv)) {
+		s.mu.Unlock()
+		return
+	}
 	if !exists {
-		conv = &Conversation{
-			ID:        generateID(),
-			Messages:  []Message{},
-			Context:   context.Background(),
-			CreatedAt: currentTimestamp(),
-		}
+		conv = s.newConversation()
 		s.conversations[conv.ID] = conv
-		// 将新会话绑定到当前Agent会话ID
-		if s.agent != nil {
-			s.agentConvMap[conv.ID] = s.agent.GetConversationID()
+	}
+	if !s.convLimiter.Allow(conv.ID) {
+		if !exists {
+			s.discardConversation(r.Context(), conv.ID)
 		}
+		s.mu.Unlock()
+		logger.FromContext(r.Context()).Warn("会话请求过于频繁", map[string]interface{}{"conversation_id": conv.ID})
+		http.Error(w, "Too many requests for this conversation", http.StatusTooManyRequests)
+		return
 	}
+	// 流结束或客户端断开、处理函数返回时释放名额
+	release := s.activeConvs.Acquire(clientIP(r), conv.ID)
+	defer release()
 	// 获取绑定的Agent会话ID
 	var agentConvID string
 	if s.agent != nil {
 		if aid, ok := s.agentConvMap[conv.ID]; ok {
 			agentConvID = aid
-			_ = s.agent.SetConversationID(aid)
 		} else {
 			agentConvID = s.agent.GetConversationID()
 			s.agentConvMap[conv.ID] = agentConvID
@@ -222,7 +630,15 @@ func (s *Server) handleChatStream(w http.ResponseWriter, r *http.Request) {
 	// 添加用户消息到会话缓存
 	userMsg := Message{Role: "user", Content: message}
 	conv.Messages = append(conv.Messages, userMsg)
+	touchConversation(conv)
 	s.mu.Unlock()
+	r = r.WithContext(logger.WithContextFields(r.Context(), map[string]interface{}{"conversation_id": conv.ID}))
+
+	// 不支持SSE的客户端：服务端照常流式生成，组装完成后一次性返回JSON
+	if wantsJSONResponse(r) {
+		s.respondStreamAsJSON(w, r, conv, agentConvID, message)
+		return
+	}
 
 	// 设置SSE响应头
 	w.Header().Set("Content-Type", "text/event-stream")
@@ -250,38 +666,185 @@ func (s *Server) handleChatStream(w http.ResponseWriter, r *http.Request) {
 	flusher.Flush()
 
 	// 准备流式通道
-	streamChan := make(chan string, 100)
+	streamChan := make(chan agent.StreamEvent, 100)
 
 	// 启动Agent流式处理（包含工具闭环）
+	// 使用可取消的请求上下文：客户端断开或长时间不读取时取消生成
+	ctx, cancel := context.WithCancel(withAgentConversation(r.Context(), agentConvID))
+	defer cancel()
+	ctx, span := tracing.StartSpan(ctx, "chat.request")
+	defer span.End()
 	go func() {
-		// 使用请求上下文以便断开时取消
-		_ = s.agent.ProcessStream(r.Context(), message, streamChan)
+		_ = s.processStreamEvents(ctx, message, streamChan)
 	}()
 
-	// 将流式内容转发为SSE data事件
+	// 正文片段转发为SSE data事件，思考事件转发为命名事件，只处理 data 的客户端不受影响
+	rc := http.NewResponseController(w)
+	var answer strings.Builder
 	for {
 		select {
-		case <-r.Context().Done():
-			close(streamChan)
+		case <-ctx.Done():
+			abandonStream(cancel, streamChan)
 			return
-		case chunk, ok := <-streamChan:
+		case event, ok := <-streamChan:
 			if !ok {
+				if answer.Len() > 0 {
+					// SSE 回复不写入会话缓存，生成标题时作为待定消息附在缓存的消息之后
+					s.mu.Lock()
+					s.maybeGenerateTitle(conv, Message{Role: "assistant", Content: answer.String()})
+					s.mu.Unlock()
+				}
 				// 结束事件
-				_, _ = w.Write([]byte("event: done\n"))
-				_, _ = w.Write([]byte("data: done\n\n"))
-				flusher.Flush()
+				_ = s.writeSSE(rc, w, "event: done\ndata: done\n\n")
+				return
+			}
+			if event.IsContent() {
+				answer.WriteString(event.Data)
+			}
+			if err := s.writeSSE(rc, w, sseEvent(event, encoding)); err != nil {
+				logger.FromContext(r.Context()).Warn("SSE客户端写入超时或断开，取消生成", map[string]interface{}{
+					"conversation_id": conv.ID,
+					"remote_addr":     r.RemoteAddr,
+					"error":           err.Error(),
+				})
+				abandonStream(cancel, streamChan)
 				return
 			}
-			// 正常数据块
-			esc, _ := json.Marshal(chunk)
-			_, _ = w.Write([]byte("data: "))
-			_, _ = w.Write(esc)
-			_, _ = w.Write([]byte("\n\n"))
-			flusher.Flush()
 		}
 	}
 }
 
+// writeSSE 在写超时限制内写入并刷新一段SSE数据，客户端长时间不读取时返回错误
+func (s *Server) writeSSE(rc *http.ResponseController, w http.ResponseWriter, data string) error {
+	if s.streamWriteTimeout > 0 {
+		// 部分 ResponseWriter 不支持设置写超时，此时退化为阻塞写入
+		_ = rc.SetWriteDeadline(time.Now().Add(s.streamWriteTimeout))
+	}
+	if _, err := w.Write([]byte(data)); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
+
+// StreamEncodingHeader 选择SSE事件编码的请求头，查询参数 encoding 优先
+const StreamEncodingHeader = "X-Stream-Encoding"
+
+// streamEncoding SSE事件的编码方式
+type streamEncoding string
+
+const (
+	// streamEncodingJSON 类型化事件（默认）：正文为 JSON 字符串，思考事件为 event: thinking 的 JSON 对象
+	streamEncodingJSON streamEncoding = "json"
+	// streamEncodingRaw 纯文本：正文按原文写入 data 行，思考事件以类型为事件名、说明为纯文本
+	streamEncodingRaw streamEncoding = "raw"
+)
+
+// parseStreamEncoding 从查询参数 encoding 或 X-Stream-Encoding 请求头读取编码（不区分大小写），未指定时为 json
+func parseStreamEncoding(r *http.Request) (streamEncoding, bool) {
+	name := r.URL.Query().Get("encoding")
+	if name == "" {
+		name = r.Header.Get(StreamEncodingHeader)
+	}
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", string(streamEncodingJSON):
+		return streamEncodingJSON, true
+	case string(streamEncodingRaw):
+		return streamEncodingRaw, true
+	default:
+		return "", false
+	}
+}
+
+// sseEvent 按 encoding 将流式事件编码为SSE
+// json：正文为 data 事件（JSON 字符串），思考事件为 event: thinking（JSON 对象）
+// raw：正文为 data 事件（原文，多行拆成多个 data 行），思考事件为 event: <类型>（说明原文）
+func sseEvent(event agent.StreamEvent, encoding streamEncoding) string {
+	if encoding == streamEncodingRaw {
+		if event.IsContent() {
+			return sseText("", event.Data)
+		}
+		return sseText(event.Kind, event.Data)
+	}
+	if event.IsContent() {
+		esc, _ := json.Marshal(event.Data)
+		return "data: " + string(esc) + "\n\n"
+	}
+	esc, _ := json.Marshal(event)
+	return "event: thinking\ndata: " + string(esc) + "\n\n"
+}
+
+// sseText 将纯文本编码为一个SSE事件，每行一个 data 字段，客户端按换行拼接后即为原文
+func sseText(name, text string) string {
+	var sb strings.Builder
+	if name != "" {
+		sb.WriteString("event: " + name + "\n")
+	}
+	text = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(text)
+	for _, line := range strings.Split(text, "\n") {
+		sb.WriteString("data: " + line + "\n")
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// processStreamEvents 执行流式处理并输出类型化事件，结束时关闭 events
+// Agent 未实现 agent.EventStreamer 时调用 ProcessStream，并将其文本数据块中的思考事件标记还原为事件
+func (s *Server) processStreamEvents(ctx context.Context, message string, events chan<- agent.StreamEvent) error {
+	if es, ok := s.agent.(agent.EventStreamer); ok {
+		return es.ProcessStreamEvents(ctx, message, events)
+	}
+	chunks := make(chan string, 100)
+	go func() {
+		defer close(events)
+		for chunk := range chunks {
+			events <- agent.ParseStreamChunk(chunk)
+		}
+	}()
+	return s.agent.ProcessStream(ctx, message, chunks)
+}
+
+// withAgentConversation 将本轮绑定到 Agent 会话，多个会话的轮次并发执行时各自使用自己的历史
+// agentConvID 为空时（Agent 不支持持久化）沿用 Agent 的当前会话
+func withAgentConversation(ctx context.Context, agentConvID string) context.Context {
+	if agentConvID == "" {
+		return ctx
+	}
+	return agent.WithConversationID(ctx, agentConvID)
+}
+
+// turnStats 返回 Agent 会话最近一轮的统计
+// Agent 未实现 agent.TurnReporter 时回退到报告当前会话的可选接口
+func (s *Server) turnStats(agentConvID string) agent.TurnStats {
+	if tr, ok := s.agent.(agent.TurnReporter); ok && agentConvID != "" {
+		if stats, ok := tr.LastTurn(agentConvID); ok {
+			return stats
+		}
+	}
+	var stats agent.TurnStats
+	if ur, ok := s.agent.(usageReporter); ok {
+		stats.Usage = ur.LastUsage()
+	}
+	if tr, ok := s.agent.(historyTrimReporter); ok {
+		stats.HistoryTrimmed = tr.HistoryTrimmed()
+	}
+	if cr, ok := s.agent.(citationReporter); ok {
+		stats.CitationMissing = cr.CitationMissing()
+	}
+	if sp, ok := s.agent.(sourcesProvider); ok {
+		stats.Sources = sp.GetLastSources()
+	}
+	return stats
+}
+
+// abandonStream 取消生成并在后台排空通道，避免生产者阻塞在已无人读取的通道上
+func abandonStream(cancel context.CancelFunc, streamChan <-chan agent.StreamEvent) {
+	cancel()
+	go func() {
+		for range streamChan {
+		}
+	}()
+}
+
 // 生成唯一ID
 func generateID() string {
 	// 简单实现，实际应用中应使用UUID库
@@ -317,14 +880,261 @@ func currentTimestamp() int64 {
 	return time.Now().UnixNano()
 }
 
+// touchConversation 记录会话收到新消息，已归档的会话重新变为活跃，调用方需持有 s.mu
+// 记忆层在保存消息时同样会取消归档
+func touchConversation(conv *Conversation) {
+	conv.UpdatedAt = currentTimestamp()
+	conv.Archived = false
+}
+
+// lastActive 返回会话最近一次活动的时间（纳秒）
+func lastActive(conv *Conversation) int64 {
+	return max(conv.CreatedAt, conv.UpdatedAt)
+}
+
+// StartAutoArchive 启动后台任务，定期归档超过 after 未收到消息的会话；after<=0 时不启动，ctx 结束时停止
+// 启动时立即检查一次，之后每隔 after 与 DefaultAutoArchiveCheckInterval 中较小者检查一次
+func (s *Server) StartAutoArchive(ctx context.Context, after time.Duration) {
+	if after <= 0 {
+		return
+	}
+	interval := min(after, DefaultAutoArchiveCheckInterval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.archiveInactive(ctx, time.Now().Add(-after))
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// archiveInactive 归档最近活动早于 cutoff 的会话，返回本次归档的数量
+// 会话拥有独立的记忆会话时先持久化归档状态，失败的会话保持活跃，下次检查时重试
+// 持久化在锁外进行，不阻塞其他请求；期间收到新消息的会话不再归档
+func (s *Server) archiveInactive(ctx context.Context, cutoff time.Time) int {
+	type staleConversation struct {
+		id      string
+		persist bool
+	}
+	s.mu.Lock()
+	var stale []staleConversation
+	for id, conv := range s.conversations {
+		if conv.Archived || lastActive(conv) >= cutoff.UnixNano() {
+			continue
+		}
+		stale = append(stale, staleConversation{id: id, persist: s.agentConvMap[id] == id})
+	}
+	s.mu.Unlock()
+
+	archiver, _ := s.agent.(conversationArchiver)
+	var persisted []string
+	for _, c := range stale {
+		if archiver != nil && c.persist {
+			if err := archiver.ArchiveConversation(ctx, c.id, true); err != nil {
+				logger.Warn("保存会话归档状态失败", map[string]interface{}{"conversation_id": c.id, "error": err.Error()})
+				continue
+			}
+		}
+		persisted = append(persisted, c.id)
+	}
+
+	s.mu.Lock()
+	archived := 0
+	var revert []string
+	for _, id := range persisted {
+		conv, ok := s.conversations[id]
+		if !ok || conv.Archived {
+			continue
+		}
+		if lastActive(conv) >= cutoff.UnixNano() {
+			if archiver != nil && s.agentConvMap[id] == id {
+				revert = append(revert, id)
+			}
+			continue
+		}
+		conv.Archived = true
+		archived++
+	}
+	s.mu.Unlock()
+
+	// 持久化期间会话又有了新消息：撤销记忆中的归档状态
+	for _, id := range revert {
+		if err := archiver.ArchiveConversation(ctx, id, false); err != nil {
+			logger.Warn("撤销会话归档状态失败", map[string]interface{}{"conversation_id": id, "error": err.Error()})
+		}
+	}
+	if archived > 0 {
+		logger.Info("已自动归档不活跃会话", map[string]interface{}{"count": archived})
+	}
+	return archived
+}
+
+// handleCache 清空LLM响应缓存（DELETE）
+func (s *Server) handleCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	clearer, ok := s.agent.(cacheClearer)
+	if !ok {
+		http.Error(w, "Response cache not supported", http.StatusNotImplemented)
+		return
+	}
+	clearer.ClearResponseCache()
+	logger.FromContext(r.Context()).Info("已清空响应缓存")
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Response cache cleared",
+	})
+}
+
 // handleHealth 健康检查端点
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	status := map[string]interface{}{
+		"status":    "healthy",
+		"timestamp": time.Now().Unix(),
+	}
+	if pr, ok := s.agent.(persistenceReporter); ok {
+		status["persistence_enabled"] = pr.PersistenceEnabled()
+	}
+	// 后端不可达时仍返回 200，由 status 区分，避免负载均衡因共同依赖的后端故障摘除全部实例
+	if checker, ok := s.agent.(llmHealthChecker); ok {
+		health := s.checkLLMHealth(r.Context(), checker)
+		status["provider"] = health.Provider
+		status["model"] = health.Model
+		status["llm"] = health
+		if health.Checked && !health.Reachable {
+			status["status"] = "degraded"
+			status["error"] = health.Error
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status": "healthy",
-		"timestamp": time.Now().Unix(),
-	})
+	json.NewEncoder(w).Encode(status)
+}
+
+// checkLLMHealth 返回LLM连通性检查结果，HealthCheckCacheTTL 内复用上一次的结果
+func (s *Server) checkLLMHealth(ctx context.Context, checker llmHealthChecker) agent.LLMHealth {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	if !s.llmHealthAt.IsZero() && time.Since(s.llmHealthAt) < HealthCheckCacheTTL {
+		return s.llmHealth
+	}
+	s.llmHealth = checker.CheckLLMHealth(ctx)
+	s.llmHealthAt = time.Now()
+	if s.llmHealth.Checked && !s.llmHealth.Reachable {
+		logger.FromContext(ctx).Warn("LLM后端不可达", map[string]interface{}{
+			"provider": s.llmHealth.Provider,
+			"model":    s.llmHealth.Model,
+			"error":    s.llmHealth.Error,
+		})
+	}
+	return s.llmHealth
+}
+
+// wantsJSONResponse 判断流式接口的客户端是否要求以单个JSON返回
+func wantsJSONResponse(r *http.Request) bool {
+	if strings.EqualFold(r.URL.Query().Get("format"), "json") {
+		return true
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/event-stream")
+}
+
+// respondStreamAsJSON 在服务端执行 ProcessStream（含工具闭环），拼接正文数据块后一次性返回JSON
+func (s *Server) respondStreamAsJSON(w http.ResponseWriter, r *http.Request, conv *Conversation, agentConvID, message string) {
+	ctx, cancel := context.WithCancel(withAgentConversation(r.Context(), agentConvID))
+	defer cancel()
+	ctx, span := tracing.StartSpan(ctx, "chat.request")
+	defer span.End()
+
+	start := time.Now()
+	streamChan := make(chan agent.StreamEvent, 100)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- s.processStreamEvents(ctx, message, streamChan)
+	}()
+
+	var answer strings.Builder
+	var usage StreamUsage
+	for done := false; !done; {
+		select {
+		case <-ctx.Done():
+			abandonStream(cancel, streamChan)
+			return
+		case err := <-errChan:
+			if err != nil {
+				tracing.EndSpan(span, err)
+				logger.FromContext(r.Context()).Error("处理消息失败", map[string]interface{}{
+					"conversation_id": conv.ID,
+					"error":           err.Error(),
+				})
+				abandonStream(cancel, streamChan)
+				http.Error(w, "Failed to process message", http.StatusInternalServerError)
+				return
+			}
+			// 生成已结束，继续读取直到通道关闭
+			errChan = nil
+		case event, ok := <-streamChan:
+			if !ok {
+				done = true
+				break
+			}
+			if !event.IsContent() {
+				usage.ThinkingEvents++
+				continue
+			}
+			usage.Chunks++
+			answer.WriteString(event.Data)
+		}
+	}
+	// 流通道可能先于错误返回关闭，此时补读本轮结果
+	if errChan != nil {
+		if err := <-errChan; err != nil {
+			tracing.EndSpan(span, err)
+			logger.FromContext(r.Context()).Error("处理消息失败", map[string]interface{}{
+				"conversation_id": conv.ID,
+				"error":           err.Error(),
+			})
+			http.Error(w, "Failed to process message", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	assistantMsg := Message{Role: "assistant", Content: answer.String()}
+	usage.Characters = len([]rune(assistantMsg.Content))
+	usage.DurationMs = time.Since(start).Milliseconds()
+	stats := s.turnStats(agentConvID)
+	usage.PromptTokens = stats.Usage.PromptTokens
+	usage.CompletionTokens = stats.Usage.CompletionTokens
+
+	s.mu.Lock()
+	conv.Messages = append(conv.Messages, assistantMsg)
+	s.maybeGenerateTitle(conv)
+	s.mu.Unlock()
+
+	resp := StreamJSONResponse{
+		ConversationID:      conv.ID,
+		AgentConversationID: agentConvID,
+		Message:             assistantMsg,
+		Usage:               usage,
+		Sources:             stats.Sources,
+		HistoryTrimmed:      stats.HistoryTrimmed,
+		CitationMissing:     stats.CitationMissing,
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(resp)
 }
 
 // handleConversations 处理会话列表请求
@@ -338,52 +1148,104 @@ func (s *Server) handleConversations(w http.ResponseWriter, r *http.Request) {
 
 // handleListConversations 列出所有会话
 func (s *Server) handleListConversations(w http.ResponseWriter, r *http.Request) {
+	limit, ok := pageParam(r, "limit", s.conversationPageSize)
+	if !ok {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	if limit > MaxConversationPageSize {
+		limit = MaxConversationPageSize
+	}
+	offset, ok := pageParam(r, "offset", 0)
+	if !ok {
+		http.Error(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// 将所有会话转换为列表
+	// 将会话转换为列表，已归档的会话仅在 include_archived=true 时返回
 	type ConversationInfo struct {
-		ID        string `json:"id"`
-		Title     string `json:"title"`
-		CreatedAt int64  `json:"created_at"`
-		MessageCount int `json:"message_count"`
+		ID           string `json:"id"`
+		Title        string `json:"title"`
+		CreatedAt    int64  `json:"created_at"`
+		MessageCount int    `json:"message_count"`
+		Archived     bool   `json:"archived,omitempty"`
 	}
 
+	includeArchived := r.URL.Query().Get("include_archived") == "true"
 	conversations := make([]ConversationInfo, 0, len(s.conversations))
 	for id, conv := range s.conversations {
-		// 生成标题：使用第一条用户消息或默认标题
-		title := "新对话"
-		for _, msg := range conv.Messages {
-			if msg.Role == "user" {
-				title = msg.Content
-				if len(title) > 30 {
-					title = title[:30] + "..."
-				}
-				break
-			}
+		if conv.Archived && !includeArchived {
+			continue
 		}
-
 		conversations = append(conversations, ConversationInfo{
-			ID:        id,
-			Title:     title,
-			CreatedAt: conv.CreatedAt,
+			ID:           id,
+			Title:        conversationTitle(conv),
+			CreatedAt:    conv.CreatedAt,
 			MessageCount: len(conv.Messages),
+			Archived:     conv.Archived,
 		})
 	}
 
-	// 按创建时间倒序排序
-	for i := 0; i < len(conversations); i++ {
-		for j := i + 1; j < len(conversations); j++ {
-			if conversations[i].CreatedAt < conversations[j].CreatedAt {
-				conversations[i], conversations[j] = conversations[j], conversations[i]
-			}
+	// 按创建时间倒序排序，时间相同时按ID排序，保证各页之间顺序稳定
+	sort.Slice(conversations, func(i, j int) bool {
+		a, b := conversations[i], conversations[j]
+		if a.CreatedAt != b.CreatedAt {
+			return a.CreatedAt > b.CreatedAt
 		}
-	}
+		return a.ID < b.ID
+	})
+
+	// 排序后再分页，保证各页之间顺序一致
+	// 分别与剩余数量比较，避免 offset+limit 溢出
+	total := len(conversations)
+	start := min(offset, total)
+	end := start + min(limit, total-start)
+	page := conversations[start:end]
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"conversations": conversations,
-		"total": len(conversations),
+		"conversations": page,
+		"total":         total,
+		"limit":         limit,
+		"offset":        offset,
+		"has_more":      end < total,
+	})
+}
+
+// pageParam 解析非负整数分页参数，未提供时返回默认值，不是非负整数时返回 false
+func pageParam(r *http.Request, name string, def int) (int, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// handleTools 列出 Agent 已注册的工具
+func (s *Server) handleTools(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tools := s.agent.ListTools()
+	if tools == nil {
+		tools = []agent.ToolInfo{}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(map[string]interface{}{
+		"tools": tools,
+		"total": len(tools),
 	})
 }
 
@@ -391,6 +1253,30 @@ func (s *Server) handleListConversations(w http.ResponseWriter, r *http.Request)
 func (s *Server) handleConversationDetail(w http.ResponseWriter, r *http.Request) {
 	// 提取会话ID
 	convID := strings.TrimPrefix(r.URL.Path, "/api/conversations/")
+	if id, ok := strings.CutSuffix(convID, "/replay"); ok {
+		if id == "" {
+			http.Error(w, "Conversation ID required", http.StatusBadRequest)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.handleReplayConversation(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(convID, "/export.md"); ok {
+		if id == "" {
+			http.Error(w, "Conversation ID required", http.StatusBadRequest)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.handleExportMarkdown(w, r, id)
+		return
+	}
 	if convID == "" {
 		http.Error(w, "Conversation ID required", http.StatusBadRequest)
 		return
@@ -421,12 +1307,31 @@ func (s *Server) handleGetConversation(w http.ResponseWriter, r *http.Request, c
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"id": conv.ID,
-		"messages": conv.Messages,
-		"created_at": conv.CreatedAt,
+		"id":            conv.ID,
+		"title":         conversationTitle(conv),
+		"system_prompt": conv.SystemPrompt,
+		"archived":      conv.Archived,
+		"messages":      conv.Messages,
+		"created_at":    conv.CreatedAt,
 	})
 }
 
+// conversationTitle 返回会话标题：优先使用设置的标题，其次第一条用户消息（最多30个字符），最后默认标题
+func conversationTitle(conv *Conversation) string {
+	if conv.Title != "" {
+		return conv.Title
+	}
+	for _, msg := range conv.Messages {
+		if msg.Role == "user" {
+			if runes := []rune(msg.Content); len(runes) > 30 {
+				return string(runes[:30]) + "..."
+			}
+			return msg.Content
+		}
+	}
+	return "新对话"
+}
+
 // handleDeleteConversation 删除指定会话
 func (s *Server) handleDeleteConversation(w http.ResponseWriter, r *http.Request, convID string) {
 	s.mu.Lock()
@@ -437,8 +1342,18 @@ func (s *Server) handleDeleteConversation(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// 会话拥有独立的记忆会话时一并删除持久化数据
+	// 删除失败时保留会话，否则重启后会从残留的文件中恢复
+	if store, ok := s.agent.(conversationStore); ok && s.agentConvMap[convID] == convID {
+		if err := store.DeleteConversation(r.Context(), convID); err != nil {
+			logger.FromContext(r.Context()).Error("删除记忆会话失败", map[string]interface{}{"conversation_id": convID, "error": err.Error()})
+			http.Error(w, "Failed to delete conversation", http.StatusInternalServerError)
+			return
+		}
+	}
 	delete(s.conversations, convID)
 	delete(s.agentConvMap, convID)
+	s.convLimiter.Forget(convID)
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
@@ -448,8 +1363,17 @@ func (s *Server) handleDeleteConversation(w http.ResponseWriter, r *http.Request
 	})
 }
 
-// handleUpdateConversation 更新会话信息（目前支持更新标题）
+// handleUpdateConversation 更新会话信息：标题与专属系统提示词，未提供的字段保持不变
 func (s *Server) handleUpdateConversation(w http.ResponseWriter, r *http.Request, convID string) {
+	// 在获取锁之前解析请求体
+	var req struct {
+		Title        *string `json:"title"`
+		SystemPrompt *string `json:"system_prompt"`
+	}
+	if !s.decodeJSONBody(w, r, &req) {
+		return
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -459,23 +1383,163 @@ func (s *Server) handleUpdateConversation(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// 解析请求体
-	var req struct {
-		Title string `json:"title"`
+	// 专属提示词保存在 Agent 的记忆会话中，切换会话时随之生效，先检查再修改任何字段
+	var promptStore systemPromptStore
+	if req.SystemPrompt != nil {
+		ps, ok := s.agent.(systemPromptStore)
+		if !ok || s.agentConvMap[convID] == "" {
+			http.Error(w, "System prompt override not supported", http.StatusNotImplemented)
+			return
+		}
+		promptStore = ps
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+
+	if req.Title != nil {
+		// 空标题表示恢复为按第一条用户消息生成的标题
+		title := strings.TrimSpace(*req.Title)
+
+		// 会话拥有独立的记忆会话时先持久化，失败时保留原标题，避免重启后标题回退
+		if store, ok := s.agent.(conversationStore); ok && s.agentConvMap[convID] == convID {
+			if err := store.RenameConversation(r.Context(), convID, title); err != nil {
+				logger.FromContext(r.Context()).Error("保存会话标题失败", map[string]interface{}{"conversation_id": convID, "error": err.Error()})
+				http.Error(w, "Failed to update conversation", http.StatusInternalServerError)
+				return
+			}
+		}
+		conv.Title = title
 	}
 
-	// 暂时将标题存储在 Context 中（简化实现）
-	// 实际项目中应该扩展 Conversation 结构体
-	_ = conv
+	if promptStore != nil {
+		// 空提示词表示恢复使用全局提示词
+		prompt := strings.TrimSpace(*req.SystemPrompt)
+		if err := promptStore.SetConversationSystemPrompt(r.Context(), s.agentConvMap[convID], prompt); err != nil {
+			logger.FromContext(r.Context()).Error("保存会话系统提示词失败", map[string]interface{}{"conversation_id": convID, "error": err.Error()})
+			http.Error(w, "Failed to update conversation", http.StatusInternalServerError)
+			return
+		}
+		conv.SystemPrompt = prompt
+	}
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Conversation updated",
-		"title": req.Title,
+		"success":       true,
+		"message":       "Conversation updated",
+		"title":         conversationTitle(conv),
+		"system_prompt": conv.SystemPrompt,
 	})
 }
+
+// ConversationTurn 表示一轮对话：一条用户消息及其后续的回复
+type ConversationTurn struct {
+	Messages []Message `json:"messages"`
+}
+
+// TurnComparison 表示两个会话在同一轮次上的对比
+type TurnComparison struct {
+	Index     int               `json:"index"`
+	A         *ConversationTurn `json:"a"` // 会话A不存在该轮次时为 null
+	B         *ConversationTurn `json:"b"` // 会话B不存在该轮次时为 null
+	Identical bool              `json:"identical"`
+}
+
+// splitTurns 按用户消息将消息列表切分为轮次
+func splitTurns(messages []Message) []ConversationTurn {
+	var turns []ConversationTurn
+	for _, msg := range messages {
+		if msg.Role == "user" || len(turns) == 0 {
+			turns = append(turns, ConversationTurn{})
+		}
+		last := &turns[len(turns)-1]
+		last.Messages = append(last.Messages, msg)
+	}
+	return turns
+}
+
+// compareTurns 将两个会话的轮次按序号对齐，长度不同时缺失的一侧为 null
+func compareTurns(a, b []ConversationTurn) []TurnComparison {
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+	result := make([]TurnComparison, 0, n)
+	for i := 0; i < n; i++ {
+		cmp := TurnComparison{Index: i}
+		if i < len(a) {
+			cmp.A = &a[i]
+		}
+		if i < len(b) {
+			cmp.B = &b[i]
+		}
+		cmp.Identical = cmp.A != nil && cmp.B != nil && sameMessages(cmp.A.Messages, cmp.B.Messages)
+		result = append(result, cmp)
+	}
+	return result
+}
+
+// sameMessages 判断两组消息是否完全一致
+func sameMessages(a, b []Message) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// handleCompareConversations 按轮次对齐比较两个会话
+func (s *Server) handleCompareConversations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idA := r.URL.Query().Get("a")
+	idB := r.URL.Query().Get("b")
+	if idA == "" || idB == "" {
+		http.Error(w, "Both a and b conversation IDs are required", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	convA, okA := s.conversations[idA]
+	convB, okB := s.conversations[idB]
+	var turnsA, turnsB []ConversationTurn
+	if okA && okB {
+		turnsA = splitTurns(convA.Messages)
+		turnsB = splitTurns(convB.Messages)
+	}
+	s.mu.Unlock()
+
+	if !okA || !okB {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(map[string]interface{}{
+		"a":       idA,
+		"b":       idB,
+		"a_turns": len(turnsA),
+		"b_turns": len(turnsB),
+		"turns":   compareTurns(turnsA, turnsB),
+	})
+}
+
+// rejectLongInput Agent 实现 agent.InputValidator 时校验用户输入，超长时返回 413 及具体原因并返回 true
+func (s *Server) rejectLongInput(w http.ResponseWriter, r *http.Request, message string) bool {
+	validator, ok := s.agent.(agent.InputValidator)
+	if !ok {
+		return false
+	}
+	if err := validator.ValidateInput(message); err != nil {
+		logger.FromContext(r.Context()).Warn("拒绝超长输入", map[string]interface{}{"message_length": len(message), "error": err.Error()})
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return true
+	}
+	return false
+}
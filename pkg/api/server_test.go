@@ -0,0 +1,1328 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"agentEino/pkg/agent"
+)
+
+// addTestConversation 向服务器直接写入一个会话，消息按 user/assistant 交替排列
+func addTestConversation(s *Server, id string, contents ...string) {
+	conv := &Conversation{ID: id}
+	for i, content := range contents {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		conv.Messages = append(conv.Messages, Message{Role: role, Content: content})
+	}
+	s.conversations[id] = conv
+}
+
+func TestCompareConversationsAlignsDivergingTurns(t *testing.T) {
+	s := NewServer(nil)
+	addTestConversation(s, "a", "你好", "你好！", "1+1=?", "2", "谢谢", "不客气")
+	addTestConversation(s, "b", "你好", "你好！", "1+1=?", "等于 2")
+
+	w := httptest.NewRecorder()
+	s.handleCompareConversations(w, httptest.NewRequest(http.MethodGet, "/api/conversations/compare?a=a&b=b", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		ATurns int              `json:"a_turns"`
+		BTurns int              `json:"b_turns"`
+		Turns  []TurnComparison `json:"turns"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.ATurns != 3 || resp.BTurns != 2 || len(resp.Turns) != 3 {
+		t.Fatalf("轮次数 a=%d b=%d turns=%d，期望 3/2/3", resp.ATurns, resp.BTurns, len(resp.Turns))
+	}
+	if !resp.Turns[0].Identical {
+		t.Error("第 1 轮内容相同，应标记为 identical")
+	}
+	second := resp.Turns[1]
+	if second.Identical || second.A.Messages[1].Content != "2" || second.B.Messages[1].Content != "等于 2" {
+		t.Errorf("第 2 轮回复不同，对比结果不正确: %+v", second)
+	}
+	third := resp.Turns[2]
+	if third.A == nil || third.B != nil || third.Identical {
+		t.Errorf("第 3 轮只存在于会话 a，B 应为 null: %+v", third)
+	}
+}
+
+func TestCompareConversationsErrors(t *testing.T) {
+	s := NewServer(nil)
+	addTestConversation(s, "a", "你好")
+
+	cases := []struct {
+		query string
+		code  int
+	}{
+		{"?a=a", http.StatusBadRequest},
+		{"?a=a&b=missing", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		s.handleCompareConversations(w, httptest.NewRequest(http.MethodGet, "/api/conversations/compare"+c.query, nil))
+		if w.Code != c.code {
+			t.Errorf("%s: 状态码 = %d，期望 %d", c.query, w.Code, c.code)
+		}
+	}
+}
+
+// stubAgent 只实现测试所需方法的 Agent，其余方法调用时 panic
+type stubAgent struct {
+	agent.Agent
+	process func(ctx context.Context, input string) (string, error)
+	stream  func(ctx context.Context, input string, responseChan chan<- string) error
+}
+
+func (a *stubAgent) Process(ctx context.Context, input string) (string, error) {
+	return a.process(ctx, input)
+}
+
+func (a *stubAgent) ProcessStream(ctx context.Context, input string, responseChan chan<- string) error {
+	return a.stream(ctx, input, responseChan)
+}
+
+func (a *stubAgent) GetConversationID() string      { return "agent_conv" }
+func (a *stubAgent) SetConversationID(string) error { return nil }
+
+func TestSlowStreamClientCancelsGeneration(t *testing.T) {
+	cancelled := make(chan struct{})
+	chunk := strings.Repeat("数据", 32*1024)
+	s := NewServer(&stubAgent{stream: func(ctx context.Context, input string, responseChan chan<- string) error {
+		defer close(responseChan)
+		for {
+			select {
+			case responseChan <- chunk:
+			case <-ctx.Done():
+				close(cancelled)
+				return ctx.Err()
+			}
+		}
+	}})
+	s.SetStreamWriteTimeout(50 * time.Millisecond)
+	srv := httptest.NewServer(http.HandlerFunc(s.handleChatStream))
+	defer srv.Close()
+
+	// 发送请求后不读取响应，模拟卡住的客户端
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET /api/chat/stream?message=hi HTTP/1.1\r\nHost: test\r\n\r\n")
+
+	select {
+	case <-cancelled:
+	case <-time.After(10 * time.Second):
+		t.Fatal("客户端不读取时应取消生成")
+	}
+}
+
+func TestStreamJSONAssemblesChunks(t *testing.T) {
+	chunks := []string{"你好，", "[THINKING:generating:正在生成回复...]", "这是", "完整的回答。"}
+	s := NewServer(&stubAgent{stream: func(ctx context.Context, input string, responseChan chan<- string) error {
+		defer close(responseChan)
+		for _, c := range chunks {
+			responseChan <- c
+		}
+		return nil
+	}})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/chat/stream?message=hi&format=json", nil),
+		func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, "/api/chat/stream?message=hi", nil)
+			r.Header.Set("Accept", "application/json")
+			return r
+		}(),
+	} {
+		w := httptest.NewRecorder()
+		s.handleChatStream(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("状态码 = %d: %s", w.Code, w.Body.String())
+		}
+		var resp StreamJSONResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("响应不是JSON: %v: %s", err, w.Body.String())
+		}
+		if want := "你好，这是完整的回答。"; resp.Message.Content != want {
+			t.Errorf("组装的回答 = %q，期望 %q", resp.Message.Content, want)
+		}
+		if resp.Usage.Chunks != 3 || resp.Usage.ThinkingEvents != 1 {
+			t.Errorf("统计信息 = %+v，期望 3 个数据块、1 个思维链事件", resp.Usage)
+		}
+		if resp.Message.Role != "assistant" || resp.ConversationID == "" {
+			t.Errorf("响应缺少会话信息: %+v", resp)
+		}
+	}
+}
+
+func TestStreamJSONReturnsErrorWhenProcessingFails(t *testing.T) {
+	s := NewServer(&stubAgent{stream: func(ctx context.Context, input string, responseChan chan<- string) error {
+		close(responseChan)
+		return errors.New("模型不可用")
+	}})
+	w := httptest.NewRecorder()
+	s.handleChatStream(w, httptest.NewRequest(http.MethodGet, "/api/chat/stream?message=hi&format=json", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("处理失败时状态码 = %d，期望 500", w.Code)
+	}
+}
+
+// trimmingAgent 报告本轮裁剪了历史的 Agent
+type trimmingAgent struct {
+	*stubAgent
+	trimmed int
+}
+
+func (a *trimmingAgent) HistoryTrimmed() int { return a.trimmed }
+
+func TestChatResponseReportsHistoryTrimmed(t *testing.T) {
+	s := NewServer(&trimmingAgent{
+		stubAgent: &stubAgent{
+			process: func(ctx context.Context, input string) (string, error) { return "回复", nil },
+			stream: func(ctx context.Context, input string, responseChan chan<- string) error {
+				defer close(responseChan)
+				responseChan <- "回复"
+				return nil
+			},
+		},
+		trimmed: 4,
+	})
+
+	w := httptest.NewRecorder()
+	s.handleChat(w, httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(`{"message":"你好"}`)))
+	var resp ChatResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v: %s", err, w.Body.String())
+	}
+	if resp.HistoryTrimmed != 4 {
+		t.Errorf("history_trimmed = %d，期望 4", resp.HistoryTrimmed)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleChatStream(w, httptest.NewRequest(http.MethodGet, "/api/chat/stream?message=hi&format=json", nil))
+	var streamResp StreamJSONResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &streamResp); err != nil {
+		t.Fatalf("解析响应失败: %v: %s", err, w.Body.String())
+	}
+	if streamResp.HistoryTrimmed != 4 {
+		t.Errorf("流式JSON响应的 history_trimmed = %d，期望 4", streamResp.HistoryTrimmed)
+	}
+}
+
+// detailedAgent 支持 ProcessDetailed 的测试 Agent
+type detailedAgent struct {
+	*stubAgent
+	detail *agent.ProcessResult
+}
+
+func (d *detailedAgent) ProcessDetailed(ctx context.Context, input string) (*agent.ProcessResult, error) {
+	return d.detail, nil
+}
+
+func TestChatIncludesToolCallsOnRequest(t *testing.T) {
+	s := NewServer(&detailedAgent{
+		stubAgent: &stubAgent{process: func(ctx context.Context, input string) (string, error) { return "晴", nil }},
+		detail: &agent.ProcessResult{
+			Response: "晴",
+			Decision: `{"tool":"weather","params":{"city":"北京"}}`,
+			ToolCalls: []agent.ToolCallRecord{
+				{Iteration: 1, Tool: "weather", Params: map[string]interface{}{"city": "北京"}, Result: "晴"},
+			},
+		},
+	})
+
+	for _, include := range []bool{true, false} {
+		body := fmt.Sprintf(`{"message":"北京天气","include_tool_calls":%v}`, include)
+		w := httptest.NewRecorder()
+		s.handleChat(w, httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("状态码 = %d: %s", w.Code, w.Body.String())
+		}
+		var resp ChatResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		if resp.Message.Content != "晴" {
+			t.Errorf("include=%v: 回复 = %q", include, resp.Message.Content)
+		}
+		if !include {
+			if strings.Contains(w.Body.String(), "tool_calls") || resp.Decision != "" {
+				t.Errorf("未请求时不应返回工具调用记录: %s", w.Body.String())
+			}
+			continue
+		}
+		if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Tool != "weather" || resp.ToolCalls[0].Params["city"] != "北京" || resp.Decision == "" {
+			t.Errorf("请求 include_tool_calls 时应返回工具调用记录: %s", w.Body.String())
+		}
+	}
+}
+
+func TestListConversationsPaginatesNewestFirst(t *testing.T) {
+	s := NewServer(nil)
+	for i := 0; i < 25; i++ {
+		id := fmt.Sprintf("c%02d", i)
+		addTestConversation(s, id, "问题 "+id)
+		s.conversations[id].CreatedAt = int64(i)
+	}
+
+	list := func(query string) (int, []string, int) {
+		w := httptest.NewRecorder()
+		s.handleListConversations(w, httptest.NewRequest(http.MethodGet, "/api/conversations"+query, nil))
+		var resp struct {
+			Conversations []struct {
+				ID string `json:"id"`
+			} `json:"conversations"`
+			Total int `json:"total"`
+		}
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("%s: 解析响应失败: %v", query, err)
+			}
+		}
+		var ids []string
+		for _, c := range resp.Conversations {
+			ids = append(ids, c.ID)
+		}
+		return w.Code, ids, resp.Total
+	}
+
+	code, ids, total := list("")
+	if code != http.StatusOK || total != 25 || len(ids) != DefaultConversationPageSize || ids[0] != "c24" || ids[19] != "c05" {
+		t.Errorf("默认分页: code=%d total=%d ids=%v", code, total, ids)
+	}
+	if _, ids, _ = list("?limit=10&offset=20"); strings.Join(ids, ",") != "c04,c03,c02,c01,c00" {
+		t.Errorf("最后一页 = %v", ids)
+	}
+	for _, query := range []string{"?offset=25", "?offset=9223372036854775807", "?limit=0"} {
+		if code, ids, total := list(query); code != http.StatusOK || len(ids) != 0 || total != 25 {
+			t.Errorf("%s: code=%d ids=%v total=%d，期望空页", query, code, ids, total)
+		}
+	}
+	for _, query := range []string{"?limit=abc", "?limit=-1", "?offset=-5", "?offset=1.5"} {
+		if code, _, _ := list(query); code != http.StatusBadRequest {
+			t.Errorf("%s: 状态码 = %d，期望 400", query, code)
+		}
+	}
+}
+
+func TestListConversationsAppliesConfiguredDefaultLimit(t *testing.T) {
+	s := NewServer(nil)
+	for i := 0; i < 8; i++ {
+		addTestConversation(s, fmt.Sprintf("c%d", i), "你好")
+	}
+
+	page := func(query string) map[string]interface{} {
+		w := httptest.NewRecorder()
+		s.handleListConversations(w, httptest.NewRequest(http.MethodGet, "/api/conversations"+query, nil))
+		var resp map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: 解析响应失败: %v", query, err)
+		}
+		return resp
+	}
+
+	s.SetConversationPageSize(3)
+	resp := page("")
+	if n := len(resp["conversations"].([]interface{})); n != 3 || resp["limit"] != 3.0 || resp["total"] != 8.0 || resp["has_more"] != true {
+		t.Errorf("未指定 limit 时应按配置返回 3 条: %v", resp)
+	}
+	if resp = page("?offset=6"); len(resp["conversations"].([]interface{})) != 2 || resp["has_more"] != false {
+		t.Errorf("最后一页 has_more 应为 false: %v", resp)
+	}
+	if resp = page("?limit=8"); len(resp["conversations"].([]interface{})) != 8 || resp["has_more"] != false {
+		t.Errorf("显式 limit 应覆盖默认值: %v", resp)
+	}
+
+	s.SetConversationPageSize(0)
+	if resp = page(""); resp["limit"] != float64(DefaultConversationPageSize) {
+		t.Errorf("<=0 时应使用默认值: %v", resp["limit"])
+	}
+	s.SetConversationPageSize(1000)
+	if resp = page(""); resp["limit"] != float64(MaxConversationPageSize) {
+		t.Errorf("超过上限时应按上限: %v", resp["limit"])
+	}
+}
+
+func TestListConversationsSortIsStableForEqualTimestamps(t *testing.T) {
+	s := NewServer(nil)
+	for id, created := range map[string]int64{"b": 2, "d": 2, "a": 2, "c": 3, "e": 1} {
+		addTestConversation(s, id, "你好")
+		s.conversations[id].CreatedAt = created
+	}
+
+	for run := 0; run < 5; run++ {
+		w := httptest.NewRecorder()
+		s.handleListConversations(w, httptest.NewRequest(http.MethodGet, "/api/conversations", nil))
+		var resp struct {
+			Conversations []struct {
+				ID string `json:"id"`
+			} `json:"conversations"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		var ids []string
+		for _, c := range resp.Conversations {
+			ids = append(ids, c.ID)
+		}
+		if strings.Join(ids, ",") != "c,a,b,d,e" {
+			t.Fatalf("排序结果 = %v，期望按创建时间倒序、相同时间按ID排序", ids)
+		}
+	}
+}
+
+// storeAgent 实现 conversationStore 的测试 Agent，记录删除与重命名请求
+type storeAgent struct {
+	*stubAgent
+	deleted   []string
+	deleteErr error
+	renamed   map[string]string
+	renameErr error
+}
+
+func (s *storeAgent) NewConversation(ctx context.Context, title string) (string, error) {
+	return "", errors.New("未实现")
+}
+
+func (s *storeAgent) StoredConversations(ctx context.Context) ([]agent.StoredConversation, error) {
+	return nil, nil
+}
+
+func (s *storeAgent) StoredConversation(ctx context.Context, id string) (*agent.StoredConversation, error) {
+	return nil, errors.New("未实现")
+}
+
+func (s *storeAgent) DeleteConversation(ctx context.Context, id string) error {
+	s.deleted = append(s.deleted, id)
+	return s.deleteErr
+}
+
+func (s *storeAgent) RenameConversation(ctx context.Context, id, title string) error {
+	if s.renameErr != nil {
+		return s.renameErr
+	}
+	if s.renamed == nil {
+		s.renamed = make(map[string]string)
+	}
+	s.renamed[id] = title
+	return nil
+}
+
+// promptAgent 实现 systemPromptStore 的测试 Agent，记录每个会话设置的系统提示词
+type promptAgent struct {
+	*storeAgent
+	prompts   map[string]string
+	promptErr error
+}
+
+func (p *promptAgent) SetConversationSystemPrompt(ctx context.Context, id, prompt string) error {
+	if p.promptErr != nil {
+		return p.promptErr
+	}
+	p.prompts[id] = prompt
+	return nil
+}
+
+func TestUpdateConversationSetsSystemPrompt(t *testing.T) {
+	pa := &promptAgent{storeAgent: &storeAgent{stubAgent: &stubAgent{}}, prompts: map[string]string{}}
+	s := NewServer(pa)
+	addTestConversation(s, "conv_1", "你好")
+	s.agentConvMap["conv_1"] = "conv_1"
+	s.conversations["conv_1"].Title = "翻译"
+
+	update := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleUpdateConversation(w, httptest.NewRequest(http.MethodPut, "/api/conversations/conv_1", strings.NewReader(body)), "conv_1")
+		return w
+	}
+
+	// 只更新提示词时保留原标题
+	if w := update(`{"system_prompt":"  你是英文翻译  "}`); w.Code != http.StatusOK {
+		t.Fatalf("更新提示词: %d %s", w.Code, w.Body.String())
+	}
+	if pa.prompts["conv_1"] != "你是英文翻译" {
+		t.Errorf("提示词应传给 Agent 持久化，实际 %v", pa.prompts)
+	}
+	if pa.renamed != nil {
+		t.Errorf("未提供标题时不应重命名，实际 %v", pa.renamed)
+	}
+
+	w := httptest.NewRecorder()
+	s.handleGetConversation(w, httptest.NewRequest(http.MethodGet, "/api/conversations/conv_1", nil), "conv_1")
+	var resp struct {
+		Title        string `json:"title"`
+		SystemPrompt string `json:"system_prompt"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Title != "翻译" || resp.SystemPrompt != "你是英文翻译" {
+		t.Errorf("会话详情 = %+v", resp)
+	}
+
+	pa.promptErr = errors.New("disk full")
+	if w := update(`{"system_prompt":"新提示词"}`); w.Code != http.StatusInternalServerError {
+		t.Errorf("持久化失败应返回 500，实际 %d", w.Code)
+	}
+	if s.conversations["conv_1"].SystemPrompt != "你是英文翻译" {
+		t.Errorf("持久化失败时应保留原提示词，实际 %q", s.conversations["conv_1"].SystemPrompt)
+	}
+}
+
+func TestUpdateConversationReadsBodyOutsideLock(t *testing.T) {
+	s := NewServer(&stubAgent{})
+	addTestConversation(s, "conv_1", "你好")
+
+	// 请求体迟迟不发送完时，其他请求不应被阻塞
+	body, writer := io.Pipe()
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		s.handleUpdateConversation(w, httptest.NewRequest(http.MethodPut, "/api/conversations/conv_1", body), "conv_1")
+		done <- w.Code
+	}()
+	listed := make(chan struct{})
+	go func() {
+		s.handleConversations(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/conversations", nil))
+		close(listed)
+	}()
+	select {
+	case <-listed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("读取请求体期间列出会话被阻塞")
+	}
+	writer.Write([]byte(`{"title":"新标题"}`))
+	writer.Close()
+	if code := <-done; code != http.StatusOK || s.conversations["conv_1"].Title != "新标题" {
+		t.Errorf("更新结果 = %d，标题 %q", code, s.conversations["conv_1"].Title)
+	}
+
+	// 超过请求体上限时返回 413
+	s.SetMaxRequestBodyBytes(16)
+	w := httptest.NewRecorder()
+	s.handleUpdateConversation(w, httptest.NewRequest(http.MethodPut, "/api/conversations/conv_1", strings.NewReader(`{"title":"`+strings.Repeat("a", 64)+`"}`)), "conv_1")
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("超大请求体状态码 = %d，期望 413", w.Code)
+	}
+}
+
+func TestUpdateConversationSystemPromptUnsupported(t *testing.T) {
+	store := &storeAgent{stubAgent: &stubAgent{}}
+	s := NewServer(store)
+	addTestConversation(s, "conv_1", "你好")
+	s.agentConvMap["conv_1"] = "conv_1"
+
+	w := httptest.NewRecorder()
+	body := strings.NewReader(`{"title":"翻译","system_prompt":"你是英文翻译"}`)
+	s.handleUpdateConversation(w, httptest.NewRequest(http.MethodPut, "/api/conversations/conv_1", body), "conv_1")
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("Agent 不支持会话提示词时应返回 501，实际 %d", w.Code)
+	}
+	if store.renamed != nil || s.conversations["conv_1"].Title != "" {
+		t.Errorf("请求被拒绝时不应修改标题")
+	}
+}
+
+// archiveAgent 实现 conversationArchiver 的测试 Agent，记录持久化的归档状态
+type archiveAgent struct {
+	*stubAgent
+	archived   map[string]bool
+	archiveErr error
+	onArchive  func(id string, archived bool) // 持久化前调用
+}
+
+func (a *archiveAgent) ArchiveConversation(ctx context.Context, id string, archived bool) error {
+	if a.onArchive != nil {
+		a.onArchive(id, archived)
+	}
+	if a.archiveErr != nil {
+		return a.archiveErr
+	}
+	a.archived[id] = archived
+	return nil
+}
+
+func TestAutoArchiveHidesInactiveConversations(t *testing.T) {
+	aa := &archiveAgent{stubAgent: &stubAgent{process: func(ctx context.Context, input string) (string, error) {
+		return "好的", nil
+	}}, archived: map[string]bool{}}
+	s := NewServer(aa)
+	addTestConversation(s, "old", "上周的问题", "回答")
+	addTestConversation(s, "recent", "今天的问题", "回答")
+	s.conversations["old"].CreatedAt = time.Now().Add(-48 * time.Hour).UnixNano()
+	s.conversations["recent"].CreatedAt = time.Now().Add(-48 * time.Hour).UnixNano()
+	s.conversations["recent"].UpdatedAt = time.Now().Add(-time.Hour).UnixNano()
+	s.conversations["old"].Context = context.Background()
+	s.agentConvMap["old"] = "old"
+
+	if n := s.archiveInactive(context.Background(), time.Now().Add(-24*time.Hour)); n != 1 {
+		t.Fatalf("应归档 1 个会话，实际 %d", n)
+	}
+	if !aa.archived["old"] || aa.archived["recent"] {
+		t.Errorf("只有超过阈值的会话应持久化归档，实际 %v", aa.archived)
+	}
+
+	list := func(query string) []string {
+		w := httptest.NewRecorder()
+		s.handleListConversations(w, httptest.NewRequest(http.MethodGet, "/api/conversations"+query, nil))
+		var resp struct {
+			Conversations []struct {
+				ID string `json:"id"`
+			} `json:"conversations"`
+			Total int `json:"total"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		var ids []string
+		for _, c := range resp.Conversations {
+			ids = append(ids, c.ID)
+		}
+		sort.Strings(ids)
+		if resp.Total != len(ids) {
+			t.Errorf("total = %d，期望 %d", resp.Total, len(ids))
+		}
+		return ids
+	}
+	if got := list(""); strings.Join(got, ",") != "recent" {
+		t.Errorf("默认列表不应包含已归档会话，实际 %v", got)
+	}
+	if got := list("?include_archived=true"); strings.Join(got, ",") != "old,recent" {
+		t.Errorf("include_archived=true 应返回全部会话，实际 %v", got)
+	}
+
+	w := httptest.NewRecorder()
+	s.handleGetConversation(w, httptest.NewRequest(http.MethodGet, "/api/conversations/old", nil), "old")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"archived":true`) || !strings.Contains(w.Body.String(), "上周的问题") {
+		t.Errorf("已归档会话仍应可读取: %d %s", w.Code, w.Body.String())
+	}
+
+	// 继续对话后重新出现在默认列表中
+	w = httptest.NewRecorder()
+	s.handleChat(w, httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(`{"message":"继续","conversation_id":"old"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("对话失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := list(""); strings.Join(got, ",") != "old,recent" {
+		t.Errorf("收到新消息后应取消归档，实际 %v", got)
+	}
+}
+
+func TestAutoArchivePersistsOutsideLock(t *testing.T) {
+	aa := &archiveAgent{stubAgent: &stubAgent{}, archived: map[string]bool{}}
+	s := NewServer(aa)
+	for _, id := range []string{"idle", "revived"} {
+		addTestConversation(s, id, "很久以前的问题")
+		s.conversations[id].CreatedAt = time.Now().Add(-48 * time.Hour).UnixNano()
+		s.agentConvMap[id] = id
+	}
+	aa.onArchive = func(id string, archived bool) {
+		if !s.mu.TryLock() {
+			t.Errorf("持久化 %s 时不应持有服务器锁", id)
+			return
+		}
+		// 模拟持久化期间会话收到新消息
+		if id == "revived" && archived {
+			touchConversation(s.conversations["revived"])
+		}
+		s.mu.Unlock()
+	}
+
+	if n := s.archiveInactive(context.Background(), time.Now().Add(-24*time.Hour)); n != 1 {
+		t.Fatalf("应归档 1 个会话，实际 %d", n)
+	}
+	if !s.conversations["idle"].Archived || s.conversations["revived"].Archived {
+		t.Errorf("持久化期间重新活跃的会话不应归档: idle=%v revived=%v", s.conversations["idle"].Archived, s.conversations["revived"].Archived)
+	}
+	if aa.archived["revived"] {
+		t.Error("重新活跃的会话应撤销持久化的归档状态")
+	}
+}
+
+func TestAutoArchiveKeepsConversationWhenPersistFails(t *testing.T) {
+	aa := &archiveAgent{stubAgent: &stubAgent{}, archived: map[string]bool{}, archiveErr: errors.New("disk full")}
+	s := NewServer(aa)
+	addTestConversation(s, "old", "你好")
+	s.agentConvMap["old"] = "old"
+
+	if n := s.archiveInactive(context.Background(), time.Now()); n != 0 || s.conversations["old"].Archived {
+		t.Errorf("持久化失败时应保持活跃以便下次重试，实际归档 %d 个", n)
+	}
+}
+
+func TestStartAutoArchiveRunsImmediately(t *testing.T) {
+	s := NewServer(nil)
+	addTestConversation(s, "old", "你好")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.StartAutoArchive(ctx, time.Hour)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.mu.Lock()
+		archived := s.conversations["old"].Archived
+		s.mu.Unlock()
+		if archived {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("启动后应立即归档不活跃的会话")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// cacheAgent 实现 cacheClearer 的测试 Agent
+type cacheAgent struct {
+	*stubAgent
+	cleared int
+}
+
+func (c *cacheAgent) ClearResponseCache() { c.cleared++ }
+
+func TestClearResponseCache(t *testing.T) {
+	ca := &cacheAgent{stubAgent: &stubAgent{}}
+	h := NewServer(ca).Handler()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/cache", nil))
+	if w.Code != http.StatusOK || ca.cleared != 1 {
+		t.Fatalf("DELETE /api/cache: %d %s, 清空 %d 次", w.Code, w.Body.String(), ca.cleared)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/cache", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET 应返回 405，实际 %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	NewServer(&stubAgent{}).Handler().ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/cache", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Agent 不支持缓存时应返回 501，实际 %d", w.Code)
+	}
+}
+
+func TestDeleteConversationRemovesPersistedData(t *testing.T) {
+	store := &storeAgent{stubAgent: &stubAgent{}}
+	s := NewServer(store)
+	addTestConversation(s, "conv_1", "你好")
+	s.agentConvMap["conv_1"] = "conv_1"
+
+	store.deleteErr = errors.New("permission denied")
+	w := httptest.NewRecorder()
+	s.handleDeleteConversation(w, httptest.NewRequest(http.MethodDelete, "/api/conversations/conv_1", nil), "conv_1")
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("删除文件失败时状态码 = %d，期望 500", w.Code)
+	}
+	if _, ok := s.conversations["conv_1"]; !ok {
+		t.Error("删除文件失败时应保留会话")
+	}
+
+	store.deleteErr = nil
+	w = httptest.NewRecorder()
+	s.handleDeleteConversation(w, httptest.NewRequest(http.MethodDelete, "/api/conversations/conv_1", nil), "conv_1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d: %s", w.Code, w.Body.String())
+	}
+	if _, ok := s.conversations["conv_1"]; ok {
+		t.Error("会话应从列表中删除")
+	}
+	if strings.Join(store.deleted, ",") != "conv_1,conv_1" {
+		t.Errorf("应调用记忆层删除持久化数据: %v", store.deleted)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleDeleteConversation(w, httptest.NewRequest(http.MethodDelete, "/api/conversations/conv_1", nil), "conv_1")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("删除不存在的会话状态码 = %d，期望 404", w.Code)
+	}
+}
+
+func TestUpdateConversationPersistsTitle(t *testing.T) {
+	store := &storeAgent{stubAgent: &stubAgent{}}
+	s := NewServer(store)
+	addTestConversation(s, "conv_1", "帮我规划一次为期五天的日本关西地区自由行路线，包括京都、大阪和奈良", "好的")
+	s.agentConvMap["conv_1"] = "conv_1"
+
+	update := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleUpdateConversation(w, httptest.NewRequest(http.MethodPut, "/api/conversations/conv_1", strings.NewReader(body)), "conv_1")
+		return w
+	}
+	getTitle := func() string {
+		w := httptest.NewRecorder()
+		s.handleGetConversation(w, httptest.NewRequest(http.MethodGet, "/api/conversations/conv_1", nil), "conv_1")
+		var resp struct {
+			Title string `json:"title"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Title
+	}
+	listTitle := func() string {
+		w := httptest.NewRecorder()
+		s.handleListConversations(w, httptest.NewRequest(http.MethodGet, "/api/conversations", nil))
+		var resp struct {
+			Conversations []struct {
+				Title string `json:"title"`
+			} `json:"conversations"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if len(resp.Conversations) != 1 {
+			t.Fatalf("会话列表 = %s", w.Body.String())
+		}
+		return resp.Conversations[0].Title
+	}
+
+	// 未设置标题时按字符截断第一条用户消息，不拆分多字节字符
+	heuristic := "帮我规划一次为期五天的日本关西地区自由行路线，包括京都、大阪..."
+	if got := listTitle(); got != heuristic {
+		t.Errorf("默认标题 = %q，期望 %q", got, heuristic)
+	}
+
+	w := update(`{"title":"  关西旅行  "}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"title":"关西旅行"`) {
+		t.Fatalf("更新标题: %d %s", w.Code, w.Body.String())
+	}
+	if store.renamed["conv_1"] != "关西旅行" {
+		t.Errorf("标题应持久化到记忆层，实际 %v", store.renamed)
+	}
+	if getTitle() != "关西旅行" || listTitle() != "关西旅行" {
+		t.Errorf("后续查询应返回保存的标题: get=%q list=%q", getTitle(), listTitle())
+	}
+
+	store.renameErr = errors.New("disk full")
+	if w := update(`{"title":"新标题"}`); w.Code != http.StatusInternalServerError {
+		t.Errorf("持久化失败时状态码 = %d，期望 500", w.Code)
+	}
+	if got := getTitle(); got != "关西旅行" {
+		t.Errorf("持久化失败时应保留原标题，实际 %q", got)
+	}
+
+	store.renameErr = nil
+	if w := update(`{"title":""}`); w.Code != http.StatusOK || getTitle() != heuristic {
+		t.Errorf("清空标题后应恢复默认标题: %d %q", w.Code, getTitle())
+	}
+}
+
+// limitedAgent 在 stubAgent 基础上实现 agent.InputValidator
+type limitedAgent struct {
+	stubAgent
+	limit int
+}
+
+func (a *limitedAgent) ValidateInput(input string) error {
+	if n := len([]rune(input)); n > a.limit {
+		return fmt.Errorf("%w: 本条消息 %d 个字符，上限为 %d 个字符", agent.ErrInputTooLong, n, a.limit)
+	}
+	return nil
+}
+
+func TestChatRejectsOverLimitInputBeforeProcessing(t *testing.T) {
+	called := false
+	a := &limitedAgent{limit: 5}
+	a.process = func(ctx context.Context, input string) (string, error) {
+		called = true
+		return "好的", nil
+	}
+	a.stream = func(ctx context.Context, input string, ch chan<- string) error {
+		called = true
+		close(ch)
+		return nil
+	}
+	s := NewServer(a)
+
+	w := httptest.NewRecorder()
+	s.handleChat(w, httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(`{"message":"这条消息超过了上限"}`)))
+	if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), "上限为 5 个字符") {
+		t.Errorf("POST /api/chat = %d %q，期望 413 并说明上限", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.handleChatStream(w, httptest.NewRequest(http.MethodGet, "/api/chat/stream?message="+url.QueryEscape("这条消息超过了上限"), nil))
+	if w.Code != http.StatusRequestEntityTooLarge || strings.Contains(w.Header().Get("Content-Type"), "event-stream") {
+		t.Errorf("GET /api/chat/stream = %d %s，期望在建立 SSE 前返回 413", w.Code, w.Header().Get("Content-Type"))
+	}
+	if called {
+		t.Error("超长输入不应调用 Agent")
+	}
+	if len(s.conversations) != 0 {
+		t.Errorf("超长输入不应创建会话，实际 %d 个", len(s.conversations))
+	}
+}
+
+func TestChatRejectedDuringProcessingLeavesNoConversation(t *testing.T) {
+	// Agent 未实现 InputValidator，超长输入在处理时才被拒绝
+	a := &stubAgent{process: func(ctx context.Context, input string) (string, error) {
+		return "", fmt.Errorf("%w: 上限为 5 个字符", agent.ErrInputTooLong)
+	}}
+	s := NewServer(a)
+
+	w := httptest.NewRecorder()
+	s.handleChat(w, httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(`{"message":"这条消息超过了上限"}`)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("状态码 = %d，期望 413", w.Code)
+	}
+	if len(s.conversations) != 0 || len(s.agentConvMap) != 0 {
+		t.Errorf("被拒绝的请求不应留下会话，实际 %d 个", len(s.conversations))
+	}
+}
+
+// eventAgent 实现 agent.EventStreamer，直接输出类型化事件
+type eventAgent struct {
+	stubAgent
+	events []agent.StreamEvent
+}
+
+func (a *eventAgent) ProcessStreamEvents(ctx context.Context, input string, events chan<- agent.StreamEvent) error {
+	defer close(events)
+	for _, e := range a.events {
+		events <- e
+	}
+	return nil
+}
+
+// parseSSE 按空行切分SSE响应，返回每个事件的类型（无 event 行时为 message）与 data（多个 data 行以换行拼接）
+func parseSSE(body string) (kinds, data []string) {
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		kind := "message"
+		var lines []string
+		for _, line := range strings.Split(block, "\n") {
+			if v, ok := strings.CutPrefix(line, "event: "); ok {
+				kind = v
+			} else if v, ok := strings.CutPrefix(line, "data: "); ok {
+				lines = append(lines, v)
+			}
+		}
+		kinds = append(kinds, kind)
+		data = append(data, strings.Join(lines, "\n"))
+	}
+	return kinds, data
+}
+
+func TestStreamEncodingSelectsEventShape(t *testing.T) {
+	a := &eventAgent{events: []agent.StreamEvent{
+		{Kind: "tool_call", Data: "准备调用工具: calculator"},
+		{Kind: agent.StreamEventContent, Data: "第一行\r\n第二行"},
+	}}
+	s := NewServer(a)
+
+	// raw：正文为原文（多行拆成多个 data 行），思考事件以类型为事件名
+	w := httptest.NewRecorder()
+	s.handleChatStream(w, httptest.NewRequest(http.MethodGet, "/api/chat/stream?message=hi&encoding=raw", nil))
+	kinds, data := parseSSE(w.Body.String())
+	if strings.Join(kinds, ",") != "meta,tool_call,message,done" {
+		t.Fatalf("raw 事件序列 = %v", kinds)
+	}
+	if data[1] != "准备调用工具: calculator" || data[2] != "第一行\n第二行" {
+		t.Errorf("raw 事件内容 = %q", data[1:3])
+	}
+	if !strings.Contains(w.Body.String(), "data: 第一行\ndata: 第二行\n\n") {
+		t.Errorf("多行正文应拆成多个 data 行:\n%s", w.Body.String())
+	}
+
+	// json（请求头指定，与默认相同）：正文为 JSON 字符串，思考事件为 thinking 事件中的 JSON 对象
+	r := httptest.NewRequest(http.MethodGet, "/api/chat/stream?message=hi", nil)
+	r.Header.Set(StreamEncodingHeader, "JSON")
+	w = httptest.NewRecorder()
+	s.handleChatStream(w, r)
+	kinds, data = parseSSE(w.Body.String())
+	if strings.Join(kinds, ",") != "meta,thinking,message,done" {
+		t.Fatalf("json 事件序列 = %v", kinds)
+	}
+	var e agent.StreamEvent
+	if err := json.Unmarshal([]byte(data[1]), &e); err != nil || e.Kind != "tool_call" {
+		t.Errorf("thinking 事件 = %q", data[1])
+	}
+	var chunk string
+	if err := json.Unmarshal([]byte(data[2]), &chunk); err != nil || chunk != "第一行\r\n第二行" {
+		t.Errorf("正文事件 = %q", data[2])
+	}
+
+	w = httptest.NewRecorder()
+	s.handleChatStream(w, httptest.NewRequest(http.MethodGet, "/api/chat/stream?message=hi&encoding=xml", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("未知编码状态码 = %d，期望 400", w.Code)
+	}
+}
+
+func TestStreamSendsThinkingAsSeparateSSEEvents(t *testing.T) {
+	typed := &eventAgent{events: []agent.StreamEvent{
+		{Kind: "analyzing", Data: "正在分析您的问题..."},
+		{Kind: agent.StreamEventContent, Data: "你好，"},
+		{Kind: "tool_call", Data: "准备调用工具: calculator"},
+		{Kind: agent.StreamEventContent, Data: "[THINKING:x:y] 是正文"},
+	}}
+	// 只实现 ProcessStream 的 Agent：文本标记还原为思考事件
+	legacy := &stubAgent{stream: func(ctx context.Context, input string, responseChan chan<- string) error {
+		defer close(responseChan)
+		for _, c := range []string{"[THINKING:analyzing:正在分析您的问题...]", "你好，", "[THINKING:tool_call:准备调用工具: calculator]", "世界"} {
+			responseChan <- c
+		}
+		return nil
+	}}
+
+	for name, tc := range map[string]struct {
+		agent   agent.Agent
+		content string
+	}{
+		"EventStreamer": {typed, "你好，[THINKING:x:y] 是正文"},
+		"ProcessStream": {legacy, "你好，世界"},
+	} {
+		s := NewServer(tc.agent)
+		w := httptest.NewRecorder()
+		s.handleChatStream(w, httptest.NewRequest(http.MethodGet, "/api/chat/stream?message=hi", nil))
+
+		kinds, data := parseSSE(w.Body.String())
+		wantKinds := []string{"meta", "thinking", "message", "thinking", "message", "done"}
+		if strings.Join(kinds, ",") != strings.Join(wantKinds, ",") {
+			t.Fatalf("%s: 事件序列 = %v，期望 %v", name, kinds, wantKinds)
+		}
+		var content strings.Builder
+		var thinking []agent.StreamEvent
+		for i, kind := range kinds {
+			switch kind {
+			case "message":
+				var chunk string
+				if err := json.Unmarshal([]byte(data[i]), &chunk); err != nil {
+					t.Fatalf("%s: data 事件应为 JSON 字符串: %q", name, data[i])
+				}
+				content.WriteString(chunk)
+			case "thinking":
+				var e agent.StreamEvent
+				if err := json.Unmarshal([]byte(data[i]), &e); err != nil {
+					t.Fatalf("%s: thinking 事件应为 JSON 对象: %q", name, data[i])
+				}
+				thinking = append(thinking, e)
+			}
+		}
+		if content.String() != tc.content {
+			t.Errorf("%s: 正文 = %q，期望 %q", name, content.String(), tc.content)
+		}
+		wantThinking := []agent.StreamEvent{{Kind: "analyzing", Data: "正在分析您的问题..."}, {Kind: "tool_call", Data: "准备调用工具: calculator"}}
+		if len(thinking) != 2 || thinking[0] != wantThinking[0] || thinking[1] != wantThinking[1] {
+			t.Errorf("%s: 思考事件 = %+v，期望 %+v", name, thinking, wantThinking)
+		}
+	}
+}
+
+func TestChatStreamAcceptsPOSTBody(t *testing.T) {
+	var got []string
+	s := NewServer(&stubAgent{stream: func(ctx context.Context, input string, responseChan chan<- string) error {
+		got = append(got, input)
+		defer close(responseChan)
+		responseChan <- "回复"
+		return nil
+	}})
+	long := strings.Repeat("很长的消息", 2000)
+
+	w := httptest.NewRecorder()
+	body, _ := json.Marshal(ChatRequest{Message: long})
+	s.handleChatStream(w, httptest.NewRequest(http.MethodPost, "/api/chat/stream", bytes.NewReader(body)))
+	kinds, data := parseSSE(w.Body.String())
+	if w.Code != http.StatusOK || strings.Join(kinds, ",") != "meta,message,done" || data[1] != `"回复"` {
+		t.Fatalf("POST 流式响应 = %d %v %v", w.Code, kinds, data)
+	}
+	if len(got) != 1 || got[0] != long {
+		t.Fatalf("Agent 应收到请求体中的完整消息，实际 %d 条", len(got))
+	}
+
+	// 请求体中的 conversation_id 继续已有会话
+	var meta struct {
+		ConversationID string `json:"conversation_id"`
+	}
+	json.Unmarshal([]byte(data[0]), &meta)
+	body, _ = json.Marshal(ChatRequest{ConversationID: meta.ConversationID, Message: "继续"})
+	w = httptest.NewRecorder()
+	s.handleChatStream(w, httptest.NewRequest(http.MethodPost, "/api/chat/stream", bytes.NewReader(body)))
+	if n := len(s.conversations[meta.ConversationID].Messages); w.Code != http.StatusOK || n != 2 {
+		t.Errorf("续聊后会话消息数 = %d（状态码 %d），期望同一会话中 2 条用户消息", n, w.Code)
+	}
+
+	// GET 仍然可用
+	w = httptest.NewRecorder()
+	s.handleChatStream(w, httptest.NewRequest(http.MethodGet, "/api/chat/stream?message=hi", nil))
+	if w.Code != http.StatusOK || got[len(got)-1] != "hi" {
+		t.Errorf("GET 流式请求 = %d，最后收到的消息 %q", w.Code, got[len(got)-1])
+	}
+
+	w = httptest.NewRecorder()
+	s.handleChatStream(w, httptest.NewRequest(http.MethodPost, "/api/chat/stream", strings.NewReader("{")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("无效请求体状态码 = %d，期望 400", w.Code)
+	}
+	w = httptest.NewRecorder()
+	s.handleChatStream(w, httptest.NewRequest(http.MethodPut, "/api/chat/stream", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT 状态码 = %d，期望 405", w.Code)
+	}
+}
+
+func TestChatRejectsOversizedBody(t *testing.T) {
+	called := false
+	s := NewServer(&stubAgent{
+		process: func(ctx context.Context, input string) (string, error) {
+			called = true
+			return "回复", nil
+		},
+		stream: func(ctx context.Context, input string, responseChan chan<- string) error {
+			called = true
+			close(responseChan)
+			return nil
+		},
+	})
+	s.SetMaxRequestBodyBytes(64)
+	body, _ := json.Marshal(ChatRequest{Message: strings.Repeat("a", 100)})
+
+	for path, handler := range map[string]http.HandlerFunc{"/api/chat": s.handleChat, "/api/chat/stream": s.handleChatStream} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s 超大请求体状态码 = %d，期望 413", path, w.Code)
+		}
+	}
+	if called {
+		t.Error("超大请求体不应调用 Agent")
+	}
+
+	s.SetMaxRequestBodyBytes(0)
+	if s.maxRequestBodyBytes != DefaultMaxRequestBodyBytes {
+		t.Errorf("<=0 时应恢复默认上限，实际 %d", s.maxRequestBodyBytes)
+	}
+}
+
+// uncitedAgent 报告本轮回复缺少来源标注的 Agent
+type uncitedAgent struct {
+	*stubAgent
+}
+
+func (a *uncitedAgent) CitationMissing() bool { return true }
+
+func TestChatResponseReportsCitationMissing(t *testing.T) {
+	s := NewServer(&uncitedAgent{stubAgent: &stubAgent{
+		process: func(ctx context.Context, input string) (string, error) { return "回复", nil },
+		stream: func(ctx context.Context, input string, responseChan chan<- string) error {
+			defer close(responseChan)
+			responseChan <- "回复"
+			return nil
+		},
+	}})
+
+	w := httptest.NewRecorder()
+	s.handleChat(w, httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(`{"message":"你好"}`)))
+	var resp ChatResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || !resp.CitationMissing {
+		t.Errorf("citation_missing = %v（%v）: %s", resp.CitationMissing, err, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.handleChatStream(w, httptest.NewRequest(http.MethodGet, "/api/chat/stream?message=hi&format=json", nil))
+	var streamResp StreamJSONResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &streamResp); err != nil || !streamResp.CitationMissing {
+		t.Errorf("流式JSON响应的 citation_missing = %v（%v）: %s", streamResp.CitationMissing, err, w.Body.String())
+	}
+}
+
+// recordingLLM 记录提示词并返回固定回复，生成前短暂等待以便不同会话的轮次交错执行
+type recordingLLM struct {
+	mu      sync.Mutex
+	prompts []string
+}
+
+func (l *recordingLLM) record(prompt string) {
+	time.Sleep(time.Millisecond)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prompts = append(l.prompts, prompt)
+}
+
+func (l *recordingLLM) Generate(ctx context.Context, prompt string) (string, error) {
+	l.record(prompt)
+	return "好的", nil
+}
+
+func (l *recordingLLM) GenerateStream(ctx context.Context, prompt string, responseChan chan<- string) error {
+	defer close(responseChan)
+	l.record(prompt)
+	responseChan <- "好的"
+	return nil
+}
+
+func TestInterleavedConversationsKeepSeparateAgentState(t *testing.T) {
+	llm := &recordingLLM{}
+	a := agent.NewEinoAgent(agent.Config{MemoryConfig: agent.MemoryConfig{DBPath: t.TempDir()}})
+	if err := a.Initialize(context.Background(), llm, nil); err != nil {
+		t.Fatalf("初始化 Agent 失败: %v", err)
+	}
+	s := NewServer(a)
+
+	chat := func(path, convID, message string) ChatResponse {
+		body, _ := json.Marshal(ChatRequest{ConversationID: convID, Message: message})
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		if strings.HasPrefix(path, "/api/chat/stream") {
+			s.handleChatStream(w, r)
+		} else {
+			s.handleChat(w, r)
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("%s 返回 %d: %s", path, w.Code, w.Body.String())
+			return ChatResponse{}
+		}
+		var resp ChatResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Errorf("解析响应失败: %v", err)
+		}
+		return resp
+	}
+
+	ids := map[string]string{}
+	for _, marker := range []string{"甲", "乙"} {
+		ids[marker] = chat("/api/chat", "", marker+"-开始").ConversationID
+	}
+	if ids["甲"] == "" || ids["甲"] == ids["乙"] {
+		t.Fatalf("应创建两个不同的会话: %v", ids)
+	}
+
+	const turns = 6
+	var wg sync.WaitGroup
+	for marker, id := range ids {
+		for i := 0; i < turns; i++ {
+			wg.Add(1)
+			go func(marker, id string, i int) {
+				defer wg.Done()
+				path := "/api/chat"
+				if i%2 == 1 {
+					path = "/api/chat/stream?format=json"
+				}
+				chat(path, id, fmt.Sprintf("%s-%d", marker, i))
+			}(marker, id, i)
+		}
+	}
+	wg.Wait()
+
+	for _, p := range llm.prompts {
+		if strings.Contains(p, "甲-") && strings.Contains(p, "乙-") {
+			t.Fatalf("提示词混入了另一个会话的消息:\n%s", p)
+		}
+	}
+	for marker, id := range ids {
+		other := "乙-"
+		if marker == "乙" {
+			other = "甲-"
+		}
+		stored, err := a.StoredConversation(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stored.Messages) != 2*(turns+1) {
+			t.Errorf("%s: 记忆会话应有 %d 条消息，实际 %d 条", marker, 2*(turns+1), len(stored.Messages))
+		}
+		for _, m := range stored.Messages {
+			if strings.Contains(m.Content, other) {
+				t.Errorf("%s: 记忆会话混入了另一个会话的消息 %q", marker, m.Content)
+			}
+		}
+		for _, m := range s.conversations[id].Messages {
+			if strings.Contains(m.Content, other) {
+				t.Errorf("%s: Web 会话混入了另一个会话的消息 %q", marker, m.Content)
+			}
+		}
+	}
+}
+
+func TestActiveConversationsPerIPAreCapped(t *testing.T) {
+	// 每个流先输出一块，然后保持进行中直到客户端断开
+	s := NewServer(&stubAgent{stream: func(ctx context.Context, input string, responseChan chan<- string) error {
+		defer close(responseChan)
+		responseChan <- "开始"
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	s.SetMaxActiveConversationsPerIP(2)
+	srv := httptest.NewServer(http.HandlerFunc(s.handleChatStream))
+	defer srv.Close()
+
+	// open 发起流式请求，返回响应与断开连接的函数；conversation_id 为空时创建新会话
+	open := func(conversationID string) (*http.Response, context.CancelFunc) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		q := url.Values{"message": {"hi"}, "conversation_id": {conversationID}}
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?"+q.Encode(), nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			cancel()
+			t.Fatal(err)
+		}
+		return resp, func() {
+			cancel()
+			resp.Body.Close()
+		}
+	}
+
+	first, closeFirst := open("")
+	defer closeFirst()
+	second, closeSecond := open("")
+	defer closeSecond()
+	if first.StatusCode != http.StatusOK || second.StatusCode != http.StatusOK {
+		t.Fatalf("上限内的流应建立成功，状态码 %d/%d", first.StatusCode, second.StatusCode)
+	}
+
+	third, closeThird := open("")
+	closeThird()
+	if third.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("超过上限的新会话状态码 = %d，期望 429", third.StatusCode)
+	}
+	s.mu.Lock()
+	n := len(s.conversations)
+	var firstID string
+	for id := range s.conversations {
+		firstID = id
+		break
+	}
+	s.mu.Unlock()
+	if n != 2 {
+		t.Errorf("被拒绝的请求不应创建会话，实际 %d 个", n)
+	}
+
+	// 已在进行中的会话可以继续发起请求
+	again, closeAgain := open(firstID)
+	closeAgain()
+	if again.StatusCode != http.StatusOK {
+		t.Errorf("进行中的会话继续请求状态码 = %d，期望 200", again.StatusCode)
+	}
+
+	// 客户端断开后释放名额
+	closeFirst()
+	deadline := time.Now().Add(2 * time.Second)
+	for s.activeConvs.Active("127.0.0.1") >= 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("客户端断开后未释放名额")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	fourth, closeFourth := open("")
+	closeFourth()
+	if fourth.StatusCode != http.StatusOK {
+		t.Errorf("释放名额后新会话状态码 = %d，期望 200", fourth.StatusCode)
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"agentEino/pkg/agent"
+	"agentEino/pkg/logger"
+)
+
+// DefaultTitleMessages 自动生成标题时默认使用的最早消息数：第一轮问答
+const DefaultTitleMessages = 2
+
+// titleGenerationTimeout 后台生成一个会话标题的最长时间
+const titleGenerationTimeout = time.Minute
+
+// titleGenerator 可选接口：根据会话最早的几条消息生成标题
+type titleGenerator interface {
+	GenerateTitle(ctx context.Context, messages []agent.Message) (string, error)
+}
+
+// SetAutoTitle 设置会话标题的自动生成：useLLM 为 true 且 Agent 支持时，会话消息数达到 messages 后
+// 用 LLM 概括最早的 messages 条消息生成标题；关闭、不支持或生成失败时使用第一条用户消息。messages<=0 时使用默认值
+func (s *Server) SetAutoTitle(useLLM bool, messages int) {
+	if messages <= 0 {
+		messages = DefaultTitleMessages
+	}
+	s.titleUseLLM = useLLM
+	s.titleMessages = messages
+}
+
+// maybeGenerateTitle 会话没有标题且消息数（含 pending 中尚未写入会话的消息）首次达到 titleMessages 时，
+// 在后台生成标题，调用方需持有 s.mu；每个会话只尝试一次，失败时标题保持为空，列表中回退为第一条用户消息
+func (s *Server) maybeGenerateTitle(conv *Conversation, pending ...Message) {
+	all := append(conv.Messages[:len(conv.Messages):len(conv.Messages)], pending...)
+	if !s.titleUseLLM || conv.Title != "" || conv.titleRequested || len(all) < s.titleMessages {
+		return
+	}
+	gen, ok := s.agent.(titleGenerator)
+	if !ok {
+		return
+	}
+	conv.titleRequested = true
+	messages := make([]agent.Message, 0, s.titleMessages)
+	for _, m := range all[:s.titleMessages] {
+		messages = append(messages, agent.Message{Role: m.Role, Content: m.Content})
+	}
+	go s.generateTitle(gen, conv, messages)
+}
+
+// generateTitle 生成并保存会话标题；生成期间会话被删除或手动设置了标题时放弃结果
+func (s *Server) generateTitle(gen titleGenerator, conv *Conversation, messages []agent.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), titleGenerationTimeout)
+	defer cancel()
+	title, err := gen.GenerateTitle(ctx, messages)
+	if err != nil {
+		logger.Warn("生成会话标题失败，使用第一条用户消息", map[string]interface{}{"conversation_id": conv.ID, "error": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if conv.Title != "" || s.conversations[conv.ID] != conv {
+		return
+	}
+	// 会话拥有独立的记忆会话时一并持久化，失败时不设置标题，避免重启后标题回退
+	if store, ok := s.agent.(conversationStore); ok && s.agentConvMap[conv.ID] == conv.ID {
+		if err := store.RenameConversation(ctx, conv.ID, title); err != nil {
+			logger.Warn("保存会话标题失败", map[string]interface{}{"conversation_id": conv.ID, "error": err.Error()})
+			return
+		}
+	}
+	conv.Title = title
+	logger.Debug("已生成会话标题", map[string]interface{}{"conversation_id": conv.ID, "title": title})
+}
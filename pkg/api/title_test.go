@@ -0,0 +1,144 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"agentEino/pkg/agent"
+)
+
+// titleAgent 按收到的消息拼接标题的 Agent，err 不为空时生成失败
+type titleAgent struct {
+	stubAgent
+	mu    sync.Mutex
+	calls [][]agent.Message
+	err   error
+}
+
+func (a *titleAgent) GenerateTitle(ctx context.Context, messages []agent.Message) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls = append(a.calls, messages)
+	if a.err != nil {
+		return "", a.err
+	}
+	parts := make([]string, 0, len(messages))
+	for _, m := range messages {
+		parts = append(parts, m.Content)
+	}
+	return strings.Join(parts, " / "), nil
+}
+
+func newTitleAgent(reply string) *titleAgent {
+	a := &titleAgent{}
+	a.process = func(ctx context.Context, input string) (string, error) { return reply, nil }
+	a.stream = func(ctx context.Context, input string, responseChan chan<- string) error {
+		defer close(responseChan)
+		responseChan <- reply
+		return nil
+	}
+	return a
+}
+
+// postChat 发送一条消息并返回会话ID
+func postChat(t *testing.T, s *Server, path, convID, message string) string {
+	t.Helper()
+	body, _ := json.Marshal(ChatRequest{ConversationID: convID, Message: message})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	if strings.HasPrefix(path, "/api/chat/stream") {
+		s.handleChatStream(w, r)
+	} else {
+		s.handleChat(w, r)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s 返回 %d: %s", path, w.Code, w.Body.String())
+	}
+	var resp ChatResponse
+	if kinds, data := parseSSE(w.Body.String()); len(kinds) > 0 && kinds[0] == "meta" {
+		json.Unmarshal([]byte(data[0]), &resp)
+	} else {
+		json.NewDecoder(w.Body).Decode(&resp)
+	}
+	return resp.ConversationID
+}
+
+// waitTitle 等待后台生成的标题写入会话
+func waitTitle(t *testing.T, s *Server, convID string) string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.mu.Lock()
+		title := s.conversations[convID].Title
+		s.mu.Unlock()
+		if title != "" || time.Now().After(deadline) {
+			return title
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAutoTitleReflectsQuestionAndAnswer(t *testing.T) {
+	for _, path := range []string{"/api/chat", "/api/chat/stream?format=json", "/api/chat/stream"} {
+		a := newTitleAgent("Go 的切片按需扩容")
+		s := NewServer(a)
+		id := postChat(t, s, path, "", "切片容量怎么增长")
+
+		title := waitTitle(t, s, id)
+		if !strings.Contains(title, "切片容量怎么增长") || !strings.Contains(title, "Go 的切片按需扩容") {
+			t.Errorf("%s: 标题应同时反映问题与回答，实际 %q", path, title)
+		}
+		postChat(t, s, path, id, "再举个例子")
+		time.Sleep(20 * time.Millisecond)
+		a.mu.Lock()
+		calls := len(a.calls)
+		a.mu.Unlock()
+		if calls != 1 {
+			t.Errorf("%s: 每个会话只应生成一次标题，实际 %d 次", path, calls)
+		}
+	}
+}
+
+func TestAutoTitleMessageCountAndFallback(t *testing.T) {
+	a := newTitleAgent("回答")
+	s := NewServer(a)
+	s.SetAutoTitle(true, 4)
+	id := postChat(t, s, "/api/chat", "", "第一个问题")
+	time.Sleep(20 * time.Millisecond)
+	if a.calls != nil {
+		t.Fatal("消息数未达到配置值前不应生成标题")
+	}
+	postChat(t, s, "/api/chat", id, "第二个问题")
+	if title := waitTitle(t, s, id); strings.Count(title, " / ") != 3 {
+		t.Errorf("标题应基于最早的 4 条消息生成，实际 %q", title)
+	}
+
+	// 生成失败或关闭 LLM 时回退为第一条用户消息
+	a = newTitleAgent("回答")
+	a.err = errors.New("模型不可用")
+	s = NewServer(a)
+	id = postChat(t, s, "/api/chat", "", "第一个问题")
+	time.Sleep(20 * time.Millisecond)
+	s.mu.Lock()
+	if title := conversationTitle(s.conversations[id]); title != "第一个问题" {
+		t.Errorf("生成失败时应回退为第一条用户消息，实际 %q", title)
+	}
+	s.mu.Unlock()
+
+	a = newTitleAgent("回答")
+	s = NewServer(a)
+	s.SetAutoTitle(false, 2)
+	postChat(t, s, "/api/chat", "", "第一个问题")
+	time.Sleep(20 * time.Millisecond)
+	if a.calls != nil {
+		t.Error("关闭 LLM 标题后不应调用模型")
+	}
+}
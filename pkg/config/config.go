@@ -0,0 +1,835 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"agentEino/pkg/agent"
+	"agentEino/pkg/api"
+	"agentEino/pkg/llm"
+	"agentEino/pkg/logger"
+	"agentEino/pkg/memory"
+	"agentEino/pkg/tools"
+)
+
+// Config 应用的完整配置，可从JSON文件加载，环境变量优先于文件中的值
+type Config struct {
+	Log     LogConfig     `json:"log"`
+	LLM     LLMConfig     `json:"llm"`
+	Agent   AgentConfig   `json:"agent"`
+	Memory  MemoryConfig  `json:"memory"`
+	Tools   ToolsConfig   `json:"tools"`
+	Server  ServerConfig  `json:"server"`
+	Tracing TracingConfig `json:"tracing"`
+	// Features 实验特性开关（如 rag、native_tools），未设置的特性使用默认值，未知特性只在启动时警告
+	Features map[string]bool `json:"features"`
+}
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Level          string `json:"level"`            // DEBUG/INFO/WARN/ERROR
+	MaxFieldLength int    `json:"max_field_length"` // 字段值最大长度，<=0 表示不截断
+	Color          string `json:"color"`            // auto/true/false
+	Format         string `json:"format"`           // text/json
+
+	// 日志文件路径，留空时输出到标准输出
+	File string `json:"file"`
+	// 日志文件超过多少 MB 时轮转，<=0 不轮转
+	FileMaxSizeMB int `json:"file_max_size_mb"`
+	// 轮转时保留的历史文件个数
+	FileMaxBackups int `json:"file_max_backups"`
+}
+
+// LLMConfig 模型服务配置
+type LLMConfig struct {
+	Provider  string `json:"provider"` // ollama、openai 或通过 llm.RegisterProvider 注册的提供方
+	BaseURL   string `json:"base_url"`
+	Model     string `json:"model"`
+	APIKey    string `json:"api_key"`
+	MaxTokens int    `json:"max_tokens"` // 所有提供方通用，0 表示使用提供方默认值
+	Warmup    bool   `json:"warmup"`     // 启动时预加载模型（仅 Ollama）
+	KeepAlive string `json:"keep_alive"` // Ollama keep_alive，如 "5m"、"-1"
+	// OllamaMode Ollama 端点模式：chat（默认）/generate/auto
+	OllamaMode string `json:"ollama_mode"`
+	// Ollama 请求重试与超时
+	MaxRetries            int `json:"max_retries"`
+	MaxLoadRetries        int `json:"max_load_retries"`
+	RequestTimeoutSeconds int `json:"request_timeout_seconds"`
+	LoadWaitSeconds       int `json:"load_wait_seconds"`
+	RetryBackoffSeconds   int `json:"retry_backoff_seconds"`
+	// 按提供方设置的最大生成 token 数，优先于 max_tokens；0 表示沿用 max_tokens
+	OllamaMaxTokens int `json:"ollama_max_tokens"`
+	OpenAIMaxTokens int `json:"openai_max_tokens"`
+	// 采样参数，不设置时使用提供方默认值（Ollama 温度 0.7，OpenAI 温度 1.0）；温度可设为 0 得到确定的输出
+	Temperature *float64 `json:"temperature,omitempty"` // 0~2
+	TopP        *float64 `json:"top_p,omitempty"`       // (0, 1]
+	// DecisionModel 第一轮工具决策使用的模型（同一提供方），为空时使用 model；最终回复始终由 model 生成
+	DecisionModel string `json:"decision_model"`
+	// 响应缓存：相同提示词与采样参数直接返回缓存的回复，0 表示不缓存
+	ResponseCacheSize int `json:"response_cache_size"`
+	// ResponseCacheAnyTemperature 温度不为 0 时也缓存（默认只缓存温度为 0 的确定性生成）
+	ResponseCacheAnyTemperature bool `json:"response_cache_any_temperature"`
+}
+
+// AgentConfig Agent行为配置
+type AgentConfig struct {
+	Name                   string            `json:"name"`
+	Description            string            `json:"description"`
+	Prompt                 string            `json:"prompt"`
+	StreamDecisionThinking bool              `json:"stream_decision_thinking"`
+	MaxSearchResults       int               `json:"max_search_results"`
+	EmptyResponseMessage   string            `json:"empty_response_message"`
+	RetryOnEmpty           bool              `json:"retry_on_empty"`
+	MinResponseChars       int               `json:"min_response_chars"` // 回复至少包含的非空白字符数，不足时视为空响应
+	StrictToolRules        map[string]string `json:"strict_tool_rules"`  // 工具名 -> 正则表达式
+	MaxStrictRetries       int               `json:"max_strict_retries"`
+	MaxToolIterations      int               `json:"max_tool_iterations"`
+	MaxTurnSeconds         int               `json:"max_turn_seconds"` // 单轮对话最长执行秒数，0 不限制
+	// RetryBudgetSeconds 单轮对话内所有重试等待（模型加载、请求退避）的累计秒数上限，0 不限制
+	RetryBudgetSeconds int `json:"retry_budget_seconds"`
+	// 单条用户输入的字符数与估算 token 数上限，超过时拒绝本轮请求；0 不限制
+	MaxInputChars  int `json:"max_input_chars"`
+	MaxInputTokens int `json:"max_input_tokens"`
+	// KnowledgeContext 每轮自动检索知识库并注入相关片段（RAG），无需模型调用 knowledge_base
+	KnowledgeContext            bool `json:"knowledge_context"`
+	KnowledgeContextMaxSnippets int  `json:"knowledge_context_max_snippets"`
+	KnowledgeContextMaxChars    int  `json:"knowledge_context_max_chars"`
+	// CitationMode 使用搜索结果后的来源标注要求：off（默认）/instruct/verify
+	CitationMode string `json:"citation_mode"`
+	// ToolResultGuard 注入工具结果后的提示词缺少这些结果时：repair（默认，补齐）/strict（报错）/off（不检查）
+	ToolResultGuard string `json:"tool_result_guard"`
+	// 注入提示词的历史窗口：最近消息数与整个提示词的 token 预算（0 不按 token 限制）
+	HistoryMaxMessages int `json:"history_max_messages"`
+	HistoryMaxTokens   int `json:"history_max_tokens"`
+	// ToolSentinel 启用工具调用标记模式，标记为空时使用默认的 <<TOOL>> / <<END>>
+	ToolSentinel            bool   `json:"tool_sentinel"`
+	ToolSentinelStart       string `json:"tool_sentinel_start"`
+	ToolSentinelEnd         string `json:"tool_sentinel_end"`
+	ToolSentinelInstruction string `json:"tool_sentinel_instruction"`
+	// PersistPartialResponses 流式生成中客户端断开时保存已生成的部分（标记为未完成）
+	PersistPartialResponses bool `json:"persist_partial_responses"`
+}
+
+// MemoryConfig 记忆系统配置
+type MemoryConfig struct {
+	Type        string `json:"type"` // simple 或 vector
+	DataDir     string `json:"data_dir"`
+	MaxMessages int    `json:"max_messages"`
+	// DedupeWindowSeconds 连续相同消息（同角色同内容）在该秒数内只保存一次，0 表示不去重
+	DedupeWindowSeconds int `json:"dedupe_window_seconds"`
+	// ConversationIDPattern 会话ID需匹配的正则，为空时使用默认格式（字母、数字、下划线、短横线）
+	ConversationIDPattern string `json:"conversation_id_pattern"`
+	// Embeddings 向量记忆的嵌入模型提供方：none（默认，关键词匹配）、openai 或 ollama，仅 type 为 vector 时可用
+	Embeddings     string `json:"embeddings"`
+	EmbeddingModel string `json:"embedding_model"` // 为空时使用提供方默认模型
+	// SessionIdleMinutes 会话状态在内存中缓存的空闲分钟数，超过后释放，再次访问时从磁盘重新加载
+	SessionIdleMinutes int `json:"session_idle_minutes"`
+}
+
+// ToolsConfig 工具配置
+type ToolsConfig struct {
+	SearchAPIKey      string `json:"search_api_key"`
+	SearchEngine      string `json:"search_engine"`
+	KnowledgeBasePath string `json:"knowledge_base_path"`
+	// KnowledgeBaseMaxDocumentBytes 知识库单个文档的最大字节数，上传与读取时超出即拒绝
+	KnowledgeBaseMaxDocumentBytes int      `json:"knowledge_base_max_document_bytes"`
+	Cassette                      string   `json:"cassette"`
+	EnabledTools                  []string `json:"enabled_tools"`
+	// ParamDefaults 工具名 -> 参数名 -> 默认值，模型调用时缺少该参数则自动填入
+	ParamDefaults map[string]map[string]interface{} `json:"param_defaults"`
+	// KnowledgeBaseFuzzyNames 读取文档时找不到同名文档，按忽略大小写、省略扩展名匹配
+	KnowledgeBaseFuzzyNames bool `json:"knowledge_base_fuzzy_names"`
+	// 搜索请求超时与默认返回的最大结果数（可通过 num 参数按次覆盖）
+	SearchTimeoutSeconds int `json:"search_timeout_seconds"`
+	SearchMaxResults     int `json:"search_max_results"`
+	// 搜索结果增强：抓取首条结果页面摘录
+	SearchEnrichment               bool `json:"search_enrichment"`
+	SearchEnrichmentTimeoutSeconds int  `json:"search_enrichment_timeout_seconds"`
+	SearchEnrichmentMaxChars       int  `json:"search_enrichment_max_chars"`
+	// 密钥无效（401/403）时的备用搜索引擎：duckduckgo（默认）、mock 或 none（直接返回错误）
+	SearchAuthFallback string `json:"search_auth_fallback"`
+	// 连续多少次密钥无效后停用需要密钥的引擎，之后直接使用备用引擎，0 不停用
+	SearchAuthDisableAfter int `json:"search_auth_disable_after"`
+	// 批量工具调用的最大并发数，<=1 表示顺序执行
+	MaxParallelTools int `json:"max_parallel_tools"`
+	// 汇率换算工具：默认关闭，开启后调用免费汇率接口并按TTL缓存汇率
+	Currency                bool   `json:"currency"`
+	CurrencyAPIURL          string `json:"currency_api_url"`
+	CurrencyCacheTTLSeconds int    `json:"currency_cache_ttl_seconds"`
+}
+
+// ServerConfig Web服务配置
+type ServerConfig struct {
+	Port                      string `json:"port"`
+	StreamWriteTimeoutSeconds int    `json:"stream_write_timeout_seconds"`
+	ConversationRateLimit     int    `json:"conversation_rate_limit"`  // 单个会话每分钟最大轮数，<=0 不限制
+	ConversationPageSize      int    `json:"conversation_page_size"`   // 会话列表未指定 limit 时返回的数量
+	MaxRequestBodyBytes       int    `json:"max_request_body_bytes"`   // POST 聊天请求体的最大字节数
+	AutoArchiveAfterHours     int    `json:"auto_archive_after_hours"` // 会话超过该小时数未收到消息时自动归档，0 不归档
+
+	// 自动生成会话标题：用 LLM 概括最早的 title_messages 条消息，关闭时使用第一条用户消息
+	TitleUseLLM   bool `json:"title_use_llm"`
+	TitleMessages int  `json:"title_messages"`
+
+	// 每个客户端IP同时进行中（正在生成回复）的会话数上限，超出时新会话返回 429，<=0 不限制
+	MaxActiveConversationsPerIP int `json:"max_active_conversations_per_ip"`
+}
+
+// TracingConfig 链路追踪配置
+type TracingConfig struct {
+	Exporter string `json:"exporter"` // none 或 stdout
+}
+
+// 各提供方的默认模型，未配置 llm.model 时按 llm.provider 选用
+const (
+	DefaultOllamaModel = "gpt-oss:20b"
+	DefaultOpenAIModel = "gpt-4o-mini"
+)
+
+// DefaultAgentPrompt 默认的Agent系统提示词，工具目录由 agent.BuildToolPrompt 自动生成
+const DefaultAgentPrompt = `你是一位智能AI助手。
+
+当需要使用工具时，请使用以下格式之一：
+
+方法1 - JSON格式（推荐）：
+{"tool":"tool_name","params":{"param1":"value1"}}
+需要同时调用多个相互独立的工具时，使用JSON数组：
+[{"tool":"tool_a","params":{}},{"tool":"tool_b","params":{}}]
+
+方法2 - Markdown格式：
+` + "```tool:tool_name\n{\"param1\":\"value1\"}\n```"
+
+// Default 返回默认配置
+func Default() *Config {
+	retry := llm.DefaultRetryConfig()
+	return &Config{
+		Log: LogConfig{
+			Level:          "INFO",
+			MaxFieldLength: logger.DefaultMaxFieldLength,
+			Color:          "auto",
+			Format:         "text",
+			FileMaxSizeMB:  100,
+			FileMaxBackups: logger.DefaultMaxBackups,
+		},
+		LLM: LLMConfig{
+			Provider: "ollama",
+			BaseURL:  "http://10.0.10.112:11434", // 默认Ollama URL
+			// Ollama 请求重试与超时
+			MaxRetries:            retry.MaxRetries,
+			MaxLoadRetries:        retry.MaxLoadRetries,
+			RequestTimeoutSeconds: int(retry.RequestTimeout / time.Second),
+			LoadWaitSeconds:       int(retry.LoadWait / time.Second),
+			RetryBackoffSeconds:   int(retry.BackoffBase / time.Second),
+		},
+		Agent: AgentConfig{
+			Name:                        "EinoAgent",
+			Description:                 "A simple AI agent built with Eino",
+			Prompt:                      DefaultAgentPrompt,
+			MaxSearchResults:            agent.DefaultMaxSearchResults,
+			MaxStrictRetries:            agent.DefaultMaxStrictRetries,
+			MaxToolIterations:           agent.DefaultMaxToolIterations,
+			KnowledgeContextMaxSnippets: agent.DefaultKnowledgeContextMaxSnippets,
+			KnowledgeContextMaxChars:    agent.DefaultKnowledgeContextMaxChars,
+			HistoryMaxMessages:          agent.DefaultHistoryMaxMessages,
+			RetryBudgetSeconds:          int(agent.DefaultRetryBudget / time.Second),
+			MaxInputChars:               agent.DefaultMaxInputChars,
+		},
+		Memory: MemoryConfig{
+			Type:               "simple",
+			DataDir:            memory.DefaultDataDir,
+			SessionIdleMinutes: int(agent.DefaultSessionIdleTTL / time.Minute),
+		},
+		Tools: ToolsConfig{
+			KnowledgeBasePath:              "./knowledge_base", // 默认知识库路径
+			KnowledgeBaseMaxDocumentBytes:  tools.DefaultMaxDocumentBytes,
+			KnowledgeBaseFuzzyNames:        true,
+			SearchTimeoutSeconds:           int(tools.DefaultSearchTimeout / time.Second),
+			SearchMaxResults:               tools.DefaultSearchMaxResults,
+			SearchEnrichmentTimeoutSeconds: int(tools.DefaultEnrichTimeout / time.Second),
+			SearchEnrichmentMaxChars:       tools.DefaultEnrichMaxChars,
+			SearchAuthFallback:             string(tools.DuckDuckGo),
+			SearchAuthDisableAfter:         tools.DefaultSearchAuthDisableAfter,
+			MaxParallelTools:               tools.DefaultMaxConcurrency,
+			CurrencyAPIURL:                 tools.DefaultCurrencyAPIURL,
+			CurrencyCacheTTLSeconds:        int(tools.DefaultCurrencyCacheTTL / time.Second),
+		},
+		Server: ServerConfig{
+			Port:                      "8080",
+			StreamWriteTimeoutSeconds: 30,
+			ConversationPageSize:      api.DefaultConversationPageSize,
+			MaxRequestBodyBytes:       api.DefaultMaxRequestBodyBytes,
+			TitleUseLLM:               true,
+			TitleMessages:             api.DefaultTitleMessages,
+		},
+		Tracing: TracingConfig{
+			Exporter: "none",
+		},
+	}
+}
+
+// Load 加载配置：先取默认值，再读取JSON配置文件（path 为空时跳过），最后应用环境变量覆盖并校验
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取配置文件失败: %w", err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if cfg.LLM.Model == "" {
+		cfg.LLM.Model = defaultModel(cfg.LLM.Provider)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv 使用环境变量覆盖配置
+func (c *Config) applyEnv() error {
+	envString("LOG_LEVEL", &c.Log.Level)
+	envString("LOG_COLOR", &c.Log.Color)
+	envString("LOG_FORMAT", &c.Log.Format)
+	envString("LOG_FILE", &c.Log.File)
+	envString("LLM_PROVIDER", &c.LLM.Provider)
+	envString("LLM_DECISION_MODEL", &c.LLM.DecisionModel)
+	envString("OLLAMA_BASE_URL", &c.LLM.BaseURL)
+	envString("OPENAI_API_KEY", &c.LLM.APIKey)
+	envString("OLLAMA_KEEP_ALIVE", &c.LLM.KeepAlive)
+	envString("OLLAMA_MODE", &c.LLM.OllamaMode)
+	// 模型名只读取当前提供方对应的环境变量，避免沿用另一提供方的模型名
+	if strings.EqualFold(c.LLM.Provider, "openai") {
+		envString("OPENAI_MODEL", &c.LLM.Model)
+	} else {
+		envString("OLLAMA_MODEL", &c.LLM.Model)
+	}
+	envString("AGENT_PROMPT", &c.Agent.Prompt)
+	envString("EMPTY_RESPONSE_MESSAGE", &c.Agent.EmptyResponseMessage)
+	envString("TOOL_SENTINEL_START", &c.Agent.ToolSentinelStart)
+	envString("TOOL_SENTINEL_END", &c.Agent.ToolSentinelEnd)
+	envString("TOOL_SENTINEL_INSTRUCTION", &c.Agent.ToolSentinelInstruction)
+	envString("CITATION_MODE", &c.Agent.CitationMode)
+	envString("TOOL_RESULT_GUARD", &c.Agent.ToolResultGuard)
+	envString("MEMORY_TYPE", &c.Memory.Type)
+	envString("MEMORY_DATA_DIR", &c.Memory.DataDir)
+	envString("CONVERSATION_ID_PATTERN", &c.Memory.ConversationIDPattern)
+	envString("MEMORY_EMBEDDINGS", &c.Memory.Embeddings)
+	envString("EMBEDDING_MODEL", &c.Memory.EmbeddingModel)
+	envString("SEARCH_API_KEY", &c.Tools.SearchAPIKey)
+	envString("SEARCH_ENGINE", &c.Tools.SearchEngine)
+	envString("SEARCH_AUTH_FALLBACK", &c.Tools.SearchAuthFallback)
+	envString("KNOWLEDGE_BASE_PATH", &c.Tools.KnowledgeBasePath)
+	envString("TOOL_CASSETTE", &c.Tools.Cassette)
+	envString("CURRENCY_API_URL", &c.Tools.CurrencyAPIURL)
+	envString("OTEL_TRACES_EXPORTER", &c.Tracing.Exporter)
+
+	if v := os.Getenv("FEATURES"); v != "" {
+		c.applyFeatures(v)
+	}
+	if v := os.Getenv("ENABLED_TOOLS"); v != "" {
+		c.Tools.EnabledTools = splitList(v)
+	}
+	if v := os.Getenv("STRICT_TOOL_RULES"); v != "" {
+		var rules map[string]string
+		if err := json.Unmarshal([]byte(v), &rules); err != nil {
+			return fmt.Errorf("环境变量 STRICT_TOOL_RULES 不是有效的JSON: %w", err)
+		}
+		c.Agent.StrictToolRules = rules
+	}
+	if v := os.Getenv("TOOL_PARAM_DEFAULTS"); v != "" {
+		var defaults map[string]map[string]interface{}
+		if err := json.Unmarshal([]byte(v), &defaults); err != nil {
+			return fmt.Errorf("环境变量 TOOL_PARAM_DEFAULTS 不是有效的JSON: %w", err)
+		}
+		c.Tools.ParamDefaults = defaults
+	}
+
+	floats := []struct {
+		key    string
+		target **float64
+	}{
+		{"LLM_TEMPERATURE", &c.LLM.Temperature},
+		{"LLM_TOP_P", &c.LLM.TopP},
+	}
+	for _, item := range floats {
+		if err := envFloat(item.key, item.target); err != nil {
+			return err
+		}
+	}
+
+	ints := []struct {
+		key    string
+		target *int
+	}{
+		{"LOG_MAX_FIELD_LENGTH", &c.Log.MaxFieldLength},
+		{"LOG_FILE_MAX_SIZE_MB", &c.Log.FileMaxSizeMB},
+		{"LOG_FILE_MAX_BACKUPS", &c.Log.FileMaxBackups},
+		{"LLM_MAX_TOKENS", &c.LLM.MaxTokens},
+		{"OLLAMA_MAX_TOKENS", &c.LLM.OllamaMaxTokens},
+		{"OPENAI_MAX_TOKENS", &c.LLM.OpenAIMaxTokens},
+		{"RESPONSE_CACHE_SIZE", &c.LLM.ResponseCacheSize},
+		{"OLLAMA_MAX_RETRIES", &c.LLM.MaxRetries},
+		{"OLLAMA_MAX_LOAD_RETRIES", &c.LLM.MaxLoadRetries},
+		{"OLLAMA_REQUEST_TIMEOUT_SECONDS", &c.LLM.RequestTimeoutSeconds},
+		{"OLLAMA_LOAD_WAIT_SECONDS", &c.LLM.LoadWaitSeconds},
+		{"OLLAMA_RETRY_BACKOFF_SECONDS", &c.LLM.RetryBackoffSeconds},
+		{"MAX_SEARCH_RESULTS", &c.Agent.MaxSearchResults},
+		{"STRICT_TOOL_MAX_RETRIES", &c.Agent.MaxStrictRetries},
+		{"MAX_TOOL_ITERATIONS", &c.Agent.MaxToolIterations},
+		{"MIN_RESPONSE_CHARS", &c.Agent.MinResponseChars},
+		{"MAX_TURN_SECONDS", &c.Agent.MaxTurnSeconds},
+		{"RETRY_BUDGET_SECONDS", &c.Agent.RetryBudgetSeconds},
+		{"MAX_INPUT_CHARS", &c.Agent.MaxInputChars},
+		{"MAX_INPUT_TOKENS", &c.Agent.MaxInputTokens},
+		{"KNOWLEDGE_CONTEXT_MAX_SNIPPETS", &c.Agent.KnowledgeContextMaxSnippets},
+		{"KNOWLEDGE_CONTEXT_MAX_CHARS", &c.Agent.KnowledgeContextMaxChars},
+		{"HISTORY_MAX_MESSAGES", &c.Agent.HistoryMaxMessages},
+		{"HISTORY_MAX_TOKENS", &c.Agent.HistoryMaxTokens},
+		{"MAX_PERSISTED_MESSAGES", &c.Memory.MaxMessages},
+		{"MESSAGE_DEDUPE_WINDOW_SECONDS", &c.Memory.DedupeWindowSeconds},
+		{"SESSION_IDLE_MINUTES", &c.Memory.SessionIdleMinutes},
+		{"SSE_WRITE_TIMEOUT_SECONDS", &c.Server.StreamWriteTimeoutSeconds},
+		{"CONVERSATION_RATE_LIMIT", &c.Server.ConversationRateLimit},
+		{"MAX_ACTIVE_CONVERSATIONS_PER_IP", &c.Server.MaxActiveConversationsPerIP},
+		{"CONVERSATION_PAGE_SIZE", &c.Server.ConversationPageSize},
+		{"MAX_REQUEST_BODY_BYTES", &c.Server.MaxRequestBodyBytes},
+		{"AUTO_ARCHIVE_AFTER_HOURS", &c.Server.AutoArchiveAfterHours},
+		{"TITLE_MESSAGES", &c.Server.TitleMessages},
+		{"SEARCH_ENRICHMENT_TIMEOUT_SECONDS", &c.Tools.SearchEnrichmentTimeoutSeconds},
+		{"SEARCH_ENRICHMENT_MAX_CHARS", &c.Tools.SearchEnrichmentMaxChars},
+		{"MAX_PARALLEL_TOOLS", &c.Tools.MaxParallelTools},
+		{"CURRENCY_CACHE_TTL_SECONDS", &c.Tools.CurrencyCacheTTLSeconds},
+		{"SEARCH_TIMEOUT_SECONDS", &c.Tools.SearchTimeoutSeconds},
+		{"SEARCH_MAX_RESULTS", &c.Tools.SearchMaxResults},
+		{"SEARCH_AUTH_DISABLE_AFTER", &c.Tools.SearchAuthDisableAfter},
+		{"KNOWLEDGE_BASE_MAX_DOCUMENT_BYTES", &c.Tools.KnowledgeBaseMaxDocumentBytes},
+	}
+	for _, item := range ints {
+		if err := envInt(item.key, item.target); err != nil {
+			return err
+		}
+	}
+
+	bools := []struct {
+		key    string
+		target *bool
+	}{
+		{"STREAM_DECISION_THINKING", &c.Agent.StreamDecisionThinking},
+		{"RETRY_ON_EMPTY_RESPONSE", &c.Agent.RetryOnEmpty},
+		{"KNOWLEDGE_CONTEXT", &c.Agent.KnowledgeContext},
+		{"TOOL_SENTINEL", &c.Agent.ToolSentinel},
+		{"PERSIST_PARTIAL_RESPONSES", &c.Agent.PersistPartialResponses},
+		{"LLM_WARMUP", &c.LLM.Warmup},
+		{"RESPONSE_CACHE_ANY_TEMPERATURE", &c.LLM.ResponseCacheAnyTemperature},
+		{"SEARCH_ENRICHMENT", &c.Tools.SearchEnrichment},
+		{"CURRENCY_TOOL", &c.Tools.Currency},
+		{"KNOWLEDGE_BASE_FUZZY_NAMES", &c.Tools.KnowledgeBaseFuzzyNames},
+		{"TITLE_USE_LLM", &c.Server.TitleUseLLM},
+	}
+	for _, item := range bools {
+		if err := envBool(item.key, item.target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate 校验配置，返回第一个发现的问题
+func (c *Config) Validate() error {
+	switch strings.ToUpper(c.Log.Level) {
+	case "DEBUG", "INFO", "WARN", "ERROR":
+	default:
+		return fmt.Errorf("log.level 无效: %q（可选 DEBUG/INFO/WARN/ERROR）", c.Log.Level)
+	}
+	switch strings.ToLower(c.Log.Color) {
+	case "", "auto", "true", "false":
+	default:
+		return fmt.Errorf("log.color 无效: %q（可选 auto/true/false）", c.Log.Color)
+	}
+	if _, err := logger.ParseFormat(c.Log.Format); err != nil {
+		return fmt.Errorf("log.format 无效: %q（可选 text/json）", c.Log.Format)
+	}
+	if c.Log.FileMaxBackups < 0 {
+		return fmt.Errorf("log.file_max_backups 不能为负数")
+	}
+
+	switch strings.ToLower(c.LLM.Provider) {
+	case "ollama":
+		if c.LLM.BaseURL == "" {
+			return fmt.Errorf("llm.base_url 不能为空")
+		}
+		if _, err := llm.ParseOllamaMode(c.LLM.OllamaMode); err != nil {
+			return fmt.Errorf("llm.ollama_mode 无效: %q（可选 chat/generate/auto）", c.LLM.OllamaMode)
+		}
+	case "openai":
+		if c.LLM.APIKey == "" {
+			return fmt.Errorf("llm.provider 为 openai 时必须设置 llm.api_key（或环境变量 OPENAI_API_KEY）")
+		}
+	default:
+		// 其他提供方通过 llm.RegisterProvider 注册，所需参数由其 factory 在创建客户端时校验
+		if !llm.HasProvider(c.LLM.Provider) {
+			return fmt.Errorf("llm.provider 无效: %q（可选 %s）", c.LLM.Provider, strings.Join(llm.Providers(), "/"))
+		}
+	}
+	if c.LLM.Model == "" {
+		return fmt.Errorf("llm.model 不能为空")
+	}
+	if c.LLM.MaxTokens < 0 {
+		return fmt.Errorf("llm.max_tokens 不能为负数")
+	}
+	if c.LLM.OllamaMaxTokens < 0 {
+		return fmt.Errorf("llm.ollama_max_tokens 不能为负数")
+	}
+	if c.LLM.OpenAIMaxTokens < 0 {
+		return fmt.Errorf("llm.openai_max_tokens 不能为负数")
+	}
+	if t := c.LLM.Temperature; t != nil && (*t < 0 || *t > 2) {
+		return fmt.Errorf("llm.temperature 必须在 0~2 之间: %v", *t)
+	}
+	if p := c.LLM.TopP; p != nil && (*p <= 0 || *p > 1) {
+		return fmt.Errorf("llm.top_p 必须大于 0 且不超过 1: %v", *p)
+	}
+	if c.LLM.ResponseCacheSize < 0 {
+		return fmt.Errorf("llm.response_cache_size 不能为负数")
+	}
+
+	if c.Agent.RetryBudgetSeconds < 0 {
+		return fmt.Errorf("agent.retry_budget_seconds 不能为负数")
+	}
+	if c.Agent.MaxInputChars < 0 {
+		return fmt.Errorf("agent.max_input_chars 不能为负数")
+	}
+	if c.Agent.MaxInputTokens < 0 {
+		return fmt.Errorf("agent.max_input_tokens 不能为负数")
+	}
+
+	if c.Server.ConversationPageSize < 1 || c.Server.ConversationPageSize > api.MaxConversationPageSize {
+		return fmt.Errorf("server.conversation_page_size 必须在 1-%d 之间", api.MaxConversationPageSize)
+	}
+	if c.Server.MaxRequestBodyBytes < 1 {
+		return fmt.Errorf("server.max_request_body_bytes 必须大于 0")
+	}
+	if c.Server.AutoArchiveAfterHours < 0 {
+		return fmt.Errorf("server.auto_archive_after_hours 不能为负数")
+	}
+	if c.Server.TitleMessages < 1 {
+		return fmt.Errorf("server.title_messages 必须大于 0")
+	}
+
+	switch c.Agent.CitationMode {
+	case "", agent.CitationModeOff, agent.CitationModeInstruct, agent.CitationModeVerify:
+	default:
+		return fmt.Errorf("agent.citation_mode 无效: %q（可选 off/instruct/verify）", c.Agent.CitationMode)
+	}
+	switch c.Agent.ToolResultGuard {
+	case "", agent.ToolResultGuardRepair, agent.ToolResultGuardStrict, agent.ToolResultGuardOff:
+	default:
+		return fmt.Errorf("agent.tool_result_guard 无效: %q（可选 repair/strict/off）", c.Agent.ToolResultGuard)
+	}
+
+	switch c.Memory.Type {
+	case "", "simple", "vector":
+	default:
+		return fmt.Errorf("memory.type 无效: %q（可选 simple/vector）", c.Memory.Type)
+	}
+	switch strings.ToLower(c.Memory.Embeddings) {
+	case "", "none":
+	case "openai":
+		if c.Memory.Type != "vector" {
+			return fmt.Errorf("memory.embeddings 仅在 memory.type 为 vector 时可用")
+		}
+		if strings.TrimSpace(c.LLM.APIKey) == "" {
+			return fmt.Errorf("memory.embeddings 为 openai 时必须设置 llm.api_key（或环境变量 OPENAI_API_KEY）")
+		}
+	case "ollama":
+		if c.Memory.Type != "vector" {
+			return fmt.Errorf("memory.embeddings 仅在 memory.type 为 vector 时可用")
+		}
+		// 复用 llm.base_url，只有 provider 为 ollama 时该地址才指向 Ollama 服务
+		if !strings.EqualFold(c.LLM.Provider, "ollama") {
+			return fmt.Errorf("memory.embeddings 为 ollama 时 llm.provider 必须为 ollama")
+		}
+	default:
+		return fmt.Errorf("memory.embeddings 无效: %q（可选 none/openai/ollama）", c.Memory.Embeddings)
+	}
+	if _, err := c.conversationIDPattern(); err != nil {
+		return err
+	}
+
+	if c.Tools.SearchEngine != "" {
+		engine, err := tools.ParseSearchEngineType(c.Tools.SearchEngine)
+		if err != nil {
+			return fmt.Errorf("tools.search_engine 无效: %w", err)
+		}
+		if engine.RequiresAPIKey() && strings.TrimSpace(c.Tools.SearchAPIKey) == "" {
+			return fmt.Errorf("tools.search_engine 为 %s 时必须配置 tools.search_api_key（SEARCH_API_KEY）", engine)
+		}
+	}
+	if _, err := tools.ParseSearchFallback(c.Tools.SearchAuthFallback); err != nil {
+		return fmt.Errorf("tools.search_auth_fallback 无效: %w", err)
+	}
+	if c.Tools.SearchAuthDisableAfter < 0 {
+		return fmt.Errorf("tools.search_auth_disable_after 不能为负数")
+	}
+	if c.Tools.Currency && c.Tools.CurrencyCacheTTLSeconds < 0 {
+		return fmt.Errorf("tools.currency_cache_ttl_seconds 不能为负数")
+	}
+	if c.Tools.SearchTimeoutSeconds < 0 {
+		return fmt.Errorf("tools.search_timeout_seconds 不能为负数")
+	}
+	if c.Tools.SearchMaxResults < 0 {
+		return fmt.Errorf("tools.search_max_results 不能为负数")
+	}
+	if c.Tools.KnowledgeBaseMaxDocumentBytes < 0 {
+		return fmt.Errorf("tools.knowledge_base_max_document_bytes 不能为负数")
+	}
+
+	if c.Server.Port == "" {
+		return fmt.Errorf("server.port 不能为空")
+	}
+	return nil
+}
+
+// defaultModel 返回提供方的默认模型
+func defaultModel(provider string) string {
+	if strings.EqualFold(provider, "openai") {
+		return DefaultOpenAIModel
+	}
+	return DefaultOllamaModel
+}
+
+// conversationIDPattern 编译会话ID正则，未配置时返回 nil（使用默认格式）
+func (c *Config) conversationIDPattern() (*regexp.Regexp, error) {
+	if c.Memory.ConversationIDPattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(c.Memory.ConversationIDPattern)
+	if err != nil {
+		return nil, fmt.Errorf("memory.conversation_id_pattern 无效: %w", err)
+	}
+	return re, nil
+}
+
+// providerMaxTokens 返回当前提供方的最大生成 token 数：按提供方的配置优先，其次为 max_tokens
+// 均未配置时返回 0，由 LLM 客户端使用提供方默认值
+func (c *LLMConfig) providerMaxTokens() int {
+	perProvider := c.OllamaMaxTokens
+	if strings.EqualFold(c.Provider, "openai") {
+		perProvider = c.OpenAIMaxTokens
+	}
+	if perProvider > 0 {
+		return perProvider
+	}
+	return c.MaxTokens
+}
+
+// AgentConfig 转换为 agent.Config
+func (c *Config) AgentConfig() (agent.Config, error) {
+	rulesJSON, err := json.Marshal(c.Agent.StrictToolRules)
+	if err != nil {
+		return agent.Config{}, fmt.Errorf("序列化强制工具规则失败: %w", err)
+	}
+	strictTools, err := agent.ParseStrictToolRules(string(rulesJSON))
+	if err != nil {
+		return agent.Config{}, err
+	}
+	idPattern, err := c.conversationIDPattern()
+	if err != nil {
+		return agent.Config{}, err
+	}
+	var sentinelStart, sentinelEnd string
+	if c.Agent.ToolSentinel {
+		sentinelStart, sentinelEnd = c.Agent.ToolSentinelStart, c.Agent.ToolSentinelEnd
+		if sentinelStart == "" {
+			sentinelStart = agent.DefaultToolSentinelStart
+		}
+		if sentinelEnd == "" {
+			sentinelEnd = agent.DefaultToolSentinelEnd
+		}
+	}
+
+	return agent.Config{
+		Name:        c.Agent.Name,
+		Description: c.Agent.Description,
+		ModelConfig: agent.ModelConfig{
+			Provider:    c.LLM.Provider,
+			ModelName:   c.LLM.Model,
+			APIKey:      c.LLM.APIKey,
+			BaseURL:     c.LLM.BaseURL,
+			MaxTokens:   c.LLM.providerMaxTokens(),
+			Prompt:      c.Agent.Prompt,
+			Temperature: c.LLM.Temperature,
+			TopP:        c.LLM.TopP,
+			Warmup:      c.LLM.Warmup,
+			KeepAlive:   c.LLM.KeepAlive,
+			OllamaMode:  c.LLM.OllamaMode,
+			// Ollama 请求重试与超时
+			MaxRetries:     c.LLM.MaxRetries,
+			MaxLoadRetries: c.LLM.MaxLoadRetries,
+			RequestTimeout: time.Duration(c.LLM.RequestTimeoutSeconds) * time.Second,
+			LoadWait:       time.Duration(c.LLM.LoadWaitSeconds) * time.Second,
+			RetryBackoff:   time.Duration(c.LLM.RetryBackoffSeconds) * time.Second,
+		},
+		MemoryConfig: agent.MemoryConfig{
+			MemoryType:            c.Memory.Type,
+			DBPath:                c.Memory.DataDir,
+			MaxMessages:           c.Memory.MaxMessages,
+			DedupeWindow:          time.Duration(c.Memory.DedupeWindowSeconds) * time.Second,
+			ConversationIDPattern: idPattern,
+			SessionIdleTTL:        time.Duration(c.Memory.SessionIdleMinutes) * time.Minute,
+		},
+		ToolsConfig: agent.ToolsConfig{
+			EnabledTools:  c.Tools.EnabledTools,
+			ParamDefaults: c.Tools.ParamDefaults,
+		},
+		Behavior: agent.BehaviorConfig{
+			StreamDecisionThinking:      c.Agent.StreamDecisionThinking,
+			MaxSearchResults:            c.Agent.MaxSearchResults,
+			EmptyResponseMessage:        c.Agent.EmptyResponseMessage,
+			RetryOnEmpty:                c.Agent.RetryOnEmpty,
+			MinResponseChars:            c.Agent.MinResponseChars,
+			PersistPartialResponses:     c.Agent.PersistPartialResponses,
+			StrictTools:                 strictTools,
+			MaxStrictRetries:            c.Agent.MaxStrictRetries,
+			MaxToolIterations:           c.Agent.MaxToolIterations,
+			KnowledgeContext:            c.Agent.KnowledgeContext,
+			KnowledgeContextMaxSnippets: c.Agent.KnowledgeContextMaxSnippets,
+			KnowledgeContextMaxChars:    c.Agent.KnowledgeContextMaxChars,
+			ToolSentinelStart:           sentinelStart,
+			ToolSentinelEnd:             sentinelEnd,
+			ToolSentinelInstruction:     c.Agent.ToolSentinelInstruction,
+			CitationMode:                c.Agent.CitationMode,
+			ToolResultGuard:             c.Agent.ToolResultGuard,
+		},
+		History: agent.HistoryConfig{
+			MaxMessages: c.Agent.HistoryMaxMessages,
+			MaxTokens:   c.Agent.HistoryMaxTokens,
+		},
+		MaxTurnDuration: time.Duration(c.Agent.MaxTurnSeconds) * time.Second,
+		RetryBudget:     time.Duration(c.Agent.RetryBudgetSeconds) * time.Second,
+		MaxInputChars:   c.Agent.MaxInputChars,
+		MaxInputTokens:  c.Agent.MaxInputTokens,
+		Features:        c.agentFeatures(),
+		Cache:           c.LLM.responseCache(),
+	}, nil
+}
+
+// responseCache 按配置创建响应缓存，未启用时 Cache 为 nil
+func (l LLMConfig) responseCache() agent.CacheConfig {
+	if l.ResponseCacheSize <= 0 {
+		return agent.CacheConfig{}
+	}
+	return agent.CacheConfig{
+		Cache:          agent.NewLRUResponseCache(l.ResponseCacheSize),
+		AnyTemperature: l.ResponseCacheAnyTemperature,
+	}
+}
+
+// applyFeatures 按逗号分隔的列表设置特性开关，名称前加 "-" 表示关闭，如 "rag,-native_tools"
+func (c *Config) applyFeatures(list string) {
+	if c.Features == nil {
+		c.Features = make(map[string]bool)
+	}
+	for _, name := range splitList(list) {
+		enabled := !strings.HasPrefix(name, "-")
+		name = strings.ToLower(strings.TrimPrefix(name, "-"))
+		if name == "" {
+			continue
+		}
+		// 移除配置文件中大小写不同的同名特性，确保环境变量覆盖
+		for existing := range c.Features {
+			if strings.EqualFold(existing, name) {
+				delete(c.Features, existing)
+			}
+		}
+		c.Features[name] = enabled
+	}
+}
+
+// agentFeatures 复制特性开关，特性名不区分大小写
+func (c *Config) agentFeatures() agent.Features {
+	if len(c.Features) == 0 {
+		return nil
+	}
+	features := make(agent.Features, len(c.Features))
+	for name, enabled := range c.Features {
+		features[strings.ToLower(name)] = enabled
+	}
+	return features
+}
+
+// envString 环境变量非空时覆盖字符串配置
+func envString(key string, target *string) {
+	if v := os.Getenv(key); v != "" {
+		*target = v
+	}
+}
+
+// envInt 环境变量非空时覆盖整数配置
+func envInt(key string, target *int) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return fmt.Errorf("环境变量 %s 不是有效整数: %q", key, v)
+	}
+	*target = n
+	return nil
+}
+
+// envFloat 环境变量非空时覆盖可选的浮点配置
+func envFloat(key string, target **float64) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		return fmt.Errorf("环境变量 %s 不是有效数字: %q", key, v)
+	}
+	*target = &f
+	return nil
+}
+
+// envBool 环境变量非空时覆盖布尔配置
+func envBool(key string, target *bool) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(v))
+	if err != nil {
+		return fmt.Errorf("环境变量 %s 不是有效布尔值: %q", key, v)
+	}
+	*target = b
+	return nil
+}
+
+// splitList 解析逗号分隔的列表
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
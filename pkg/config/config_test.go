@@ -0,0 +1,687 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"agentEino/pkg/agent"
+	"agentEino/pkg/api"
+	"agentEino/pkg/llm"
+	"agentEino/pkg/memory"
+	"agentEino/pkg/tools"
+)
+
+// writeConfig 将 JSON 内容写入临时配置文件并返回路径
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+	return path
+}
+
+// clearEnv 清空会影响测试结果的环境变量
+func clearEnv(t *testing.T, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		t.Setenv(key, "")
+	}
+}
+
+func TestLoadAppliesFileThenEnvOverrides(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OLLAMA_MODEL", "OPENAI_MODEL", "OPENAI_API_KEY", "MEMORY_DATA_DIR")
+	path := writeConfig(t, `{
+		"llm": {"provider": "ollama", "base_url": "http://ollama:11434", "model": "llama3.1"},
+		"agent": {"max_tool_iterations": 7, "retry_on_empty": false},
+		"server": {"port": "9090"}
+	}`)
+	t.Setenv("OLLAMA_MODEL", "qwen2.5")
+	t.Setenv("MAX_TOOL_ITERATIONS", "3")
+	t.Setenv("RETRY_ON_EMPTY_RESPONSE", "true")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if cfg.LLM.BaseURL != "http://ollama:11434" || cfg.Server.Port != "9090" {
+		t.Errorf("未应用配置文件中的值: base_url=%q port=%q", cfg.LLM.BaseURL, cfg.Server.Port)
+	}
+	if cfg.LLM.Model != "qwen2.5" {
+		t.Errorf("OLLAMA_MODEL 应覆盖配置文件，实际 %q", cfg.LLM.Model)
+	}
+	if cfg.Agent.MaxToolIterations != 3 || !cfg.Agent.RetryOnEmpty {
+		t.Errorf("环境变量应覆盖配置文件: max_tool_iterations=%d retry_on_empty=%v", cfg.Agent.MaxToolIterations, cfg.Agent.RetryOnEmpty)
+	}
+	if cfg.Memory.DataDir != memory.DefaultDataDir {
+		t.Errorf("memory.data_dir 默认值 = %q，期望 %q", cfg.Memory.DataDir, memory.DefaultDataDir)
+	}
+}
+
+func TestLoadRejectsInvalidConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "MAX_TOOL_ITERATIONS")
+	cases := map[string]string{
+		"未知字段":      `{"llm": {"modle": "x"}}`,
+		"未知提供方":     `{"llm": {"provider": "anthropic"}}`,
+		"缺少API Key": `{"llm": {"provider": "openai"}}`,
+	}
+	for name, content := range cases {
+		if _, err := Load(writeConfig(t, content)); err == nil {
+			t.Errorf("%s: 应返回错误", name)
+		}
+	}
+
+	t.Setenv("MAX_TOOL_ITERATIONS", "abc")
+	if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "MAX_TOOL_ITERATIONS") {
+		t.Errorf("无效的整数环境变量应报错并指明变量名，实际 %v", err)
+	}
+}
+
+func TestLoadUsesProviderDefaultModel(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OLLAMA_MODEL", "OPENAI_MODEL", "OPENAI_API_KEY")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if cfg.LLM.Model != DefaultOllamaModel {
+		t.Errorf("ollama 默认模型 = %q，期望 %q", cfg.LLM.Model, DefaultOllamaModel)
+	}
+
+	t.Setenv("LLM_PROVIDER", "openai")
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	// 只设置了 Ollama 的模型时不应沿用到 OpenAI
+	t.Setenv("OLLAMA_MODEL", "llama3.1")
+	if cfg, err = Load(""); err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if cfg.LLM.Model != DefaultOpenAIModel {
+		t.Errorf("openai 默认模型 = %q，期望 %q", cfg.LLM.Model, DefaultOpenAIModel)
+	}
+
+	t.Setenv("OPENAI_MODEL", "gpt-4o")
+	if cfg, err = Load(""); err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if cfg.LLM.Model != "gpt-4o" {
+		t.Errorf("OPENAI_MODEL 应生效，实际 %q", cfg.LLM.Model)
+	}
+}
+
+func TestAgentConfigUsesPerProviderMaxTokens(t *testing.T) {
+	cases := []struct {
+		llm  LLMConfig
+		want int
+	}{
+		{LLMConfig{Provider: "ollama", MaxTokens: 1000, OllamaMaxTokens: 4000, OpenAIMaxTokens: 2000}, 4000},
+		{LLMConfig{Provider: "openai", MaxTokens: 1000, OllamaMaxTokens: 4000, OpenAIMaxTokens: 2000}, 2000},
+		{LLMConfig{Provider: "openai", MaxTokens: 1000, OllamaMaxTokens: 4000}, 1000},
+		{LLMConfig{Provider: "ollama"}, 0},
+	}
+	for _, c := range cases {
+		cfg := Default()
+		cfg.LLM = c.llm
+		ac, err := cfg.AgentConfig()
+		if err != nil {
+			t.Fatalf("转换配置失败: %v", err)
+		}
+		if ac.ModelConfig.MaxTokens != c.want {
+			t.Errorf("%+v: MaxTokens = %d，期望 %d", c.llm, ac.ModelConfig.MaxTokens, c.want)
+		}
+	}
+}
+
+func TestFeaturesEnvOverridesFile(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY")
+	path := writeConfig(t, `{"features": {"rag": false, "Tool_Catalog": true, "time_travel": true}}`)
+	t.Setenv("FEATURES", "RAG, -tool_catalog")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("未知特性不应导致加载失败: %v", err)
+	}
+	ac, err := cfg.AgentConfig()
+	if err != nil {
+		t.Fatalf("转换配置失败: %v", err)
+	}
+	if !ac.Features.Enabled(agent.FeatureRAG) || ac.Features.Enabled(agent.FeatureToolCatalog) {
+		t.Errorf("FEATURES 应覆盖配置文件且不区分大小写: %v", ac.Features)
+	}
+	if got := ac.Features.Unknown(); len(got) != 1 || got[0] != "time_travel" {
+		t.Errorf("未知特性应原样保留以便启动时警告: %v", got)
+	}
+}
+
+func TestConversationPageSize(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "CONVERSATION_PAGE_SIZE")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if cfg.Server.ConversationPageSize != api.DefaultConversationPageSize {
+		t.Errorf("默认 conversation_page_size = %d，期望 %d", cfg.Server.ConversationPageSize, api.DefaultConversationPageSize)
+	}
+
+	t.Setenv("CONVERSATION_PAGE_SIZE", "50")
+	if cfg, err = Load(""); err != nil || cfg.Server.ConversationPageSize != 50 {
+		t.Errorf("CONVERSATION_PAGE_SIZE 应覆盖默认值: %v, %v", cfg, err)
+	}
+	for _, v := range []string{"0", "101"} {
+		t.Setenv("CONVERSATION_PAGE_SIZE", v)
+		if _, err := Load(""); err == nil {
+			t.Errorf("CONVERSATION_PAGE_SIZE=%s 应返回错误", v)
+		}
+	}
+}
+
+func TestCurrencyToolConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "CURRENCY_TOOL", "CURRENCY_API_URL", "CURRENCY_CACHE_TTL_SECONDS")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if cfg.Tools.Currency || cfg.Tools.CurrencyAPIURL != tools.DefaultCurrencyAPIURL || cfg.Tools.CurrencyCacheTTLSeconds != 3600 {
+		t.Errorf("默认汇率工具配置 = %+v，期望关闭且使用默认接口和 TTL", cfg.Tools)
+	}
+
+	t.Setenv("CURRENCY_TOOL", "true")
+	t.Setenv("CURRENCY_API_URL", "http://fx.local/latest")
+	t.Setenv("CURRENCY_CACHE_TTL_SECONDS", "60")
+	if cfg, err = Load(""); err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if !cfg.Tools.Currency || cfg.Tools.CurrencyAPIURL != "http://fx.local/latest" || cfg.Tools.CurrencyCacheTTLSeconds != 60 {
+		t.Errorf("环境变量应覆盖汇率工具配置: %+v", cfg.Tools)
+	}
+
+	t.Setenv("CURRENCY_CACHE_TTL_SECONDS", "-1")
+	if _, err := Load(""); err == nil {
+		t.Error("负数的缓存时长应返回错误")
+	}
+}
+
+func TestRetryBudgetConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "RETRY_BUDGET_SECONDS")
+	budget := func() time.Duration {
+		t.Helper()
+		cfg, err := Load("")
+		if err != nil {
+			t.Fatalf("加载配置失败: %v", err)
+		}
+		ac, err := cfg.AgentConfig()
+		if err != nil {
+			t.Fatalf("生成 Agent 配置失败: %v", err)
+		}
+		return ac.RetryBudget
+	}
+	if got := budget(); got != agent.DefaultRetryBudget {
+		t.Errorf("默认重试预算 = %s，期望 %s", got, agent.DefaultRetryBudget)
+	}
+	t.Setenv("RETRY_BUDGET_SECONDS", "0")
+	if got := budget(); got != 0 {
+		t.Errorf("RETRY_BUDGET_SECONDS=0 应关闭重试预算，实际 %s", got)
+	}
+	t.Setenv("RETRY_BUDGET_SECONDS", "-5")
+	if _, err := Load(""); err == nil {
+		t.Error("负数的重试预算应返回错误")
+	}
+}
+
+func TestKeyedSearchEngineRequiresAPIKey(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "SEARCH_ENGINE", "SEARCH_API_KEY")
+	for _, engine := range []string{"searchapi", "serpapi", "bing"} {
+		t.Setenv("SEARCH_ENGINE", engine)
+		t.Setenv("SEARCH_API_KEY", "")
+		if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "SEARCH_API_KEY") {
+			t.Errorf("%s 缺少密钥时应返回提示配置 SEARCH_API_KEY 的错误，实际 %v", engine, err)
+		}
+		t.Setenv("SEARCH_API_KEY", "key")
+		if _, err := Load(""); err != nil {
+			t.Errorf("%s 配置密钥后加载失败: %v", engine, err)
+		}
+	}
+	t.Setenv("SEARCH_ENGINE", "duckduckgo")
+	t.Setenv("SEARCH_API_KEY", "")
+	if _, err := Load(""); err != nil {
+		t.Errorf("duckduckgo 不需要密钥: %v", err)
+	}
+}
+
+func TestKnowledgeBaseMaxDocumentBytesConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "KNOWLEDGE_BASE_MAX_DOCUMENT_BYTES")
+
+	cfg, err := Load("")
+	if err != nil || cfg.Tools.KnowledgeBaseMaxDocumentBytes != tools.DefaultMaxDocumentBytes {
+		t.Fatalf("默认值 = %d, %v", cfg.Tools.KnowledgeBaseMaxDocumentBytes, err)
+	}
+
+	t.Setenv("KNOWLEDGE_BASE_MAX_DOCUMENT_BYTES", "1024")
+	if cfg, err = Load(""); err != nil || cfg.Tools.KnowledgeBaseMaxDocumentBytes != 1024 {
+		t.Fatalf("环境变量覆盖 = %d, %v", cfg.Tools.KnowledgeBaseMaxDocumentBytes, err)
+	}
+
+	t.Setenv("KNOWLEDGE_BASE_MAX_DOCUMENT_BYTES", "-1")
+	if _, err := Load(""); err == nil {
+		t.Error("负数上限应校验失败")
+	}
+}
+
+func TestSearchLimitsConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "SEARCH_TIMEOUT_SECONDS", "SEARCH_MAX_RESULTS")
+
+	cfg, err := Load("")
+	if err != nil || cfg.Tools.SearchTimeoutSeconds != 10 || cfg.Tools.SearchMaxResults != tools.DefaultSearchMaxResults {
+		t.Fatalf("默认值 = %d/%d, %v", cfg.Tools.SearchTimeoutSeconds, cfg.Tools.SearchMaxResults, err)
+	}
+
+	t.Setenv("SEARCH_TIMEOUT_SECONDS", "3")
+	t.Setenv("SEARCH_MAX_RESULTS", "5")
+	if cfg, err = Load(""); err != nil || cfg.Tools.SearchTimeoutSeconds != 3 || cfg.Tools.SearchMaxResults != 5 {
+		t.Fatalf("环境变量覆盖 = %d/%d, %v", cfg.Tools.SearchTimeoutSeconds, cfg.Tools.SearchMaxResults, err)
+	}
+
+	t.Setenv("SEARCH_MAX_RESULTS", "-1")
+	if _, err := Load(""); err == nil {
+		t.Error("负数结果数应校验失败")
+	}
+}
+
+func TestMemoryEmbeddingsConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "MEMORY_TYPE", "MEMORY_EMBEDDINGS", "EMBEDDING_MODEL")
+
+	t.Setenv("MEMORY_TYPE", "vector")
+	t.Setenv("MEMORY_EMBEDDINGS", "openai")
+	if _, err := Load(""); err == nil {
+		t.Error("openai 嵌入未配置 API Key 应校验失败")
+	}
+
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("EMBEDDING_MODEL", "text-embedding-3-large")
+	cfg, err := Load("")
+	if err != nil || cfg.Memory.Embeddings != "openai" || cfg.Memory.EmbeddingModel != "text-embedding-3-large" {
+		t.Fatalf("嵌入配置 = %q/%q, %v", cfg.Memory.Embeddings, cfg.Memory.EmbeddingModel, err)
+	}
+
+	t.Setenv("MEMORY_TYPE", "simple")
+	if _, err := Load(""); err == nil {
+		t.Error("simple 记忆不应允许配置嵌入模型")
+	}
+	t.Setenv("MEMORY_EMBEDDINGS", "cohere")
+	if _, err := Load(""); err == nil {
+		t.Error("未知的嵌入提供方应校验失败")
+	}
+}
+
+func TestOllamaModeConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "OLLAMA_MODE")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentCfg, _ := cfg.AgentConfig()
+	if agentCfg.ModelConfig.OllamaMode != "" {
+		t.Errorf("默认 ollama_mode = %q，期望为空（客户端按 chat 处理）", agentCfg.ModelConfig.OllamaMode)
+	}
+
+	t.Setenv("OLLAMA_MODE", "generate")
+	if cfg, err = Load(""); err != nil || cfg.LLM.OllamaMode != "generate" {
+		t.Fatalf("环境变量覆盖 = %q, %v", cfg.LLM.OllamaMode, err)
+	}
+
+	t.Setenv("OLLAMA_MODE", "completion")
+	if _, err := Load(""); err == nil {
+		t.Error("未知模式应校验失败")
+	}
+}
+
+func TestOllamaEmbeddingsConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "MEMORY_TYPE", "MEMORY_EMBEDDINGS", "EMBEDDING_MODEL")
+
+	t.Setenv("MEMORY_TYPE", "vector")
+	t.Setenv("MEMORY_EMBEDDINGS", "ollama")
+	cfg, err := Load("")
+	if err != nil || cfg.Memory.Embeddings != "ollama" {
+		t.Fatalf("ollama 嵌入配置 = %q, %v", cfg.Memory.Embeddings, err)
+	}
+
+	t.Setenv("LLM_PROVIDER", "openai")
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	if _, err := Load(""); err == nil {
+		t.Error("provider 不是 ollama 时不应允许 ollama 嵌入")
+	}
+}
+
+func TestMaxInputConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "MAX_INPUT_CHARS", "MAX_INPUT_TOKENS")
+
+	cfg, err := Load("")
+	if err != nil || cfg.Agent.MaxInputChars != agent.DefaultMaxInputChars || cfg.Agent.MaxInputTokens != 0 {
+		t.Fatalf("默认值 = %d/%d, %v", cfg.Agent.MaxInputChars, cfg.Agent.MaxInputTokens, err)
+	}
+
+	t.Setenv("MAX_INPUT_CHARS", "0")
+	t.Setenv("MAX_INPUT_TOKENS", "4000")
+	cfg, err = Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentCfg, _ := cfg.AgentConfig()
+	if agentCfg.MaxInputChars != 0 || agentCfg.MaxInputTokens != 4000 {
+		t.Errorf("Agent 配置 = %d/%d，期望 0/4000", agentCfg.MaxInputChars, agentCfg.MaxInputTokens)
+	}
+
+	t.Setenv("MAX_INPUT_TOKENS", "-1")
+	if _, err := Load(""); err == nil {
+		t.Error("负数上限应校验失败")
+	}
+}
+
+func TestMaxRequestBodyBytesConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "MAX_REQUEST_BODY_BYTES")
+
+	cfg, err := Load("")
+	if err != nil || cfg.Server.MaxRequestBodyBytes != api.DefaultMaxRequestBodyBytes {
+		t.Fatalf("默认值 = %d, %v", cfg.Server.MaxRequestBodyBytes, err)
+	}
+	t.Setenv("MAX_REQUEST_BODY_BYTES", "4096")
+	if cfg, err = Load(""); err != nil || cfg.Server.MaxRequestBodyBytes != 4096 {
+		t.Fatalf("环境变量覆盖 = %d, %v", cfg.Server.MaxRequestBodyBytes, err)
+	}
+	t.Setenv("MAX_REQUEST_BODY_BYTES", "0")
+	if _, err := Load(""); err == nil {
+		t.Error("0 应校验失败")
+	}
+}
+
+func TestCitationModeConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "CITATION_MODE")
+
+	t.Setenv("CITATION_MODE", "verify")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentCfg, _ := cfg.AgentConfig()
+	if agentCfg.Behavior.CitationMode != agent.CitationModeVerify {
+		t.Errorf("citation_mode = %q，期望 verify", agentCfg.Behavior.CitationMode)
+	}
+
+	t.Setenv("CITATION_MODE", "strict")
+	if _, err := Load(""); err == nil {
+		t.Error("未知的引用模式应校验失败")
+	}
+}
+
+func TestAutoArchiveConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "AUTO_ARCHIVE_AFTER_HOURS")
+
+	cfg, err := Load("")
+	if err != nil || cfg.Server.AutoArchiveAfterHours != 0 {
+		t.Fatalf("默认应不自动归档: %d, %v", cfg.Server.AutoArchiveAfterHours, err)
+	}
+	t.Setenv("AUTO_ARCHIVE_AFTER_HOURS", "72")
+	if cfg, err = Load(""); err != nil || cfg.Server.AutoArchiveAfterHours != 72 {
+		t.Fatalf("环境变量覆盖 = %d, %v", cfg.Server.AutoArchiveAfterHours, err)
+	}
+	t.Setenv("AUTO_ARCHIVE_AFTER_HOURS", "-1")
+	if _, err := Load(""); err == nil {
+		t.Error("负数应校验失败")
+	}
+}
+
+func TestTitleConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "TITLE_USE_LLM", "TITLE_MESSAGES")
+
+	cfg, err := Load("")
+	if err != nil || !cfg.Server.TitleUseLLM || cfg.Server.TitleMessages != 2 {
+		t.Fatalf("默认应用 LLM 根据第一轮问答生成标题: %v %d, %v", cfg.Server.TitleUseLLM, cfg.Server.TitleMessages, err)
+	}
+	t.Setenv("TITLE_USE_LLM", "false")
+	t.Setenv("TITLE_MESSAGES", "4")
+	if cfg, err = Load(""); err != nil || cfg.Server.TitleUseLLM || cfg.Server.TitleMessages != 4 {
+		t.Fatalf("环境变量覆盖 = %v %d, %v", cfg.Server.TitleUseLLM, cfg.Server.TitleMessages, err)
+	}
+	t.Setenv("TITLE_MESSAGES", "0")
+	if _, err := Load(""); err == nil {
+		t.Error("title_messages 为 0 应校验失败")
+	}
+}
+
+func TestResponseCacheConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "RESPONSE_CACHE_SIZE", "RESPONSE_CACHE_ANY_TEMPERATURE")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agentCfg, _ := cfg.AgentConfig(); agentCfg.Cache.Cache != nil {
+		t.Error("默认不应启用响应缓存")
+	}
+
+	t.Setenv("RESPONSE_CACHE_SIZE", "16")
+	t.Setenv("RESPONSE_CACHE_ANY_TEMPERATURE", "true")
+	if cfg, err = Load(""); err != nil {
+		t.Fatal(err)
+	}
+	agentCfg, _ := cfg.AgentConfig()
+	if agentCfg.Cache.Cache == nil || !agentCfg.Cache.AnyTemperature {
+		t.Errorf("响应缓存配置 = %+v", agentCfg.Cache)
+	}
+
+	t.Setenv("RESPONSE_CACHE_SIZE", "-1")
+	if _, err := Load(""); err == nil {
+		t.Error("负数应校验失败")
+	}
+}
+
+func TestToolParamDefaultsConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "TOOL_PARAM_DEFAULTS")
+
+	t.Setenv("TOOL_PARAM_DEFAULTS", `{"web_search":{"num":5}}`)
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentCfg, _ := cfg.AgentConfig()
+	if got := agentCfg.ToolsConfig.ParamDefaults["web_search"]["num"]; got != float64(5) {
+		t.Errorf("web_search.num 默认值 = %v", got)
+	}
+
+	t.Setenv("TOOL_PARAM_DEFAULTS", `{"web_search":5}`)
+	if _, err := Load(""); err == nil {
+		t.Error("格式错误的 JSON 应报错")
+	}
+}
+
+func TestSamplingConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "LLM_TEMPERATURE", "LLM_TOP_P")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agentCfg, _ := cfg.AgentConfig(); agentCfg.ModelConfig.Temperature != nil || agentCfg.ModelConfig.TopP != nil {
+		t.Error("默认不应设置采样参数，由提供方决定")
+	}
+
+	// 温度 0 是有效的显式设置
+	t.Setenv("LLM_TEMPERATURE", "0")
+	t.Setenv("LLM_TOP_P", "0.9")
+	if cfg, err = Load(""); err != nil {
+		t.Fatal(err)
+	}
+	agentCfg, _ := cfg.AgentConfig()
+	if m := agentCfg.ModelConfig; m.Temperature == nil || *m.Temperature != 0 || m.TopP == nil || *m.TopP != 0.9 {
+		t.Errorf("采样参数 = %v, %v", m.Temperature, m.TopP)
+	}
+
+	for _, c := range []struct{ key, value string }{
+		{"LLM_TEMPERATURE", "2.5"},
+		{"LLM_TEMPERATURE", "abc"},
+		{"LLM_TOP_P", "0"},
+	} {
+		t.Setenv("LLM_TEMPERATURE", "0.7")
+		t.Setenv("LLM_TOP_P", "0.9")
+		t.Setenv(c.key, c.value)
+		if _, err := Load(""); err == nil {
+			t.Errorf("%s=%s 应校验失败", c.key, c.value)
+		}
+	}
+}
+
+func TestKnowledgeBaseFuzzyNamesConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "KNOWLEDGE_BASE_FUZZY_NAMES")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Tools.KnowledgeBaseFuzzyNames {
+		t.Error("默认应开启文档名称模糊匹配")
+	}
+
+	t.Setenv("KNOWLEDGE_BASE_FUZZY_NAMES", "false")
+	if cfg, err = Load(""); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Tools.KnowledgeBaseFuzzyNames {
+		t.Error("KNOWLEDGE_BASE_FUZZY_NAMES=false 应关闭模糊匹配")
+	}
+}
+
+func TestDecisionModelConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "LLM_DECISION_MODEL")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LLM.DecisionModel != "" {
+		t.Errorf("默认不应设置决策模型，实际 %q", cfg.LLM.DecisionModel)
+	}
+
+	t.Setenv("LLM_DECISION_MODEL", "llama3.2:1b")
+	if cfg, err = Load(""); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LLM.DecisionModel != "llama3.2:1b" {
+		t.Errorf("决策模型 = %q", cfg.LLM.DecisionModel)
+	}
+}
+
+func TestSearchAuthFallbackConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "SEARCH_AUTH_FALLBACK", "SEARCH_AUTH_DISABLE_AFTER")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Tools.SearchAuthFallback != "duckduckgo" || cfg.Tools.SearchAuthDisableAfter != 3 {
+		t.Errorf("默认备用引擎 = %q，停用阈值 = %d", cfg.Tools.SearchAuthFallback, cfg.Tools.SearchAuthDisableAfter)
+	}
+
+	t.Setenv("SEARCH_AUTH_FALLBACK", "none")
+	t.Setenv("SEARCH_AUTH_DISABLE_AFTER", "0")
+	if cfg, err = Load(""); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Tools.SearchAuthFallback != "none" || cfg.Tools.SearchAuthDisableAfter != 0 {
+		t.Errorf("备用引擎 = %q，停用阈值 = %d", cfg.Tools.SearchAuthFallback, cfg.Tools.SearchAuthDisableAfter)
+	}
+
+	t.Setenv("SEARCH_AUTH_FALLBACK", "bing")
+	if _, err := Load(""); err == nil {
+		t.Error("需要密钥的引擎不能作为备用引擎")
+	}
+}
+
+func TestLogFileConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "LOG_FILE", "LOG_FILE_MAX_SIZE_MB", "LOG_FILE_MAX_BACKUPS")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Log.File != "" || cfg.Log.FileMaxSizeMB != 100 || cfg.Log.FileMaxBackups != 5 {
+		t.Errorf("默认日志文件配置 = %+v", cfg.Log)
+	}
+
+	t.Setenv("LOG_FILE", "logs/agent.log")
+	t.Setenv("LOG_FILE_MAX_SIZE_MB", "10")
+	t.Setenv("LOG_FILE_MAX_BACKUPS", "2")
+	if cfg, err = Load(""); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Log.File != "logs/agent.log" || cfg.Log.FileMaxSizeMB != 10 || cfg.Log.FileMaxBackups != 2 {
+		t.Errorf("日志文件配置 = %+v", cfg.Log)
+	}
+
+	t.Setenv("LOG_FILE_MAX_BACKUPS", "-1")
+	if _, err := Load(""); err == nil {
+		t.Error("负数的 LOG_FILE_MAX_BACKUPS 应校验失败")
+	}
+}
+
+func TestRegisteredProviderPassesValidation(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "OLLAMA_MODEL")
+	llm.RegisterProvider("config-test-llm", func(config llm.ModelConfig) (agent.LLMClient, error) {
+		return nil, nil
+	})
+
+	t.Setenv("LLM_PROVIDER", "config-test-llm")
+	if _, err := Load(""); err != nil {
+		t.Fatalf("已注册的提供方应通过校验: %v", err)
+	}
+
+	t.Setenv("LLM_PROVIDER", "unregistered")
+	_, err := Load("")
+	if err == nil || !strings.Contains(err.Error(), "config-test-llm") {
+		t.Errorf("未注册的提供方应报错并列出已注册的名称: %v", err)
+	}
+}
+
+func TestToolResultGuardConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "TOOL_RESULT_GUARD")
+
+	t.Setenv("TOOL_RESULT_GUARD", "strict")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentCfg, err := cfg.AgentConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agentCfg.Behavior.ToolResultGuard != agent.ToolResultGuardStrict {
+		t.Errorf("ToolResultGuard = %q", agentCfg.Behavior.ToolResultGuard)
+	}
+
+	t.Setenv("TOOL_RESULT_GUARD", "ignore")
+	if _, err := Load(""); err == nil {
+		t.Error("未知的 TOOL_RESULT_GUARD 应校验失败")
+	}
+}
+
+func TestMaxActiveConversationsPerIPConfig(t *testing.T) {
+	clearEnv(t, "LLM_PROVIDER", "OPENAI_API_KEY", "MAX_ACTIVE_CONVERSATIONS_PER_IP")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.MaxActiveConversationsPerIP != 0 {
+		t.Errorf("默认不应限制，实际 %d", cfg.Server.MaxActiveConversationsPerIP)
+	}
+
+	t.Setenv("MAX_ACTIVE_CONVERSATIONS_PER_IP", "3")
+	if cfg, err = Load(""); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.MaxActiveConversationsPerIP != 3 {
+		t.Errorf("上限 = %d", cfg.Server.MaxActiveConversationsPerIP)
+	}
+}
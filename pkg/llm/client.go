@@ -0,0 +1,41 @@
+package llm
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"agentEino/pkg/agent"
+)
+
+// Usage 单次生成的用量：字符数与模型服务返回的 token 数
+type Usage = agent.GenerationUsage
+
+// joinMessageContent 拼接消息内容，用于统计提示词字符数
+func joinMessageContent(messages []agent.Message) string {
+	var b strings.Builder
+	for _, m := range messages {
+		b.WriteString(m.Content)
+	}
+	return b.String()
+}
+
+// newUsage 按提示词与回复计算字符数，并记录模型服务返回的 token 数（未返回时传 0）
+func newUsage(prompt, completion string, promptEvalCount, evalCount int) Usage {
+	return Usage{
+		PromptChars:     utf8.RuneCountInString(prompt),
+		CompletionChars: utf8.RuneCountInString(completion),
+		PromptEvalCount: promptEvalCount,
+		EvalCount:       evalCount,
+	}
+}
+
+// NewClient 根据模型配置中的 Provider 创建LLM客户端，CLI 与 Web 模式共用
+// Provider 未指定时使用 Ollama，其他名称须已通过 RegisterProvider 注册（内置 ollama 与 openai）
+// MaxTokens 为 0 时使用提供方默认值，并按模型已知上限校验
+func NewClient(config agent.ModelConfig) (agent.LLMClient, error) {
+	provider := config.Provider
+	if strings.TrimSpace(provider) == "" {
+		provider = "ollama"
+	}
+	return NewClientFor(provider, config)
+}
@@ -0,0 +1,50 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"agentEino/pkg/agent"
+)
+
+func TestNewClientProviders(t *testing.T) {
+	if _, err := NewClient(agent.ModelConfig{Provider: "anthropic", ModelName: "x"}); err == nil {
+		t.Error("未知的提供方应返回错误，而不是回退到 Ollama")
+	}
+	if _, err := NewClient(agent.ModelConfig{Provider: "openai", ModelName: "gpt-4o-mini"}); err == nil {
+		t.Error("openai 缺少 API Key 时应返回错误")
+	}
+	for _, provider := range []string{"", "ollama", " Ollama "} {
+		c, err := NewClient(agent.ModelConfig{Provider: provider, ModelName: "llama3.1", BaseURL: "http://localhost:11434"})
+		if err != nil {
+			t.Errorf("provider=%q: 创建客户端失败: %v", provider, err)
+			continue
+		}
+		if _, ok := c.(*OllamaClient); !ok {
+			t.Errorf("provider=%q: 应创建 Ollama 客户端，实际 %T", provider, c)
+		}
+	}
+}
+
+func TestOllamaWarmupSendsLoadRequest(t *testing.T) {
+	var got OllamaRequest
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"done":true,"done_reason":"load"}`))
+	}))
+	defer srv.Close()
+
+	client := NewOllamaClient(srv.URL, "llama3.1", 0)
+	client.SetKeepAlive("30m")
+	if err := client.Warmup(context.Background()); err != nil {
+		t.Fatalf("预加载失败: %v", err)
+	}
+	if path != "/api/generate" || got.Model != "llama3.1" || got.KeepAlive != "30m" || got.Prompt != "" {
+		t.Errorf("预加载请求 = %s %+v，期望不带 prompt 的 /api/generate 请求", path, got)
+	}
+}
@@ -0,0 +1,202 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"agentEino/pkg/memory"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// DefaultOpenAIEmbeddingModel 未指定模型时使用的 OpenAI 嵌入模型
+	DefaultOpenAIEmbeddingModel = string(openai.SmallEmbedding3)
+	// DefaultEmbeddingBatchSize 单次嵌入请求最多包含的文本数
+	DefaultEmbeddingBatchSize = 100
+	// DefaultOllamaEmbeddingModel 未指定模型时使用的 Ollama 嵌入模型
+	DefaultOllamaEmbeddingModel = "nomic-embed-text"
+	// DefaultOllamaEmbeddingTimeout 单条文本嵌入请求的超时时间
+	DefaultOllamaEmbeddingTimeout = 60 * time.Second
+)
+
+// OpenAIEmbedder 通过 OpenAI（或兼容服务）的 embeddings 接口生成向量，实现 memory.Embedder
+type OpenAIEmbedder struct {
+	client    *openai.Client
+	model     string
+	batchSize int
+
+	dimensions dimensionChecker
+}
+
+// NewOpenAIEmbedder 创建 OpenAI 嵌入客户端，model 为空时使用 DefaultOpenAIEmbeddingModel
+func NewOpenAIEmbedder(apiKey string, model string) *OpenAIEmbedder {
+	if model == "" {
+		model = DefaultOpenAIEmbeddingModel
+	}
+	return &OpenAIEmbedder{
+		client:    openai.NewClient(apiKey),
+		model:     model,
+		batchSize: DefaultEmbeddingBatchSize,
+	}
+}
+
+// Model 返回嵌入模型名称
+func (e *OpenAIEmbedder) Model() string {
+	return e.model
+}
+
+// Embed 生成文本向量，返回顺序与 texts 一致；文本较多时按 batchSize 分批请求
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += e.batchSize {
+		end := min(start+e.batchSize, len(texts))
+		batch, err := e.embedBatch(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+// embedBatch 发送一次嵌入请求，按响应中的 index 还原顺序并校验数量与维度
+func (e *OpenAIEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	resp, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Input: texts,
+		Model: openai.EmbeddingModel(e.model),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("OpenAI 嵌入请求失败（模型 %s）: %w", e.model, err)
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("OpenAI 嵌入响应数量不一致: 请求 %d 条，返回 %d 条", len(texts), len(resp.Data))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, item := range resp.Data {
+		if item.Index < 0 || item.Index >= len(texts) || vectors[item.Index] != nil {
+			return nil, fmt.Errorf("OpenAI 嵌入响应的 index 无效: %d", item.Index)
+		}
+		if err := e.dimensions.check("OpenAI", e.model, len(item.Embedding)); err != nil {
+			return nil, err
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, nil
+}
+
+// dimensionChecker 记录嵌入模型首次返回的向量维度，之后维度变化时返回 memory.ErrEmbeddingDimensionMismatch
+type dimensionChecker struct {
+	mu        sync.Mutex
+	dimension int
+}
+
+// check 校验向量维度，provider 与 model 仅用于错误信息
+func (d *dimensionChecker) check(provider, model string, n int) error {
+	if n == 0 {
+		return fmt.Errorf("%s 嵌入响应包含空向量（模型 %s）", provider, model)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.dimension == 0 {
+		d.dimension = n
+		return nil
+	}
+	if d.dimension != n {
+		return fmt.Errorf("%w: 模型 %s 此前返回 %d 维，本次返回 %d 维", memory.ErrEmbeddingDimensionMismatch, model, d.dimension, n)
+	}
+	return nil
+}
+
+// OllamaEmbedder 通过 Ollama 的 /api/embeddings 接口生成向量，实现 memory.Embedder，适用于完全本地部署
+type OllamaEmbedder struct {
+	baseURL string
+	model   string
+	client  *http.Client
+
+	dimensions dimensionChecker
+}
+
+// ollamaEmbeddingRequest /api/embeddings 的请求体，每次只能嵌入一条文本
+type ollamaEmbeddingRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+// ollamaEmbeddingResponse /api/embeddings 的响应体
+type ollamaEmbeddingResponse struct {
+	Embedding []float32 `json:"embedding"`
+	Error     string    `json:"error"`
+}
+
+// NewOllamaEmbedder 创建 Ollama 嵌入客户端，baseURL 的处理与 NewOllamaClient 一致，model 为空时使用 DefaultOllamaEmbeddingModel
+func NewOllamaEmbedder(baseURL, model string) *OllamaEmbedder {
+	if model == "" {
+		model = DefaultOllamaEmbeddingModel
+	}
+	return &OllamaEmbedder{
+		baseURL: normalizeOllamaBaseURL(baseURL),
+		model:   model,
+		client:  &http.Client{Timeout: DefaultOllamaEmbeddingTimeout},
+	}
+}
+
+// Model 返回嵌入模型名称
+func (e *OllamaEmbedder) Model() string {
+	return e.model
+}
+
+// Embed 逐条请求文本向量（/api/embeddings 不支持批量），返回顺序与 texts 一致
+func (e *OllamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		vector, err := e.embedOne(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, vector)
+	}
+	return vectors, nil
+}
+
+// embedOne 发送一次 /api/embeddings 请求并校验向量维度
+func (e *OllamaEmbedder) embedOne(ctx context.Context, text string) ([]float32, error) {
+	body, err := json.Marshal(ollamaEmbeddingRequest{Model: e.model, Prompt: text})
+	if err != nil {
+		return nil, fmt.Errorf("序列化嵌入请求失败: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", e.baseURL+"api/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建HTTP请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Ollama 嵌入请求失败（模型 %s）: %w", e.model, err)
+	}
+	defer resp.Body.Close()
+
+	var result ollamaEmbeddingResponse
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &result) == nil && result.Error != "" {
+			data = []byte(result.Error)
+		}
+		return nil, fmt.Errorf("Ollama 嵌入请求失败（模型 %s）: 状态码 %d: %s", e.model, resp.StatusCode, data)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("解析 Ollama 嵌入响应失败: %w", err)
+	}
+	if err := e.dimensions.check("Ollama", e.model, len(result.Embedding)); err != nil {
+		return nil, err
+	}
+	return result.Embedding, nil
+}
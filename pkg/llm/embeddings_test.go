@@ -0,0 +1,172 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"agentEino/pkg/memory"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// embeddingServer 模拟 embeddings 接口：每条文本的向量为 [长度, 序号]，dims 指定向量维度（不足时补 0）
+// 响应中的条目顺序与请求相反，用于验证按 index 还原顺序
+func embeddingServer(t *testing.T, dims *int, requests *[]openai.EmbeddingRequestStrings) *OpenAIEmbedder {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("请求路径 = %s", r.URL.Path)
+		}
+		var req openai.EmbeddingRequestStrings
+		json.NewDecoder(r.Body).Decode(&req)
+		*requests = append(*requests, req)
+
+		var resp openai.EmbeddingResponse
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			vec := make([]float32, *dims)
+			vec[0] = float32(len([]rune(req.Input[i])))
+			if *dims > 1 {
+				vec[1] = float32(i)
+			}
+			resp.Data = append(resp.Data, openai.Embedding{Embedding: vec, Index: i})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+
+	e := NewOpenAIEmbedder("sk-test", "")
+	cfg := openai.DefaultConfig("sk-test")
+	cfg.BaseURL = srv.URL + "/v1"
+	e.client = openai.NewClientWithConfig(cfg)
+	return e
+}
+
+func TestOpenAIEmbedderBatchesAndKeepsOrder(t *testing.T) {
+	dims := 3
+	var requests []openai.EmbeddingRequestStrings
+	e := embeddingServer(t, &dims, &requests)
+	e.batchSize = 2
+
+	vectors, err := e.Embed(context.Background(), []string{"一", "二二", "三三三"})
+	if err != nil {
+		t.Fatalf("Embed 失败: %v", err)
+	}
+	want := [][]float32{{1, 0, 0}, {2, 1, 0}, {3, 0, 0}}
+	if !reflect.DeepEqual(vectors, want) {
+		t.Errorf("向量 = %v，期望 %v", vectors, want)
+	}
+	if len(requests) != 2 || len(requests[0].Input) != 2 || len(requests[1].Input) != 1 {
+		t.Fatalf("应分两批请求（2+1），实际 %+v", requests)
+	}
+	if requests[0].Model != openai.SmallEmbedding3 {
+		t.Errorf("默认模型 = %q，期望 %q", requests[0].Model, openai.SmallEmbedding3)
+	}
+}
+
+func TestOpenAIEmbedderReportsDimensionChange(t *testing.T) {
+	dims := 3
+	var requests []openai.EmbeddingRequestStrings
+	e := embeddingServer(t, &dims, &requests)
+
+	if _, err := e.Embed(context.Background(), []string{"你好"}); err != nil {
+		t.Fatalf("Embed 失败: %v", err)
+	}
+	dims = 4
+	_, err := e.Embed(context.Background(), []string{"你好"})
+	if !errors.Is(err, memory.ErrEmbeddingDimensionMismatch) {
+		t.Errorf("维度变化时错误 = %v，期望 ErrEmbeddingDimensionMismatch", err)
+	}
+}
+
+func TestOllamaEmbedderPostsModelAndPrompt(t *testing.T) {
+	var got []ollamaEmbeddingRequest
+	dims := 3
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/embeddings" {
+			t.Errorf("请求路径 = %s", r.URL.Path)
+		}
+		var req ollamaEmbeddingRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		got = append(got, req)
+		vec := make([]float32, dims)
+		vec[0] = float32(len([]rune(req.Prompt)))
+		json.NewEncoder(w).Encode(map[string]interface{}{"embedding": vec})
+	}))
+	defer srv.Close()
+
+	// baseURL 不带结尾斜杠时与 NewOllamaClient 一样补全
+	e := NewOllamaEmbedder(srv.URL, "")
+	if e.Model() != DefaultOllamaEmbeddingModel {
+		t.Errorf("默认模型 = %q", e.Model())
+	}
+	vectors, err := e.Embed(context.Background(), []string{"你好", "天气不错"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]float32{{2, 0, 0}, {4, 0, 0}}
+	if !reflect.DeepEqual(vectors, want) {
+		t.Errorf("向量 = %v，期望 %v", vectors, want)
+	}
+	wantReqs := []ollamaEmbeddingRequest{{Model: DefaultOllamaEmbeddingModel, Prompt: "你好"}, {Model: DefaultOllamaEmbeddingModel, Prompt: "天气不错"}}
+	if !reflect.DeepEqual(got, wantReqs) {
+		t.Errorf("请求 = %+v，期望 %+v", got, wantReqs)
+	}
+
+	dims = 4
+	if _, err := e.Embed(context.Background(), []string{"换了模型"}); !errors.Is(err, memory.ErrEmbeddingDimensionMismatch) {
+		t.Errorf("维度变化应返回 ErrEmbeddingDimensionMismatch，实际 %v", err)
+	}
+}
+
+func TestOllamaEmbedderReportsServerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"model \"nomic-embed-text\" not found"}`))
+	}))
+	defer srv.Close()
+
+	_, err := NewOllamaEmbedder(srv.URL+"/", "").Embed(context.Background(), []string{"你好"})
+	if err == nil || !strings.Contains(err.Error(), "not found") || !strings.Contains(err.Error(), "404") {
+		t.Errorf("错误 = %v，期望包含状态码与服务端错误信息", err)
+	}
+}
+
+func TestOllamaEmbedderWorksWithVectorMemory(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaEmbeddingRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		vec := []float32{0, 0}
+		if strings.Contains(req.Prompt, "猫") {
+			vec[0] = 1
+		} else {
+			vec[1] = 1
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"embedding": vec})
+	}))
+	defer srv.Close()
+
+	var _ memory.Embedder = (*OllamaEmbedder)(nil)
+	dir := t.TempDir()
+	vm := memory.NewVectorMemoryWithDataDir(dir, filepath.Join(dir, "vectors.json"))
+	vm.SetEmbedder(NewOllamaEmbedder(srv.URL, "nomic-embed-text"))
+	ctx := context.Background()
+	cat, err := vm.AddVector(ctx, "我家的猫很可爱", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.AddVector(ctx, "明天会下雨", nil); err != nil {
+		t.Fatal(err)
+	}
+	results, err := vm.SearchVector(ctx, "猫粮", 1)
+	if err != nil || len(results) != 1 || results[0].ID != cat.ID {
+		t.Fatalf("相似度搜索结果 = %+v, %v", results, err)
+	}
+}
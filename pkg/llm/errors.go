@@ -0,0 +1,87 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrModelNotFound 请求的模型在 Ollama 中不存在（需先 ollama pull）
+	ErrModelNotFound = errors.New("模型不存在")
+	// ErrOutOfMemory Ollama 没有足够的内存/显存加载或运行模型
+	ErrOutOfMemory = errors.New("内存不足")
+)
+
+// maxErrorMessageRunes 非 JSON 错误响应体保留的最大字符数
+const maxErrorMessageRunes = 500
+
+// OllamaError Ollama 返回的错误：非 200 状态码，或响应体（含流式响应中的某一行）为 {"error":"..."}
+// 可识别的常见错误可通过 errors.Is 与 ErrModelNotFound、ErrOutOfMemory 比较
+type OllamaError struct {
+	StatusCode int    // HTTP 状态码，200 响应中返回的错误也会记录为 200
+	Message    string // Ollama 返回的错误信息
+	Kind       error  // 错误类别，无法识别时为 nil
+}
+
+// Error 返回包含状态码、类别与 Ollama 原始信息的错误描述
+func (e *OllamaError) Error() string {
+	if e.Kind != nil {
+		return fmt.Sprintf("Ollama 返回错误（状态码 %d，%v）: %s", e.StatusCode, e.Kind, e.Message)
+	}
+	return fmt.Sprintf("Ollama 返回错误（状态码 %d）: %s", e.StatusCode, e.Message)
+}
+
+// Unwrap 返回错误类别，便于 errors.Is 判断
+func (e *OllamaError) Unwrap() error {
+	return e.Kind
+}
+
+// parseOllamaError 将错误响应体解析为 OllamaError
+// 响应体为 {"error":"..."} 时取其中的信息，否则使用截断后的原始文本，为空时使用状态码说明
+func parseOllamaError(statusCode int, body []byte) *OllamaError {
+	message, ok := ollamaErrorMessage(body)
+	if !ok {
+		message = strings.TrimSpace(string(body))
+		if runes := []rune(message); len(runes) > maxErrorMessageRunes {
+			message = string(runes[:maxErrorMessageRunes]) + "..."
+		}
+	}
+	if message == "" {
+		message = http.StatusText(statusCode)
+	}
+	return newOllamaError(statusCode, message)
+}
+
+// newOllamaError 按错误信息识别类别并创建 OllamaError
+func newOllamaError(statusCode int, message string) *OllamaError {
+	return &OllamaError{StatusCode: statusCode, Message: message, Kind: classifyOllamaError(message)}
+}
+
+// ollamaErrorMessage 提取 {"error":"..."} 中的错误信息，响应体不是该结构时返回 false
+func ollamaErrorMessage(body []byte) (string, bool) {
+	var payload struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || strings.TrimSpace(payload.Error) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(payload.Error), true
+}
+
+// classifyOllamaError 按错误信息识别常见错误类别
+func classifyOllamaError(message string) error {
+	lower := strings.ToLower(message)
+	switch {
+	case strings.Contains(lower, "model") && strings.Contains(lower, "not found"):
+		// 如 "model 'llama3' not found, try pulling it first"；仅 404 状态码不足以判断（端点错误也是 404）
+		return ErrModelNotFound
+	case strings.Contains(lower, "out of memory"),
+		strings.Contains(lower, "requires more system memory"),
+		strings.Contains(lower, "insufficient memory"):
+		return ErrOutOfMemory
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseOllamaError(t *testing.T) {
+	cases := []struct {
+		name    string
+		status  int
+		body    string
+		message string
+		kind    error
+	}{
+		{"模型不存在", 404, `{"error":"model 'llama9' not found, try pulling it first"}`, "model 'llama9' not found, try pulling it first", ErrModelNotFound},
+		{"内存不足", 500, `{"error":"model requires more system memory (12.0 GiB) than is available (7.5 GiB)"}`, "model requires more system memory (12.0 GiB) than is available (7.5 GiB)", ErrOutOfMemory},
+		{"显存不足", 500, `{"error":"llama runner process has terminated: cudaMalloc failed: out of memory"}`, "llama runner process has terminated: cudaMalloc failed: out of memory", ErrOutOfMemory},
+		{"其他JSON错误", 400, `{"error":"invalid options: num_predict"}`, "invalid options: num_predict", nil},
+		{"纯文本", 404, "404 page not found\n", "404 page not found", nil},
+		{"空响应体", 503, "", "Service Unavailable", nil},
+		{"空的error字段", 500, `{"error":""}`, `{"error":""}`, nil},
+	}
+	for _, c := range cases {
+		err := parseOllamaError(c.status, []byte(c.body))
+		if err.StatusCode != c.status || err.Message != c.message || err.Kind != c.kind {
+			t.Errorf("%s: 解析结果 = %+v，期望 message=%q kind=%v", c.name, err, c.message, c.kind)
+		}
+		if c.kind != nil && !errors.Is(err, c.kind) {
+			t.Errorf("%s: errors.Is(%v) 应为 true", c.name, c.kind)
+		}
+		if strings.Contains(err.Error(), `{"error"`) && c.message != c.body {
+			t.Errorf("%s: 错误信息不应包含原始JSON: %s", c.name, err)
+		}
+	}
+
+	long := strings.Repeat("x", maxErrorMessageRunes+100)
+	if err := parseOllamaError(502, []byte(long)); len([]rune(err.Message)) != maxErrorMessageRunes+3 {
+		t.Errorf("过长的响应体应被截断，实际长度 %d", len([]rune(err.Message)))
+	}
+}
+
+func TestOllamaClientReturnsTypedErrors(t *testing.T) {
+	// clientFor 返回连接到固定响应的测试服务的客户端
+	clientFor := func(status int, body string) *OllamaClient {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}))
+		t.Cleanup(srv.Close)
+		return NewOllamaClient(srv.URL, "llama9", 0, WithRetryConfig(RetryConfig{MaxRetries: 1}))
+	}
+
+	missing := clientFor(http.StatusNotFound, `{"error":"model 'llama9' not found, try pulling it first"}`)
+	var oerr *OllamaError
+	_, err := missing.Generate(context.Background(), "你好")
+	if !errors.As(err, &oerr) || oerr.StatusCode != 404 || !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("非200响应: %v，期望状态码 404 的 ErrModelNotFound", err)
+	}
+	if err := missing.GenerateStream(context.Background(), "你好", make(chan string, 10)); !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("流式非200响应: %v，期望 ErrModelNotFound", err)
+	}
+	if err := missing.Warmup(context.Background()); !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("预加载非200响应: %v，期望 ErrModelNotFound", err)
+	}
+
+	// 流式生成中途出错：状态码 200，错误在某一行中返回
+	oom := clientFor(http.StatusOK, `{"response":"部分","done":false}`+"\n"+`{"error":"CUDA error: out of memory"}`+"\n")
+	err = oom.GenerateStream(context.Background(), "你好", make(chan string, 10))
+	if !errors.As(err, &oerr) || oerr.StatusCode != 200 || !errors.Is(err, ErrOutOfMemory) {
+		t.Errorf("流中的错误行: %v，期望 ErrOutOfMemory", err)
+	}
+
+	inBody := clientFor(http.StatusOK, `{"error":"model 'x' not found"}`)
+	if _, err := inBody.Generate(context.Background(), "你好"); !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("200响应体中的错误: %v，期望 ErrModelNotFound", err)
+	}
+
+	// 正常回复中出现 error 一词不应被当作错误
+	mentions := clientFor(http.StatusOK, `{"response":"the error was fixed","done":true}`)
+	if got, err := mentions.Generate(context.Background(), "你好"); err != nil || got != "the error was fixed" {
+		t.Errorf("包含 error 一词的正常回复 = %q, %v", got, err)
+	}
+}
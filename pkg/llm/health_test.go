@@ -0,0 +1,71 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestOllamaPingChecksTagsForModel(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		w.Write([]byte(`{"models":[{"name":"llama3.1:latest"},{"name":"qwen2.5:7b"}]}`))
+	}))
+	defer srv.Close()
+
+	for _, model := range []string{"llama3.1", "llama3.1:latest", "qwen2.5:7b"} {
+		if err := NewOllamaClient(srv.URL, model, 0).Ping(context.Background()); err != nil {
+			t.Errorf("%s 已下载，Ping 应成功: %v", model, err)
+		}
+	}
+	if err := NewOllamaClient(srv.URL, "mistral", 0).Ping(context.Background()); !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("模型未下载时应返回 ErrModelNotFound，实际 %v", err)
+	}
+	for _, p := range paths {
+		if p != "GET /api/tags" {
+			t.Errorf("Ping 只应请求 GET /api/tags，实际 %s", p)
+		}
+	}
+
+	srv.Close()
+	if err := NewOllamaClient(srv.URL, "llama3.1", 0).Ping(context.Background()); err == nil {
+		t.Error("服务不可达时 Ping 应返回错误")
+	}
+}
+
+func TestOpenAIPingRetrievesModel(t *testing.T) {
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") != "Bearer sk-test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"message":"Incorrect API key provided","type":"invalid_request_error"}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"gpt-4o-mini","object":"model","owned_by":"openai"}`))
+	}))
+	defer srv.Close()
+
+	newClient := func(apiKey string) *OpenAIClient {
+		client := NewOpenAIClient(apiKey, "gpt-4o-mini", 0)
+		cfg := openai.DefaultConfig(apiKey)
+		cfg.BaseURL = srv.URL + "/v1"
+		client.client = openai.NewClientWithConfig(cfg)
+		return client
+	}
+	if err := newClient("sk-test").Ping(context.Background()); err != nil {
+		t.Errorf("Ping 应成功: %v", err)
+	}
+	if path != "/v1/models/gpt-4o-mini" {
+		t.Errorf("应查询配置的模型，实际请求 %s", path)
+	}
+	if err := newClient("sk-wrong").Ping(context.Background()); err == nil {
+		t.Error("API Key 无效时 Ping 应返回错误")
+	}
+}
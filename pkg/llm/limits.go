@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"strings"
+
+	"agentEino/pkg/logger"
+)
+
+// 各提供方的默认最大生成 token 数，未配置 max_tokens 时使用
+const (
+	DefaultOpenAIMaxTokens = 4096
+	DefaultOllamaMaxTokens = 2048
+)
+
+// MinRecommendedMaxTokens 低于该值时回复很可能被截断，仅记录警告
+const MinRecommendedMaxTokens = 256
+
+// openAIOutputLimits 已知 OpenAI 模型的最大输出 token 数，按模型名前缀匹配（取最长前缀）
+var openAIOutputLimits = map[string]int{
+	"gpt-3.5-turbo": 4096,
+	"gpt-4":         8192,
+	"gpt-4-turbo":   4096,
+	"gpt-4o":        16384,
+	"gpt-4o-mini":   16384,
+	"gpt-4.1":       32768,
+	"o1":            100000,
+	"o1-mini":       65536,
+	"o3":            100000,
+	"o3-mini":       100000,
+	"o4-mini":       100000,
+}
+
+// DefaultMaxTokens 返回提供方的默认最大生成 token 数
+func DefaultMaxTokens(provider string) int {
+	if strings.EqualFold(strings.TrimSpace(provider), "openai") {
+		return DefaultOpenAIMaxTokens
+	}
+	return DefaultOllamaMaxTokens
+}
+
+// ModelMaxOutputTokens 返回已知模型的最大输出 token 数；未知模型（包括全部 Ollama 模型）返回 false
+func ModelMaxOutputTokens(provider, model string) (int, bool) {
+	if !strings.EqualFold(strings.TrimSpace(provider), "openai") {
+		return 0, false
+	}
+	name := strings.ToLower(strings.TrimSpace(model))
+	best, limit := "", 0
+	for prefix, n := range openAIOutputLimits {
+		if strings.HasPrefix(name, prefix) && len(prefix) > len(best) {
+			best, limit = prefix, n
+		}
+	}
+	return limit, best != ""
+}
+
+// resolveMaxTokens 确定实际使用的最大生成 token 数：
+// 未配置时使用提供方默认值，超过模型已知上限时截断到上限，过低时记录警告
+func resolveMaxTokens(provider, model string, maxTokens int) int {
+	if maxTokens <= 0 {
+		maxTokens = DefaultMaxTokens(provider)
+	}
+	if limit, ok := ModelMaxOutputTokens(provider, model); ok && maxTokens > limit {
+		logger.Warn("max_tokens 超过模型输出上限，已截断", map[string]interface{}{
+			"model":      model,
+			"configured": maxTokens,
+			"limit":      limit,
+		})
+		maxTokens = limit
+	}
+	if maxTokens < MinRecommendedMaxTokens {
+		logger.Warn("max_tokens 过低，回复可能被截断", map[string]interface{}{
+			"model":       model,
+			"configured":  maxTokens,
+			"recommended": MinRecommendedMaxTokens,
+		})
+	}
+	return maxTokens
+}
@@ -0,0 +1,74 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"agentEino/pkg/agent"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestOllamaRequestUsesResolvedMaxTokens(t *testing.T) {
+	var got OllamaRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"response":"好","done":true}`))
+	}))
+	defer srv.Close()
+
+	for _, c := range []struct{ configured, want int }{
+		{3000, 3000},
+		{0, DefaultOllamaMaxTokens},
+	} {
+		client, err := NewClient(agent.ModelConfig{Provider: "ollama", ModelName: "llama3.1", BaseURL: srv.URL, MaxTokens: c.configured})
+		if err != nil {
+			t.Fatalf("创建客户端失败: %v", err)
+		}
+		if _, err := client.Generate(context.Background(), "你好"); err != nil {
+			t.Fatalf("生成失败: %v", err)
+		}
+		if got.Options.MaxTokens != c.want {
+			t.Errorf("max_tokens=%d: 请求中的 num_predict = %d，期望 %d", c.configured, got.Options.MaxTokens, c.want)
+		}
+	}
+}
+
+func TestOpenAIRequestUsesResolvedMaxTokens(t *testing.T) {
+	var got openai.ChatCompletionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"好"}}]}`))
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		model             string
+		configured, wantN int
+	}{
+		{"gpt-4o-mini", 1500, 1500},
+		{"gpt-4o-mini", 0, DefaultOpenAIMaxTokens},
+		{"gpt-4", 20000, 8192}, // 超过已知上限时截断
+	}
+	for _, c := range cases {
+		client, err := NewClient(agent.ModelConfig{Provider: "openai", ModelName: c.model, APIKey: "sk-test", MaxTokens: c.configured})
+		if err != nil {
+			t.Fatalf("创建客户端失败: %v", err)
+		}
+		// 将请求发往测试服务器
+		cfg := openai.DefaultConfig("sk-test")
+		cfg.BaseURL = srv.URL + "/v1"
+		client.(*OpenAIClient).client = openai.NewClientWithConfig(cfg)
+
+		if _, err := client.Generate(context.Background(), "你好"); err != nil {
+			t.Fatalf("生成失败: %v", err)
+		}
+		if got.MaxTokens != c.wantN {
+			t.Errorf("%s max_tokens=%d: 请求中的 max_tokens = %d，期望 %d", c.model, c.configured, got.MaxTokens, c.wantN)
+		}
+	}
+}
@@ -10,22 +10,141 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"agentEino/pkg/agent"
 )
 
+func init() {
+	RegisterProvider("ollama", func(config ModelConfig) (agent.LLMClient, error) {
+		return newOllamaFromConfig(config), nil
+	})
+}
+
+// newOllamaFromConfig 按模型配置创建Ollama客户端
+func newOllamaFromConfig(config ModelConfig) *OllamaClient {
+	maxTokens := resolveMaxTokens("ollama", config.ModelName, config.MaxTokens)
+	client := NewOllamaClient(config.BaseURL, config.ModelName, maxTokens, WithRetryConfig(RetryConfig{
+		MaxRetries:     config.MaxRetries,
+		MaxLoadRetries: config.MaxLoadRetries,
+		RequestTimeout: config.RequestTimeout,
+		LoadWait:       config.LoadWait,
+		BackoffBase:    config.RetryBackoff,
+	}))
+	client.SetKeepAlive(config.KeepAlive)
+	client.SetSampling(config.Temperature, config.TopP)
+	// 模式名已在配置校验时确认有效，无法解析时保持默认的 chat
+	if mode, err := ParseOllamaMode(config.OllamaMode); err == nil {
+		client.mode = mode
+	}
+	return client
+}
+
 // OllamaClient 实现了LLM客户端接口
 type OllamaClient struct {
 	baseURL   string
 	modelName string
 	maxTokens int
+	keepAlive string // 模型在内存中的保留时长（如 "5m"、"-1"），为空时使用Ollama默认值
+	retry     RetryConfig
+	mode      OllamaMode // 请求端点的选择方式，默认 OllamaModeChat
+	// 采样参数，temperature 为 nil 时使用 DefaultOllamaTemperature，topP 为 nil 时使用 Ollama 默认值
+	temperature *float64
+	topP        *float64
+}
+
+// OllamaMode 决定请求发送到 /api/chat 还是 /api/generate
+type OllamaMode string
+
+const (
+	// OllamaModeChat 始终使用 /api/chat：消息列表原样发送，文本提示词整体作为一条用户消息
+	OllamaModeChat OllamaMode = "chat"
+	// OllamaModeGenerate 始终使用 /api/generate：消息列表按 "role: content" 渲染为文本提示词
+	OllamaModeGenerate OllamaMode = "generate"
+	// OllamaModeAuto 兼容旧行为：消息列表走 /api/chat，文本提示词同时包含 "user:" 与 "assistant:" 时解析为消息走 /api/chat，否则走 /api/generate
+	OllamaModeAuto OllamaMode = "auto"
+)
+
+// ParseOllamaMode 解析端点模式（不区分大小写），为空时返回 OllamaModeChat
+func ParseOllamaMode(name string) (OllamaMode, error) {
+	switch mode := OllamaMode(strings.ToLower(strings.TrimSpace(name))); mode {
+	case "":
+		return OllamaModeChat, nil
+	case OllamaModeChat, OllamaModeGenerate, OllamaModeAuto:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("不支持的 Ollama 端点模式: %q（可选 chat/generate/auto）", name)
+	}
+}
+
+// RetryConfig Ollama 请求的重试与超时配置，零值字段使用 DefaultRetryConfig 中的值
+type RetryConfig struct {
+	MaxRetries     int           // 发送请求失败时的最大尝试次数
+	MaxLoadRetries int           // 模型加载中（done_reason=load）时的最大重试次数
+	RequestTimeout time.Duration // 单次生成（含读取流式响应）的超时时间
+	LoadWait       time.Duration // 模型加载中时重试前的等待时间
+	BackoffBase    time.Duration // 请求失败后的退避基数，第 n 次失败后等待 n*BackoffBase
+}
+
+// DefaultRetryConfig 返回默认的重试与超时配置
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxRetries:     3,
+		MaxLoadRetries: 3,
+		RequestTimeout: 180 * time.Second,
+		LoadWait:       5 * time.Second,
+		BackoffBase:    2 * time.Second,
+	}
+}
+
+// withDefaults 将零值字段替换为默认值
+func (rc RetryConfig) withDefaults() RetryConfig {
+	d := DefaultRetryConfig()
+	if rc.MaxRetries <= 0 {
+		rc.MaxRetries = d.MaxRetries
+	}
+	if rc.MaxLoadRetries <= 0 {
+		rc.MaxLoadRetries = d.MaxLoadRetries
+	}
+	if rc.RequestTimeout <= 0 {
+		rc.RequestTimeout = d.RequestTimeout
+	}
+	if rc.LoadWait <= 0 {
+		rc.LoadWait = d.LoadWait
+	}
+	if rc.BackoffBase <= 0 {
+		rc.BackoffBase = d.BackoffBase
+	}
+	return rc
+}
+
+// OllamaOption 创建 OllamaClient 时的可选配置
+type OllamaOption func(*OllamaClient)
+
+// WithMode 设置端点模式，空值使用 OllamaModeChat
+func WithMode(mode OllamaMode) OllamaOption {
+	return func(c *OllamaClient) {
+		if mode == "" {
+			mode = OllamaModeChat
+		}
+		c.mode = mode
+	}
+}
+
+// WithRetryConfig 设置重试与超时配置
+func WithRetryConfig(rc RetryConfig) OllamaOption {
+	return func(c *OllamaClient) {
+		c.retry = rc.withDefaults()
+	}
 }
 
 // OllamaRequest 表示发送到Ollama API的请求
 type OllamaRequest struct {
-	Model    string    `json:"model"`
-	Prompt   string    `json:"prompt,omitempty"`
-	Messages []Message `json:"messages,omitempty"`
-	Stream   bool      `json:"stream,omitempty"`
-	Options  Options   `json:"options,omitempty"`
+	Model     string    `json:"model"`
+	Prompt    string    `json:"prompt,omitempty"`
+	Messages  []Message `json:"messages,omitempty"`
+	Stream    bool      `json:"stream,omitempty"`
+	Options   Options   `json:"options,omitempty"`
+	KeepAlive string    `json:"keep_alive,omitempty"`
 }
 
 // Message 表示对话中的一条消息
@@ -35,10 +154,11 @@ type Message struct {
 }
 
 // Options 表示Ollama请求的选项
+// Temperature 与 TopP 使用指针，显式设置的 0 也会发送，nil 时省略
 type Options struct {
-	Temperature float64 `json:"temperature,omitempty"`
-	TopP        float64 `json:"top_p,omitempty"`
-	MaxTokens   int     `json:"num_predict,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	MaxTokens   int      `json:"num_predict,omitempty"`
 }
 
 // OllamaResponse 表示从Ollama API返回的响应
@@ -48,6 +168,9 @@ type OllamaResponse struct {
 	CreatedAt  string `json:"created_at"`
 	Done       bool   `json:"done"`
 	DoneReason string `json:"done_reason"`
+	// 生成完成时返回的 token 统计
+	PromptEvalCount int `json:"prompt_eval_count"`
+	EvalCount       int `json:"eval_count"`
 }
 
 // ChatStreamResponse 兼容 /api/chat 的返回结构（流式与非流式通用）
@@ -57,6 +180,9 @@ type ChatStreamResponse struct {
 	CreatedAt  string      `json:"created_at"`
 	Done       bool        `json:"done"`
 	DoneReason string      `json:"done_reason"`
+	// 生成完成时返回的 token 统计
+	PromptEvalCount int `json:"prompt_eval_count"`
+	EvalCount       int `json:"eval_count"`
 }
 
 // ChatMessage 表示 chat 端点的消息结构
@@ -65,18 +191,178 @@ type ChatMessage struct {
 	Content string `json:"content"`
 }
 
-// NewOllamaClient 创建一个新的Ollama客户端
-func NewOllamaClient(baseURL, modelName string, maxTokens int) *OllamaClient {
-	// 确保baseURL以"/"结尾
+// normalizeOllamaBaseURL 确保baseURL以"/"结尾，便于直接拼接 "api/..." 端点
+func normalizeOllamaBaseURL(baseURL string) string {
 	if !strings.HasSuffix(baseURL, "/") {
 		baseURL += "/"
 	}
+	return baseURL
+}
 
-	return &OllamaClient{
-		baseURL:   baseURL,
+// NewOllamaClient 创建一个新的Ollama客户端
+func NewOllamaClient(baseURL, modelName string, maxTokens int, opts ...OllamaOption) *OllamaClient {
+	c := &OllamaClient{
+		baseURL:   normalizeOllamaBaseURL(baseURL),
 		modelName: modelName,
 		maxTokens: maxTokens,
+		retry:     DefaultRetryConfig(),
+		mode:      OllamaModeChat,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// postWithRetry 发送请求，连接失败时按 BackoffBase 线性退避重试，最多尝试 MaxRetries 次
+func (c *OllamaClient) postWithRetry(ctx context.Context, endpoint string, reqBody []byte) (*http.Response, error) {
+	var lastErr error
+	for attempt := 1; attempt <= c.retry.MaxRetries; attempt++ {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+endpoint, bytes.NewBuffer(reqBody))
+		if err != nil {
+			return nil, fmt.Errorf("创建HTTP请求失败: %w", err)
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+
+		fmt.Printf("尝试请求 #%d...\n", attempt)
+		resp, err := http.DefaultClient.Do(httpReq)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+		if attempt < c.retry.MaxRetries {
+			wait := time.Duration(attempt) * c.retry.BackoffBase
+			fmt.Printf("请求失败，等待 %s 后重试: %v\n", wait, err)
+			if err := sleepContext(ctx, wait); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, fmt.Errorf("HTTP请求失败，已重试 %d 次: %w", c.retry.MaxRetries, lastErr)
+}
+
+// waitForLoad 模型加载中时等待 LoadWait，上下文取消时提前返回
+func (c *OllamaClient) waitForLoad(ctx context.Context, retryCount int) error {
+	fmt.Printf("模型正在加载中，等待 %s 后重试... (重试次数: %d/%d)\n", c.retry.LoadWait, retryCount, c.retry.MaxLoadRetries)
+	return sleepContext(ctx, c.retry.LoadWait)
+}
+
+// sleepContext 等待 d，上下文取消时返回其错误
+// 上下文带有本轮重试预算时先从中扣减，预算不足则不等待直接返回 agent.ErrRetryBudgetExhausted
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if budget := agent.RetryBudgetFromContext(ctx); budget != nil {
+		if err := budget.Reserve(d); err != nil {
+			return err
+		}
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// DefaultOllamaTemperature 生成请求使用的温度
+const DefaultOllamaTemperature = 0.7
+
+// SetSampling 设置请求的 temperature 与 top_p，nil 表示使用默认值
+func (c *OllamaClient) SetSampling(temperature, topP *float64) {
+	c.temperature = temperature
+	c.topP = topP
+}
+
+// Sampling 返回生成请求使用的采样参数
+func (c *OllamaClient) Sampling() agent.Sampling {
+	opts := c.options()
+	s := agent.Sampling{Temperature: *opts.Temperature, MaxTokens: c.maxTokens}
+	if opts.TopP != nil {
+		s.TopP = *opts.TopP
+	}
+	return s
+}
+
+// options 返回请求的生成选项
+func (c *OllamaClient) options() Options {
+	temperature := DefaultOllamaTemperature
+	if c.temperature != nil {
+		temperature = *c.temperature
+	}
+	return Options{Temperature: &temperature, TopP: c.topP, MaxTokens: c.maxTokens}
+}
+
+// SetKeepAlive 设置请求中的 keep_alive，控制模型在内存中的保留时长
+func (c *OllamaClient) SetKeepAlive(keepAlive string) {
+	c.keepAlive = keepAlive
+}
+
+// Warmup 预加载模型：向 /api/generate 发送不带 prompt 的请求，Ollama 仅加载模型不做生成
+// 模型加载完成后按 keep_alive 保留在内存中，首个真实请求无需等待加载
+func (c *OllamaClient) Warmup(ctx context.Context) error {
+	reqBody, err := json.Marshal(OllamaRequest{
+		Model:     c.modelName,
+		KeepAlive: c.keepAlive,
+	})
+	if err != nil {
+		return fmt.Errorf("序列化请求失败: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"api/generate", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return fmt.Errorf("创建HTTP请求失败: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("发送HTTP请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return parseOllamaError(resp.StatusCode, body)
 	}
+	return nil
+}
+
+// ollamaTagsResponse /api/tags 返回的本地模型列表
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+// Ping 请求 /api/tags 检查 Ollama 是否可达，并确认配置的模型已下载
+// 不加载模型，开销很小，可用于健康检查
+func (c *OllamaClient) Ping(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"api/tags", nil)
+	if err != nil {
+		return fmt.Errorf("创建HTTP请求失败: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("发送HTTP请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return parseOllamaError(resp.StatusCode, body)
+	}
+	var tags ollamaTagsResponse
+	if err := json.Unmarshal(body, &tags); err != nil {
+		return fmt.Errorf("解析模型列表失败: %w", err)
+	}
+	for _, m := range tags.Models {
+		// 未指定标签的模型名对应 :latest
+		if m.Name == c.modelName || m.Name == c.modelName+":latest" {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s（请先执行 ollama pull %s）", ErrModelNotFound, c.modelName, c.modelName)
 }
 
 // parsePromptToMessages 将文本提示转换为消息数组
@@ -137,51 +423,116 @@ func parsePromptToMessages(prompt string) []Message {
 
 // Generate 使用提示词生成响应，支持流式处理
 func (c *OllamaClient) Generate(ctx context.Context, prompt string) (string, error) {
-	return c.generateWithRetry(ctx, prompt, 0)
+	resp, _, err := c.generateWithRetry(ctx, ollamaInput{prompt: prompt}, 0)
+	return resp, err
+}
+
+// GenerateWithUsage 生成文本并返回用量，token 数取自 Ollama 返回的 prompt_eval_count/eval_count
+func (c *OllamaClient) GenerateWithUsage(ctx context.Context, prompt string) (string, Usage, error) {
+	return c.generateWithRetry(ctx, ollamaInput{prompt: prompt}, 0)
 }
 
 // GenerateStream 生成流式响应，返回一个通道用于接收实时响应
 func (c *OllamaClient) GenerateStream(ctx context.Context, prompt string, responseChan chan<- string) error {
 	defer close(responseChan)
-	return c.generateStreamWithRetry(ctx, prompt, responseChan, 0)
+	return c.generateStreamWithRetry(ctx, ollamaInput{prompt: prompt}, responseChan, 0)
 }
 
-// generateStreamWithRetry 带重试的流式生成方法
-func (c *OllamaClient) generateStreamWithRetry(ctx context.Context, prompt string, responseChan chan<- string, retryCount int) error {
+// GenerateMessages 按消息列表通过 /api/chat 生成，角色原样传递，无需解析文本
+func (c *OllamaClient) GenerateMessages(ctx context.Context, messages []agent.Message) (string, Usage, error) {
+	return c.generateWithRetry(ctx, messagesInput(messages), 0)
+}
+
+// GenerateMessagesStream 按消息列表通过 /api/chat 流式生成
+func (c *OllamaClient) GenerateMessagesStream(ctx context.Context, messages []agent.Message, responseChan chan<- string) error {
+	defer close(responseChan)
+	return c.generateStreamWithRetry(ctx, messagesInput(messages), responseChan, 0)
+}
+
+// ollamaInput 一次生成的输入：消息列表（走 /api/chat）或文本提示词
+type ollamaInput struct {
+	prompt   string
+	messages []Message
+}
+
+// messagesInput 将 Agent 的消息列表转换为生成输入
+func messagesInput(messages []agent.Message) ollamaInput {
+	in := ollamaInput{messages: make([]Message, 0, len(messages))}
+	for _, m := range messages {
+		in.messages = append(in.messages, Message{Role: m.Role, Content: m.Content})
+	}
+	return in
+}
+
+// text 返回用于统计字符数的提示词文本
+func (in ollamaInput) text() string {
+	if in.messages == nil {
+		return in.prompt
+	}
+	var b strings.Builder
+	for _, m := range in.messages {
+		b.WriteString(m.Content)
+	}
+	return b.String()
+}
+
+// apply 按端点模式将输入写入请求，返回是否走 /api/chat 端点
+func (in ollamaInput) apply(req *OllamaRequest, mode OllamaMode) bool {
+	switch mode {
+	case OllamaModeGenerate:
+		req.Prompt = in.prompt
+		if in.messages != nil {
+			prompt := make(agent.Prompt, len(in.messages))
+			for i, m := range in.messages {
+				prompt[i] = agent.Message{Role: m.Role, Content: m.Content}
+			}
+			req.Prompt = prompt.String()
+		}
+		return false
+	case OllamaModeAuto:
+		if in.messages != nil {
+			req.Messages = in.messages
+			return true
+		}
+		// 旧的启发式：同时包含 "user:" 与 "assistant:" 时按角色前缀解析为消息列表
+		if strings.Contains(in.prompt, "user:") && strings.Contains(in.prompt, "assistant:") {
+			if messages := parsePromptToMessages(in.prompt); len(messages) > 0 {
+				req.Messages = messages
+				return true
+			}
+		}
+		req.Prompt = in.prompt
+		return false
+	default:
+		req.Messages = in.messages
+		if in.messages == nil {
+			req.Messages = []Message{{Role: "user", Content: in.prompt}}
+		}
+		return true
+	}
+}
 
-	const maxLoadRetries = 3
-	if retryCount > maxLoadRetries {
+// generateStreamWithRetry 带重试的流式生成方法
+func (c *OllamaClient) generateStreamWithRetry(ctx context.Context, in ollamaInput, responseChan chan<- string, retryCount int) error {
+	if retryCount > c.retry.MaxLoadRetries {
 		return fmt.Errorf("模型加载重试次数超限，已尝试 %d 次", retryCount)
 	}
 
 	// 创建带超时的上下文
-	timeoutCtx, cancel := context.WithTimeout(ctx, 180*time.Second)
+	timeoutCtx, cancel := context.WithTimeout(ctx, c.retry.RequestTimeout)
 	defer cancel()
 
 	// 构建请求
 	req := OllamaRequest{
-		Model:  c.modelName,
-		Stream: true, // 启用流式响应
-		Options: Options{
-			Temperature: 0.7,
-			MaxTokens:   c.maxTokens,
-		},
-	}
-
-	// 检查是否是结构化消息格式，并标记是否走 chat 端点
-	isChat := false
-	if strings.Contains(prompt, "user:") && strings.Contains(prompt, "assistant:") {
-		messages := parsePromptToMessages(prompt)
-		if len(messages) > 0 {
-			req.Messages = messages
-			isChat = true
-		} else {
-			req.Prompt = prompt
-		}
-	} else {
-		req.Prompt = prompt
+		Model:     c.modelName,
+		Stream:    true, // 启用流式响应
+		Options:   c.options(),
+		KeepAlive: c.keepAlive,
 	}
 
+	// 写入消息列表或提示词，并标记是否走 chat 端点
+	isChat := in.apply(&req, c.mode)
+
 	// 发送请求
 	reqBody, err := json.Marshal(req)
 	if err != nil {
@@ -193,25 +544,16 @@ func (c *OllamaClient) generateStreamWithRetry(ctx context.Context, prompt strin
 	if isChat {
 		endpoint = "api/chat"
 	}
-	httpReq, err := http.NewRequestWithContext(timeoutCtx, "POST", c.baseURL+endpoint, bytes.NewBuffer(reqBody))
+	resp, err := c.postWithRetry(timeoutCtx, endpoint, reqBody)
 	if err != nil {
-		return fmt.Errorf("创建HTTP请求失败: %w", err)
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	// 发送请求
-	client := &http.Client{}
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		return fmt.Errorf("发送HTTP请求失败: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
 	// 检查状态码
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API返回错误状态码 %d: %s", resp.StatusCode, string(body))
+		return parseOllamaError(resp.StatusCode, body)
 	}
 
 	// 处理流式响应
@@ -225,14 +567,20 @@ func (c *OllamaClient) generateStreamWithRetry(ctx context.Context, prompt strin
 			continue
 		}
 
+		// 生成过程中出错时 Ollama 在流中返回 {"error":"..."}
+		if message, ok := ollamaErrorMessage([]byte(line)); ok {
+			return newOllamaError(resp.StatusCode, message)
+		}
+
 		// 先尝试按 /api/generate 解析；失败则尝试 /api/chat
 		var genResp OllamaResponse
 		if err := json.Unmarshal([]byte(line), &genResp); err == nil && (genResp.Response != "" || genResp.Done || genResp.DoneReason != "") {
 			if genResp.DoneReason == "load" {
 				isModelLoading = true
-				fmt.Printf("模型正在加载中，等待5秒后重试... (重试次数: %d/%d)\n", retryCount, maxLoadRetries)
-				time.Sleep(5 * time.Second)
-				return c.generateStreamWithRetry(ctx, prompt, responseChan, retryCount+1)
+				if err := c.waitForLoad(ctx, retryCount); err != nil {
+					return err
+				}
+				return c.generateStreamWithRetry(ctx, in, responseChan, retryCount+1)
 			}
 			if genResp.Response != "" {
 				responseChan <- genResp.Response
@@ -248,9 +596,10 @@ func (c *OllamaClient) generateStreamWithRetry(ctx context.Context, prompt strin
 		if err := json.Unmarshal([]byte(line), &chatResp); err == nil {
 			if chatResp.DoneReason == "load" {
 				isModelLoading = true
-				fmt.Printf("模型正在加载中，等待5秒后重试... (重试次数: %d/%d)\n", retryCount, maxLoadRetries)
-				time.Sleep(5 * time.Second)
-				return c.generateStreamWithRetry(ctx, prompt, responseChan, retryCount+1)
+				if err := c.waitForLoad(ctx, retryCount); err != nil {
+					return err
+				}
+				return c.generateStreamWithRetry(ctx, in, responseChan, retryCount+1)
 			}
 			if chatResp.Message.Content != "" {
 				responseChan <- chatResp.Message.Content
@@ -282,96 +631,55 @@ func (c *OllamaClient) generateStreamWithRetry(ctx context.Context, prompt strin
 }
 
 // generateWithRetry 带重试计数的生成方法，防止无限递归
-func (c *OllamaClient) generateWithRetry(ctx context.Context, prompt string, retryCount int) (string, error) {
-	// 防止无限递归，最多重试3次模型加载
-	const maxLoadRetries = 3
-	if retryCount > maxLoadRetries {
-		return "", fmt.Errorf("模型加载重试次数超限，已尝试 %d 次", retryCount)
+func (c *OllamaClient) generateWithRetry(ctx context.Context, in ollamaInput, retryCount int) (string, Usage, error) {
+	// 防止无限递归，最多重试 MaxLoadRetries 次模型加载
+	if retryCount > c.retry.MaxLoadRetries {
+		return "", Usage{}, fmt.Errorf("模型加载重试次数超限，已尝试 %d 次", retryCount)
 	}
 
 	// 创建带超时的上下文
 	fmt.Println("开始处理请求...")
-	timeoutCtx, cancel := context.WithTimeout(ctx, 180*time.Second) // 增加超时时间到3分钟
+	timeoutCtx, cancel := context.WithTimeout(ctx, c.retry.RequestTimeout)
 	defer cancel()
 
 	// 构建请求
 	req := OllamaRequest{
-		Model:  c.modelName,
-		Stream: false, // 非流式响应
-		Options: Options{
-			Temperature: 0.7,
-			MaxTokens:   c.maxTokens,
-		},
-	}
-
-	// 检查是否是结构化消息格式，并标记是否走 chat 端点
-	isChat := false
-	if strings.Contains(prompt, "user:") && strings.Contains(prompt, "assistant:") {
-		// 解析为消息数组
-		messages := parsePromptToMessages(prompt)
-		if len(messages) > 0 {
-			req.Messages = messages
-			isChat = true
-		} else {
-			req.Prompt = prompt
-		}
-	} else {
-		req.Prompt = prompt
+		Model:     c.modelName,
+		Stream:    false, // 非流式响应
+		Options:   c.options(),
+		KeepAlive: c.keepAlive,
 	}
 
+	// 写入消息列表或提示词，并标记是否走 chat 端点
+	isChat := in.apply(&req, c.mode)
+
 	fmt.Printf("准备发送请求到Ollama...\n")
 	// 发送请求
 	reqBody, err := json.Marshal(req)
 	if err != nil {
-		return "", fmt.Errorf("序列化请求失败: %w", err)
+		return "", Usage{}, fmt.Errorf("序列化请求失败: %w", err)
 	}
 
-	// 最大重试次数
-	maxRetries := 3
-	var resp *http.Response
-	var lastErr error
-
-	// 重试循环
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		// 创建HTTP请求（依据 isChat 切换端点）
-		endpoint := "api/generate"
-		if isChat {
-			endpoint = "api/chat"
-		}
-		httpReq, err := http.NewRequestWithContext(timeoutCtx, "POST", c.baseURL+endpoint, bytes.NewBuffer(reqBody))
-		if err != nil {
-			return "", fmt.Errorf("创建HTTP请求失败: %w", err)
-		}
-
-		httpReq.Header.Set("Content-Type", "application/json")
-
-		fmt.Printf("尝试请求 #%d...\n", attempt)
-
-		// 发送请求
-		client := &http.Client{}
-		resp, err = client.Do(httpReq)
-		if err != nil {
-			lastErr = err
-			if attempt < maxRetries {
-				fmt.Printf("请求失败，等待 %d 秒后重试: %v\n", attempt*2, err)
-				time.Sleep(time.Duration(attempt*2) * time.Second) // 指数退避
-				continue
-			}
-			return "", fmt.Errorf("HTTP请求失败，已重试 %d 次: %w", maxRetries, lastErr)
-		}
-		break // 成功，退出重试循环
+	// 依据 isChat 切换端点，连接失败时按 RetryConfig 重试
+	endpoint := "api/generate"
+	if isChat {
+		endpoint = "api/chat"
+	}
+	resp, err := c.postWithRetry(timeoutCtx, endpoint, reqBody)
+	if err != nil {
+		return "", Usage{}, err
 	}
 	defer resp.Body.Close()
 
 	// 读取响应
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("读取响应失败: %w", err)
+		return "", Usage{}, fmt.Errorf("读取响应失败: %w", err)
 	}
 
 	// 检查状态码
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API返回错误状态码 %d: %s", resp.StatusCode, string(body))
+		return "", Usage{}, parseOllamaError(resp.StatusCode, body)
 	}
 
 	fmt.Println("成功收到响应，正在处理...")
@@ -380,22 +688,23 @@ func (c *OllamaClient) generateWithRetry(ctx context.Context, prompt string, ret
 	responseStr := string(body)
 	fmt.Printf("原始响应内容: %s\n", responseStr)
 
-	// 检查是否包含错误信息
-	if strings.Contains(responseStr, "error") {
-		return "", fmt.Errorf("API返回错误: %s", responseStr)
+	// 检查是否为 {"error":"..."} 错误响应（不能只按子串判断，正常回复中也可能出现 error 一词）
+	if message, ok := ollamaErrorMessage(body); ok {
+		return "", Usage{}, newOllamaError(resp.StatusCode, message)
 	}
 
 	// 优先尝试按 /api/generate 解析
 	var genResp OllamaResponse
 	if err := json.Unmarshal(body, &genResp); err == nil && (genResp.Response != "" || genResp.Done || genResp.DoneReason != "") {
 		if genResp.DoneReason == "load" {
-			fmt.Printf("模型正在加载中，等待5秒后重试... (重试次数: %d/%d)\n", retryCount, maxLoadRetries)
-			time.Sleep(5 * time.Second)
-			return c.generateWithRetry(ctx, prompt, retryCount+1)
+			if err := c.waitForLoad(ctx, retryCount); err != nil {
+				return "", Usage{}, err
+			}
+			return c.generateWithRetry(ctx, in, retryCount+1)
 		}
 		if strings.TrimSpace(genResp.Response) != "" {
 			fmt.Printf("成功生成响应，长度: %d 字符\n", len(genResp.Response))
-			return genResp.Response, nil
+			return genResp.Response, newUsage(in.text(), genResp.Response, genResp.PromptEvalCount, genResp.EvalCount), nil
 		}
 	}
 
@@ -403,23 +712,25 @@ func (c *OllamaClient) generateWithRetry(ctx context.Context, prompt string, ret
 	var chatResp ChatStreamResponse
 	if err := json.Unmarshal(body, &chatResp); err == nil {
 		if chatResp.DoneReason == "load" {
-			fmt.Printf("模型正在加载中，等待5秒后重试... (重试次数: %d/%d)\n", retryCount, maxLoadRetries)
-			time.Sleep(5 * time.Second)
-			return c.generateWithRetry(ctx, prompt, retryCount+1)
+			if err := c.waitForLoad(ctx, retryCount); err != nil {
+				return "", Usage{}, err
+			}
+			return c.generateWithRetry(ctx, in, retryCount+1)
 		}
 		if strings.TrimSpace(chatResp.Message.Content) != "" {
 			fmt.Printf("成功生成响应（chat），长度: %d 字符\n", len(chatResp.Message.Content))
-			return chatResp.Message.Content, nil
+			return chatResp.Message.Content, newUsage(in.text(), chatResp.Message.Content, chatResp.PromptEvalCount, chatResp.EvalCount), nil
 		}
 	}
 
 	// JSON解析都不符合或为空，尝试将响应作为纯文本处理
 	if strings.TrimSpace(responseStr) != "" {
 		fmt.Println("将响应作为纯文本处理")
-		return strings.TrimSpace(responseStr), nil
+		text := strings.TrimSpace(responseStr)
+		return text, newUsage(in.text(), text, 0, 0), nil
 	}
 
 	// 最终失败
 	fmt.Println("警告: 收到空响应")
-	return "", fmt.Errorf("模型返回了空响应")
+	return "", Usage{}, fmt.Errorf("模型返回了空响应")
 }
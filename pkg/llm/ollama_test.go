@@ -0,0 +1,173 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"agentEino/pkg/agent"
+)
+
+func TestOllamaRequestTimeoutAppliesToRequestContext(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 模拟一直不返回的模型，测试结束时才释放
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := NewOllamaClient(srv.URL, "llama3.1", 0, WithRetryConfig(RetryConfig{
+		MaxRetries:     1,
+		RequestTimeout: 100 * time.Millisecond,
+	}))
+
+	calls := map[string]func() error{
+		"Generate": func() error {
+			_, err := client.Generate(context.Background(), "你好")
+			return err
+		},
+		"GenerateStream": func() error {
+			ch := make(chan string, 10)
+			return client.GenerateStream(context.Background(), "你好", ch)
+		},
+	}
+	for name, call := range calls {
+		start := time.Now()
+		err := call()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: 错误 = %v，期望请求超时", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s: 耗时 %s，RequestTimeout 未作用于请求上下文", name, elapsed)
+		}
+	}
+}
+
+func TestRetryBudgetBoundsCumulativeWait(t *testing.T) {
+	// 模型始终处于加载中，不受预算限制时会等待 MaxLoadRetries*LoadWait
+	loading := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"done":true,"done_reason":"load"}`))
+	}))
+	defer loading.Close()
+	// 连接失败的地址，不受预算限制时按 BackoffBase 线性退避
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL := down.URL
+	down.Close()
+
+	rc := RetryConfig{MaxRetries: 10, MaxLoadRetries: 10, LoadWait: 40 * time.Millisecond, BackoffBase: 40 * time.Millisecond}
+	loadClient := NewOllamaClient(loading.URL, "llama3.1", 0, WithRetryConfig(rc))
+	downClient := NewOllamaClient(downURL, "llama3.1", 0, WithRetryConfig(rc))
+
+	budget := 100 * time.Millisecond
+	ctx := agent.WithRetryBudget(context.Background(), agent.NewRetryBudget(budget))
+	start := time.Now()
+
+	_, err := loadClient.Generate(ctx, "你好")
+	if !errors.Is(err, agent.ErrRetryBudgetExhausted) {
+		t.Fatalf("Generate: 错误 = %v，期望 ErrRetryBudgetExhausted", err)
+	}
+	// 同一轮的后续请求共享剩余预算：剩余 20ms 不足一次退避，立即失败
+	err = downClient.GenerateStream(ctx, "你好", make(chan string, 10))
+	if !errors.Is(err, agent.ErrRetryBudgetExhausted) {
+		t.Fatalf("GenerateStream: 错误 = %v，期望 ErrRetryBudgetExhausted", err)
+	}
+
+	// 两次加载等待共 80ms；不限制时仅加载重试就要 400ms
+	if elapsed := time.Since(start); elapsed > budget+150*time.Millisecond {
+		t.Errorf("累计耗时 %s，应受 %s 的重试预算约束", elapsed, budget)
+	}
+}
+
+func TestOllamaModeSelectsEndpoint(t *testing.T) {
+	var paths []string
+	var got []OllamaRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OllamaRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		paths = append(paths, r.URL.Path)
+		got = append(got, req)
+		if r.URL.Path == "/api/chat" {
+			w.Write([]byte(`{"message":{"role":"assistant","content":"回复"},"done":true}`))
+			return
+		}
+		w.Write([]byte(`{"response":"回复","done":true}`))
+	}))
+	defer srv.Close()
+
+	plain := "你好"
+	transcript := "user: 你好\nassistant: 你好！\nuser: 再见"
+	messages := []agent.Message{{Role: "system", Content: "你是助手"}, {Role: "user", Content: "你好"}}
+
+	tests := []struct {
+		mode  OllamaMode
+		input string // 为空时发送 messages
+		path  string
+	}{
+		{OllamaModeChat, plain, "/api/chat"},
+		{OllamaModeChat, transcript, "/api/chat"},
+		{OllamaModeChat, "", "/api/chat"},
+		{OllamaModeGenerate, plain, "/api/generate"},
+		{OllamaModeGenerate, transcript, "/api/generate"},
+		{OllamaModeGenerate, "", "/api/generate"},
+		{OllamaModeAuto, plain, "/api/generate"},
+		{OllamaModeAuto, transcript, "/api/chat"},
+		{OllamaModeAuto, "", "/api/chat"},
+	}
+	for _, tt := range tests {
+		paths, got = nil, nil
+		client := NewOllamaClient(srv.URL, "llama3.1", 0, WithMode(tt.mode))
+		var resp string
+		var err error
+		if tt.input == "" {
+			resp, _, err = client.GenerateMessages(context.Background(), messages)
+		} else {
+			resp, err = client.Generate(context.Background(), tt.input)
+		}
+		if err != nil || resp != "回复" {
+			t.Fatalf("%s %q: 响应 = %q, %v", tt.mode, tt.input, resp, err)
+		}
+		if len(paths) != 1 || paths[0] != tt.path {
+			t.Errorf("%s %q: 请求路径 = %v，期望 %s", tt.mode, tt.input, paths, tt.path)
+		}
+	}
+
+	// chat 模式下文本提示词整体作为一条用户消息，不按角色前缀拆分
+	paths, got = nil, nil
+	client := NewOllamaClient(srv.URL, "llama3.1", 0)
+	if _, err := client.Generate(context.Background(), transcript); err != nil {
+		t.Fatal(err)
+	}
+	if want := []Message{{Role: "user", Content: transcript}}; !reflect.DeepEqual(got[0].Messages, want) {
+		t.Errorf("默认 chat 模式 messages = %+v，期望 %+v", got[0].Messages, want)
+	}
+
+	// generate 模式下消息按 "role: content" 渲染为提示词
+	paths, got = nil, nil
+	client = NewOllamaClient(srv.URL, "llama3.1", 0, WithMode(OllamaModeGenerate))
+	if _, _, err := client.GenerateMessages(context.Background(), messages); err != nil {
+		t.Fatal(err)
+	}
+	if want := agent.Prompt(messages).String(); got[0].Prompt != want || got[0].Messages != nil {
+		t.Errorf("generate 模式 prompt = %q messages = %+v，期望 %q", got[0].Prompt, got[0].Messages, want)
+	}
+}
+
+func TestParseOllamaMode(t *testing.T) {
+	for name, want := range map[string]OllamaMode{"": OllamaModeChat, "Chat": OllamaModeChat, " generate ": OllamaModeGenerate, "AUTO": OllamaModeAuto} {
+		if got, err := ParseOllamaMode(name); err != nil || got != want {
+			t.Errorf("ParseOllamaMode(%q) = %q, %v，期望 %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseOllamaMode("completion"); err == nil {
+		t.Error("未知模式应返回错误")
+	}
+}
@@ -2,16 +2,74 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"agentEino/pkg/agent"
 
 	"github.com/sashabaranov/go-openai"
 )
 
+// openAIToolParameters 未声明参数的工具使用的通用 JSON Schema：参数格式由各工具自行校验
+var openAIToolParameters = json.RawMessage(`{"type":"object","additionalProperties":true}`)
+
+// openAIParamSchema JSON Schema 中单个参数的定义
+type openAIParamSchema struct {
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// openAIToolSchema 按工具声明的参数生成 JSON Schema（属性、类型与必填项），让模型知道参数名
+// 未声明参数时返回通用 Schema
+func openAIToolSchema(tool agent.ToolSpec) json.RawMessage {
+	if len(tool.Parameters) == 0 {
+		return openAIToolParameters
+	}
+	properties := make(map[string]openAIParamSchema, len(tool.Parameters))
+	required := []string{}
+	for name, spec := range tool.Parameters {
+		properties[name] = openAIParamSchema{Type: spec.Type, Description: spec.Description}
+		if spec.Required {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+	schema, err := json.Marshal(map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	})
+	if err != nil {
+		return openAIToolParameters
+	}
+	return schema
+}
+
+func init() {
+	RegisterProvider("openai", newOpenAIFromConfig)
+}
+
+// newOpenAIFromConfig 按模型配置创建OpenAI客户端，未设置 API Key 时返回错误
+func newOpenAIFromConfig(config ModelConfig) (agent.LLMClient, error) {
+	if config.APIKey == "" {
+		return nil, fmt.Errorf("provider 为 openai 但未设置 API Key（请配置 llm.api_key 或环境变量 OPENAI_API_KEY）")
+	}
+	maxTokens := resolveMaxTokens("openai", config.ModelName, config.MaxTokens)
+	client := NewOpenAIClient(config.APIKey, config.ModelName, maxTokens)
+	client.SetSampling(config.Temperature, config.TopP)
+	return client, nil
+}
+
 // OpenAIClient 实现了LLM客户端接口
 type OpenAIClient struct {
-	client    *openai.Client
-	modelName string
-	maxTokens int
+	client      *openai.Client
+	modelName   string
+	maxTokens   int
+	temperature *float64 // nil 时使用 OpenAI 默认值
+	topP        *float64
 }
 
 // NewOpenAIClient 创建一个新的OpenAI客户端
@@ -24,35 +82,151 @@ func NewOpenAIClient(apiKey string, modelName string, maxTokens int) *OpenAIClie
 	}
 }
 
+// DefaultOpenAITemperature 请求未设置 temperature 时 OpenAI 使用的默认温度
+const DefaultOpenAITemperature = 1.0
+
+// SetSampling 设置请求的 temperature 与 top_p，nil 表示使用 OpenAI 默认值
+func (c *OpenAIClient) SetSampling(temperature, topP *float64) {
+	c.temperature = temperature
+	c.topP = topP
+}
+
+// Sampling 返回生成请求使用的采样参数
+func (c *OpenAIClient) Sampling() agent.Sampling {
+	s := agent.Sampling{Temperature: DefaultOpenAITemperature, MaxTokens: c.maxTokens}
+	if c.temperature != nil {
+		s.Temperature = *c.temperature
+	}
+	if c.topP != nil {
+		s.TopP = *c.topP
+	}
+	return s
+}
+
+// newRequest 构建带模型、token 上限与采样参数的请求
+// go-openai 的 temperature 带 omitempty，0 会被省略而变成默认值 1，按其文档以最小正数代替
+func (c *OpenAIClient) newRequest(messages []openai.ChatCompletionMessage) openai.ChatCompletionRequest {
+	req := openai.ChatCompletionRequest{
+		Model:     c.modelName,
+		Messages:  messages,
+		MaxTokens: c.maxTokens,
+	}
+	if c.temperature != nil {
+		req.Temperature = float32(*c.temperature)
+		if req.Temperature == 0 {
+			req.Temperature = math.SmallestNonzeroFloat32
+		}
+	}
+	if c.topP != nil {
+		req.TopP = float32(*c.topP)
+	}
+	return req
+}
+
+// Ping 查询配置的模型信息，检查 API 是否可达、API Key 是否有效以及模型是否可用
+func (c *OpenAIClient) Ping(ctx context.Context) error {
+	if _, err := c.client.GetModel(ctx, c.modelName); err != nil {
+		return fmt.Errorf("查询模型 %s 失败: %w", c.modelName, err)
+	}
+	return nil
+}
+
 // Generate 生成文本
 func (c *OpenAIClient) Generate(ctx context.Context, prompt string) (string, error) {
+	resp, _, err := c.GenerateWithUsage(ctx, prompt)
+	return resp, err
+}
+
+// GenerateWithUsage 生成文本并返回用量，token 数取自响应中的 usage
+// 文本提示词整体作为一条用户消息发送
+func (c *OpenAIClient) GenerateWithUsage(ctx context.Context, prompt string) (string, Usage, error) {
 	if prompt == "" {
-		return "", errors.New("prompt cannot be empty")
-	}
-
-	resp, err := c.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model: c.modelName,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
+		return "", Usage{}, errors.New("prompt cannot be empty")
+	}
+	return c.complete(ctx, userMessage(prompt), prompt)
+}
+
+// GenerateMessages 按消息列表生成文本，各消息的角色原样传递给 OpenAI
+func (c *OpenAIClient) GenerateMessages(ctx context.Context, messages []agent.Message) (string, Usage, error) {
+	if len(messages) == 0 {
+		return "", Usage{}, errors.New("messages cannot be empty")
+	}
+	return c.complete(ctx, toOpenAIMessages(messages), joinMessageContent(messages))
+}
+
+// complete 发送非流式请求，promptText 用于统计提示词字符数
+func (c *OpenAIClient) complete(ctx context.Context, messages []openai.ChatCompletionMessage, promptText string) (string, Usage, error) {
+	resp, err := c.client.CreateChatCompletion(ctx, c.newRequest(messages))
+
+	if err != nil {
+		return "", Usage{}, err
+	}
+
+	if len(resp.Choices) == 0 {
+		return "", Usage{}, errors.New("no response from OpenAI")
+	}
+
+	content := resp.Choices[0].Message.Content
+	return content, newUsage(promptText, content, resp.Usage.PromptTokens, resp.Usage.CompletionTokens), nil
+}
+
+// GenerateWithTools 使用 OpenAI 原生函数调用生成响应
+// 模型请求调用工具时返回结构化的工具调用，否则返回普通文本回复
+func (c *OpenAIClient) GenerateWithTools(ctx context.Context, prompt string, tools []agent.ToolSpec) (string, []agent.ToolCall, error) {
+	if prompt == "" {
+		return "", nil, errors.New("prompt cannot be empty")
+	}
+	return c.completeWithTools(ctx, userMessage(prompt), tools)
+}
+
+// GenerateMessagesWithTools 按消息列表使用原生函数调用生成响应
+func (c *OpenAIClient) GenerateMessagesWithTools(ctx context.Context, messages []agent.Message, tools []agent.ToolSpec) (string, []agent.ToolCall, error) {
+	if len(messages) == 0 {
+		return "", nil, errors.New("messages cannot be empty")
+	}
+	return c.completeWithTools(ctx, toOpenAIMessages(messages), tools)
+}
+
+// completeWithTools 发送带工具定义的请求，解析模型返回的全部工具调用（并行调用作为一批执行）
+func (c *OpenAIClient) completeWithTools(ctx context.Context, messages []openai.ChatCompletionMessage, tools []agent.ToolSpec) (string, []agent.ToolCall, error) {
+	req := c.newRequest(messages)
+	for _, tool := range tools {
+		req.Tools = append(req.Tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  openAIToolSchema(tool),
 			},
-			MaxTokens: c.maxTokens,
-		},
-	)
+		})
+	}
 
+	resp, err := c.client.CreateChatCompletion(ctx, req)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	if len(resp.Choices) == 0 {
-		return "", errors.New("no response from OpenAI")
+		return "", nil, errors.New("no response from OpenAI")
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	msg := resp.Choices[0].Message
+	if len(msg.ToolCalls) == 0 {
+		return msg.Content, nil, nil
+	}
+
+	calls := make([]agent.ToolCall, 0, len(msg.ToolCalls))
+	for _, tc := range msg.ToolCalls {
+		fn := tc.Function
+		params := make(map[string]interface{})
+		if fn.Arguments != "" {
+			if err := json.Unmarshal([]byte(fn.Arguments), &params); err != nil {
+				return "", nil, fmt.Errorf("解析工具 %s 的参数失败: %w", fn.Name, err)
+			}
+		}
+		calls = append(calls, agent.ToolCall{Name: fn.Name, Params: params})
+	}
+	return msg.Content, calls, nil
 }
 
 // GenerateStream 生成流式响应
@@ -62,22 +236,25 @@ func (c *OpenAIClient) GenerateStream(ctx context.Context, prompt string, respon
 	if prompt == "" {
 		return errors.New("prompt cannot be empty")
 	}
+	return c.stream(ctx, userMessage(prompt), responseChan)
+}
+
+// GenerateMessagesStream 按消息列表生成流式响应
+func (c *OpenAIClient) GenerateMessagesStream(ctx context.Context, messages []agent.Message, responseChan chan<- string) error {
+	defer close(responseChan)
+
+	if len(messages) == 0 {
+		return errors.New("messages cannot be empty")
+	}
+	return c.stream(ctx, toOpenAIMessages(messages), responseChan)
+}
 
+// stream 发送流式请求并将内容片段写入 responseChan（由调用方关闭）
+func (c *OpenAIClient) stream(ctx context.Context, messages []openai.ChatCompletionMessage, responseChan chan<- string) error {
 	// 创建流式请求
-	stream, err := c.client.CreateChatCompletionStream(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model: c.modelName,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
-			},
-			MaxTokens: c.maxTokens,
-			Stream:    true,
-		},
-	)
+	req := c.newRequest(messages)
+	req.Stream = true
+	stream, err := c.client.CreateChatCompletionStream(ctx, req)
 
 	if err != nil {
 		return err
@@ -104,3 +281,22 @@ func (c *OpenAIClient) GenerateStream(ctx context.Context, prompt string, respon
 		}
 	}
 }
+
+// userMessage 将文本提示词包装为单条用户消息
+func userMessage(prompt string) []openai.ChatCompletionMessage {
+	return []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}}
+}
+
+// toOpenAIMessages 转换消息列表，system/assistant 以外的角色按用户消息发送
+func toOpenAIMessages(messages []agent.Message) []openai.ChatCompletionMessage {
+	out := make([]openai.ChatCompletionMessage, 0, len(messages))
+	for _, m := range messages {
+		role := openai.ChatMessageRoleUser
+		switch m.Role {
+		case openai.ChatMessageRoleSystem, openai.ChatMessageRoleAssistant:
+			role = m.Role
+		}
+		out = append(out, openai.ChatCompletionMessage{Role: role, Content: m.Content})
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"agentEino/pkg/agent"
+	"agentEino/pkg/tools"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// newOpenAITestClient 创建请求发往 handler 的OpenAI客户端
+func newOpenAITestClient(t *testing.T, handler http.HandlerFunc) *OpenAIClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	client := NewOpenAIClient("sk-test", "gpt-4o-mini", 0)
+	cfg := openai.DefaultConfig("sk-test")
+	cfg.BaseURL = srv.URL + "/v1"
+	client.client = openai.NewClientWithConfig(cfg)
+	return client
+}
+
+func TestOpenAIToolsDeclareParameterSchema(t *testing.T) {
+	var got map[string]interface{}
+	client := newOpenAITestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"好"}}]}`))
+	})
+
+	specs := []agent.ToolSpec{
+		{Name: "weather", Description: "查询天气", Parameters: map[string]tools.ParamSpec{
+			"city": {Type: tools.ParamTypeString, Required: true, Description: "城市名"},
+			"days": {Type: tools.ParamTypeInteger},
+		}},
+		{Name: "echo"},
+	}
+	if _, _, err := client.GenerateWithTools(context.Background(), "北京天气", specs); err != nil {
+		t.Fatalf("GenerateWithTools 失败: %v", err)
+	}
+
+	declared := got["tools"].([]interface{})
+	params := func(i int) map[string]interface{} {
+		return declared[i].(map[string]interface{})["function"].(map[string]interface{})["parameters"].(map[string]interface{})
+	}
+	weather := params(0)
+	wantProps := map[string]interface{}{
+		"city": map[string]interface{}{"type": "string", "description": "城市名"},
+		"days": map[string]interface{}{"type": "integer"},
+	}
+	if !reflect.DeepEqual(weather["properties"], wantProps) {
+		t.Errorf("properties = %v，期望 %v", weather["properties"], wantProps)
+	}
+	if !reflect.DeepEqual(weather["required"], []interface{}{"city"}) {
+		t.Errorf("required = %v，期望 [city]", weather["required"])
+	}
+	if echo := params(1); echo["properties"] != nil || echo["additionalProperties"] != true {
+		t.Errorf("未声明参数的工具应使用通用 Schema，实际 %v", echo)
+	}
+}
+
+func TestOpenAIReturnsAllParallelToolCalls(t *testing.T) {
+	client := newOpenAITestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"","tool_calls":[
+			{"id":"1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"北京\"}"}},
+			{"id":"2","type":"function","function":{"name":"air","arguments":""}}
+		]}}]}`))
+	})
+
+	_, calls, err := client.GenerateWithTools(context.Background(), "北京天气和空气", []agent.ToolSpec{{Name: "weather"}, {Name: "air"}})
+	if err != nil {
+		t.Fatalf("GenerateWithTools 失败: %v", err)
+	}
+	want := []agent.ToolCall{
+		{Name: "weather", Params: map[string]interface{}{"city": "北京"}},
+		{Name: "air", Params: map[string]interface{}{}},
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("工具调用 = %+v，期望 %+v", calls, want)
+	}
+}
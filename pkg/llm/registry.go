@@ -0,0 +1,76 @@
+package llm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"agentEino/pkg/agent"
+)
+
+// ModelConfig 创建LLM客户端使用的模型配置
+type ModelConfig = agent.ModelConfig
+
+// ProviderFactory 按模型配置创建某个提供方的LLM客户端，配置不完整（如缺少 API Key）时返回错误
+type ProviderFactory func(ModelConfig) (agent.LLMClient, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]ProviderFactory)
+)
+
+// normalizeProvider 提供方名称不区分大小写，忽略首尾空白
+func normalizeProvider(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// RegisterProvider 注册LLM提供方，通常在提供方所在文件的 init() 中调用
+// 注册后 NewClient/NewClientFor 与配置校验即可识别该名称，无需修改 main.go；
+// 名称为空、factory 为 nil 或重复注册时 panic
+func RegisterProvider(name string, factory ProviderFactory) {
+	key := normalizeProvider(name)
+	if key == "" {
+		panic("llm: 提供方名称不能为空")
+	}
+	if factory == nil {
+		panic("llm: 提供方 " + key + " 的 factory 为 nil")
+	}
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if _, dup := providers[key]; dup {
+		panic("llm: 重复注册提供方 " + key)
+	}
+	providers[key] = factory
+}
+
+// Providers 返回已注册的提供方名称（按字母排序）
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HasProvider 判断提供方是否已注册
+func HasProvider(name string) bool {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	_, ok := providers[normalizeProvider(name)]
+	return ok
+}
+
+// NewClientFor 使用名为 name 的已注册提供方创建LLM客户端，未注册时返回列出可选名称的错误
+func NewClientFor(name string, config ModelConfig) (agent.LLMClient, error) {
+	providersMu.RLock()
+	factory, ok := providers[normalizeProvider(name)]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("不支持的LLM提供方: %q（可选 %s）", name, strings.Join(Providers(), "/"))
+	}
+	return factory(config)
+}
@@ -0,0 +1,46 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+
+	"agentEino/pkg/agent"
+)
+
+func TestRegisterProvider(t *testing.T) {
+	var got ModelConfig
+	RegisterProvider("Test-Provider", func(config ModelConfig) (agent.LLMClient, error) {
+		got = config
+		return NewOpenAIClient("sk-test", config.ModelName, 0), nil
+	})
+
+	if !HasProvider(" test-provider ") {
+		t.Fatal("注册后应能按名称（不区分大小写）找到提供方")
+	}
+	client, err := NewClient(ModelConfig{Provider: "TEST-PROVIDER", ModelName: "m1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.(*OpenAIClient); !ok || got.ModelName != "m1" {
+		t.Errorf("应由注册的 factory 创建客户端，实际 %T，收到配置 %+v", client, got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("重复注册应 panic")
+		}
+	}()
+	RegisterProvider("test-provider", newOpenAIFromConfig)
+}
+
+func TestNewClientForUnknownProviderListsRegistered(t *testing.T) {
+	_, err := NewClientFor("anthropic", ModelConfig{ModelName: "x"})
+	if err == nil {
+		t.Fatal("未注册的提供方应返回错误")
+	}
+	for _, name := range []string{"anthropic", "ollama", "openai"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("错误信息应包含 %q: %v", name, err)
+		}
+	}
+}
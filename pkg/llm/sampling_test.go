@@ -0,0 +1,115 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"agentEino/pkg/agent"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func float(v float64) *float64 { return &v }
+
+func TestOllamaRequestSendsConfiguredSampling(t *testing.T) {
+	var raw map[string]json.RawMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw = nil
+		json.NewDecoder(r.Body).Decode(&raw)
+		if r.URL.Path == "/api/chat" {
+			w.Write([]byte(`{"message":{"role":"assistant","content":"好"},"done":false}` + "\n" + `{"done":true}` + "\n"))
+			return
+		}
+		w.Write([]byte(`{"response":"好","done":true}`))
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		name        string
+		temperature *float64
+		topP        *float64
+		want        string
+	}{
+		{"未设置时使用默认温度且不发送 top_p", nil, nil, `{"temperature":0.7,"num_predict":4096}`},
+		{"温度为 0 时仍然发送", float(0), nil, `{"temperature":0,"num_predict":4096}`},
+		{"同时设置温度与 top_p", float(1.2), float(0.9), `{"temperature":1.2,"top_p":0.9,"num_predict":4096}`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client, err := NewClient(agent.ModelConfig{Provider: "ollama", ModelName: "llama3.1", BaseURL: srv.URL, MaxTokens: 4096, Temperature: c.temperature, TopP: c.topP})
+			if err != nil {
+				t.Fatalf("创建客户端失败: %v", err)
+			}
+			for _, generate := range []func() error{
+				func() error { _, err := client.Generate(context.Background(), "你好"); return err },
+				func() error {
+					ch := make(chan string, 10)
+					return client.GenerateStream(context.Background(), "你好", ch)
+				},
+			} {
+				if err := generate(); err != nil {
+					t.Fatalf("生成失败: %v", err)
+				}
+				if got := string(raw["options"]); got != c.want {
+					t.Errorf("请求中的 options = %s，期望 %s", got, c.want)
+				}
+			}
+			s := client.(agent.Sampler).Sampling()
+			if c.temperature != nil && s.Temperature != *c.temperature {
+				t.Errorf("Sampling().Temperature = %v，期望 %v", s.Temperature, *c.temperature)
+			}
+		})
+	}
+}
+
+func TestOpenAIRequestSendsConfiguredSampling(t *testing.T) {
+	var raw map[string]json.RawMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw = nil
+		json.NewDecoder(r.Body).Decode(&raw)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"好"}}]}`))
+	}))
+	defer srv.Close()
+
+	newClient := func(temperature, topP *float64) *OpenAIClient {
+		client, err := NewClient(agent.ModelConfig{Provider: "openai", ModelName: "gpt-4o-mini", APIKey: "sk-test", Temperature: temperature, TopP: topP})
+		if err != nil {
+			t.Fatalf("创建客户端失败: %v", err)
+		}
+		cfg := openai.DefaultConfig("sk-test")
+		cfg.BaseURL = srv.URL + "/v1"
+		client.(*OpenAIClient).client = openai.NewClientWithConfig(cfg)
+		return client.(*OpenAIClient)
+	}
+
+	client := newClient(nil, nil)
+	if _, err := client.Generate(context.Background(), "你好"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw["temperature"]; ok {
+		t.Errorf("未设置时不应发送 temperature: %s", raw["temperature"])
+	}
+	if s := client.Sampling(); s.Temperature != DefaultOpenAITemperature {
+		t.Errorf("未设置时 Sampling().Temperature = %v，期望 %v", s.Temperature, DefaultOpenAITemperature)
+	}
+
+	// 温度 0 不能因 omitempty 被省略，否则 OpenAI 会使用默认温度 1
+	client = newClient(float(0), float(0.5))
+	if _, err := client.Generate(context.Background(), "你好"); err != nil {
+		t.Fatal(err)
+	}
+	var temperature, topP float64
+	if err := json.Unmarshal(raw["temperature"], &temperature); err != nil || temperature >= 1e-6 {
+		t.Errorf("温度为 0 时应发送接近 0 的 temperature，实际 %s", raw["temperature"])
+	}
+	if err := json.Unmarshal(raw["top_p"], &topP); err != nil || topP != 0.5 {
+		t.Errorf("请求中的 top_p = %s，期望 0.5", raw["top_p"])
+	}
+	if s := client.Sampling(); s.Temperature != 0 || s.TopP != 0.5 {
+		t.Errorf("Sampling() = %+v", s)
+	}
+}
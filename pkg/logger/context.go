@@ -0,0 +1,49 @@
+package logger
+
+import "context"
+
+// contextKey 上下文中日志记录器的键
+type contextKey struct{}
+
+// With 返回附带固定字段的日志记录器，之后的每条日志都包含这些字段，调用时传入的同名字段优先
+// 派生的记录器不复制配置：级别、输出目标与格式始终跟随全局（或创建它的根记录器）的当前设置
+func (l *Logger) With(fields map[string]interface{}) *Logger {
+	root := l
+	if l.root != nil {
+		root = l.root
+	}
+	merged := make(map[string]interface{}, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &Logger{root: root, fields: merged}
+}
+
+// With 基于全局日志记录器返回附带固定字段的日志记录器
+func With(fields map[string]interface{}) *Logger {
+	return defaultLogger.With(fields)
+}
+
+// NewContext 返回携带日志记录器 l 的上下文
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext 返回上下文中的日志记录器，没有时返回全局日志记录器
+// 请求处理链上的日志应通过它输出，自动带上中间件注入的请求ID等字段
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(contextKey{}).(*Logger); ok && l != nil {
+			return l
+		}
+	}
+	return defaultLogger
+}
+
+// WithContextFields 在上下文已有的日志记录器上追加字段（如会话ID），返回携带新记录器的上下文
+func WithContextFields(ctx context.Context, fields map[string]interface{}) context.Context {
+	return NewContext(ctx, FromContext(ctx).With(fields))
+}
@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWithAddsFieldsToEveryLine(t *testing.T) {
+	var buf bytes.Buffer
+	root := newTestLogger(&buf)
+	root.format = FormatJSON
+	l := root.With(map[string]interface{}{"request_id": "req_1"}).With(map[string]interface{}{"conversation_id": "conv_1"})
+
+	l.Info("第一条")
+	l.Warn("第二条", map[string]interface{}{"request_id": "req_override", "n": 2})
+	root.Info("根记录器")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("期望 3 行日志: %s", buf.String())
+	}
+	var entries []map[string]interface{}
+	for _, line := range lines {
+		var e map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("输出不是合法 JSON: %v: %s", err, line)
+		}
+		entries = append(entries, e)
+	}
+	if entries[0]["request_id"] != "req_1" || entries[0]["conversation_id"] != "conv_1" {
+		t.Errorf("派生记录器应附带固定字段: %v", entries[0])
+	}
+	if entries[1]["request_id"] != "req_override" || entries[1]["n"] != float64(2) {
+		t.Errorf("调用时传入的同名字段应优先: %v", entries[1])
+	}
+	if _, ok := entries[2]["request_id"]; ok {
+		t.Errorf("With 不应修改原记录器: %v", entries[2])
+	}
+	if !strings.HasSuffix(entries[0]["caller"].(string), "context_test.go:17") {
+		t.Errorf("调用位置应指向调用方，实际 %v", entries[0]["caller"])
+	}
+}
+
+func TestWithFollowsRootSettings(t *testing.T) {
+	var buf bytes.Buffer
+	root := newTestLogger(&buf)
+	l := root.With(map[string]interface{}{"request_id": "req_1"})
+
+	root.level = WARN
+	l.Info("被过滤")
+	if buf.Len() != 0 {
+		t.Fatalf("派生记录器应使用根记录器的级别: %s", buf.String())
+	}
+	l.Warn("保留")
+	if !strings.Contains(buf.String(), "request_id=req_1") {
+		t.Errorf("文本格式也应输出固定字段: %s", buf.String())
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if FromContext(context.Background()) != defaultLogger {
+		t.Error("上下文中没有记录器时应返回全局记录器")
+	}
+
+	var buf bytes.Buffer
+	root := newTestLogger(&buf)
+	ctx := NewContext(context.Background(), root.With(map[string]interface{}{"request_id": "req_1"}))
+	ctx = WithContextFields(ctx, map[string]interface{}{"conversation_id": "conv_1"})
+
+	FromContext(ctx).Info("处理消息")
+	out := buf.String()
+	if !strings.Contains(out, "request_id=req_1") || !strings.Contains(out, "conversation_id=conv_1") {
+		t.Errorf("上下文中的记录器应带上请求ID与会话ID: %s", out)
+	}
+}
@@ -0,0 +1,145 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// DefaultMaxBackups 日志文件轮转时默认保留的历史文件个数
+const DefaultMaxBackups = 5
+
+var (
+	// ansiPattern 匹配 ANSI 颜色控制序列，写入文件前去除
+	ansiPattern = regexp.MustCompile("\033\\[[0-9;]*m")
+
+	fileMu     sync.Mutex
+	maxBackups = DefaultMaxBackups
+	logFile    *rotatingFile
+)
+
+// rotatingFile 按大小轮转的日志文件：写入后超过 maxBytes 时将当前文件依次重命名为
+// path.1、path.2……（数字越大越旧），超出 backups 个的最旧文件被删除
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64 // <=0 表示不轮转
+	backups  int   // 0 表示轮转时不保留历史文件
+	file     *os.File
+	size     int64
+}
+
+// openRotatingFile 以追加方式打开日志文件，必要时创建所在目录
+func openRotatingFile(path string, maxBytes int64, backups int) (*rotatingFile, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("创建日志目录失败: %w", err)
+		}
+	}
+	r := &rotatingFile{path: path, maxBytes: maxBytes, backups: backups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("打开日志文件失败: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("读取日志文件信息失败: %w", err)
+	}
+	r.file = f
+	r.size = info.Size()
+	return nil
+}
+
+// Write 写入一条日志，去掉颜色控制序列；写入后会超过大小上限时先轮转
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	clean := ansiPattern.ReplaceAll(p, nil)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.maxBytes > 0 && r.size > 0 && r.size+int64(len(clean)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(clean)
+	r.size += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	// 返回调用方传入的长度，避免去除颜色后 log.Logger 误判为短写
+	return len(p), nil
+}
+
+// rotate 关闭当前文件、依次后移历史文件并重新打开，调用方需持有 r.mu
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("关闭日志文件失败: %w", err)
+	}
+	r.file = nil
+	if r.backups <= 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("删除日志文件失败: %w", err)
+		}
+		return r.open()
+	}
+	os.Remove(fmt.Sprintf("%s.%d", r.path, r.backups))
+	for i := r.backups - 1; i >= 1; i-- {
+		old := fmt.Sprintf("%s.%d", r.path, i)
+		if err := os.Rename(old, fmt.Sprintf("%s.%d", r.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("轮转日志文件失败: %w", err)
+		}
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("轮转日志文件失败: %w", err)
+	}
+	return r.open()
+}
+
+// Close 关闭日志文件，之后的写入返回错误
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// SetMaxBackups 设置 ToFile 轮转时保留的历史文件个数，需在 ToFile 之前调用；<=0 表示不保留
+func SetMaxBackups(n int) {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	maxBackups = n
+}
+
+// ToFile 将日志改为写入 path，文件超过 maxSizeMB 兆字节时轮转（<=0 表示不轮转）
+// 写入文件的内容不含颜色；再次调用会关闭之前打开的日志文件
+func ToFile(path string, maxSizeMB int) error {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	f, err := openRotatingFile(path, int64(maxSizeMB)*1024*1024, maxBackups)
+	if err != nil {
+		return err
+	}
+	SetOutput(f)
+	if logFile != nil {
+		logFile.Close()
+	}
+	logFile = f
+	return nil
+}
@@ -0,0 +1,85 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFileKeepsBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "agent.log")
+	f, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"}
+	for p, content := range want {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("%s = %q，期望 %q", filepath.Base(p), data, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("超出保留个数的历史文件应被删除")
+	}
+}
+
+func TestRotatingFileWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	f, err := openRotatingFile(path, 8, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("first\n"))
+	f.Write([]byte("second\n"))
+	data, _ := os.ReadFile(path)
+	if string(data) != "second\n" {
+		t.Errorf("不保留历史文件时应清空后继续写入，实际 %q", data)
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Error("不应生成历史文件")
+	}
+}
+
+func TestToFileStripsColors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	if err := ToFile(path, 1); err != nil {
+		t.Fatal(err)
+	}
+	SetColor(true)
+	t.Cleanup(func() {
+		SetOutput(os.Stdout)
+		fileMu.Lock()
+		logFile.Close()
+		logFile = nil
+		fileMu.Unlock()
+	})
+
+	Info("写入文件")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	if !strings.Contains(out, "[INFO]") || !strings.Contains(out, "写入文件") {
+		t.Fatalf("日志未写入文件: %q", out)
+	}
+	if strings.Contains(out, "\033[") {
+		t.Errorf("文件中不应包含颜色控制序列: %q", out)
+	}
+}
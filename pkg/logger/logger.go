@@ -1,10 +1,14 @@
 package logger
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 )
@@ -20,10 +24,27 @@ const (
 	FATAL
 )
 
+// LogFormat 日志输出格式
+type LogFormat int
+
+const (
+	// FormatText 文本格式（默认）：[LEVEL] | 时间 | 调用位置 | 消息 | 字段
+	FormatText LogFormat = iota
+	// FormatJSON JSON格式：每行一个JSON对象，便于 Loki/ELK 等采集
+	FormatJSON
+)
+
 // Logger 结构化日志记录器
 type Logger struct {
-	level  LogLevel
-	logger *log.Logger
+	level          LogLevel
+	logger         *log.Logger
+	maxFieldLength int       // 单个字段值的最大长度，<=0 表示不截断
+	colorEnabled   bool      // 是否输出ANSI颜色（JSON格式下忽略）
+	format         LogFormat // 输出格式
+
+	// With 派生的记录器：级别、输出与格式使用 root 的设置，每条日志附带 fields
+	root   *Logger
+	fields map[string]interface{}
 }
 
 var (
@@ -43,6 +64,16 @@ var (
 		FATAL: "\033[35m", // 紫色
 	}
 	resetColor = "\033[0m"
+
+	// sensitiveKeys 字段名（不区分大小写）等于或以这些词结尾时对值进行脱敏，
+	// 如 token、access_token、apiKey；prompt_tokens、max_tokens 等用量字段不受影响
+	sensitiveKeys = []string{"apikey", "api_key", "token", "password", "secret"}
+)
+
+const (
+	// DefaultMaxFieldLength 默认的字段值最大长度
+	DefaultMaxFieldLength = 200
+	redactedValue         = "***"
 )
 
 func init() {
@@ -52,8 +83,51 @@ func init() {
 // NewLogger 创建新的日志记录器
 func NewLogger(level LogLevel) *Logger {
 	return &Logger{
-		level:  level,
-		logger: log.New(os.Stdout, "", 0),
+		level:          level,
+		logger:         log.New(os.Stdout, "", 0),
+		maxFieldLength: DefaultMaxFieldLength,
+		colorEnabled:   isTerminal(os.Stdout),
+	}
+}
+
+// isTerminal 判断输出目标是否为终端，非 *os.File 的 Writer 一律视为非终端
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// SetOutput 设置日志输出目标，并根据目标是否为终端自动开关颜色
+func SetOutput(w io.Writer) {
+	defaultLogger.logger.SetOutput(w)
+	defaultLogger.colorEnabled = isTerminal(w)
+}
+
+// SetColor 手动开启或关闭颜色输出，覆盖自动检测结果
+func SetColor(enabled bool) {
+	defaultLogger.colorEnabled = enabled
+}
+
+// SetFormat 设置日志输出格式
+func SetFormat(format LogFormat) {
+	defaultLogger.format = format
+}
+
+// ParseFormat 解析格式名称（text/json，不区分大小写），空字符串视为 text
+func ParseFormat(name string) (LogFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	default:
+		return FormatText, fmt.Errorf("未知的日志格式: %q", name)
 	}
 }
 
@@ -62,6 +136,37 @@ func SetLevel(level LogLevel) {
 	defaultLogger.level = level
 }
 
+// SetMaxFieldLength 设置字段值的最大长度，<=0 表示不截断
+func SetMaxFieldLength(n int) {
+	defaultLogger.maxFieldLength = n
+}
+
+// isSensitiveKey 判断字段名是否属于需要脱敏的敏感字段
+func isSensitiveKey(key string) bool {
+	k := strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.HasSuffix(k, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatFieldValue 格式化单个字段值：敏感字段脱敏，过长的值截断并追加省略号
+func (l *Logger) formatFieldValue(key string, value interface{}) string {
+	if isSensitiveKey(key) {
+		return redactedValue
+	}
+	v := fmt.Sprintf("%v", value)
+	if l.maxFieldLength > 0 {
+		runes := []rune(v)
+		if len(runes) > l.maxFieldLength {
+			v = string(runes[:l.maxFieldLength]) + "..."
+		}
+	}
+	return v
+}
+
 // formatMessage 格式化日志消息
 func (l *Logger) formatMessage(level LogLevel, msg string, fields map[string]interface{}) string {
 	// 获取调用者信息
@@ -76,15 +181,22 @@ func (l *Logger) formatMessage(level LogLevel, msg string, fields map[string]int
 		caller = fmt.Sprintf("%s:%d", file, line)
 	}
 
+	if l.format == FormatJSON {
+		return l.formatJSON(level, time.Now().Format(time.RFC3339Nano), caller, msg, fields)
+	}
+
 	// 时间戳
 	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
 
 	// 构建基础消息
 	levelName := levelNames[level]
-	color := levelColors[level]
 
 	var parts []string
-	parts = append(parts, fmt.Sprintf("%s[%s]%s", color, levelName, resetColor))
+	if l.colorEnabled {
+		parts = append(parts, fmt.Sprintf("%s[%s]%s", levelColors[level], levelName, resetColor))
+	} else {
+		parts = append(parts, fmt.Sprintf("[%s]", levelName))
+	}
 	parts = append(parts, timestamp)
 	parts = append(parts, caller)
 	parts = append(parts, msg)
@@ -93,7 +205,7 @@ func (l *Logger) formatMessage(level LogLevel, msg string, fields map[string]int
 	if len(fields) > 0 {
 		var fieldParts []string
 		for k, v := range fields {
-			fieldParts = append(fieldParts, fmt.Sprintf("%s=%v", k, v))
+			fieldParts = append(fieldParts, fmt.Sprintf("%s=%s", k, l.formatFieldValue(k, v)))
 		}
 		parts = append(parts, strings.Join(fieldParts, " "))
 	}
@@ -101,14 +213,82 @@ func (l *Logger) formatMessage(level LogLevel, msg string, fields map[string]int
 	return strings.Join(parts, " | ")
 }
 
+// jsonBaseKeys JSON格式中的固定字段，同名的自定义字段加 "field." 前缀以免覆盖
+var jsonBaseKeys = map[string]bool{"level": true, "timestamp": true, "caller": true, "msg": true}
+
+// formatJSON 将日志格式化为单行JSON对象，字段平铺到顶层
+func (l *Logger) formatJSON(level LogLevel, timestamp, caller, msg string, fields map[string]interface{}) string {
+	var buf bytes.Buffer
+	writePair := func(key string, value interface{}) {
+		if buf.Len() > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprintf("%v", value))
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+
+	writePair("level", levelNames[level])
+	writePair("timestamp", timestamp)
+	writePair("caller", caller)
+	writePair("msg", msg)
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name := k
+		if jsonBaseKeys[k] {
+			name = "field." + k
+		}
+		writePair(name, l.jsonFieldValue(k, fields[k]))
+	}
+
+	return "{" + buf.String() + "}"
+}
+
+// jsonFieldValue 返回JSON格式下的字段值：数值和布尔保留原类型，其余按文本格式脱敏、截断
+func (l *Logger) jsonFieldValue(key string, value interface{}) interface{} {
+	if isSensitiveKey(key) {
+		return redactedValue
+	}
+	switch value.(type) {
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return value
+	}
+	return l.formatFieldValue(key, value)
+}
+
 // log 内部日志方法
 func (l *Logger) log(level LogLevel, msg string, fields map[string]interface{}) {
-	if level < l.level {
+	root := l
+	if l.root != nil {
+		root = l.root
+	}
+	if level < root.level {
 		return
 	}
+	if len(l.fields) > 0 {
+		// 调用时传入的同名字段优先
+		merged := make(map[string]interface{}, len(l.fields)+len(fields))
+		for k, v := range l.fields {
+			merged[k] = v
+		}
+		for k, v := range fields {
+			merged[k] = v
+		}
+		fields = merged
+	}
 
-	message := l.formatMessage(level, msg, fields)
-	l.logger.Println(message)
+	message := root.formatMessage(level, msg, fields)
+	root.logger.Println(message)
 
 	// FATAL 级别退出程序
 	if level == FATAL {
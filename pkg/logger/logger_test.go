@@ -0,0 +1,134 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newTestLogger 创建输出到缓冲区、不带颜色的日志记录器
+func newTestLogger(buf *bytes.Buffer) *Logger {
+	l := NewLogger(DEBUG)
+	l.logger = log.New(buf, "", 0)
+	l.colorEnabled = false
+	return l
+}
+
+func TestLongFieldIsTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLogger(&buf)
+	l.maxFieldLength = 10
+
+	l.Info("prompt", map[string]interface{}{"prompt": strings.Repeat("长", 50)})
+
+	out := buf.String()
+	if !strings.Contains(out, "prompt="+strings.Repeat("长", 10)+"...") {
+		t.Fatalf("字段未按 10 个字符截断: %s", out)
+	}
+	if strings.Contains(out, strings.Repeat("长", 11)) {
+		t.Fatalf("截断后仍包含超长内容: %s", out)
+	}
+}
+
+func TestSensitiveFieldsAreRedacted(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLogger(&buf)
+
+	l.Info("request", map[string]interface{}{
+		"api_key":      "sk-secret-1",
+		"apiKey":       "sk-secret-2",
+		"access_token": "tok-secret",
+		"password":     "hunter2",
+		"clientSecret": "shh",
+	})
+
+	out := buf.String()
+	for _, secret := range []string{"sk-secret-1", "sk-secret-2", "tok-secret", "hunter2", "shh"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("敏感值 %q 未脱敏: %s", secret, out)
+		}
+	}
+	if strings.Count(out, redactedValue) != 5 {
+		t.Errorf("期望 5 个脱敏字段: %s", out)
+	}
+}
+
+func TestUsageFieldsAreNotRedacted(t *testing.T) {
+	for _, key := range []string{"prompt_tokens", "completion_tokens", "max_tokens", "token_count"} {
+		if isSensitiveKey(key) {
+			t.Errorf("%s 不应被视为敏感字段", key)
+		}
+	}
+	for _, key := range []string{"token", "TOKEN", "access_token", "refreshToken", "api_key", "db_password", "secret"} {
+		if !isSensitiveKey(key) {
+			t.Errorf("%s 应被视为敏感字段", key)
+		}
+	}
+}
+
+func TestJSONFormatRedactsAndKeepsNumbers(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLogger(&buf)
+	l.format = FormatJSON
+
+	l.Info("usage", map[string]interface{}{"prompt_tokens": 12, "token": "abc"})
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("输出不是合法 JSON: %v: %s", err, buf.String())
+	}
+	if entry["prompt_tokens"] != float64(12) {
+		t.Errorf("prompt_tokens = %v，期望 12", entry["prompt_tokens"])
+	}
+	if entry["token"] != redactedValue {
+		t.Errorf("token = %v，期望脱敏", entry["token"])
+	}
+}
+
+func TestColorsDisabledForNonTTYWriter(t *testing.T) {
+	var buf bytes.Buffer
+	SetColor(true)
+	SetOutput(&buf)
+	defer SetOutput(os.Stdout)
+
+	Info("hello")
+
+	if strings.Contains(buf.String(), "\033[") {
+		t.Errorf("写入非终端时不应包含颜色码: %q", buf.String())
+	}
+	if !strings.HasPrefix(buf.String(), "[INFO]") {
+		t.Errorf("日志应以级别开头: %q", buf.String())
+	}
+}
+
+func TestSetColorOverridesDetection(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	SetColor(true)
+	defer func() {
+		SetOutput(os.Stdout)
+	}()
+
+	Info("hello")
+
+	if !strings.Contains(buf.String(), levelColors[INFO]+"[INFO]"+resetColor) {
+		t.Errorf("手动开启颜色后应包含颜色码: %q", buf.String())
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	if isTerminal(&bytes.Buffer{}) {
+		t.Error("bytes.Buffer 不是终端")
+	}
+	f, err := os.CreateTemp(t.TempDir(), "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if isTerminal(f) {
+		t.Error("普通文件不是终端")
+	}
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Embedder 将文本转换为向量，返回的向量顺序与 texts 一致
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// ErrEmbeddingDimensionMismatch 新向量与已存储向量的维度不一致（通常是更换了嵌入模型）
+var ErrEmbeddingDimensionMismatch = errors.New("向量维度不一致")
+
+// SetEmbedder 设置嵌入模型，设置后新增条目保存真实向量，搜索按余弦相似度排序；nil 时恢复关键词匹配
+func (m *VectorMemory) SetEmbedder(embedder Embedder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.embedder = embedder
+}
+
+// embedOne 使用嵌入模型生成单条文本的向量，并检查与已存储向量的维度是否一致
+func (m *VectorMemory) embedOne(ctx context.Context, embedder Embedder, text string) ([]float32, error) {
+	vectors, err := embedder.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, fmt.Errorf("生成向量失败: %w", err)
+	}
+	if len(vectors) != 1 || len(vectors[0]) == 0 {
+		return nil, fmt.Errorf("生成向量失败: 嵌入模型返回了 %d 个向量", len(vectors))
+	}
+	m.mu.RLock()
+	stored := m.storedDimension()
+	m.mu.RUnlock()
+	if stored > 0 && stored != len(vectors[0]) {
+		return nil, fmt.Errorf("%w: 嵌入模型返回 %d 维，已存储的向量为 %d 维；更换嵌入模型后需删除 %s 重新生成向量",
+			ErrEmbeddingDimensionMismatch, len(vectors[0]), stored, m.vectorsFile)
+	}
+	return vectors[0], nil
+}
+
+// storedDimension 返回已存储真实向量的维度，没有时返回 0，调用方需持有 m.mu
+func (m *VectorMemory) storedDimension() int {
+	for _, entry := range m.vectors {
+		if hasEmbedding(entry.Vector) {
+			return len(entry.Vector)
+		}
+	}
+	return 0
+}
+
+// hasEmbedding 判断是否为嵌入模型生成的向量；未配置嵌入模型时保存的占位向量全为 0
+func hasEmbedding(vector []float32) bool {
+	for _, v := range vector {
+		if v != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// cosineSimilarity 计算两个等长向量的余弦相似度，任一向量为零向量时返回 0
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -6,25 +6,70 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 )
 
+// 消息角色
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleSystem    = "system"
+	RoleTool      = "tool"
+)
+
+// ValidateRole 校验消息角色是否属于已知角色
+func ValidateRole(role string) error {
+	switch role {
+	case RoleUser, RoleAssistant, RoleSystem, RoleTool:
+		return nil
+	default:
+		return fmt.Errorf("未知的消息角色: %q（可选 user/assistant/system/tool）", role)
+	}
+}
+
+// DefaultConversationIDPattern 默认的会话ID格式：字母、数字、下划线、短横线
+const DefaultConversationIDPattern = `^[A-Za-z0-9_-]{1,128}$`
+
+var defaultConversationIDRegexp = regexp.MustCompile(DefaultConversationIDPattern)
+
+// NormalizeConversationID 去除首尾空白后按 pattern 校验会话ID，pattern 为 nil 时使用默认格式
+// 会话ID会被用作文件名，因此无论 pattern 如何配置，含路径分隔符或 ".." 的ID一律拒绝
+func NormalizeConversationID(id string, pattern *regexp.Regexp) (string, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return "", fmt.Errorf("会话ID不能为空")
+	}
+	if pattern == nil {
+		pattern = defaultConversationIDRegexp
+	}
+	if strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") || !pattern.MatchString(id) {
+		return "", fmt.Errorf("会话ID格式无效: %q", id)
+	}
+	return id, nil
+}
+
 // Message 表示对话中的一条消息
 type Message struct {
-	Role      string    `json:"role"`      // 消息角色：user 或 assistant
+	Role      string    `json:"role"`      // 消息角色：user/assistant/system/tool
 	Content   string    `json:"content"`   // 消息内容
 	Timestamp time.Time `json:"timestamp"` // 消息时间戳
+	// Partial 回复在生成完成前中断（客户端断开或超时），内容不完整
+	Partial bool `json:"partial,omitempty"`
 }
 
 // Conversation 表示一个完整的对话
 type Conversation struct {
-	ID        string    `json:"id"`         // 对话ID
-	Title     string    `json:"title"`      // 对话标题
-	Messages  []Message `json:"messages"`   // 对话消息列表
-	CreatedAt time.Time `json:"created_at"` // 创建时间
-	UpdatedAt time.Time `json:"updated_at"` // 更新时间
+	ID           string    `json:"id"`                      // 对话ID
+	Title        string    `json:"title"`                   // 对话标题
+	SystemPrompt string    `json:"system_prompt,omitempty"` // 对话专属的系统提示词，为空时使用全局提示词
+	Archived     bool      `json:"archived,omitempty"`      // 已归档：默认不出现在会话列表中，仍可按ID读取，收到新消息时取消归档
+	Messages     []Message `json:"messages"`                // 对话消息列表
+	CreatedAt    time.Time `json:"created_at"`              // 创建时间
+	UpdatedAt    time.Time `json:"updated_at"`              // 更新时间
 }
 
 // MemoryManager 内存管理器接口
@@ -55,6 +100,18 @@ type MemoryManager interface {
 
 	// 从文件加载对话
 	LoadConversation(ctx context.Context, conversationID string) error
+
+	// 修改对话标题
+	SetConversationTitle(ctx context.Context, conversationID, title string) error
+
+	// 修改对话专属的系统提示词
+	SetConversationSystemPrompt(ctx context.Context, conversationID, prompt string) error
+
+	// 设置对话的归档状态
+	SetConversationArchived(ctx context.Context, conversationID string, archived bool) error
+
+	// 删除对话
+	DeleteConversation(ctx context.Context, conversationID string) error
 }
 
 // SimpleMemory 是一个简单的内存存储实现
@@ -62,15 +119,24 @@ type SimpleMemory struct {
 	data          map[string]interface{}
 	conversations map[string]*Conversation
 	dataDir       string
-	mu            sync.RWMutex
+	maxMessages   int            // 每个对话持久化的最大消息数，<=0 表示不限制
+	idPattern     *regexp.Regexp // 会话ID格式，nil 表示使用默认格式
+	// 与上一条消息角色、内容相同且间隔不超过该时长时跳过，<=0 表示不去重
+	dedupeWindow time.Duration
+	// 数据目录不可写时为 true，跳过所有文件写入
+	persistenceDisabled bool
+	mu                  sync.RWMutex
 }
 
+// DefaultDataDir 未指定数据目录时对话文件的保存位置
+const DefaultDataDir = "./data/conversations"
+
 // NewSimpleMemory 创建一个新的简单内存存储
 func NewSimpleMemory() *SimpleMemory {
 	return &SimpleMemory{
 		data:          make(map[string]interface{}),
 		conversations: make(map[string]*Conversation),
-		dataDir:       "./data/conversations", // 默认数据目录
+		dataDir:       DefaultDataDir,
 	}
 }
 
@@ -78,21 +144,75 @@ func NewSimpleMemory() *SimpleMemory {
 func NewSimpleMemoryWithDataDir(dataDir string) *SimpleMemory {
 	// 如果路径为空，使用默认路径
 	if dataDir == "" {
-		dataDir = "./data/conversations"
+		dataDir = DefaultDataDir
 	}
 
-	// 确保数据目录存在
-	if err := os.MkdirAll(dataDir, 0755); err != nil {
-		fmt.Printf("创建数据目录失败: %v\n", err)
+	// 确保数据目录存在且可写，否则降级为仅内存存储
+	persistenceDisabled := false
+	if err := checkWritableDir(dataDir); err != nil {
+		fmt.Printf("数据目录不可写，对话将仅保存在内存中: %v\n", err)
+		persistenceDisabled = true
 	} else {
 		fmt.Printf("成功创建或确认数据目录: %s\n", dataDir)
 	}
 
 	return &SimpleMemory{
-		data:          make(map[string]interface{}),
-		conversations: make(map[string]*Conversation),
-		dataDir:       dataDir,
+		data:                make(map[string]interface{}),
+		conversations:       make(map[string]*Conversation),
+		dataDir:             dataDir,
+		persistenceDisabled: persistenceDisabled,
+	}
+}
+
+// checkWritableDir 创建目录并写入探测文件，确认目录可写
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("创建数据目录失败: %w", err)
+	}
+	f, err := os.CreateTemp(dir, ".write_probe_*")
+	if err != nil {
+		return fmt.Errorf("数据目录不可写: %w", err)
 	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+// PersistenceEnabled 返回对话是否会持久化到数据目录
+// 数据目录不可写时返回 false，此时对话仅保存在内存中
+func (m *SimpleMemory) PersistenceEnabled() bool {
+	return !m.persistenceDisabled
+}
+
+// SetMaxMessages 设置每个对话持久化的最大消息数，超出部分追加到归档文件
+func (m *SimpleMemory) SetMaxMessages(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxMessages = n
+}
+
+// SetDedupeWindow 设置连续重复消息的去重时间窗口，<=0 表示不去重
+// 用于避免重试或断线重连导致同一条消息被连续追加两次
+func (m *SimpleMemory) SetDedupeWindow(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dedupeWindow = d
+}
+
+// SetConversationIDPattern 设置会话ID格式，nil 表示使用默认格式
+func (m *SimpleMemory) SetConversationIDPattern(pattern *regexp.Regexp) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.idPattern = pattern
+}
+
+// conversationFilePath 校验会话ID并返回其在数据目录下的文件路径（内部方法）
+func (m *SimpleMemory) conversationFilePath(conversationID, suffix string) (string, error) {
+	id, err := NormalizeConversationID(conversationID, m.idPattern)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(m.dataDir, id+suffix), nil
 }
 
 // Store 存储数据
@@ -152,6 +272,17 @@ func (m *SimpleMemory) Search(ctx context.Context, query string, limit int) ([]i
 	return results, nil
 }
 
+// 向量条目元数据的键
+const (
+	MetadataConversationID = "conversation_id"
+	MetadataRole           = "role"
+	MetadataTimestamp      = "timestamp"
+	MetadataType           = "type"
+)
+
+// EntryTypeFeedback 用户反馈类型的向量条目
+const EntryTypeFeedback = "feedback"
+
 // VectorEntry 表示向量数据库中的一个条目
 type VectorEntry struct {
 	ID        string                 `json:"id"`         // 条目ID
@@ -166,6 +297,7 @@ type VectorMemory struct {
 	SimpleMemory
 	vectors     map[string]*VectorEntry // 向量数据
 	vectorsFile string                  // 向量数据文件
+	embedder    Embedder                // 嵌入模型，nil 时使用占位向量与关键词匹配
 }
 
 // NewVectorMemory 创建一个新的向量内存存储
@@ -187,17 +319,26 @@ func NewVectorMemoryWithDataDir(dataDir string, vectorsFile string) *VectorMemor
 }
 
 // AddVector 添加向量
+// 配置了嵌入模型时调用模型生成向量（在加锁前完成，避免网络请求期间阻塞其他读写），否则保存占位向量
 func (m *VectorMemory) AddVector(ctx context.Context, content string, metadata map[string]interface{}) (*VectorEntry, error) {
+	m.mu.RLock()
+	embedder := m.embedder
+	m.mu.RUnlock()
+
+	vector := make([]float32, 10) // 未配置嵌入模型时的占位向量
+	if embedder != nil {
+		var err error
+		if vector, err = m.embedOne(ctx, embedder, content); err != nil {
+			return nil, err
+		}
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// 生成唯一ID
 	id := fmt.Sprintf("vec_%d", time.Now().UnixNano())
 
-	// 创建向量条目（这里简化实现，实际应调用嵌入模型生成向量）
-	// 在实际应用中，应该使用嵌入模型（如OpenAI的text-embedding-ada-002）生成向量
-	vector := make([]float32, 10) // 假设向量维度为10
-
 	entry := &VectorEntry{
 		ID:        id,
 		Content:   content,
@@ -217,21 +358,47 @@ func (m *VectorMemory) AddVector(ctx context.Context, content string, metadata m
 	return entry, nil
 }
 
+// AddConversationEntry 添加来自对话的向量条目，并附带对话ID、角色、时间和类型元数据
+func (m *VectorMemory) AddConversationEntry(ctx context.Context, conversationID, role, entryType, content string) (*VectorEntry, error) {
+	metadata := map[string]interface{}{
+		MetadataConversationID: conversationID,
+		MetadataRole:           role,
+		MetadataTimestamp:      time.Now().Format(time.RFC3339),
+		MetadataType:           entryType,
+	}
+	return m.AddVector(ctx, content, metadata)
+}
+
 // SearchVector 搜索向量
 func (m *VectorMemory) SearchVector(ctx context.Context, query string, limit int) ([]*VectorEntry, error) {
+	return m.SearchVectorFiltered(ctx, query, nil, limit)
+}
+
+// SearchVectorFiltered 搜索向量，仅返回元数据与 filter 全部匹配的条目
+// 元数据值按字符串比较，因为从文件加载后数值类型会变为 float64
+// 配置了嵌入模型时按与查询向量的余弦相似度从高到低返回，否则按关键词匹配
+func (m *VectorMemory) SearchVectorFiltered(ctx context.Context, query string, filter map[string]interface{}, limit int) ([]*VectorEntry, error) {
 	m.mu.RLock()
-	defer m.mu.RUnlock()
+	embedder := m.embedder
+	m.mu.RUnlock()
+	if embedder != nil {
+		queryVector, err := m.embedOne(ctx, embedder, query)
+		if err != nil {
+			return nil, err
+		}
+		return m.searchBySimilarity(queryVector, filter, limit), nil
+	}
 
-	// 简化实现：基于关键词匹配
-	// 在实际应用中，应该：
-	// 1. 使用嵌入模型将查询转换为向量
-	// 2. 计算查询向量与所有向量的余弦相似度
-	// 3. 返回相似度最高的结果
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
 	var results []*VectorEntry
 
 	// 遍历所有向量
 	for _, entry := range m.vectors {
+		if !matchMetadata(entry.Metadata, filter) {
+			continue
+		}
 		if strings.Contains(strings.ToLower(entry.Content), strings.ToLower(query)) {
 			results = append(results, entry)
 		}
@@ -245,6 +412,50 @@ func (m *VectorMemory) SearchVector(ctx context.Context, query string, limit int
 	return results, nil
 }
 
+// searchBySimilarity 按余弦相似度排序返回条目，跳过没有真实向量（配置嵌入模型前保存）的条目
+func (m *VectorMemory) searchBySimilarity(queryVector []float32, filter map[string]interface{}, limit int) []*VectorEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	type scored struct {
+		entry *VectorEntry
+		score float64
+	}
+	var candidates []scored
+	for _, entry := range m.vectors {
+		if !matchMetadata(entry.Metadata, filter) || len(entry.Vector) != len(queryVector) || !hasEmbedding(entry.Vector) {
+			continue
+		}
+		candidates = append(candidates, scored{entry: entry, score: cosineSimilarity(queryVector, entry.Vector)})
+	}
+	// 相似度相同时按创建时间排序，保证结果稳定
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].entry.CreatedAt.Before(candidates[j].entry.CreatedAt)
+	})
+	if limit > 0 && len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	results := make([]*VectorEntry, len(candidates))
+	for i, c := range candidates {
+		results[i] = c.entry
+	}
+	return results
+}
+
+// matchMetadata 检查元数据是否包含 filter 中的全部键值
+func matchMetadata(metadata, filter map[string]interface{}) bool {
+	for key, want := range filter {
+		got, ok := metadata[key]
+		if !ok || fmt.Sprint(got) != fmt.Sprint(want) {
+			return false
+		}
+	}
+	return true
+}
+
 // GetVector 获取向量
 func (m *VectorMemory) GetVector(ctx context.Context, id string) (*VectorEntry, error) {
 	m.mu.RLock()
@@ -279,6 +490,10 @@ func (m *VectorMemory) DeleteVector(ctx context.Context, id string) error {
 
 // 保存向量数据
 func (m *VectorMemory) saveVectors() error {
+	if m.persistenceDisabled {
+		return nil
+	}
+
 	// 确保目录存在
 	dir := filepath.Dir(m.vectorsFile)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -353,6 +568,10 @@ func (m *SimpleMemory) CreateConversation(ctx context.Context, title string) (*C
 
 // AddMessage 添加消息到对话
 func (m *SimpleMemory) AddMessage(ctx context.Context, conversationID string, message Message) error {
+	if err := ValidateRole(message.Role); err != nil {
+		return err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -366,9 +585,28 @@ func (m *SimpleMemory) AddMessage(ctx context.Context, conversationID string, me
 		message.Timestamp = time.Now()
 	}
 
-	// 添加消息
+	// 与紧邻的上一条消息重复时跳过
+	if m.dedupeWindow > 0 && len(conversation.Messages) > 0 {
+		last := conversation.Messages[len(conversation.Messages)-1]
+		if last.Role == message.Role && last.Content == message.Content &&
+			message.Timestamp.Sub(last.Timestamp) <= m.dedupeWindow {
+			return nil
+		}
+	}
+
+	// 添加消息，已归档的对话重新变为活跃
 	conversation.Messages = append(conversation.Messages, message)
 	conversation.UpdatedAt = time.Now()
+	conversation.Archived = false
+
+	// 超出上限时将最早的消息移入归档文件
+	if m.maxMessages > 0 && len(conversation.Messages) > m.maxMessages {
+		overflow := len(conversation.Messages) - m.maxMessages
+		if err := m.archiveMessages(conversation.ID, conversation.Messages[:overflow]); err != nil {
+			return fmt.Errorf("归档消息失败: %w", err)
+		}
+		conversation.Messages = append([]Message(nil), conversation.Messages[overflow:]...)
+	}
 
 	// 保存到文件
 	if err := m.saveConversationToFile(conversation); err != nil {
@@ -402,15 +640,14 @@ func (m *SimpleMemory) GetConversationHistory(ctx context.Context, limit int) ([
 		conversations = append(conversations, conv)
 	}
 
-	// 按更新时间排序（简化实现）
-	// 实际应用中应该使用更高效的排序算法
-	for i := 0; i < len(conversations); i++ {
-		for j := i + 1; j < len(conversations); j++ {
-			if conversations[i].UpdatedAt.Before(conversations[j].UpdatedAt) {
-				conversations[i], conversations[j] = conversations[j], conversations[i]
-			}
+	// 按更新时间倒序排序，时间相同时按ID排序，保证结果稳定
+	sort.Slice(conversations, func(i, j int) bool {
+		a, b := conversations[i], conversations[j]
+		if !a.UpdatedAt.Equal(b.UpdatedAt) {
+			return a.UpdatedAt.After(b.UpdatedAt)
 		}
-	}
+		return a.ID < b.ID
+	})
 
 	// 限制返回数量
 	if limit > 0 && limit < len(conversations) {
@@ -433,16 +670,93 @@ func (m *SimpleMemory) SaveConversation(ctx context.Context, conversationID stri
 	return m.saveConversationToFile(conversation)
 }
 
+// SetConversationTitle 修改对话标题并保存
+func (m *SimpleMemory) SetConversationTitle(ctx context.Context, conversationID, title string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conversation, exists := m.conversations[conversationID]
+	if !exists {
+		return fmt.Errorf("对话不存在: %s", conversationID)
+	}
+	conversation.Title = title
+	conversation.UpdatedAt = time.Now()
+
+	return m.saveConversationToFile(conversation)
+}
+
+// SetConversationSystemPrompt 修改对话专属的系统提示词并保存，空字符串表示恢复使用全局提示词
+func (m *SimpleMemory) SetConversationSystemPrompt(ctx context.Context, conversationID, prompt string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conversation, exists := m.conversations[conversationID]
+	if !exists {
+		return fmt.Errorf("对话不存在: %s", conversationID)
+	}
+	conversation.SystemPrompt = prompt
+	conversation.UpdatedAt = time.Now()
+
+	return m.saveConversationToFile(conversation)
+}
+
+// SetConversationArchived 设置对话的归档状态并保存
+// 归档不算作对话活动，不更新 UpdatedAt
+func (m *SimpleMemory) SetConversationArchived(ctx context.Context, conversationID string, archived bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conversation, exists := m.conversations[conversationID]
+	if !exists {
+		return fmt.Errorf("对话不存在: %s", conversationID)
+	}
+	conversation.Archived = archived
+
+	return m.saveConversationToFile(conversation)
+}
+
+// DeleteConversation 删除对话及其文件（包括归档文件）
+// 会话ID不合法时不做任何删除；文件不存在视为已删除，其他删除失败返回包装后的错误
+func (m *SimpleMemory) DeleteConversation(ctx context.Context, conversationID string) error {
+	// 先校验ID，避免拼接出数据目录之外的路径
+	if _, err := m.conversationFilePath(conversationID, ".json"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.conversations, conversationID)
+	if m.persistenceDisabled {
+		return nil
+	}
+
+	for _, suffix := range []string{".json", ".archive.jsonl"} {
+		filePath, _ := m.conversationFilePath(conversationID, suffix)
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("删除对话 %s 的文件失败: %w", conversationID, err)
+		}
+	}
+
+	return nil
+}
+
 // 保存对话到文件（内部方法）
 func (m *SimpleMemory) saveConversationToFile(conversation *Conversation) error {
+	// 构建文件路径
+	filePath, err := m.conversationFilePath(conversation.ID, ".json")
+	if err != nil {
+		return err
+	}
+	if m.persistenceDisabled {
+		return nil
+	}
+
 	// 确保数据目录存在
 	if err := os.MkdirAll(m.dataDir, 0755); err != nil {
 		return fmt.Errorf("创建数据目录失败: %w", err)
 	}
 
-	// 构建文件路径
-	filePath := filepath.Join(m.dataDir, fmt.Sprintf("%s.json", conversation.ID))
-
 	// 序列化对话
 	data, err := json.MarshalIndent(conversation, "", "  ")
 	if err != nil {
@@ -457,13 +771,46 @@ func (m *SimpleMemory) saveConversationToFile(conversation *Conversation) error
 	return nil
 }
 
+// archiveMessages 将消息以JSON Lines格式追加到对话的归档文件（内部方法）
+// 归档文件使用 .jsonl 扩展名，不会被 LoadAllConversations 当作对话加载
+func (m *SimpleMemory) archiveMessages(conversationID string, messages []Message) error {
+	filePath, err := m.conversationFilePath(conversationID, ".archive.jsonl")
+	if err != nil {
+		return err
+	}
+	if m.persistenceDisabled {
+		// 不可持久化时超出上限的消息直接丢弃
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dataDir, 0755); err != nil {
+		return fmt.Errorf("创建数据目录失败: %w", err)
+	}
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("打开归档文件失败: %w", err)
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	for _, msg := range messages {
+		if err := encoder.Encode(msg); err != nil {
+			return fmt.Errorf("写入归档文件失败: %w", err)
+		}
+	}
+	return nil
+}
+
 // LoadConversation 从文件加载对话
 func (m *SimpleMemory) LoadConversation(ctx context.Context, conversationID string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// 构建文件路径
-	filePath := filepath.Join(m.dataDir, fmt.Sprintf("%s.json", conversationID))
+	filePath, err := m.conversationFilePath(conversationID, ".json")
+	if err != nil {
+		return err
+	}
 
 	// 读取文件
 	data, err := os.ReadFile(filePath)
@@ -0,0 +1,443 @@
+package memory
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestMemory 创建使用临时数据目录的 SimpleMemory 及一个空对话
+func newTestMemory(t *testing.T) (*SimpleMemory, *Conversation) {
+	t.Helper()
+	m := NewSimpleMemoryWithDataDir(t.TempDir())
+	conv, err := m.CreateConversation(context.Background(), "测试")
+	if err != nil {
+		t.Fatalf("创建对话失败: %v", err)
+	}
+	return m, conv
+}
+
+// readPersisted 读取对话文件中持久化的消息
+func readPersisted(t *testing.T, m *SimpleMemory, id string) []Message {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(m.dataDir, id+".json"))
+	if err != nil {
+		t.Fatalf("读取对话文件失败: %v", err)
+	}
+	var conv Conversation
+	if err := json.Unmarshal(data, &conv); err != nil {
+		t.Fatalf("解析对话文件失败: %v", err)
+	}
+	return conv.Messages
+}
+
+func TestMaxMessagesArchivesOldest(t *testing.T) {
+	m, conv := newTestMemory(t)
+	m.SetMaxMessages(3)
+	ctx := context.Background()
+
+	for i := 1; i <= 5; i++ {
+		if err := m.AddMessage(ctx, conv.ID, Message{Role: RoleUser, Content: fmt.Sprintf("消息%d", i)}); err != nil {
+			t.Fatalf("添加消息失败: %v", err)
+		}
+	}
+
+	persisted := readPersisted(t, m, conv.ID)
+	if len(persisted) != 3 || persisted[0].Content != "消息3" || persisted[2].Content != "消息5" {
+		t.Fatalf("对话文件应只保留最近 3 条消息，实际 %+v", persisted)
+	}
+
+	f, err := os.Open(filepath.Join(m.dataDir, conv.ID+".archive.jsonl"))
+	if err != nil {
+		t.Fatalf("打开归档文件失败: %v", err)
+	}
+	defer f.Close()
+	var archived []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.Fatalf("解析归档行失败: %v", err)
+		}
+		archived = append(archived, msg.Content)
+	}
+	if len(archived) != 2 || archived[0] != "消息1" || archived[1] != "消息2" {
+		t.Errorf("归档文件应按顺序包含最早的 2 条消息，实际 %v", archived)
+	}
+
+	// 归档文件不会被当作对话加载
+	reloaded := NewSimpleMemoryWithDataDir(m.dataDir)
+	if err := reloaded.LoadAllConversations(ctx); err != nil {
+		t.Fatalf("重新加载失败: %v", err)
+	}
+	if len(reloaded.conversations) != 1 {
+		t.Errorf("重新加载后应只有 1 个对话，实际 %d", len(reloaded.conversations))
+	}
+}
+
+func TestMaxMessagesUnlimitedByDefault(t *testing.T) {
+	m, conv := newTestMemory(t)
+	for i := 0; i < 10; i++ {
+		m.AddMessage(context.Background(), conv.ID, Message{Role: RoleUser, Content: fmt.Sprintf("消息%d", i)})
+	}
+	if n := len(readPersisted(t, m, conv.ID)); n != 10 {
+		t.Errorf("未设置上限时应保留全部消息，实际 %d 条", n)
+	}
+	if _, err := os.Stat(filepath.Join(m.dataDir, conv.ID+".archive.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("未设置上限时不应创建归档文件: %v", err)
+	}
+}
+
+func TestAddMessageRejectsInvalidRole(t *testing.T) {
+	m, conv := newTestMemory(t)
+	ctx := context.Background()
+
+	for _, role := range []string{"", "User", "admin"} {
+		if err := m.AddMessage(ctx, conv.ID, Message{Role: role, Content: "内容"}); err == nil {
+			t.Errorf("角色 %q 应被拒绝", role)
+		}
+	}
+	for _, role := range []string{RoleUser, RoleAssistant, RoleSystem, RoleTool} {
+		if err := m.AddMessage(ctx, conv.ID, Message{Role: role, Content: "内容 " + role}); err != nil {
+			t.Errorf("角色 %q 应被接受: %v", role, err)
+		}
+	}
+	if n := len(readPersisted(t, m, conv.ID)); n != 4 {
+		t.Errorf("只应保存 4 条合法消息，实际 %d", n)
+	}
+}
+
+func TestNormalizeConversationIDRejectsUnsafeIDs(t *testing.T) {
+	for _, id := range []string{"../../etc/x", `..\x`, "a/b", "conv..1", "", "   ", "名字", strings.Repeat("a", 129)} {
+		if _, err := NormalizeConversationID(id, nil); err == nil {
+			t.Errorf("会话ID %q 应被拒绝", id)
+		}
+	}
+	if id, err := NormalizeConversationID("  conv_123-abc ", nil); err != nil || id != "conv_123-abc" {
+		t.Errorf("合法ID应去除首尾空白后通过: %q, %v", id, err)
+	}
+
+	// 自定义格式也不能放行路径穿越
+	permissive := regexp.MustCompile(`.*`)
+	if _, err := NormalizeConversationID("../../etc/x", permissive); err == nil {
+		t.Error("自定义格式下含 .. 的ID仍应被拒绝")
+	}
+}
+
+func TestLoadConversationRejectsPathTraversal(t *testing.T) {
+	root := t.TempDir()
+	dataDir := filepath.Join(root, "data")
+	m := NewSimpleMemoryWithDataDir(dataDir)
+	// 数据目录之外的文件不能通过会话ID读取
+	if err := os.WriteFile(filepath.Join(root, "x.json"), []byte(`{"id":"x"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.LoadConversation(context.Background(), "../x"); err == nil {
+		t.Error("加载 ../x 应被拒绝")
+	}
+	if len(m.conversations) != 0 {
+		t.Errorf("不应加载数据目录之外的对话: %v", m.conversations)
+	}
+}
+
+func TestUnwritableDataDirFallsBackToMemory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "readonly")
+	if err := os.WriteFile(file, nil, 0444); err != nil {
+		t.Fatal(err)
+	}
+	m := NewSimpleMemoryWithDataDir(filepath.Join(file, "conversations"))
+	if m.PersistenceEnabled() {
+		t.Fatal("数据目录不可写时应关闭持久化")
+	}
+
+	ctx := context.Background()
+	conv, err := m.CreateConversation(ctx, "测试")
+	if err != nil {
+		t.Fatalf("关闭持久化时创建对话不应失败: %v", err)
+	}
+	if err := m.AddMessage(ctx, conv.ID, Message{Role: RoleUser, Content: "你好"}); err != nil {
+		t.Fatalf("关闭持久化时添加消息不应失败: %v", err)
+	}
+	if len(m.conversations[conv.ID].Messages) != 1 {
+		t.Errorf("消息应保存在内存中")
+	}
+}
+
+func TestDedupeWindowSkipsConsecutiveDuplicates(t *testing.T) {
+	m, conv := newTestMemory(t)
+	m.SetDedupeWindow(time.Minute)
+	ctx := context.Background()
+	now := time.Now()
+
+	add := func(role, content string, at time.Time) {
+		t.Helper()
+		if err := m.AddMessage(ctx, conv.ID, Message{Role: role, Content: content, Timestamp: at}); err != nil {
+			t.Fatalf("添加消息失败: %v", err)
+		}
+	}
+	add(RoleUser, "你好", now)
+	add(RoleUser, "你好", now.Add(time.Second))                 // 重连重发，跳过
+	add(RoleAssistant, "你好", now.Add(2*time.Second))          // 角色不同，保留
+	add(RoleUser, "你好", now.Add(3*time.Second))               // 与上一条不同，保留
+	add(RoleUser, "你好", now.Add(3*time.Second+2*time.Minute)) // 超出窗口，保留
+
+	var got []string
+	for _, msg := range readPersisted(t, m, conv.ID) {
+		got = append(got, msg.Role+":"+msg.Content)
+	}
+	want := []string{"user:你好", "assistant:你好", "user:你好", "user:你好"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("保存的消息 = %v，期望 %v", got, want)
+	}
+}
+
+func TestDedupeDisabledByDefault(t *testing.T) {
+	m, conv := newTestMemory(t)
+	for i := 0; i < 2; i++ {
+		m.AddMessage(context.Background(), conv.ID, Message{Role: RoleUser, Content: "你好"})
+	}
+	if n := len(readPersisted(t, m, conv.ID)); n != 2 {
+		t.Errorf("未开启去重时应保存 2 条消息，实际 %d", n)
+	}
+}
+
+func TestGetConversationHistoryOrdersByUpdatedAtDescending(t *testing.T) {
+	m := NewSimpleMemoryWithDataDir(t.TempDir())
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	offsets := map[string]int{"c": 5, "a": 1, "e": 5, "b": 3, "d": 5, "f": 0}
+	for id, minutes := range offsets {
+		m.conversations[id] = &Conversation{ID: id, UpdatedAt: base.Add(time.Duration(minutes) * time.Minute)}
+	}
+
+	// 原先的两两交换排序，用作时间顺序的参照
+	legacy := make([]*Conversation, 0, len(m.conversations))
+	for _, conv := range m.conversations {
+		legacy = append(legacy, conv)
+	}
+	for i := 0; i < len(legacy); i++ {
+		for j := i + 1; j < len(legacy); j++ {
+			if legacy[i].UpdatedAt.Before(legacy[j].UpdatedAt) {
+				legacy[i], legacy[j] = legacy[j], legacy[i]
+			}
+		}
+	}
+
+	for run := 0; run < 5; run++ {
+		got, err := m.GetConversationHistory(context.Background(), 0)
+		if err != nil {
+			t.Fatalf("获取对话列表失败: %v", err)
+		}
+		var ids []string
+		for i, conv := range got {
+			ids = append(ids, conv.ID)
+			if !conv.UpdatedAt.Equal(legacy[i].UpdatedAt) {
+				t.Fatalf("第 %d 个对话的更新时间与原排序不一致: %s != %s", i, conv.UpdatedAt, legacy[i].UpdatedAt)
+			}
+		}
+		// 更新时间相同的对话按ID排序，多次调用结果一致
+		if strings.Join(ids, ",") != "c,d,e,b,a,f" {
+			t.Fatalf("排序结果 = %v，期望 c,d,e,b,a,f", ids)
+		}
+	}
+
+	got, _ := m.GetConversationHistory(context.Background(), 2)
+	if len(got) != 2 || got[0].ID != "c" || got[1].ID != "d" {
+		t.Errorf("limit=2 应返回最新的两个对话: %v", got)
+	}
+}
+
+func TestDeleteConversationRemovesFiles(t *testing.T) {
+	m, conv := newTestMemory(t)
+	ctx := context.Background()
+	if err := m.AddMessage(ctx, conv.ID, Message{Role: RoleUser, Content: "你好"}); err != nil {
+		t.Fatal(err)
+	}
+	jsonPath := filepath.Join(m.dataDir, conv.ID+".json")
+	archivePath := filepath.Join(m.dataDir, conv.ID+".archive.jsonl")
+	if err := os.WriteFile(archivePath, []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.DeleteConversation(ctx, conv.ID); err != nil {
+		t.Fatalf("删除对话失败: %v", err)
+	}
+	for _, p := range []string{jsonPath, archivePath} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s 应被删除: %v", filepath.Base(p), err)
+		}
+	}
+	if _, err := m.GetConversation(ctx, conv.ID); err == nil {
+		t.Error("删除后不应再能读取对话")
+	}
+	// 文件已不存在时再次删除不报错
+	if err := m.DeleteConversation(ctx, conv.ID); err != nil {
+		t.Errorf("重复删除应视为成功: %v", err)
+	}
+}
+
+func TestDeleteConversationRejectsTraversalAndWrapsErrors(t *testing.T) {
+	m, conv := newTestMemory(t)
+	ctx := context.Background()
+
+	outside := filepath.Join(filepath.Dir(m.dataDir), "victim.json")
+	if err := os.WriteFile(outside, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"../victim", "a/b", ""} {
+		if err := m.DeleteConversation(ctx, id); err == nil {
+			t.Errorf("%q: 不合法的会话ID应返回错误", id)
+		}
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("数据目录之外的文件不应被删除: %v", err)
+	}
+
+	// 同名路径是非空目录时删除失败，返回带会话ID的包装错误
+	jsonPath := filepath.Join(m.dataDir, conv.ID+".json")
+	os.Remove(jsonPath)
+	if err := os.MkdirAll(filepath.Join(jsonPath, "child"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := m.DeleteConversation(ctx, conv.ID)
+	if err == nil || !strings.Contains(err.Error(), conv.ID) || errors.Unwrap(err) == nil {
+		t.Errorf("删除失败时应返回包装后的错误，实际 %v", err)
+	}
+}
+
+func TestSetConversationTitlePersists(t *testing.T) {
+	m, conv := newTestMemory(t)
+	if err := m.SetConversationTitle(context.Background(), conv.ID, "关西旅行"); err != nil {
+		t.Fatalf("设置标题失败: %v", err)
+	}
+
+	reloaded := NewSimpleMemoryWithDataDir(m.dataDir)
+	if err := reloaded.LoadConversation(context.Background(), conv.ID); err != nil {
+		t.Fatalf("重新加载对话失败: %v", err)
+	}
+	got, err := reloaded.GetConversation(context.Background(), conv.ID)
+	if err != nil || got.Title != "关西旅行" {
+		t.Errorf("重新加载后的标题 = %v, %v，期望 关西旅行", got, err)
+	}
+
+	if err := m.SetConversationTitle(context.Background(), "missing", "x"); err == nil {
+		t.Error("对话不存在时应返回错误")
+	}
+}
+
+func TestSetConversationSystemPromptPersists(t *testing.T) {
+	m, conv := newTestMemory(t)
+	if err := m.SetConversationSystemPrompt(context.Background(), conv.ID, "你是英文翻译"); err != nil {
+		t.Fatalf("设置系统提示词失败: %v", err)
+	}
+
+	reloaded := NewSimpleMemoryWithDataDir(m.dataDir)
+	if err := reloaded.LoadConversation(context.Background(), conv.ID); err != nil {
+		t.Fatalf("重新加载对话失败: %v", err)
+	}
+	got, err := reloaded.GetConversation(context.Background(), conv.ID)
+	if err != nil || got.SystemPrompt != "你是英文翻译" {
+		t.Errorf("重新加载后的系统提示词 = %v, %v，期望 你是英文翻译", got, err)
+	}
+
+	if err := m.SetConversationSystemPrompt(context.Background(), "missing", "x"); err == nil {
+		t.Error("对话不存在时应返回错误")
+	}
+}
+
+func TestSetConversationArchivedPersistsUntilNewMessage(t *testing.T) {
+	ctx := context.Background()
+	m, conv := newTestMemory(t)
+	updatedAt := conv.UpdatedAt
+	if err := m.SetConversationArchived(ctx, conv.ID, true); err != nil {
+		t.Fatalf("归档失败: %v", err)
+	}
+	if !conv.UpdatedAt.Equal(updatedAt) {
+		t.Error("归档不应更新 UpdatedAt")
+	}
+
+	reloaded := NewSimpleMemoryWithDataDir(m.dataDir)
+	if err := reloaded.LoadConversation(ctx, conv.ID); err != nil {
+		t.Fatalf("重新加载对话失败: %v", err)
+	}
+	got, err := reloaded.GetConversation(ctx, conv.ID)
+	if err != nil || !got.Archived {
+		t.Fatalf("重新加载后应保持归档状态: %v, %v", got, err)
+	}
+
+	if err := reloaded.AddMessage(ctx, conv.ID, Message{Role: RoleUser, Content: "继续"}); err != nil {
+		t.Fatal(err)
+	}
+	if got.Archived {
+		t.Error("收到新消息后应取消归档")
+	}
+
+	if err := m.SetConversationArchived(ctx, "missing", true); err == nil {
+		t.Error("对话不存在时应返回错误")
+	}
+}
+
+// keywordEmbedder 测试用嵌入模型：向量的每一维表示文本是否包含对应关键词
+type keywordEmbedder struct {
+	keywords []string
+}
+
+func (e *keywordEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = make([]float32, len(e.keywords))
+		for j, kw := range e.keywords {
+			if strings.Contains(text, kw) {
+				vectors[i][j] = 1
+			}
+		}
+	}
+	return vectors, nil
+}
+
+func TestVectorMemoryEmbedderRanksBySimilarity(t *testing.T) {
+	dir := t.TempDir()
+	vectorsFile := filepath.Join(dir, "vectors", "vectors.json")
+	m := NewVectorMemoryWithDataDir(dir, vectorsFile)
+	m.SetEmbedder(&keywordEmbedder{keywords: []string{"天气", "北京", "股票"}})
+	ctx := context.Background()
+
+	for _, content := range []string{"今天股票大涨", "北京天气晴朗", "上海天气多云"} {
+		if _, err := m.AddVector(ctx, content, nil); err != nil {
+			t.Fatalf("AddVector 失败: %v", err)
+		}
+	}
+
+	// 查询与条目没有相同的子串，关键词匹配找不到，按向量相似度可以找到
+	results, err := m.SearchVector(ctx, "北京的天气怎么样", 2)
+	if err != nil {
+		t.Fatalf("SearchVector 失败: %v", err)
+	}
+	if len(results) != 2 || results[0].Content != "北京天气晴朗" || results[1].Content != "上海天气多云" {
+		var got []string
+		for _, r := range results {
+			got = append(got, r.Content)
+		}
+		t.Errorf("检索结果 = %v，期望按相似度返回 北京天气晴朗、上海天气多云", got)
+	}
+
+	// 更换维度不同的嵌入模型后，写入与检索都返回明确的维度错误
+	reloaded := NewVectorMemoryWithDataDir(dir, vectorsFile)
+	if err := reloaded.LoadVectors(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reloaded.SetEmbedder(&keywordEmbedder{keywords: []string{"天气", "北京", "股票", "新闻"}})
+	if _, err := reloaded.AddVector(ctx, "新闻", nil); !errors.Is(err, ErrEmbeddingDimensionMismatch) || !strings.Contains(err.Error(), "3") {
+		t.Errorf("AddVector 错误 = %v，期望包含已存储维度的 ErrEmbeddingDimensionMismatch", err)
+	}
+	if _, err := reloaded.SearchVector(ctx, "天气", 1); !errors.Is(err, ErrEmbeddingDimensionMismatch) {
+		t.Errorf("SearchVector 错误 = %v，期望 ErrEmbeddingDimensionMismatch", err)
+	}
+}
@@ -0,0 +1,95 @@
+package tokenizer
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer 统计文本的 token 数，用于上下文预算与用量展示
+// 内置实现均为估算器，不加载模型词表；需要精确计数时可注入基于真实编码器的实现
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// ForModel 根据模型名选择估算器：OpenAI 模型使用 OpenAIEstimator，其余使用 HeuristicEstimator
+func ForModel(model string) Tokenizer {
+	m := strings.ToLower(model)
+	for _, prefix := range []string{"gpt-", "o1", "o3", "o4", "text-embedding-"} {
+		if strings.HasPrefix(m, prefix) {
+			return OpenAIEstimator{}
+		}
+	}
+	return HeuristicEstimator{}
+}
+
+// HeuristicEstimator 默认的启发式估算：非CJK字符约 4 个字节一个 token，CJK 字符每字一个 token
+type HeuristicEstimator struct{}
+
+// CountTokens 估算 token 数
+func (HeuristicEstimator) CountTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	cjk, other := 0, 0
+	for _, r := range text {
+		if isCJK(r) {
+			cjk++
+		} else {
+			other += utf8.RuneLen(r)
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+// pretokenizePattern 参照 cl100k_base 的预切分规则（Go 正则不支持前瞻，空白处理略有简化）
+var pretokenizePattern = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\pL\pN]?\pL+|\pN{1,3}| ?[^\s\pL\pN]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+// OpenAIEstimator 面向 OpenAI 模型的 token 数估算器，并非真实的 BPE 编码
+// 先按 cl100k_base 的规则预切分，再按片段类型估算合并后的 token 数；未内置词表，
+// 常见英文文本与 tiktoken 的结果基本一致，长单词、生僻字等情况可能有偏差
+type OpenAIEstimator struct{}
+
+// CountTokens 估算 token 数
+func (OpenAIEstimator) CountTokens(text string) int {
+	total := 0
+	for _, piece := range pretokenizePattern.FindAllString(text, -1) {
+		total += pieceTokens(piece)
+	}
+	return total
+}
+
+// pieceTokens 估算单个预切分片段的 token 数
+func pieceTokens(piece string) int {
+	letters, cjk, other := 0, 0, 0
+	for _, r := range piece {
+		switch {
+		case isCJK(r):
+			cjk++
+		case unicode.IsLetter(r):
+			letters++
+		default:
+			other++
+		}
+	}
+	if cjk > 0 {
+		// 常用汉字在 cl100k 中多为 1 个 token，生僻字会被拆成 2~3 个字节级 token
+		return cjk + (letters+other+3)/4
+	}
+	if letters > 0 {
+		// 常见英文单词（含前导空格）通常是 1 个 token，长单词按约 6 个字母一个 token 拆分
+		return (letters + 5) / 6
+	}
+	if strings.TrimSpace(piece) == "" {
+		return 1
+	}
+	// 数字（最多 3 位一组）与标点串
+	return (other + 2) / 3
+}
+
+// isCJK 判断是否为中日韩字符
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
@@ -0,0 +1,73 @@
+package tokenizer
+
+import "testing"
+
+// 参考值为 tiktoken cl100k_base 编码的 token 数
+var cl100kSamples = []struct {
+	text  string
+	known int
+}{
+	{"hello world", 2},
+	{"Hello, world!", 4},
+	{"tiktoken is great!", 6},
+	{"The quick brown fox jumps over the lazy dog.", 10},
+	{"1234567", 3},
+	{"It's a beautiful day, isn't it?", 10},
+}
+
+// withinTolerance 判断估算值与参考值的偏差是否在 25% 以内（至少允许相差 1）
+func withinTolerance(got, known int) bool {
+	diff := got - known
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= 1 || diff*4 <= known
+}
+
+func TestOpenAIEstimatorMatchesKnownCounts(t *testing.T) {
+	var est OpenAIEstimator
+	for _, c := range cl100kSamples {
+		if got := est.CountTokens(c.text); !withinTolerance(got, c.known) {
+			t.Errorf("%q: 估算 %d，参考值 %d", c.text, got, c.known)
+		}
+	}
+	if got := est.CountTokens(""); got != 0 {
+		t.Errorf("空字符串应为 0，实际 %d", got)
+	}
+}
+
+func TestHeuristicEstimator(t *testing.T) {
+	var est HeuristicEstimator
+	cases := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"你好世界", 4},
+		{"你好 abc", 3},
+	}
+	for _, c := range cases {
+		if got := est.CountTokens(c.text); got != c.want {
+			t.Errorf("%q: 估算 %d，期望 %d", c.text, got, c.want)
+		}
+	}
+}
+
+func TestForModelSelectsEstimator(t *testing.T) {
+	cases := map[string]Tokenizer{
+		"gpt-4o-mini":            OpenAIEstimator{},
+		"GPT-3.5-turbo":          OpenAIEstimator{},
+		"o1-mini":                OpenAIEstimator{},
+		"text-embedding-3-small": OpenAIEstimator{},
+		"llama3.1":               HeuristicEstimator{},
+		"gpt-oss:20b":            OpenAIEstimator{},
+		"":                       HeuristicEstimator{},
+	}
+	for model, want := range cases {
+		if got := ForModel(model); got != want {
+			t.Errorf("%q: 选择了 %T，期望 %T", model, got, want)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxExpressionLength 表达式的最大字符数
+	MaxExpressionLength = 1000
+	// maxExpressionDepth 括号与一元运算符的最大嵌套层数，防止递归过深
+	maxExpressionDepth = 100
+)
+
+var (
+	// ErrDivisionByZero 除数为零
+	ErrDivisionByZero = errors.New("除数不能为零")
+	// ErrInvalidExpression 表达式格式错误
+	ErrInvalidExpression = errors.New("表达式格式错误")
+)
+
+// CalculatorTool 计算器：计算中缀算术表达式，或对两个操作数执行单个运算
+type CalculatorTool struct{}
+
+// NewCalculatorTool 创建计算器工具
+func NewCalculatorTool() *CalculatorTool {
+	return &CalculatorTool{}
+}
+
+// Name 返回工具名称
+func (t *CalculatorTool) Name() string {
+	return "calculator"
+}
+
+// Description 返回工具描述
+func (t *CalculatorTool) Description() string {
+	return "计算器：通过 expression 计算算术表达式（支持 + - * / 、括号与运算优先级），或通过 operation/a/b 执行单个运算"
+}
+
+// Parameters 返回工具参数定义
+// expression 与 operation/a/b 二选一，因此均不标记为必填，由 Execute 校验
+func (t *CalculatorTool) Parameters() map[string]ParamSpec {
+	return map[string]ParamSpec{
+		"expression": {Type: ParamTypeString, Description: "算术表达式，如 (12+5)*3/2"},
+		"operation":  {Type: ParamTypeString, Description: "未提供 expression 时使用：add、subtract、multiply 或 divide"},
+		"a":          {Type: ParamTypeNumber, Description: "第一个操作数"},
+		"b":          {Type: ParamTypeNumber, Description: "第二个操作数"},
+	}
+}
+
+// Execute 执行计算，返回数值结果
+// 参数示例:
+//   - 表达式: {"expression":"(12+5)*3/2"}
+//   - 单个运算: {"operation":"add","a":10,"b":5}
+func (t *CalculatorTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	if expr, ok := params["expression"].(string); ok && strings.TrimSpace(expr) != "" {
+		return EvaluateExpression(expr)
+	}
+
+	operation, ok := params["operation"].(string)
+	if !ok {
+		return nil, fmt.Errorf("缺少 expression 或 operation 参数")
+	}
+	a, ok := numberValue(params["a"])
+	if !ok {
+		return nil, fmt.Errorf("缺少操作数 a")
+	}
+	b, ok := numberValue(params["b"])
+	if !ok {
+		return nil, fmt.Errorf("缺少操作数 b")
+	}
+
+	switch operation {
+	case "add":
+		return a + b, nil
+	case "subtract":
+		return a - b, nil
+	case "multiply":
+		return a * b, nil
+	case "divide":
+		if b == 0 {
+			return nil, ErrDivisionByZero
+		}
+		return a / b, nil
+	default:
+		return nil, fmt.Errorf("不支持的运算: %s", operation)
+	}
+}
+
+// EvaluateExpression 计算中缀算术表达式
+// 支持 + - * /（也接受 − × ÷）、括号、一元正负号与小数，乘除优先于加减，同级运算从左到右
+func EvaluateExpression(expr string) (float64, error) {
+	if len([]rune(expr)) > MaxExpressionLength {
+		return 0, fmt.Errorf("%w: 表达式超过 %d 个字符", ErrInvalidExpression, MaxExpressionLength)
+	}
+	p := &exprParser{input: []rune(expr)}
+	value, err := p.parseSum()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return 0, p.errorf("多余的字符 %q", string(p.input[p.pos]))
+	}
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return 0, fmt.Errorf("%w: 计算结果超出数值范围", ErrInvalidExpression)
+	}
+	return value, nil
+}
+
+// exprParser 递归下降解析器，边解析边求值
+//
+//	sum     = product { ("+" | "-") product }
+//	product = unary { ("*" | "/") unary }
+//	unary   = ("+" | "-") unary | primary
+//	primary = number | "(" sum ")"
+type exprParser struct {
+	input []rune
+	pos   int
+	depth int
+}
+
+// errorf 返回带位置信息（从 1 开始的字符位置）的格式错误
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: 第 %d 个字符处%s", ErrInvalidExpression, p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+// peekOperator 跳过空白后返回下一个运算符（统一为 ASCII 形式），不是运算符时返回 0
+func (p *exprParser) peekOperator() rune {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	switch r := p.input[p.pos]; r {
+	case '+', '-', '*', '/':
+		return r
+	case '−':
+		return '-'
+	case '×':
+		return '*'
+	case '÷':
+		return '/'
+	}
+	return 0
+}
+
+func (p *exprParser) parseSum() (float64, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peekOperator()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			left += right
+		} else {
+			left -= right
+		}
+	}
+}
+
+func (p *exprParser) parseProduct() (float64, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peekOperator()
+		if op != '*' && op != '/' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+		if op == '*' {
+			left *= right
+		} else {
+			if right == 0 {
+				return 0, ErrDivisionByZero
+			}
+			left /= right
+		}
+	}
+}
+
+func (p *exprParser) parseUnary() (float64, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxExpressionDepth {
+		return 0, p.errorf("嵌套超过 %d 层", maxExpressionDepth)
+	}
+
+	switch p.peekOperator() {
+	case '+':
+		p.pos++
+		return p.parseUnary()
+	case '-':
+		p.pos++
+		v, err := p.parseUnary()
+		return -v, err
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (float64, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return 0, p.errorf("缺少操作数")
+	}
+
+	if p.input[p.pos] == '(' || p.input[p.pos] == '（' {
+		p.pos++
+		v, err := p.parseSum()
+		if err != nil {
+			return 0, err
+		}
+		p.skipSpaces()
+		if p.pos >= len(p.input) || (p.input[p.pos] != ')' && p.input[p.pos] != '）') {
+			return 0, p.errorf("缺少右括号")
+		}
+		p.pos++
+		return v, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && (p.input[p.pos] >= '0' && p.input[p.pos] <= '9' || p.input[p.pos] == '.') {
+		p.pos++
+	}
+	if start == p.pos {
+		return 0, p.errorf("应为数字或左括号，实际为 %q", string(p.input[p.pos]))
+	}
+	literal := string(p.input[start:p.pos])
+	v, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		p.pos = start
+		return 0, p.errorf("无效的数字 %q", literal)
+	}
+	return v, nil
+}
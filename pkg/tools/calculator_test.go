@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateExpression(t *testing.T) {
+	cases := []struct {
+		expr string
+		want float64
+	}{
+		{"(12+5)*3/2", 25.5},
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3}, // 同级运算从左到右
+		{"64 / 4 / 2", 8},
+		{"-3 + 5", 2},
+		{"2 * -(1 + 1)", -4},
+		{"--2", 2},
+		{"0.5 + .25", 0.75},
+		{"7 × 8 ÷ 2 − 1", 27},
+		{"（1+1）*2", 4},
+		{"  42  ", 42},
+	}
+	for _, c := range cases {
+		got, err := EvaluateExpression(c.expr)
+		if err != nil {
+			t.Errorf("%q: 计算失败: %v", c.expr, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%q = %v，期望 %v", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestEvaluateExpressionErrors(t *testing.T) {
+	if _, err := EvaluateExpression("1 / (2 - 2)"); !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("除以零应返回 ErrDivisionByZero，实际 %v", err)
+	}
+
+	for _, expr := range []string{
+		"",
+		"1 +",
+		"(1 + 2",
+		"1 + 2)",
+		"2 ** 3",
+		"1..2",
+		"abc",
+		"3 4",
+		strings.Repeat("(", 200) + "1" + strings.Repeat(")", 200),
+		strings.Repeat("1+", MaxExpressionLength) + "1",
+	} {
+		if _, err := EvaluateExpression(expr); !errors.Is(err, ErrInvalidExpression) {
+			t.Errorf("%.20q: 应返回 ErrInvalidExpression，实际 %v", expr, err)
+		}
+	}
+
+	_, err := EvaluateExpression("1 + * 2")
+	if err == nil || !strings.Contains(err.Error(), "第 5 个字符") {
+		t.Errorf("错误信息应包含出错位置: %v", err)
+	}
+}
+
+func TestCalculatorToolModes(t *testing.T) {
+	tool := NewCalculatorTool()
+	ctx := context.Background()
+
+	got, err := tool.Execute(ctx, map[string]interface{}{"expression": "(12+5)*3/2"})
+	if err != nil || got != 25.5 {
+		t.Errorf("表达式模式 = %v, %v，期望 25.5", got, err)
+	}
+	// 兼容原有的单个运算模式
+	got, err = tool.Execute(ctx, map[string]interface{}{"operation": "multiply", "a": 7.0, "b": 8.0})
+	if err != nil || got != 56.0 {
+		t.Errorf("运算模式 = %v, %v，期望 56", got, err)
+	}
+	if _, err := tool.Execute(ctx, map[string]interface{}{"operation": "divide", "a": 1.0, "b": 0.0}); !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("除以零应返回 ErrDivisionByZero，实际 %v", err)
+	}
+	if _, err := tool.Execute(ctx, map[string]interface{}{"operation": "pow", "a": 1.0, "b": 2.0}); err == nil {
+		t.Error("不支持的运算应返回错误")
+	}
+	if _, err := tool.Execute(ctx, map[string]interface{}{}); err == nil {
+		t.Error("缺少参数时应返回错误")
+	}
+
+	// 经 ToolManager 执行时，两种模式都能通过参数校验
+	tm := NewToolManager()
+	tm.RegisterTool(tool.Name(), tool)
+	if got, err := tm.ExecuteTool(ctx, "calculator", map[string]interface{}{"expression": "1+1"}); err != nil || got != 2.0 {
+		t.Errorf("ExecuteTool 表达式模式 = %v, %v", got, err)
+	}
+}
@@ -0,0 +1,220 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// CassetteEntry 表示一次被录制的工具调用
+type CassetteEntry struct {
+	Tool   string                 `json:"tool"`
+	Params map[string]interface{} `json:"params"`
+	Result json.RawMessage        `json:"result,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// Cassette 录制并回放工具调用结果，用于可复现的端到端测试
+// 首次调用时执行真实工具并写入文件，之后按 工具名+参数 匹配直接回放
+type Cassette struct {
+	path    string
+	entries map[string]*CassetteEntry
+	mu      sync.Mutex
+}
+
+// NewCassette 创建录制文件，文件存在时加载已有记录
+func NewCassette(path string) (*Cassette, error) {
+	c := &Cassette{
+		path:    path,
+		entries: make(map[string]*CassetteEntry),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, fmt.Errorf("读取录制文件失败: %w", err)
+	}
+
+	var entries []*CassetteEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("解析录制文件失败: %w", err)
+	}
+	for _, e := range entries {
+		key, err := cassetteKey(e.Tool, e.Params)
+		if err != nil {
+			return nil, err
+		}
+		c.entries[key] = e
+	}
+	return c, nil
+}
+
+// WrapWithCassette 返回一个新的工具管理器，其中每个工具的调用都经过录制/回放
+func WrapWithCassette(tm *ToolManager, c *Cassette) *ToolManager {
+	wrapped := NewToolManager()
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	wrapped.maxConcurrency = tm.maxConcurrency
+	for name, tool := range tm.tools {
+		wrapped.tools[name] = &cassetteTool{inner: tool, cassette: c}
+	}
+	return wrapped
+}
+
+// cassetteKey 生成匹配用的键（json.Marshal 对 map 键排序，结果稳定）
+func cassetteKey(tool string, params map[string]interface{}) (string, error) {
+	p, err := json.Marshal(params)
+	if err != nil {
+		return "", fmt.Errorf("序列化工具参数失败: %w", err)
+	}
+	return tool + ":" + string(p), nil
+}
+
+// lookup 查找已录制的调用
+func (c *Cassette) lookup(key string) (*CassetteEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	return e, ok
+}
+
+// record 记录一次调用并写回文件
+func (c *Cassette) record(key string, entry *CassetteEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry
+
+	// 按键排序输出，重新录制时文件内容稳定，便于提交与比对
+	keys := make([]string, 0, len(c.entries))
+	for k := range c.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	entries := make([]*CassetteEntry, 0, len(keys))
+	for _, k := range keys {
+		entries = append(entries, c.entries[k])
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化录制数据失败: %w", err)
+	}
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+
+	// 先写临时文件再重命名，写入中途失败不会截断已有的录制文件
+	tmp, err := os.CreateTemp(dir, ".cassette-*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入录制文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入录制文件失败: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("设置录制文件权限失败: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("写入录制文件失败: %w", err)
+	}
+	return nil
+}
+
+// cassetteTool 包装真实工具，实现录制/回放
+type cassetteTool struct {
+	inner    Tool
+	cassette *Cassette
+}
+
+func (t *cassetteTool) Name() string {
+	return t.inner.Name()
+}
+
+func (t *cassetteTool) Description() string {
+	return t.inner.Description()
+}
+
+// Parameters 沿用被包装工具的参数定义
+func (t *cassetteTool) Parameters() map[string]ParamSpec {
+	return toolParameters(t.inner)
+}
+
+// Sequential 沿用被包装工具的顺序执行标记
+func (t *cassetteTool) Sequential() bool {
+	return isSequential(t.inner)
+}
+
+// ParamDefaults 沿用被包装工具声明的参数默认值
+func (t *cassetteTool) ParamDefaults() []ParamDefault {
+	if dt, ok := t.inner.(DefaultingTool); ok {
+		return dt.ParamDefaults()
+	}
+	return nil
+}
+
+// Snippets 转发给支持片段检索的被包装工具（如知识库），保证自动注入上下文在录制模式下仍然可用
+func (t *cassetteTool) Snippets(query string, limit int) ([]Snippet, error) {
+	searcher, ok := t.inner.(interface {
+		Snippets(query string, limit int) ([]Snippet, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("工具 %s 不支持片段检索", t.inner.Name())
+	}
+	return searcher.Snippets(query, limit)
+}
+
+// Execute 命中录制则回放，否则执行真实工具并录制结果
+func (t *cassetteTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	key, err := cassetteKey(t.inner.Name(), params)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry, ok := t.cassette.lookup(key); ok {
+		return replayEntry(entry)
+	}
+
+	result, execErr := t.inner.Execute(ctx, params)
+	entry := &CassetteEntry{Tool: t.inner.Name(), Params: params}
+	if execErr != nil {
+		entry.Error = execErr.Error()
+	} else {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			return nil, fmt.Errorf("序列化工具结果失败: %w", err)
+		}
+		entry.Result = raw
+	}
+	if err := t.cassette.record(key, entry); err != nil {
+		return nil, err
+	}
+	return result, execErr
+}
+
+// replayEntry 还原录制的结果；搜索类结果优先还原为 []map[string]string 以保持与真实调用一致
+func replayEntry(entry *CassetteEntry) (interface{}, error) {
+	if entry.Error != "" {
+		return nil, errors.New(entry.Error)
+	}
+	var rows []map[string]string
+	if err := json.Unmarshal(entry.Result, &rows); err == nil {
+		return rows, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(entry.Result, &v); err != nil {
+		return nil, fmt.Errorf("解析录制结果失败: %w", err)
+	}
+	return v, nil
+}
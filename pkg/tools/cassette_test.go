@@ -0,0 +1,148 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCassetteRecordsThenReplaysWebSearch(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		json.NewEncoder(w).Encode(SearchResponse{Results: []SearchResult{
+			{Title: "Go 并发", Link: "https://go.dev/blog", Description: "goroutine 与 channel"},
+		}})
+	}))
+	defer srv.Close()
+
+	newManager := func() *ToolManager {
+		search := NewWebSearchToolWithEngine(SearchAPI, "key")
+		search.searchAPIURL = srv.URL
+		tm := NewToolManager()
+		tm.RegisterTool(search.Name(), search)
+		return tm
+	}
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	params := map[string]interface{}{"query": "go 并发"}
+
+	// 第一次运行：执行真实搜索并录制
+	recorder, err := NewCassette(path)
+	if err != nil {
+		t.Fatalf("创建录制文件失败: %v", err)
+	}
+	recorded, err := WrapWithCassette(newManager(), recorder).ExecuteTool(context.Background(), "web_search", params)
+	if err != nil {
+		t.Fatalf("录制时执行失败: %v", err)
+	}
+	if hits != 1 {
+		t.Fatalf("录制时应请求一次搜索接口，实际 %d 次", hits)
+	}
+
+	// 第二次运行：从文件加载并回放，不再访问搜索接口
+	player, err := NewCassette(path)
+	if err != nil {
+		t.Fatalf("加载录制文件失败: %v", err)
+	}
+	replayed, err := WrapWithCassette(newManager(), player).ExecuteTool(context.Background(), "web_search", params)
+	if err != nil {
+		t.Fatalf("回放失败: %v", err)
+	}
+	if hits != 1 {
+		t.Errorf("回放时不应访问搜索接口，实际共 %d 次", hits)
+	}
+	if !reflect.DeepEqual(recorded, replayed) {
+		t.Errorf("回放结果与录制结果不一致:\n录制: %#v\n回放: %#v", recorded, replayed)
+	}
+	if _, ok := replayed.([]map[string]string); !ok {
+		t.Errorf("回放的搜索结果类型应为 []map[string]string，实际 %T", replayed)
+	}
+
+	// 参数不同的调用不命中录制，执行真实工具
+	if _, err := WrapWithCassette(newManager(), player).ExecuteTool(context.Background(), "web_search", map[string]interface{}{"query": "rust"}); err != nil {
+		t.Fatalf("未命中录制时执行失败: %v", err)
+	}
+	if hits != 2 {
+		t.Errorf("未命中录制时应访问搜索接口，实际共 %d 次", hits)
+	}
+}
+
+func TestCassetteReplaysRecordedErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	params := map[string]interface{}{"operation": "validate", "input": "{}"}
+	newManager := func(maxInputBytes int) *ToolManager {
+		tm := NewToolManager()
+		tm.RegisterTool("json", NewJSONTool(maxInputBytes))
+		return tm
+	}
+
+	// 录制时输入超过上限，工具返回错误
+	recorder, _ := NewCassette(path)
+	_, recordedErr := WrapWithCassette(newManager(1), recorder).ExecuteTool(context.Background(), "json", params)
+	if recordedErr == nil {
+		t.Fatal("输入超过上限时应返回错误")
+	}
+
+	// 回放时即使真实工具可以成功，也返回录制的错误
+	player, _ := NewCassette(path)
+	_, replayedErr := WrapWithCassette(newManager(0), player).ExecuteTool(context.Background(), "json", params)
+	if replayedErr == nil || replayedErr.Error() != recordedErr.Error() {
+		t.Errorf("回放错误 = %v，期望 %v", replayedErr, recordedErr)
+	}
+}
+
+func TestCassetteKeepsToolParamDefaults(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "policy.md"), []byte("年假天数为每年十五天\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tm := NewToolManager()
+	tm.RegisterTool("knowledge_base", NewKnowledgeBaseTool(dir))
+	c, err := NewCassette(filepath.Join(t.TempDir(), "cassette.json"))
+	if err != nil {
+		t.Fatalf("创建录制文件失败: %v", err)
+	}
+
+	// 只提供 query 时应由知识库声明的默认值补全 operation=search
+	result, err := WrapWithCassette(tm, c).ExecuteTool(context.Background(), "knowledge_base", map[string]interface{}{"query": "年假"})
+	if err != nil {
+		t.Fatalf("录制模式下应补全默认参数: %v", err)
+	}
+	if result == nil {
+		t.Error("搜索结果不应为空")
+	}
+}
+
+func TestCassetteWritesEntriesInStableOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	tm := NewToolManager()
+	tm.RegisterTool("json", NewJSONTool(0))
+
+	record := func(inputs ...string) []byte {
+		os.Remove(path)
+		c, err := NewCassette(path)
+		if err != nil {
+			t.Fatalf("创建录制文件失败: %v", err)
+		}
+		wrapped := WrapWithCassette(tm, c)
+		for _, in := range inputs {
+			wrapped.ExecuteTool(context.Background(), "json", map[string]interface{}{"operation": "validate", "input": in})
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("读取录制文件失败: %v", err)
+		}
+		return data
+	}
+
+	first := record(`{"a":1}`, `[1]`, `"x"`, `{}`, `2`)
+	second := record(`2`, `{}`, `"x"`, `[1]`, `{"a":1}`)
+	if string(first) != string(second) {
+		t.Errorf("录制顺序不同时文件内容应一致:\n%s\n---\n%s", first, second)
+	}
+}
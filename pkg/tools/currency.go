@@ -0,0 +1,205 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCurrencyAPIURL 默认的汇率接口（Frankfurter，基于欧洲央行数据，无需API密钥）
+	DefaultCurrencyAPIURL = "https://api.frankfurter.app/latest"
+	// DefaultCurrencyCacheTTL 默认的汇率缓存时长
+	DefaultCurrencyCacheTTL = time.Hour
+	// currencyRequestTimeout 单次汇率请求的超时时间
+	currencyRequestTimeout = 10 * time.Second
+	// currencyMaxResponseBytes 汇率接口响应的最大读取字节数
+	currencyMaxResponseBytes = 1 << 20
+)
+
+// ErrUnknownCurrency 货币代码格式无效或汇率接口不支持
+var ErrUnknownCurrency = errors.New("未知的货币代码")
+
+// currencyCodeRe ISO 4217 货币代码：三个字母
+var currencyCodeRe = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// CurrencyTool 按实时汇率换算货币
+// 汇率接口需兼容 Frankfurter：GET {apiURL}?from=USD 返回 {"base":"USD","date":"2024-05-01","rates":{"EUR":0.93,...}}
+// 同一基准货币的汇率在缓存时长内只请求一次
+type CurrencyTool struct {
+	apiURL string
+	ttl    time.Duration
+	client *http.Client
+	now    func() time.Time // 当前时间，测试中可替换
+
+	mu    sync.Mutex
+	cache map[string]currencyRates // 按基准货币缓存
+}
+
+// currencyRates 某一基准货币的汇率
+type currencyRates struct {
+	date      string
+	rates     map[string]float64
+	fetchedAt time.Time
+}
+
+// NewCurrencyTool 创建汇率换算工具，apiURL 为空时使用 DefaultCurrencyAPIURL，ttl<=0 时使用 DefaultCurrencyCacheTTL
+func NewCurrencyTool(apiURL string, ttl time.Duration) *CurrencyTool {
+	if apiURL == "" {
+		apiURL = DefaultCurrencyAPIURL
+	}
+	if ttl <= 0 {
+		ttl = DefaultCurrencyCacheTTL
+	}
+	return &CurrencyTool{
+		apiURL: apiURL,
+		ttl:    ttl,
+		client: &http.Client{Timeout: currencyRequestTimeout},
+		now:    time.Now,
+		cache:  make(map[string]currencyRates),
+	}
+}
+
+// Name 返回工具名称
+func (t *CurrencyTool) Name() string {
+	return "currency"
+}
+
+// Description 返回工具描述
+func (t *CurrencyTool) Description() string {
+	return "按实时汇率换算货币，返回换算结果、汇率及汇率日期（货币代码如 USD、CNY、EUR）"
+}
+
+// Parameters 返回工具参数定义
+func (t *CurrencyTool) Parameters() map[string]ParamSpec {
+	return map[string]ParamSpec{
+		"amount": {Type: ParamTypeNumber, Required: true, Description: "金额"},
+		"from":   {Type: ParamTypeString, Required: true, Description: "源货币代码，如 USD"},
+		"to":     {Type: ParamTypeString, Required: true, Description: "目标货币代码，如 CNY"},
+	}
+}
+
+// Execute 执行货币换算
+// 参数: {"amount":100,"from":"USD","to":"CNY"}
+func (t *CurrencyTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	amount, ok := numberValue(params["amount"])
+	if !ok {
+		return nil, fmt.Errorf("缺少金额参数")
+	}
+	from, err := parseCurrencyCode(params["from"])
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseCurrencyCode(params["to"])
+	if err != nil {
+		return nil, err
+	}
+
+	rate, date := 1.0, ""
+	if from != to {
+		rates, err := t.ratesFor(ctx, from)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := rates.rates[to]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownCurrency, to)
+		}
+		rate, date = r, rates.date
+	}
+
+	return map[string]interface{}{
+		"amount":    amount,
+		"from":      from,
+		"to":        to,
+		"rate":      rate,
+		"converted": math.Round(amount*rate*10000) / 10000,
+		"date":      date,
+	}, nil
+}
+
+// parseCurrencyCode 解析货币代码参数，统一为大写
+func parseCurrencyCode(v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("缺少货币代码参数")
+	}
+	code := strings.ToUpper(strings.TrimSpace(s))
+	if !currencyCodeRe.MatchString(code) {
+		return "", fmt.Errorf("%w: %q", ErrUnknownCurrency, s)
+	}
+	return code, nil
+}
+
+// ratesFor 返回基准货币的汇率，缓存未过期时直接使用缓存
+func (t *CurrencyTool) ratesFor(ctx context.Context, base string) (currencyRates, error) {
+	t.mu.Lock()
+	cached, ok := t.cache[base]
+	t.mu.Unlock()
+	if ok && t.now().Sub(cached.fetchedAt) < t.ttl {
+		return cached, nil
+	}
+
+	rates, err := t.fetchRates(ctx, base)
+	if err != nil {
+		return currencyRates{}, err
+	}
+	t.mu.Lock()
+	t.cache[base] = rates
+	t.mu.Unlock()
+	return rates, nil
+}
+
+// fetchRates 从汇率接口获取基准货币的汇率
+func (t *CurrencyTool) fetchRates(ctx context.Context, base string) (currencyRates, error) {
+	reqURL, err := url.Parse(t.apiURL)
+	if err != nil {
+		return currencyRates{}, fmt.Errorf("汇率接口地址无效: %w", err)
+	}
+	query := reqURL.Query()
+	query.Set("from", base)
+	reqURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL.String(), nil)
+	if err != nil {
+		return currencyRates{}, fmt.Errorf("创建请求失败: %w", err)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return currencyRates{}, fmt.Errorf("请求汇率接口失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, currencyMaxResponseBytes))
+	if err != nil {
+		return currencyRates{}, fmt.Errorf("读取汇率响应失败: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnprocessableEntity:
+		// Frankfurter 对不支持的基准货币返回 404
+		return currencyRates{}, fmt.Errorf("%w: %s", ErrUnknownCurrency, base)
+	case resp.StatusCode != http.StatusOK:
+		return currencyRates{}, fmt.Errorf("汇率接口返回错误状态码 %d: %s", resp.StatusCode, truncateRunes(string(body), 200))
+	}
+
+	var data struct {
+		Date  string             `json:"date"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return currencyRates{}, fmt.Errorf("解析汇率响应失败: %w", err)
+	}
+	if len(data.Rates) == 0 {
+		return currencyRates{}, fmt.Errorf("%w: %s", ErrUnknownCurrency, base)
+	}
+	return currencyRates{date: data.Date, rates: data.Rates, fetchedAt: t.now()}, nil
+}
@@ -0,0 +1,106 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newStubRatesAPI 返回以 USD/EUR 为基准的汇率接口，并统计请求次数
+func newStubRatesAPI(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Query().Get("from") {
+		case "USD":
+			w.Write([]byte(`{"amount":1.0,"base":"USD","date":"2024-05-01","rates":{"CNY":7.2,"EUR":0.9}}`))
+		case "EUR":
+			w.Write([]byte(`{"amount":1.0,"base":"EUR","date":"2024-05-01","rates":{"USD":1.1}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"not found"}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestCurrencyToolConverts(t *testing.T) {
+	srv, _ := newStubRatesAPI(t)
+	tool := NewCurrencyTool(srv.URL+"/latest", 0)
+
+	res, err := tool.Execute(context.Background(), map[string]interface{}{"amount": 100.0, "from": "usd", "to": " CNY "})
+	if err != nil {
+		t.Fatalf("换算失败: %v", err)
+	}
+	got := res.(map[string]interface{})
+	if got["converted"] != 720.0 || got["rate"] != 7.2 || got["date"] != "2024-05-01" || got["from"] != "USD" || got["to"] != "CNY" {
+		t.Errorf("换算结果 = %v", got)
+	}
+
+	// 相同货币不请求接口
+	res, err = tool.Execute(context.Background(), map[string]interface{}{"amount": 5.5, "from": "JPY", "to": "jpy"})
+	if err != nil || res.(map[string]interface{})["converted"] != 5.5 {
+		t.Errorf("相同货币换算 = %v, %v", res, err)
+	}
+}
+
+func TestCurrencyToolRejectsUnknownCodes(t *testing.T) {
+	srv, _ := newStubRatesAPI(t)
+	tool := NewCurrencyTool(srv.URL, 0)
+
+	for _, params := range []map[string]interface{}{
+		{"amount": 1.0, "from": "US", "to": "CNY"},  // 格式无效
+		{"amount": 1.0, "from": "XYZ", "to": "CNY"}, // 接口不支持的基准货币
+		{"amount": 1.0, "from": "USD", "to": "ABC"}, // 汇率表中没有目标货币
+		{"amount": 1.0, "from": "USD", "to": "€UR"}, // 非字母
+		{"amount": 1.0, "from": "USD", "to": 123.0}, // 类型错误
+	} {
+		_, err := tool.Execute(context.Background(), params)
+		if params["to"] == 123.0 {
+			if err == nil {
+				t.Errorf("%v: 应返回错误", params)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrUnknownCurrency) {
+			t.Errorf("%v: 错误 = %v，期望 ErrUnknownCurrency", params, err)
+		}
+	}
+}
+
+func TestCurrencyToolCachesRatesPerBase(t *testing.T) {
+	srv, requests := newStubRatesAPI(t)
+	tool := NewCurrencyTool(srv.URL, time.Hour)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tool.now = func() time.Time { return now }
+
+	convert := func(from, to string) {
+		t.Helper()
+		if _, err := tool.Execute(context.Background(), map[string]interface{}{"amount": 1.0, "from": from, "to": to}); err != nil {
+			t.Fatalf("%s->%s 换算失败: %v", from, to, err)
+		}
+	}
+
+	convert("USD", "CNY")
+	convert("USD", "EUR") // 同一基准货币，命中缓存
+	if n := atomic.LoadInt32(requests); n != 1 {
+		t.Errorf("缓存有效期内应只请求 1 次，实际 %d", n)
+	}
+	convert("EUR", "USD") // 不同基准货币单独缓存
+	if n := atomic.LoadInt32(requests); n != 2 {
+		t.Errorf("新的基准货币应请求接口，实际共 %d 次", n)
+	}
+
+	now = now.Add(time.Hour)
+	convert("USD", "CNY")
+	if n := atomic.LoadInt32(requests); n != 3 {
+		t.Errorf("缓存过期后应重新请求，实际共 %d 次", n)
+	}
+}
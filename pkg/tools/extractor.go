@@ -0,0 +1,393 @@
+package tools
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// DocumentExtractor 将某种格式的文档转换为纯文本，供知识库读取与检索
+type DocumentExtractor interface {
+	Extract(content []byte) (string, error)
+}
+
+// ExtractorFunc 函数形式的 DocumentExtractor
+type ExtractorFunc func(content []byte) (string, error)
+
+// Extract 调用函数本身
+func (f ExtractorFunc) Extract(content []byte) (string, error) {
+	return f(content)
+}
+
+// defaultExtractors 返回内置的提取器：文本类格式原样返回，PDF 与 DOCX 解码为纯文本
+func defaultExtractors() map[string]DocumentExtractor {
+	plain := ExtractorFunc(extractPlainText)
+	return map[string]DocumentExtractor{
+		".txt":  plain,
+		".md":   plain,
+		".csv":  plain,
+		".tsv":  plain,
+		".pdf":  ExtractorFunc(extractPDFText),
+		".docx": ExtractorFunc(extractDOCXText),
+	}
+}
+
+// extractPlainText 文本类文档原样返回
+func extractPlainText(content []byte) (string, error) {
+	return string(content), nil
+}
+
+// extractDOCXText 读取 DOCX 中 word/document.xml 的正文，段落之间换行
+func extractDOCXText(content []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", fmt.Errorf("不是有效的 DOCX 文件: %w", err)
+	}
+	var doc *zip.File
+	for _, f := range zr.File {
+		if f.Name == "word/document.xml" {
+			doc = f
+			break
+		}
+	}
+	if doc == nil {
+		return "", errors.New("DOCX 中缺少 word/document.xml")
+	}
+	rc, err := doc.Open()
+	if err != nil {
+		return "", fmt.Errorf("读取 DOCX 正文失败: %w", err)
+	}
+	defer rc.Close()
+
+	// 压缩包中的正文解压后可能远大于文件本身，读取量超过 DefaultMaxDocumentBytes 时报错
+	lr := &io.LimitedReader{R: rc, N: DefaultMaxDocumentBytes + 1}
+	var b strings.Builder
+	decoder := xml.NewDecoder(lr)
+	inText := false
+	for {
+		tok, err := decoder.Token()
+		if lr.N <= 0 {
+			return "", errDecompressedTooLarge()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("解析 DOCX 正文失败: %w", err)
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				b.WriteString("\t")
+			case "br", "cr":
+				b.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch el.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				b.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(el)
+			}
+		}
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// extractPDFText 提取 PDF 内容流中的文本（Tj/TJ/'/" 操作符），支持未压缩与 FlateDecode 压缩的流
+// 仅处理标准编码的文本，扫描件或使用自定义字体编码（CID）的 PDF 可能提取不到内容
+func extractPDFText(content []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(content, " \t\r\n"), []byte("%PDF")) {
+		return "", errors.New("不是有效的 PDF 文件")
+	}
+
+	var b strings.Builder
+	rest := content
+	for {
+		start := bytes.Index(rest, []byte("stream"))
+		if start == -1 {
+			break
+		}
+		// 跳过 endstream 中的 stream
+		if start >= 3 && string(rest[start-3:start]) == "end" {
+			rest = rest[start+len("stream"):]
+			continue
+		}
+		dict := rest[:start]
+		if i := bytes.LastIndex(dict, []byte("obj")); i != -1 {
+			dict = dict[i:]
+		}
+		body := rest[start+len("stream"):]
+		body = bytes.TrimPrefix(body, []byte("\r"))
+		body = bytes.TrimPrefix(body, []byte("\n"))
+		end := bytes.Index(body, []byte("endstream"))
+		if end == -1 {
+			break
+		}
+		data := body[:end]
+		rest = body[end+len("endstream"):]
+
+		if bytes.Contains(dict, []byte("/Filter")) {
+			if !bytes.Contains(dict, []byte("/FlateDecode")) {
+				// 图片等其他编码的流不含文本
+				continue
+			}
+			inflated, err := inflate(data)
+			if errors.Is(err, ErrDocumentTooLarge) {
+				return "", err
+			}
+			if err != nil {
+				continue
+			}
+			data = inflated
+		}
+		b.WriteString(pdfContentText(data))
+	}
+
+	text := collapseBlankLines(b.String())
+	if text == "" {
+		return "", errors.New("PDF 中没有可提取的文本（可能是扫描件或使用了不支持的字体编码）")
+	}
+	return text, nil
+}
+
+// inflate 解压 FlateDecode 流，解压后超过 DefaultMaxDocumentBytes 时返回 ErrDocumentTooLarge
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(io.LimitReader(zr, DefaultMaxDocumentBytes+1))
+	if len(out) > DefaultMaxDocumentBytes {
+		return nil, errDecompressedTooLarge()
+	}
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	// 流末尾损坏时保留已解压的部分
+	return out, nil
+}
+
+// pdfContentText 解析内容流中的文本操作符，文本对象与换行操作符之间换行
+func pdfContentText(data []byte) string {
+	var b strings.Builder
+	var operands []string // 上一个操作符之后出现的字符串
+	inArray := false
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '(':
+			s, next := readPDFLiteral(data, i)
+			operands = append(operands, s)
+			i = next
+		case c == '<' && i+1 < len(data) && data[i+1] != '<':
+			end := bytes.IndexByte(data[i:], '>')
+			if end == -1 {
+				return b.String()
+			}
+			if s, ok := decodePDFHex(data[i+1 : i+end]); ok {
+				operands = append(operands, s)
+			}
+			i += end + 1
+		case c == '[':
+			inArray = true
+			i++
+		case c == ']':
+			inArray = false
+			i++
+		case c == '%':
+			// 注释直到行尾
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		case isPDFNumberStart(c):
+			j := i + 1
+			for j < len(data) && (data[j] >= '0' && data[j] <= '9' || data[j] == '.') {
+				j++
+			}
+			// TJ 数组中较大的负偏移通常表示单词间距
+			if inArray {
+				if n, err := strconv.ParseFloat(string(data[i:j]), 64); err == nil && n <= -200 {
+					operands = append(operands, " ")
+				}
+			}
+			i = j
+		case isPDFRegular(c):
+			j := i
+			for j < len(data) && isPDFRegular(data[j]) {
+				j++
+			}
+			switch string(data[i:j]) {
+			case "Tj", "TJ":
+				b.WriteString(strings.Join(operands, ""))
+			case "'", "\"":
+				b.WriteString("\n" + strings.Join(operands, ""))
+			case "T*", "Td", "TD", "ET":
+				b.WriteString("\n")
+			}
+			if !inArray {
+				operands = operands[:0]
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+	return b.String()
+}
+
+// readPDFLiteral 读取从 data[start]（左括号）开始的字面字符串，返回解码后的文本与结束位置
+func readPDFLiteral(data []byte, start int) (string, int) {
+	var raw []byte
+	depth := 0
+	i := start
+	for ; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '\\':
+			if i+1 >= len(data) {
+				continue
+			}
+			i++
+			switch e := data[i]; e {
+			case 'n':
+				raw = append(raw, '\n')
+			case 'r':
+				raw = append(raw, '\r')
+			case 't':
+				raw = append(raw, '\t')
+			case 'b':
+				raw = append(raw, '\b')
+			case 'f':
+				raw = append(raw, '\f')
+			case '\r', '\n':
+				// 行尾续行
+				if e == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+					i++
+				}
+			default:
+				if e >= '0' && e <= '7' {
+					n := 0
+					j := i
+					for ; j < len(data) && j < i+3 && data[j] >= '0' && data[j] <= '7'; j++ {
+						n = n*8 + int(data[j]-'0')
+					}
+					raw = append(raw, byte(n))
+					i = j - 1
+				} else {
+					raw = append(raw, e)
+				}
+			}
+			continue
+		case '(':
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case ')':
+			depth--
+			if depth == 0 {
+				return decodePDFString(raw), i + 1
+			}
+		}
+		raw = append(raw, c)
+	}
+	return decodePDFString(raw), i
+}
+
+// decodePDFHex 解码十六进制字符串，无法识别为文本（如 CID 字形编号）时返回 false
+func decodePDFHex(hex []byte) (string, bool) {
+	var digits []byte
+	for _, c := range hex {
+		if c != ' ' && c != '\n' && c != '\r' && c != '\t' {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	raw := make([]byte, 0, len(digits)/2)
+	for i := 0; i < len(digits); i += 2 {
+		n, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		if err != nil {
+			return "", false
+		}
+		raw = append(raw, byte(n))
+	}
+	s := decodePDFString(raw)
+	for _, r := range s {
+		if r < 0x20 && r != '\n' && r != '\t' {
+			return "", false
+		}
+	}
+	return s, true
+}
+
+// decodePDFString 解码 PDF 字符串：带 BOM 的按 UTF-16BE，其余按单字节编码
+func decodePDFString(raw []byte) string {
+	if len(raw) >= 2 && raw[0] == 0xFE && raw[1] == 0xFF {
+		units := make([]uint16, 0, (len(raw)-2)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	runes := make([]rune, len(raw))
+	for i, c := range raw {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// isPDFNumberStart 判断字符是否可能是数字的开头
+func isPDFNumberStart(c byte) bool {
+	return c >= '0' && c <= '9' || c == '-' || c == '+' || c == '.'
+}
+
+// isPDFRegular 判断字符是否属于操作符或名称（非空白、非分隔符）
+func isPDFRegular(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0, '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return false
+	}
+	return true
+}
+
+// collapseBlankLines 去除每行首尾空白并合并连续的空行
+func collapseBlankLines(s string) string {
+	var lines []string
+	blank := false
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if !blank && len(lines) > 0 {
+				lines = append(lines, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// errDecompressedTooLarge 文档解压后的内容超过 DefaultMaxDocumentBytes
+func errDecompressedTooLarge() error {
+	return fmt.Errorf("%w: 解压后超过 %d 字节", ErrDocumentTooLarge, DefaultMaxDocumentBytes)
+}
@@ -0,0 +1,128 @@
+package tools
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildDOCX 构造只包含 word/document.xml 的 DOCX
+func buildDOCX(t *testing.T, documentXML string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("word/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(documentXML)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// buildPDF 构造包含单个内容流的 PDF，compress 为 true 时使用 FlateDecode
+func buildPDF(t *testing.T, stream []byte, compress bool) []byte {
+	t.Helper()
+	dict := fmt.Sprintf("<< /Length %d >>", len(stream))
+	if compress {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(stream)
+		zw.Close()
+		stream = buf.Bytes()
+		dict = fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>", len(stream))
+	}
+	var pdf bytes.Buffer
+	fmt.Fprintf(&pdf, "%%PDF-1.4\n1 0 obj\n%s\nstream\n", dict)
+	pdf.Write(stream)
+	pdf.WriteString("\nendstream\nendobj\n%%EOF\n")
+	return pdf.Bytes()
+}
+
+func TestExtractDOCXText(t *testing.T) {
+	doc := buildDOCX(t, `<w:document xmlns:w="w"><w:body>`+
+		`<w:p><w:r><w:t>第一段</w:t><w:tab/><w:t>带制表符</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>第二段</w:t><w:br/><w:t>换行</w:t></w:r></w:p>`+
+		`</w:body></w:document>`)
+	text, err := extractDOCXText(doc)
+	if err != nil {
+		t.Fatalf("提取 DOCX 失败: %v", err)
+	}
+	if want := "第一段\t带制表符\n第二段\n换行"; text != want {
+		t.Errorf("DOCX 文本 = %q，期望 %q", text, want)
+	}
+
+	if _, err := extractDOCXText([]byte("not a zip")); err == nil {
+		t.Error("无效的 DOCX 应返回错误")
+	}
+}
+
+func TestExtractPDFText(t *testing.T) {
+	stream := []byte("BT /F1 12 Tf (Hello PDF) Tj ET\nBT [(Second) -250 ( line)] TJ ET")
+	for _, compress := range []bool{false, true} {
+		text, err := extractPDFText(buildPDF(t, stream, compress))
+		if err != nil {
+			t.Fatalf("compress=%v: 提取 PDF 失败: %v", compress, err)
+		}
+		if !strings.Contains(text, "Hello PDF") || !strings.Contains(text, "Second") {
+			t.Errorf("compress=%v: PDF 文本 = %q", compress, text)
+		}
+	}
+	if _, err := extractPDFText([]byte("plain text")); err == nil {
+		t.Error("缺少 %PDF 头的内容应返回错误")
+	}
+}
+
+func TestExtractorsRejectDecompressionBombs(t *testing.T) {
+	// 压缩后只有几十 KB，解压后超过 DefaultMaxDocumentBytes
+	huge := bytes.Repeat([]byte(" "), DefaultMaxDocumentBytes+1024)
+
+	pdf := buildPDF(t, huge, true)
+	if len(pdf) > DefaultMaxDocumentBytes/100 {
+		t.Fatalf("构造的 PDF 应远小于上限，实际 %d 字节", len(pdf))
+	}
+	if _, err := extractPDFText(pdf); !errors.Is(err, ErrDocumentTooLarge) {
+		t.Errorf("PDF 流解压后超限应返回 ErrDocumentTooLarge，实际 %v", err)
+	}
+
+	docXML := "<w:document><w:body><w:p><w:r><w:t>" + string(huge) + "</w:t></w:r></w:p></w:body></w:document>"
+	if _, err := extractDOCXText(buildDOCX(t, docXML)); !errors.Is(err, ErrDocumentTooLarge) {
+		t.Errorf("DOCX 正文解压后超限应返回 ErrDocumentTooLarge，实际 %v", err)
+	}
+}
+
+func TestKnowledgeBaseSearchSkipsUnextractableDocuments(t *testing.T) {
+	captureLogs(t)
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"notes.txt":  []byte("年假十五天\n"),
+		"broken.pdf": []byte("%PDF-1.4 没有内容流"),
+		"bad.docx":   []byte("不是压缩包"),
+		"guide.docx": buildDOCX(t, `<w:document><w:body><w:p><w:r><w:t>年假需提前申请</w:t></w:r></w:p></w:body></w:document>`),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := NewKnowledgeBaseTool(dir).Execute(context.Background(), map[string]interface{}{"operation": "search", "query": "年假"})
+	if err != nil {
+		t.Fatalf("单个文档提取失败不应中断搜索: %v", err)
+	}
+	results, ok := res.(map[string][]string)
+	if !ok || len(results) != 2 || len(results["notes.txt"]) != 1 || len(results["guide.docx"]) != 1 {
+		t.Errorf("搜索结果 = %v，期望只包含 notes.txt 与 guide.docx", res)
+	}
+}
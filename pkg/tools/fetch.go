@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var (
+	scriptStyleRe = regexp.MustCompile(`(?is)<(script|style|noscript)[^>]*>.*?</(script|style|noscript)>`)
+	htmlTagRe     = regexp.MustCompile(`(?s)<[^>]+>`)
+	whitespaceRe  = regexp.MustCompile(`\s+`)
+)
+
+// fetchPageText 获取网页并提取纯文本，最多读取 maxBytes 字节
+func fetchPageText(ctx context.Context, pageURL string, maxBytes int64) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; EinoAgent/1.0)")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("发送请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("页面请求失败，状态码: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes))
+	if err != nil {
+		return "", fmt.Errorf("读取页面失败: %w", err)
+	}
+	return extractText(string(body)), nil
+}
+
+// extractText 去除HTML标签、脚本和样式，压缩空白字符
+func extractText(page string) string {
+	text := scriptStyleRe.ReplaceAllString(page, " ")
+	text = htmlTagRe.ReplaceAllString(text, " ")
+	text = html.UnescapeString(text)
+	return strings.TrimSpace(whitespaceRe.ReplaceAllString(text, " "))
+}
+
+// truncateRunes 按字符截断文本，超出时追加省略号
+func truncateRunes(text string, max int) string {
+	runes := []rune(text)
+	if max <= 0 || len(runes) <= max {
+		return text
+	}
+	return string(runes[:max]) + "..."
+}
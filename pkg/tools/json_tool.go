@@ -0,0 +1,254 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultJSONMaxInputBytes JSON 工具默认接受的最大输入字节数
+const DefaultJSONMaxInputBytes = 1 << 20
+
+// maxJSONIndent format 操作允许的最大缩进空格数
+const maxJSONIndent = 8
+
+// JSONTool 校验、格式化 JSON，并按路径表达式提取值
+type JSONTool struct {
+	maxInputBytes int
+}
+
+// NewJSONTool 创建JSON工具，maxInputBytes<=0 时使用 DefaultJSONMaxInputBytes
+func NewJSONTool(maxInputBytes int) *JSONTool {
+	if maxInputBytes <= 0 {
+		maxInputBytes = DefaultJSONMaxInputBytes
+	}
+	return &JSONTool{
+		maxInputBytes: maxInputBytes,
+	}
+}
+
+// Name 返回工具名称
+func (t *JSONTool) Name() string {
+	return "json"
+}
+
+// Description 返回工具描述
+func (t *JSONTool) Description() string {
+	return "校验 JSON（validate）、格式化 JSON（format）或按路径提取值（query，如 $.items[0].name）"
+}
+
+// Parameters 返回工具参数定义
+func (t *JSONTool) Parameters() map[string]ParamSpec {
+	return map[string]ParamSpec{
+		"operation": {Type: ParamTypeString, Required: true, Description: "操作类型：validate/format/query"},
+		"input":     {Type: ParamTypeString, Required: true, Description: "JSON 文本"},
+		"indent":    {Type: ParamTypeInteger, Description: "format 的缩进空格数，默认 2，0 表示压缩为一行"},
+		"path":      {Type: ParamTypeString, Description: "query 的路径表达式，如 $.items[0].name"},
+	}
+}
+
+// Execute 执行JSON操作
+// 参数: {"operation":"validate","input":"..."}、{"operation":"format","input":"...","indent":4}
+// 或 {"operation":"query","input":"...","path":"$.a.b[0]"}
+func (t *JSONTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	operation, ok := params["operation"].(string)
+	if !ok {
+		return nil, fmt.Errorf("缺少操作类型参数")
+	}
+	input, ok := params["input"].(string)
+	if !ok {
+		return nil, fmt.Errorf("缺少 input 参数")
+	}
+	if len(input) > t.maxInputBytes {
+		return nil, fmt.Errorf("输入过大: %d 字节，上限 %d 字节", len(input), t.maxInputBytes)
+	}
+
+	switch operation {
+	case "validate":
+		return validateJSON(input), nil
+	case "format":
+		indent := 2
+		if v, ok := params["indent"].(float64); ok {
+			indent = int(v)
+		}
+		return formatJSON(input, indent)
+	case "query":
+		path, _ := params["path"].(string)
+		return queryJSON(input, path)
+	default:
+		return nil, fmt.Errorf("不支持的操作类型: %s", operation)
+	}
+}
+
+// validateJSON 校验 JSON，无效时返回错误信息及出错位置（字节偏移、行号、列号，从 1 开始）
+func validateJSON(input string) map[string]interface{} {
+	var v interface{}
+	err := json.Unmarshal([]byte(input), &v)
+	if err == nil {
+		return map[string]interface{}{"valid": true}
+	}
+
+	result := map[string]interface{}{
+		"valid": false,
+		"error": err.Error(),
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line, column := lineColumn(input, syntaxErr.Offset)
+		result["offset"] = syntaxErr.Offset
+		result["line"] = line
+		result["column"] = column
+	}
+	return result
+}
+
+// lineColumn 将字节偏移转换为行号与列号（列号按字符计）
+func lineColumn(input string, offset int64) (int, int) {
+	if offset > int64(len(input)) {
+		offset = int64(len(input))
+	}
+	prefix := input[:offset]
+	line := strings.Count(prefix, "\n") + 1
+	lastLine := prefix[strings.LastIndex(prefix, "\n")+1:]
+	return line, len([]rune(lastLine))
+}
+
+// formatJSON 按指定缩进格式化 JSON，indent 为 0 时压缩为一行
+func formatJSON(input string, indent int) (string, error) {
+	if indent < 0 || indent > maxJSONIndent {
+		return "", fmt.Errorf("缩进必须在 0-%d 之间: %d", maxJSONIndent, indent)
+	}
+	// json.Indent 会原样保留输入末尾的空白，先去掉首尾空白
+	input = strings.TrimSpace(input)
+	var buf bytes.Buffer
+	var err error
+	if indent == 0 {
+		err = json.Compact(&buf, []byte(input))
+	} else {
+		err = json.Indent(&buf, []byte(input), "", strings.Repeat(" ", indent))
+	}
+	if err != nil {
+		return "", fmt.Errorf("JSON 无效: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// queryJSON 按路径表达式提取值，返回该值的 JSON 文本
+func queryJSON(input, path string) (string, error) {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(input))
+	decoder.UseNumber()
+	var current interface{}
+	if err := decoder.Decode(&current); err != nil {
+		return "", fmt.Errorf("JSON 无效: %w", err)
+	}
+
+	for i, seg := range segments {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			if seg.isIndex {
+				return "", fmt.Errorf("%s 处是对象，不能按下标访问", jsonPathPrefix(segments[:i]))
+			}
+			v, ok := node[seg.key]
+			if !ok {
+				return "", fmt.Errorf("路径不存在: %s", jsonPathPrefix(segments[:i+1]))
+			}
+			current = v
+		case []interface{}:
+			if !seg.isIndex {
+				return "", fmt.Errorf("%s 处是数组，不能按字段访问", jsonPathPrefix(segments[:i]))
+			}
+			index := seg.index
+			if index < 0 {
+				index += len(node)
+			}
+			if index < 0 || index >= len(node) {
+				return "", fmt.Errorf("下标越界: %s（数组长度 %d）", jsonPathPrefix(segments[:i+1]), len(node))
+			}
+			current = node[index]
+		default:
+			return "", fmt.Errorf("%s 处不是对象或数组", jsonPathPrefix(segments[:i]))
+		}
+	}
+
+	out, err := json.Marshal(current)
+	if err != nil {
+		return "", fmt.Errorf("序列化结果失败: %w", err)
+	}
+	return string(out), nil
+}
+
+// jsonPathSegment 路径中的一段：对象字段或数组下标
+type jsonPathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parseJSONPath 解析类 JSONPath 的路径表达式
+// 支持 $.a.b、a.b、[0]、[-1]（倒数）与 ['key']/["key"]（含特殊字符的字段名），开头的 $ 可省略
+func parseJSONPath(path string) ([]jsonPathSegment, error) {
+	p := strings.TrimSpace(path)
+	p = strings.TrimPrefix(p, "$")
+	var segments []jsonPathSegment
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end == -1 {
+				end = len(p)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("路径表达式无效: %q（字段名为空）", path)
+			}
+			segments = append(segments, jsonPathSegment{key: p[:end]})
+			p = p[end:]
+		case '[':
+			end := strings.Index(p, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("路径表达式无效: %q（缺少 ]）", path)
+			}
+			inner := strings.TrimSpace(p[1:end])
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				segments = append(segments, jsonPathSegment{key: inner[1 : len(inner)-1]})
+			} else {
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("路径表达式无效: %q（下标 %q 不是整数）", path, inner)
+				}
+				segments = append(segments, jsonPathSegment{index: n, isIndex: true})
+			}
+			p = p[end+1:]
+		default:
+			// 省略 $ 时第一段可以直接写字段名
+			if len(segments) > 0 {
+				return nil, fmt.Errorf("路径表达式无效: %q", path)
+			}
+			p = "." + p
+		}
+	}
+	return segments, nil
+}
+
+// jsonPathPrefix 将路径片段还原为表达式，用于错误信息
+func jsonPathPrefix(segments []jsonPathSegment) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, seg := range segments {
+		if seg.isIndex {
+			fmt.Fprintf(&b, "[%d]", seg.index)
+		} else {
+			b.WriteString("." + seg.key)
+		}
+	}
+	return b.String()
+}
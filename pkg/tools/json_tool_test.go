@@ -0,0 +1,113 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// runJSON 执行 JSON 工具
+func runJSON(t *testing.T, tool *JSONTool, params map[string]interface{}) (interface{}, error) {
+	t.Helper()
+	return tool.Execute(context.Background(), params)
+}
+
+func TestJSONToolValidate(t *testing.T) {
+	tool := NewJSONTool(0)
+
+	res, err := runJSON(t, tool, map[string]interface{}{"operation": "validate", "input": `{"a": [1, 2]}`})
+	if err != nil || res.(map[string]interface{})["valid"] != true {
+		t.Errorf("合法 JSON 校验结果 = %v, %v", res, err)
+	}
+
+	res, err = runJSON(t, tool, map[string]interface{}{"operation": "validate", "input": "{\n  \"名称\": 1,\n  \"b\": }"})
+	if err != nil {
+		t.Fatalf("校验无效 JSON 不应返回错误: %v", err)
+	}
+	got := res.(map[string]interface{})
+	if got["valid"] != false || got["error"] == "" {
+		t.Fatalf("无效 JSON 校验结果 = %v", got)
+	}
+	if got["line"] != 3 || got["column"] != 8 || got["offset"] != int64(25) {
+		t.Errorf("出错位置 = 第 %v 行第 %v 列（偏移 %v），期望第 3 行第 8 列（偏移 25）", got["line"], got["column"], got["offset"])
+	}
+}
+
+func TestJSONToolFormat(t *testing.T) {
+	tool := NewJSONTool(0)
+	input := `{"a":1,"b":[true,null]}`
+	cases := []struct {
+		indent interface{}
+		want   string
+	}{
+		{nil, "{\n  \"a\": 1,\n  \"b\": [\n    true,\n    null\n  ]\n}"},
+		{float64(4), "{\n    \"a\": 1,\n    \"b\": [\n        true,\n        null\n    ]\n}"},
+		{float64(0), `{"a":1,"b":[true,null]}`},
+	}
+	for _, c := range cases {
+		params := map[string]interface{}{"operation": "format", "input": "  " + input + "\n"}
+		if c.indent != nil {
+			params["indent"] = c.indent
+		}
+		res, err := runJSON(t, tool, params)
+		if err != nil || res != c.want {
+			t.Errorf("indent=%v: 格式化结果 = %q, %v，期望 %q", c.indent, res, err, c.want)
+		}
+	}
+
+	for _, params := range []map[string]interface{}{
+		{"operation": "format", "input": `{"a":}`},
+		{"operation": "format", "input": input, "indent": float64(9)},
+	} {
+		if _, err := runJSON(t, tool, params); err == nil {
+			t.Errorf("%v: 应返回错误", params)
+		}
+	}
+}
+
+func TestJSONToolQuery(t *testing.T) {
+	tool := NewJSONTool(0)
+	input := `{"items":[{"name":"苹果","price":3.50},{"name":"梨","tags":["a","b"]}],"meta.key":{"n":12345678901234567890}}`
+	cases := []struct {
+		path, want string
+	}{
+		{"$.items[0].name", `"苹果"`},
+		{"items[1].tags[-1]", `"b"`},
+		{"$.items[0]", `{"name":"苹果","price":3.50}`},
+		{"$['meta.key'].n", `12345678901234567890`},
+		{"$", input},
+	}
+	for _, c := range cases {
+		res, err := runJSON(t, tool, map[string]interface{}{"operation": "query", "input": input, "path": c.path})
+		if err != nil || res != c.want {
+			t.Errorf("%s: 查询结果 = %v, %v，期望 %s", c.path, res, err, c.want)
+		}
+	}
+
+	errCases := map[string]string{
+		"$.items[5]":        "下标越界",
+		"$.missing":         "路径不存在",
+		"$.items.name":      "不能按字段访问",
+		"$.items[0][0]":     "不能按下标访问",
+		"$.items[x]":        "不是整数",
+		"$.items[0":         "缺少 ]",
+		"$.items[0].name.x": "不是对象或数组",
+	}
+	for path, want := range errCases {
+		_, err := runJSON(t, tool, map[string]interface{}{"operation": "query", "input": input, "path": path})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: 错误 = %v，期望包含 %q", path, err, want)
+		}
+	}
+}
+
+func TestJSONToolRejectsOversizedInput(t *testing.T) {
+	tool := NewJSONTool(16)
+	_, err := runJSON(t, tool, map[string]interface{}{"operation": "validate", "input": `{"key":"` + strings.Repeat("x", 20) + `"}`})
+	if err == nil || !strings.Contains(err.Error(), "输入过大") {
+		t.Errorf("超过上限的输入应被拒绝，实际 %v", err)
+	}
+	if _, err := runJSON(t, tool, map[string]interface{}{"operation": "validate", "input": `{"k":1}`}); err != nil {
+		t.Errorf("上限内的输入应正常处理: %v", err)
+	}
+}
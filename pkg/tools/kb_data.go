@@ -0,0 +1,174 @@
+package tools
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// data 操作的默认上限：只返回小表格，大表格应使用 search 或 stats 工具
+const (
+	// DefaultMaxDataRows data 操作返回的最大数据行数（不含表头）
+	DefaultMaxDataRows = 200
+	// DefaultMaxDataBytes data 操作返回的 JSON 最大字节数
+	DefaultMaxDataBytes = 64 << 10
+)
+
+// ErrDataTooLarge 表格超过 data 操作的行数或大小上限
+var ErrDataTooLarge = errors.New("表格数据过大")
+
+// SetDataLimits 设置 data 操作的最大行数与 JSON 字节数，<=0 时使用默认值
+func (t *KnowledgeBaseTool) SetDataLimits(maxRows, maxBytes int) {
+	if maxRows <= 0 {
+		maxRows = DefaultMaxDataRows
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxDataBytes
+	}
+	t.maxDataRows = maxRows
+	t.maxDataBytes = maxBytes
+}
+
+// readData 将 CSV/TSV 文档转换为以表头为键的 JSON 对象数组，键按表头顺序排列，值均为字符串
+func (t *KnowledgeBaseTool) readData(docName string) (interface{}, error) {
+	if err := t.ensureKnowledgeBaseExists(); err != nil {
+		return nil, err
+	}
+	docName, err := t.resolveDocument(docName)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.validateDocumentName(docName); err != nil {
+		return nil, err
+	}
+	ext := strings.ToLower(filepath.Ext(docName))
+	if ext != ".csv" && ext != ".tsv" {
+		return nil, fmt.Errorf("data 操作仅支持 CSV/TSV 文档: %s", docName)
+	}
+	text, err := t.extractText(docName)
+	if err != nil {
+		return nil, err
+	}
+
+	comma := ','
+	if ext == ".tsv" {
+		comma = '\t'
+	}
+	columns, rows, err := parseTable(text, comma, t.maxDataRows)
+	if err != nil {
+		if errors.Is(err, ErrDataTooLarge) {
+			return nil, fmt.Errorf("%w: %s 超过 %d 行，请使用 search 操作或 stats 工具", ErrDataTooLarge, docName, t.maxDataRows)
+		}
+		return nil, fmt.Errorf("解析表格失败: %w", err)
+	}
+
+	data, err := tableJSON(columns, rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > t.maxDataBytes {
+		return nil, fmt.Errorf("%w: %s 转换后为 %d 字节，上限 %d 字节，请使用 search 操作或 stats 工具", ErrDataTooLarge, docName, len(data), t.maxDataBytes)
+	}
+	return string(data), nil
+}
+
+// parseTable 解析表格文本，首行为表头；数据行超过 maxRows 时返回 ErrDataTooLarge
+// 空表头命名为 column_N，重复的表头追加 _2、_3 后缀；字段数与表头不一致的行按位置对应，缺少的字段为空字符串
+func parseTable(text string, comma rune, maxRows int) ([]string, [][]string, error) {
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(text, "\ufeff")))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取表头失败: %w", err)
+	}
+	var rows [][]string
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, nil, err
+		}
+		if isBlankRecord(record) {
+			continue
+		}
+		if len(rows) == maxRows {
+			return nil, nil, ErrDataTooLarge
+		}
+		rows = append(rows, record)
+		if len(record) > len(header) {
+			header = append(header, make([]string, len(record)-len(header))...)
+		}
+	}
+	return columnNames(header), rows, nil
+}
+
+// columnNames 规范化表头：去除首尾空白，补全空列名并区分重复列名
+func columnNames(header []string) []string {
+	names := make([]string, len(header))
+	seen := make(map[string]int)
+	for i, h := range header {
+		name := strings.TrimSpace(h)
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		seen[name]++
+		if n := seen[name]; n > 1 {
+			name = fmt.Sprintf("%s_%d", name, n)
+		}
+		names[i] = name
+	}
+	return names
+}
+
+// isBlankRecord 判断是否为空行
+func isBlankRecord(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// tableJSON 将数据行编码为 JSON 对象数组，对象的键按列顺序输出
+func tableJSON(columns []string, rows [][]string) ([]byte, error) {
+	var sb strings.Builder
+	sb.WriteByte('[')
+	for i, row := range rows {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteByte('{')
+		for j, col := range columns {
+			value := ""
+			if j < len(row) {
+				value = row[j]
+			}
+			key, err := json.Marshal(col)
+			if err != nil {
+				return nil, err
+			}
+			val, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			if j > 0 {
+				sb.WriteByte(',')
+			}
+			sb.Write(key)
+			sb.WriteByte(':')
+			sb.Write(val)
+		}
+		sb.WriteByte('}')
+	}
+	sb.WriteByte(']')
+	return []byte(sb.String()), nil
+}
@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newDataKB 创建包含指定文档的知识库
+func newDataKB(t *testing.T, docs map[string]string) *KnowledgeBaseTool {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range docs {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewKnowledgeBaseTool(dir)
+}
+
+func readData(t *testing.T, kb *KnowledgeBaseTool, doc string) (string, error) {
+	t.Helper()
+	result, err := kb.Execute(context.Background(), map[string]interface{}{"operation": "data", "document": doc})
+	if err != nil {
+		return "", err
+	}
+	return result.(string), nil
+}
+
+func TestKnowledgeBaseDataParsesHeader(t *testing.T) {
+	kb := newDataKB(t, map[string]string{
+		// BOM、表头空白、空表头与重复表头；第二行缺少字段，第三行多出字段
+		"products.csv": "\ufeff name , price,,name\n苹果,5,a,x\n香蕉,3\n\n橙子,4,b,y,多余\n",
+	})
+
+	got, err := readData(t, kb, "products.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"name":"苹果","price":"5","column_3":"a","name_2":"x","column_5":""},` +
+		`{"name":"香蕉","price":"3","column_3":"","name_2":"","column_5":""},` +
+		`{"name":"橙子","price":"4","column_3":"b","name_2":"y","column_5":"多余"}]`
+	if got != want {
+		t.Errorf("data =\n%s\n期望\n%s", got, want)
+	}
+	var rows []map[string]string
+	if err := json.Unmarshal([]byte(got), &rows); err != nil {
+		t.Fatalf("结果应为有效的 JSON 对象数组: %v", err)
+	}
+}
+
+func TestKnowledgeBaseDataHandlesQuoting(t *testing.T) {
+	kb := newDataKB(t, map[string]string{
+		"quotes.csv": "title,note\n\"Hello, world\",\"他说\"\"你好\"\"\"\n\"多行\n备注\",<b>&</b>\n",
+		"data.tsv":   "城市\t人口\n北京\t\"2,189万\"\n",
+	})
+
+	got, err := readData(t, kb, "quotes.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]string
+	if err := json.Unmarshal([]byte(got), &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0]["title"] != "Hello, world" || rows[0]["note"] != `他说"你好"` ||
+		rows[1]["title"] != "多行\n备注" || rows[1]["note"] != "<b>&</b>" {
+		t.Errorf("引号字段解析错误: %q", rows)
+	}
+
+	got, err = readData(t, kb, "data.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != `[{"城市":"北京","人口":"2,189万"}]` {
+		t.Errorf("TSV 按制表符分隔，实际 %s", got)
+	}
+
+	kb = newDataKB(t, map[string]string{"broken.csv": "a,b\n\"未闭合,1\n"})
+	if _, err := readData(t, kb, "broken.csv"); err == nil || !strings.Contains(err.Error(), "解析表格失败") {
+		t.Errorf("引号未闭合时应返回解析错误，实际 %v", err)
+	}
+}
+
+func TestKnowledgeBaseDataEnforcesCaps(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("id,value\n")
+	for i := 1; i <= 5; i++ {
+		fmt.Fprintf(&sb, "%d,%s\n", i, strings.Repeat("x", 20))
+	}
+	kb := newDataKB(t, map[string]string{"rows.csv": sb.String(), "notes.txt": "a,b\n1,2\n"})
+
+	if _, err := readData(t, kb, "rows.csv"); err != nil {
+		t.Fatalf("默认上限内应成功: %v", err)
+	}
+
+	kb.SetDataLimits(4, 0)
+	if _, err := readData(t, kb, "rows.csv"); !errors.Is(err, ErrDataTooLarge) || !strings.Contains(err.Error(), "4 行") {
+		t.Errorf("超过行数上限应返回 ErrDataTooLarge，实际 %v", err)
+	}
+
+	kb.SetDataLimits(5, 100)
+	if _, err := readData(t, kb, "rows.csv"); !errors.Is(err, ErrDataTooLarge) || !strings.Contains(err.Error(), "字节") {
+		t.Errorf("超过字节上限应返回 ErrDataTooLarge，实际 %v", err)
+	}
+
+	if _, err := readData(t, kb, "notes.txt"); err == nil || !strings.Contains(err.Error(), "CSV/TSV") {
+		t.Errorf("非表格文档应返回错误，实际 %v", err)
+	}
+	if _, err := readData(t, kb, "../rows.csv"); !errors.Is(err, ErrInvalidDocumentName) {
+		t.Errorf("包含路径的文档名应拒绝，实际 %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"agentEino/pkg/logger"
+)
+
+// ErrAmbiguousDocument 文档名称模糊匹配到多个文档
+var ErrAmbiguousDocument = errors.New("文档名称不明确")
+
+// SetFuzzyNames 设置 read 与 data 操作找不到同名文档时是否按忽略大小写、省略扩展名的方式匹配
+func (t *KnowledgeBaseTool) SetFuzzyNames(enabled bool) {
+	t.fuzzyNames = enabled
+}
+
+// resolveDocument 返回 docName 对应的文档文件名：同名文档存在时原样返回，
+// 否则（开启模糊匹配时）在知识库文档中按忽略大小写、省略扩展名匹配，唯一匹配时返回该文档，
+// 多个匹配时返回 ErrAmbiguousDocument 并列出候选文档
+// 包含路径的名称（如 ../../etc/passwd）直接拒绝
+func (t *KnowledgeBaseTool) resolveDocument(docName string) (string, error) {
+	if docName == "" || strings.ContainsAny(docName, `/\`) || strings.Contains(docName, "..") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidDocumentName, docName)
+	}
+	if _, err := os.Stat(filepath.Join(t.basePath, docName)); !os.IsNotExist(err) {
+		return docName, nil
+	}
+	if !t.fuzzyNames {
+		return "", fmt.Errorf("文档不存在: %s", docName)
+	}
+
+	files, err := ioutil.ReadDir(t.basePath)
+	if err != nil {
+		return "", fmt.Errorf("读取知识库目录失败: %w", err)
+	}
+	var candidates []string
+	for _, file := range files {
+		if file.IsDir() || !t.isKnowledgeDocument(file.Name()) {
+			continue
+		}
+		if matchesDocumentName(file.Name(), docName) {
+			candidates = append(candidates, file.Name())
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("文档不存在: %s", docName)
+	case 1:
+		logger.Debug("按模糊匹配解析文档名称", map[string]interface{}{"document": docName, "resolved": candidates[0]})
+		return candidates[0], nil
+	default:
+		sort.Strings(candidates)
+		return "", fmt.Errorf("%w: %s 匹配到多个文档: %s，请使用完整文件名", ErrAmbiguousDocument, docName, strings.Join(candidates, ", "))
+	}
+}
+
+// matchesDocumentName 忽略大小写比较文件名，或比较去掉扩展名后的文件名（如 setup 匹配 Setup.md）
+func matchesDocumentName(fileName, docName string) bool {
+	if strings.EqualFold(fileName, docName) {
+		return true
+	}
+	return strings.EqualFold(strings.TrimSuffix(fileName, filepath.Ext(fileName)), docName)
+}
@@ -0,0 +1,84 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func readDoc(kb *KnowledgeBaseTool, doc string) (interface{}, error) {
+	return kb.Execute(context.Background(), map[string]interface{}{"operation": "read", "document": doc})
+}
+
+func TestKnowledgeBaseReadExactName(t *testing.T) {
+	kb := newDataKB(t, map[string]string{
+		"setup":    "无扩展名文件",
+		"setup.md": "安装步骤",
+		"Setup.md": "大写的安装步骤",
+	})
+
+	got, err := readDoc(kb, "setup.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "安装步骤" {
+		t.Errorf("精确匹配时应读取同名文档，实际 %v", got)
+	}
+}
+
+func TestKnowledgeBaseReadFuzzySingleMatch(t *testing.T) {
+	kb := newDataKB(t, map[string]string{
+		"Setup.md":   "安装步骤",
+		"notes.txt":  "其他",
+		"prices.csv": "name,price\n苹果,5\n",
+	})
+
+	for _, name := range []string{"setup", "SETUP.MD", "Setup"} {
+		got, err := readDoc(kb, name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got != "安装步骤" {
+			t.Errorf("%s 应解析为 Setup.md，实际 %v", name, got)
+		}
+	}
+	if _, err := readData(t, kb, "Prices"); err != nil {
+		t.Errorf("data 操作同样应支持模糊匹配: %v", err)
+	}
+
+	kb.SetFuzzyNames(false)
+	if _, err := readDoc(kb, "setup"); err == nil || !strings.Contains(err.Error(), "文档不存在") {
+		t.Errorf("关闭模糊匹配后应返回文档不存在，实际 %v", err)
+	}
+}
+
+func TestKnowledgeBaseReadAmbiguousMatchListsCandidates(t *testing.T) {
+	kb := newDataKB(t, map[string]string{
+		"setup.md":  "markdown",
+		"Setup.txt": "text",
+		"other.md":  "其他",
+	})
+
+	_, err := readDoc(kb, "setup")
+	if !errors.Is(err, ErrAmbiguousDocument) {
+		t.Fatalf("多个匹配时应返回 ErrAmbiguousDocument，实际 %v", err)
+	}
+	if !strings.Contains(err.Error(), "Setup.txt, setup.md") {
+		t.Errorf("错误信息应列出候选文档，实际 %v", err)
+	}
+
+	if _, err := readDoc(kb, "missing"); err == nil || !strings.Contains(err.Error(), "文档不存在") {
+		t.Errorf("没有匹配时应返回文档不存在，实际 %v", err)
+	}
+}
+
+func TestKnowledgeBaseReadRejectsPaths(t *testing.T) {
+	kb := newDataKB(t, map[string]string{"setup.md": "安装步骤"})
+
+	for _, name := range []string{"../setup.md", "sub/setup.md", `..\setup.md`} {
+		if _, err := readDoc(kb, name); !errors.Is(err, ErrInvalidDocumentName) {
+			t.Errorf("%s: 包含路径的文档名应拒绝，实际 %v", name, err)
+		}
+	}
+}
@@ -2,23 +2,116 @@ package tools
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"unicode"
+
+	"agentEino/pkg/logger"
 )
 
 // KnowledgeBaseTool 实现了本地知识库查看功能
 type KnowledgeBaseTool struct {
-	basePath string
+	basePath         string
+	extractors       map[string]DocumentExtractor // 按小写扩展名（含点）注册的文本提取器
+	maxDocumentBytes int                          // 单个文档的最大字节数，上传与读取时都会校验
+	maxDataRows      int                          // data 操作返回的最大数据行数
+	maxDataBytes     int                          // data 操作返回的 JSON 最大字节数
+	fuzzyNames       bool                         // 找不到同名文档时按忽略大小写、省略扩展名匹配
 }
 
-// NewKnowledgeBaseTool 创建一个新的知识库工具
+// NewKnowledgeBaseTool 创建一个新的知识库工具，默认支持 .txt/.md/.csv/.tsv/.pdf/.docx
 func NewKnowledgeBaseTool(basePath string) *KnowledgeBaseTool {
 	return &KnowledgeBaseTool{
-		basePath: basePath,
+		basePath:         basePath,
+		extractors:       defaultExtractors(),
+		maxDocumentBytes: DefaultMaxDocumentBytes,
+		maxDataRows:      DefaultMaxDataRows,
+		maxDataBytes:     DefaultMaxDataBytes,
+		fuzzyNames:       true,
+	}
+}
+
+// SetMaxDocumentBytes 设置单个文档的最大字节数，<=0 时使用 DefaultMaxDocumentBytes
+func (t *KnowledgeBaseTool) SetMaxDocumentBytes(n int) {
+	if n <= 0 {
+		n = DefaultMaxDocumentBytes
+	}
+	t.maxDocumentBytes = n
+}
+
+// MaxDocumentBytes 返回单个文档的最大字节数
+func (t *KnowledgeBaseTool) MaxDocumentBytes() int {
+	return t.maxDocumentBytes
+}
+
+// documentTooLarge 返回文档超过大小上限时的错误
+func (t *KnowledgeBaseTool) documentTooLarge(docName string, size int64) error {
+	return fmt.Errorf("%w: %s 为 %d 字节，上限 %d 字节", ErrDocumentTooLarge, docName, size, t.maxDocumentBytes)
+}
+
+// RegisterExtractor 为扩展名（如 ".html"）注册文本提取器，已有的提取器会被替换
+func (t *KnowledgeBaseTool) RegisterExtractor(ext string, extractor DocumentExtractor) {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	t.extractors[ext] = extractor
+}
+
+// extractor 返回文档扩展名对应的提取器，不支持的类型返回 nil
+func (t *KnowledgeBaseTool) extractor(name string) DocumentExtractor {
+	return t.extractors[strings.ToLower(filepath.Ext(name))]
+}
+
+// isKnowledgeDocument 判断是否为已注册提取器的知识库文档类型
+func (t *KnowledgeBaseTool) isKnowledgeDocument(name string) bool {
+	return t.extractor(name) != nil
+}
+
+// supportedExtensions 返回已注册的扩展名，按名称排序
+func (t *KnowledgeBaseTool) supportedExtensions() []string {
+	exts := make([]string, 0, len(t.extractors))
+	for ext := range t.extractors {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// extractText 读取文档并转换为纯文本
+// 读取前先检查文件大小，超过上限时返回 ErrDocumentTooLarge，不会把文件读入内存
+func (t *KnowledgeBaseTool) extractText(docName string) (string, error) {
+	extractor := t.extractor(docName)
+	if extractor == nil {
+		return "", fmt.Errorf("不支持的文档类型: %s", docName)
+	}
+	f, err := os.Open(filepath.Join(t.basePath, docName))
+	if err != nil {
+		return "", fmt.Errorf("读取文档失败: %w", err)
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.Size() > int64(t.maxDocumentBytes) {
+		return "", t.documentTooLarge(docName, info.Size())
+	}
+	// 文件在检查后仍可能被追加写入，读取时同样限制字节数
+	content, err := io.ReadAll(io.LimitReader(f, int64(t.maxDocumentBytes)+1))
+	if err != nil {
+		return "", fmt.Errorf("读取文档失败: %w", err)
+	}
+	if len(content) > t.maxDocumentBytes {
+		return "", t.documentTooLarge(docName, int64(len(content)))
+	}
+	text, err := extractor.Extract(content)
+	if err != nil {
+		return "", fmt.Errorf("提取文档内容失败: %w", err)
 	}
+	return text, nil
 }
 
 // Name 返回工具名称
@@ -31,6 +124,20 @@ func (t *KnowledgeBaseTool) Description() string {
 	return "查看本地知识库中的文档"
 }
 
+// Parameters 返回工具参数定义
+func (t *KnowledgeBaseTool) Parameters() map[string]ParamSpec {
+	return map[string]ParamSpec{
+		"operation": {Type: ParamTypeString, Required: true, Description: "操作类型：list/read/search/data（data 将 CSV/TSV 小表格返回为以表头为键的 JSON 对象数组）"},
+		"document":  {Type: ParamTypeString, Description: "文档名称，read 与 data 时必填；找不到同名文档时忽略大小写与扩展名匹配"},
+		"query":     {Type: ParamTypeString, Description: "搜索查询，search 时必填"},
+	}
+}
+
+// ParamDefaults 只提供 query 时按搜索处理
+func (t *KnowledgeBaseTool) ParamDefaults() []ParamDefault {
+	return []ParamDefault{{Param: "operation", Value: "search", When: []string{"query"}}}
+}
+
 // Execute 执行知识库查询
 func (t *KnowledgeBaseTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
 	// 获取操作类型
@@ -48,6 +155,12 @@ func (t *KnowledgeBaseTool) Execute(ctx context.Context, params map[string]inter
 			return nil, fmt.Errorf("缺少文档名称参数")
 		}
 		return t.readDocument(docName)
+	case "data":
+		docName, ok := params["document"].(string)
+		if !ok {
+			return nil, fmt.Errorf("缺少文档名称参数")
+		}
+		return t.readData(docName)
 	case "search":
 		query, ok := params["query"].(string)
 		if !ok {
@@ -72,13 +185,10 @@ func (t *KnowledgeBaseTool) listDocuments() (interface{}, error) {
 		return nil, fmt.Errorf("读取知识库目录失败: %w", err)
 	}
 
-	// 过滤出支持的文档类型（文本/Markdown/CSV/TSV）
+	// 过滤出已注册提取器的文档类型
 	var documents []string
 	for _, file := range files {
-		if !file.IsDir() && (strings.HasSuffix(strings.ToLower(file.Name()), ".txt") ||
-			strings.HasSuffix(strings.ToLower(file.Name()), ".md") ||
-			strings.HasSuffix(strings.ToLower(file.Name()), ".csv") ||
-			strings.HasSuffix(strings.ToLower(file.Name()), ".tsv")) {
+		if !file.IsDir() && t.isKnowledgeDocument(file.Name()) {
 			documents = append(documents, file.Name())
 		}
 	}
@@ -97,21 +207,14 @@ func (t *KnowledgeBaseTool) readDocument(docName string) (interface{}, error) {
 		return nil, err
 	}
 
-	// 构建文件路径
-	filePath := filepath.Join(t.basePath, docName)
-
-	// 检查文件是否存在
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("文档不存在: %s", docName)
-	}
-
-	// 读取文件内容
-	content, err := ioutil.ReadFile(filePath)
+	// 解析文档名称：同名文档不存在时尝试模糊匹配
+	docName, err := t.resolveDocument(docName)
 	if err != nil {
-		return nil, fmt.Errorf("读取文档失败: %w", err)
+		return nil, err
 	}
 
-	return string(content), nil
+	// 读取文件内容并转换为纯文本
+	return t.extractText(docName)
 }
 
 // searchDocuments 在文档中搜索内容
@@ -130,18 +233,16 @@ func (t *KnowledgeBaseTool) searchDocuments(query string) (interface{}, error) {
 	// 在每个文档中搜索
 	results := make(map[string][]string)
 	for _, file := range files {
-		if !file.IsDir() && (strings.HasSuffix(strings.ToLower(file.Name()), ".txt") ||
-			strings.HasSuffix(strings.ToLower(file.Name()), ".md") ||
-			strings.HasSuffix(strings.ToLower(file.Name()), ".csv") ||
-			strings.HasSuffix(strings.ToLower(file.Name()), ".tsv")) {
-			filePath := filepath.Join(t.basePath, file.Name())
-			content, err := ioutil.ReadFile(filePath)
+		if !file.IsDir() && t.isKnowledgeDocument(file.Name()) {
+			// 单个文档读取或提取失败时跳过，不影响其他文档的搜索
+			content, err := t.extractText(file.Name())
 			if err != nil {
+				logger.Warn("跳过无法读取的知识库文档", map[string]interface{}{"document": file.Name(), "error": err.Error()})
 				continue
 			}
 
 			// 简单的文本搜索；对CSV/TSV增加行号提示
-			lines := strings.Split(string(content), "\n")
+			lines := strings.Split(content, "\n")
 			var matches []string
 			lowerQuery := strings.ToLower(query)
 			isCSV := strings.HasSuffix(strings.ToLower(file.Name()), ".csv")
@@ -172,8 +273,16 @@ func (t *KnowledgeBaseTool) searchDocuments(query string) (interface{}, error) {
 }
 
 // ensureKnowledgeBaseExists 确保知识库目录存在
+// 路径已存在但不是目录时返回 ErrKnowledgeBaseNotDir，不存在时创建目录及示例文档
 func (t *KnowledgeBaseTool) ensureKnowledgeBaseExists() error {
-	if _, err := os.Stat(t.basePath); os.IsNotExist(err) {
+	info, err := os.Stat(t.basePath)
+	if err == nil {
+		if !info.IsDir() {
+			return t.notDirError()
+		}
+		return nil
+	}
+	if os.IsNotExist(err) {
 		// 创建知识库目录
 		if err := os.MkdirAll(t.basePath, 0755); err != nil {
 			return fmt.Errorf("创建知识库目录失败: %w", err)
@@ -189,7 +298,7 @@ func (t *KnowledgeBaseTool) ensureKnowledgeBaseExists() error {
 
 1. 将你的知识文档放在知识库目录中
 2. 使用 knowledge_base 工具查询文档
-3. 支持 .txt、.md、.csv、.tsv 格式的文档
+3. 支持 .txt、.md、.csv、.tsv、.pdf、.docx 格式的文档
 
 ## 示例查询
 
@@ -200,7 +309,202 @@ func (t *KnowledgeBaseTool) ensureKnowledgeBaseExists() error {
 		if err := ioutil.WriteFile(examplePath, []byte(exampleContent), 0644); err != nil {
 			return fmt.Errorf("创建示例文档失败: %w", err)
 		}
+		return nil
+	}
+
+	return fmt.Errorf("检查知识库目录失败: %w", err)
+}
+
+// notDirError 返回知识库路径不是目录时的配置错误
+func (t *KnowledgeBaseTool) notDirError() error {
+	return fmt.Errorf("%w: %s 是一个文件，请将 tools.knowledge_base_path（KNOWLEDGE_BASE_PATH）配置为目录", ErrKnowledgeBaseNotDir, t.basePath)
+}
+
+// Snippet 知识库中与查询相关的一段内容
+type Snippet struct {
+	Document string `json:"document"` // 文档名
+	Line     int    `json:"line"`     // 行号（从1开始）
+	Text     string `json:"text"`     // 内容
+	Score    int    `json:"score"`    // 命中的查询词数量
+}
+
+// Snippets 按查询词命中数量返回最相关的若干行，用于每轮自动注入上下文
+// 与 search 操作的整句匹配不同，这里将查询拆分为词（中文按相邻两字切分），适合自然语言问题
+func (t *KnowledgeBaseTool) Snippets(query string, limit int) ([]Snippet, error) {
+	terms := queryTerms(query)
+	if len(terms) == 0 || limit <= 0 {
+		return nil, nil
 	}
 
+	if info, err := os.Stat(t.basePath); err == nil && !info.IsDir() {
+		return nil, t.notDirError()
+	}
+	files, err := ioutil.ReadDir(t.basePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取知识库目录失败: %w", err)
+	}
+
+	var snippets []Snippet
+	for _, file := range files {
+		if file.IsDir() || !t.isKnowledgeDocument(file.Name()) {
+			continue
+		}
+		content, err := t.extractText(file.Name())
+		if err != nil {
+			logger.Warn("跳过无法读取的知识库文档", map[string]interface{}{"document": file.Name(), "error": err.Error()})
+			continue
+		}
+		for i, line := range strings.Split(content, "\n") {
+			text := strings.TrimSpace(line)
+			if text == "" {
+				continue
+			}
+			lower := strings.ToLower(text)
+			score := 0
+			for _, term := range terms {
+				if strings.Contains(lower, term) {
+					score++
+				}
+			}
+			if score > 0 {
+				snippets = append(snippets, Snippet{Document: file.Name(), Line: i + 1, Text: text, Score: score})
+			}
+		}
+	}
+
+	// 命中词多者优先，同分时保持文档与行号顺序
+	sort.SliceStable(snippets, func(i, j int) bool {
+		return snippets[i].Score > snippets[j].Score
+	})
+	if len(snippets) > limit {
+		snippets = snippets[:limit]
+	}
+	return snippets, nil
+}
+
+// DefaultMaxDocumentBytes 知识库单个文档的默认最大字节数，也是压缩文档解压后的内容上限
+const DefaultMaxDocumentBytes = 10 << 20
+
+var (
+	// ErrInvalidDocumentName 文档名为空、包含路径或不是支持的文档类型
+	ErrInvalidDocumentName = errors.New("无效的文档名")
+	// ErrDocumentExists 同名文档已存在且未允许覆盖
+	ErrDocumentExists = errors.New("文档已存在")
+	// ErrDocumentTooLarge 文档超过配置的大小上限
+	ErrDocumentTooLarge = errors.New("文档过大")
+	// ErrKnowledgeBaseNotDir 知识库路径已存在但不是目录
+	ErrKnowledgeBaseNotDir = errors.New("知识库路径不是目录")
+)
+
+// SaveDocument 将文档写入知识库目录，写入后即可被 list/read/search 检索
+// 文档名只能是不含路径的文件名，且扩展名须已注册提取器；overwrite 为 false 时拒绝覆盖同名文档
+func (t *KnowledgeBaseTool) SaveDocument(name string, content []byte, overwrite bool) error {
+	if err := t.validateDocumentName(name); err != nil {
+		return err
+	}
+	if len(content) > t.maxDocumentBytes {
+		return t.documentTooLarge(name, int64(len(content)))
+	}
+	if err := t.ensureKnowledgeBaseExists(); err != nil {
+		return err
+	}
+
+	filePath := filepath.Join(t.basePath, name)
+	if !overwrite {
+		if _, err := os.Stat(filePath); err == nil {
+			return fmt.Errorf("%w: %s", ErrDocumentExists, name)
+		}
+	}
+
+	// 先写临时文件再重命名，避免检索时读到写了一半的文档
+	tmp, err := os.CreateTemp(t.basePath, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入文档失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入文档失败: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("设置文档权限失败: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return fmt.Errorf("保存文档失败: %w", err)
+	}
+	return nil
+}
+
+// validateDocumentName 校验上传的文档名，拒绝路径穿越（如 ../../etc/passwd）与不支持的类型
+func (t *KnowledgeBaseTool) validateDocumentName(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("%w: %q", ErrInvalidDocumentName, name)
+	}
+	if filepath.Base(name) != name {
+		return fmt.Errorf("%w: %q", ErrInvalidDocumentName, name)
+	}
+	if !t.isKnowledgeDocument(name) {
+		return fmt.Errorf("%w: %q（仅支持 %s）", ErrInvalidDocumentName, name, strings.Join(t.supportedExtensions(), "/"))
+	}
 	return nil
 }
+
+// stopTerms 过于常见、不参与相关性打分的检索词
+var stopTerms = map[string]bool{
+	"the": true, "is": true, "are": true, "and": true, "of": true, "to": true, "in": true,
+	"what": true, "how": true, "do": true, "does": true, "can": true, "for": true,
+	"什么": true, "怎么": true, "如何": true, "是否": true, "可以": true, "一下": true, "请问": true,
+}
+
+// queryTerms 将查询拆分为小写检索词：连续字母数字作为一个词（至少2个字符），中文按相邻两字切分
+func queryTerms(query string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	add := func(term string) {
+		if !seen[term] && !stopTerms[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+
+	var word []rune
+	var han []rune
+	flush := func() {
+		if len(word) >= 2 {
+			add(string(word))
+		}
+		word = word[:0]
+		if len(han) == 1 {
+			add(string(han))
+		}
+		for i := 0; i+1 < len(han); i++ {
+			add(string(han[i : i+2]))
+		}
+		han = han[:0]
+	}
+
+	for _, r := range strings.ToLower(query) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			if len(word) > 0 {
+				flush()
+			}
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if len(han) > 0 {
+				flush()
+			}
+			word = append(word, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return terms
+}
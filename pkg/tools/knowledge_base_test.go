@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKnowledgeBasePathPointingAtFileIsConfigError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kb.txt")
+	if err := os.WriteFile(path, []byte("不是目录"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	kb := NewKnowledgeBaseTool(path)
+
+	for _, params := range []map[string]interface{}{
+		{"operation": "list"},
+		{"operation": "read", "document": "a.txt"},
+		{"operation": "search", "query": "目录"},
+	} {
+		_, err := kb.Execute(context.Background(), params)
+		if !errors.Is(err, ErrKnowledgeBaseNotDir) {
+			t.Errorf("%v: 错误 = %v，期望 ErrKnowledgeBaseNotDir", params["operation"], err)
+			continue
+		}
+		if !strings.Contains(err.Error(), path) || !strings.Contains(err.Error(), "KNOWLEDGE_BASE_PATH") {
+			t.Errorf("%v: 错误信息应指明路径与配置项: %v", params["operation"], err)
+		}
+	}
+	if _, err := kb.Snippets("目录", 3); !errors.Is(err, ErrKnowledgeBaseNotDir) {
+		t.Errorf("Snippets 错误 = %v，期望 ErrKnowledgeBaseNotDir", err)
+	}
+	if err := kb.SaveDocument("a.txt", []byte("内容"), false); !errors.Is(err, ErrKnowledgeBaseNotDir) {
+		t.Errorf("SaveDocument 错误 = %v，期望 ErrKnowledgeBaseNotDir", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "不是目录" {
+		t.Error("不应修改配置为知识库路径的文件")
+	}
+}
+
+func TestKnowledgeBaseCreatesMissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "kb")
+	kb := NewKnowledgeBaseTool(path)
+
+	if _, err := kb.Execute(context.Background(), map[string]interface{}{"operation": "list"}); err != nil {
+		t.Fatalf("知识库目录不存在时应自动创建: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		t.Errorf("应创建知识库目录: %v", err)
+	}
+}
+
+func TestKnowledgeBaseRejectsOversizedDocuments(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "small.txt"), []byte("预算说明"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "huge.txt"), []byte(strings.Repeat("预算", 100)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	kb := NewKnowledgeBaseTool(dir)
+	kb.SetMaxDocumentBytes(64)
+
+	_, err := kb.Execute(context.Background(), map[string]interface{}{"operation": "read", "document": "huge.txt"})
+	if !errors.Is(err, ErrDocumentTooLarge) || !strings.Contains(err.Error(), "huge.txt") || !strings.Contains(err.Error(), "64") {
+		t.Errorf("读取超大文档错误 = %v，期望包含文档名与上限的 ErrDocumentTooLarge", err)
+	}
+
+	// 搜索与自动检索跳过超大文档，不影响其他文档
+	result, err := kb.Execute(context.Background(), map[string]interface{}{"operation": "search", "query": "预算"})
+	if err != nil {
+		t.Fatalf("search 失败: %v", err)
+	}
+	if matches := result.(map[string][]string); len(matches) != 1 || matches["small.txt"] == nil {
+		t.Errorf("search 应只返回未超限的文档: %v", matches)
+	}
+	snippets, err := kb.Snippets("预算", 10)
+	if err != nil || len(snippets) != 1 || snippets[0].Document != "small.txt" {
+		t.Errorf("Snippets = %+v, %v，期望只包含 small.txt", snippets, err)
+	}
+
+	if err := kb.SaveDocument("new.txt", make([]byte, 65), false); !errors.Is(err, ErrDocumentTooLarge) {
+		t.Errorf("保存超大文档错误 = %v，期望 ErrDocumentTooLarge", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.txt")); !os.IsNotExist(err) {
+		t.Error("超大文档不应写入知识库")
+	}
+}
+
+func TestKnowledgeBaseCallWithOnlyQueryDefaultsToSearch(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "budget.txt"), []byte("年度预算说明"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tm := NewToolManager()
+	tm.RegisterTool("knowledge_base", NewKnowledgeBaseTool(dir))
+
+	params := map[string]interface{}{"query": "预算"}
+	result, err := tm.ExecuteTool(context.Background(), "knowledge_base", params)
+	if err != nil {
+		t.Fatalf("只提供 query 时应按 search 执行: %v", err)
+	}
+	if matches := result.(map[string][]string); matches["budget.txt"] == nil {
+		t.Errorf("search 结果 = %v", matches)
+	}
+	if _, ok := params["operation"]; ok {
+		t.Error("补全默认值不应修改调用方传入的参数")
+	}
+
+	// 既没有 operation 也没有 query 时不补全，仍按缺少必需参数报错
+	var pe *ParamError
+	if _, err := tm.ExecuteTool(context.Background(), "knowledge_base", map[string]interface{}{}); !errors.As(err, &pe) {
+		t.Errorf("缺少 query 时不应补全 operation，实际 %v", err)
+	}
+}
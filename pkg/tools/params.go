@@ -0,0 +1,208 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// 参数类型，取值与 JSON Schema 的基本类型一致
+const (
+	ParamTypeString  = "string"
+	ParamTypeNumber  = "number"
+	ParamTypeInteger = "integer"
+	ParamTypeBoolean = "boolean"
+	ParamTypeArray   = "array"
+	ParamTypeObject  = "object"
+)
+
+// ParamSpec 描述工具的一个参数；Type 为空表示不限制类型
+type ParamSpec struct {
+	Type        string `json:"type,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// ParameterizedTool 可选接口：声明参数定义的工具在执行前会按定义校验参数
+type ParameterizedTool interface {
+	Parameters() map[string]ParamSpec
+}
+
+// toolParameters 返回工具的参数定义，未实现可选接口时返回 nil
+func toolParameters(tool Tool) map[string]ParamSpec {
+	if pt, ok := tool.(ParameterizedTool); ok {
+		return pt.Parameters()
+	}
+	return nil
+}
+
+// ParamDefault 工具参数的默认值：调用缺少 Param 时填入 Value；When 非空时仅在这些参数均已提供时生效
+type ParamDefault struct {
+	Param string
+	Value interface{}
+	When  []string
+}
+
+// DefaultingTool 可选接口：声明参数默认值的工具，执行前由 ToolManager 补全模型遗漏的参数
+type DefaultingTool interface {
+	ParamDefaults() []ParamDefault
+}
+
+// applyParamDefaults 按顺序补全缺少的参数，同一参数以先匹配的默认值为准
+// 返回补全后的参数副本与补全的参数名，不修改传入的 params；没有补全时原样返回
+func applyParamDefaults(params map[string]interface{}, defaults []ParamDefault) (map[string]interface{}, []string) {
+	var filled []string
+	out := params
+	for _, d := range defaults {
+		if v, ok := out[d.Param]; ok && v != nil {
+			continue
+		}
+		if !hasParams(out, d.When) {
+			continue
+		}
+		if len(filled) == 0 {
+			out = make(map[string]interface{}, len(params)+1)
+			for k, v := range params {
+				out[k] = v
+			}
+		}
+		out[d.Param] = d.Value
+		filled = append(filled, d.Param)
+	}
+	return out, filled
+}
+
+// hasParams 判断参数是否均已提供（非 nil）
+func hasParams(params map[string]interface{}, names []string) bool {
+	for _, name := range names {
+		if v, ok := params[name]; !ok || v == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ParamIssue 单个参数的校验问题
+type ParamIssue struct {
+	Param  string `json:"param"`
+	Reason string `json:"reason"`
+}
+
+// ParamError 工具参数校验失败时返回的结构化错误
+type ParamError struct {
+	Tool   string       `json:"tool"`
+	Issues []ParamIssue `json:"issues"`
+}
+
+func (e *ParamError) Error() string {
+	parts := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		parts = append(parts, fmt.Sprintf("%s: %s", issue.Param, issue.Reason))
+	}
+	return fmt.Sprintf("工具 %s 参数校验失败: %s", e.Tool, strings.Join(parts, "; "))
+}
+
+// ValidateParams 按参数定义校验参数：检查必需参数与类型，未声明的参数不做限制
+// 校验通过返回 nil，否则返回 *ParamError
+func ValidateParams(toolName string, specs map[string]ParamSpec, params map[string]interface{}) error {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var issues []ParamIssue
+	for _, name := range names {
+		spec := specs[name]
+		value, ok := params[name]
+		if !ok || value == nil {
+			if spec.Required {
+				issues = append(issues, ParamIssue{Param: name, Reason: "缺少必需参数"})
+			}
+			continue
+		}
+		if !matchParamType(spec.Type, value) {
+			issues = append(issues, ParamIssue{
+				Param:  name,
+				Reason: fmt.Sprintf("类型应为 %s，实际为 %s", spec.Type, paramTypeOf(value)),
+			})
+		}
+	}
+
+	if len(issues) > 0 {
+		return &ParamError{Tool: toolName, Issues: issues}
+	}
+	return nil
+}
+
+// matchParamType 判断参数值是否符合声明的类型
+func matchParamType(typ string, value interface{}) bool {
+	switch typ {
+	case "":
+		return true
+	case ParamTypeString:
+		_, ok := value.(string)
+		return ok
+	case ParamTypeNumber:
+		_, ok := numberValue(value)
+		return ok
+	case ParamTypeInteger:
+		f, ok := numberValue(value)
+		return ok && f == math.Trunc(f)
+	case ParamTypeBoolean:
+		_, ok := value.(bool)
+		return ok
+	case ParamTypeArray:
+		_, ok := value.([]interface{})
+		return ok
+	case ParamTypeObject:
+		_, ok := value.(map[string]interface{})
+		return ok
+	default:
+		// 未知类型不做限制，避免定义笔误导致工具不可用
+		return true
+	}
+}
+
+// numberValue 将 JSON 解码可能产生的数值类型统一为 float64
+func numberValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// paramTypeOf 返回参数值对应的类型名，用于错误信息
+func paramTypeOf(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return ParamTypeString
+	case bool:
+		return ParamTypeBoolean
+	case []interface{}:
+		return ParamTypeArray
+	case map[string]interface{}:
+		return ParamTypeObject
+	}
+	if _, ok := numberValue(value); ok {
+		return ParamTypeNumber
+	}
+	return fmt.Sprintf("%T", value)
+}
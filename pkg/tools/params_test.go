@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestValidateParams(t *testing.T) {
+	specs := map[string]ParamSpec{
+		"query": {Type: ParamTypeString, Required: true},
+		"limit": {Type: ParamTypeInteger},
+		"ratio": {Type: ParamTypeNumber},
+		"flags": {Type: ParamTypeArray},
+		"extra": {},
+	}
+	cases := []struct {
+		name   string
+		params map[string]interface{}
+		issues []ParamIssue
+	}{
+		{"全部合法", map[string]interface{}{"query": "go", "limit": float64(3), "ratio": 0.5, "flags": []interface{}{"a"}, "extra": true}, nil},
+		{"未声明的参数不限制", map[string]interface{}{"query": "go", "unknown": 1}, nil},
+		{"缺少必需参数", map[string]interface{}{"limit": float64(3)}, []ParamIssue{{Param: "query", Reason: "缺少必需参数"}}},
+		{"必需参数为 null", map[string]interface{}{"query": nil}, []ParamIssue{{Param: "query", Reason: "缺少必需参数"}}},
+		{"整数带小数", map[string]interface{}{"query": "go", "limit": 2.5}, []ParamIssue{{Param: "limit", Reason: "类型应为 integer，实际为 number"}}},
+		{"多个问题按参数名排序", map[string]interface{}{"flags": "a", "ratio": "高"}, []ParamIssue{
+			{Param: "flags", Reason: "类型应为 array，实际为 string"},
+			{Param: "query", Reason: "缺少必需参数"},
+			{Param: "ratio", Reason: "类型应为 number，实际为 string"},
+		}},
+	}
+	for _, c := range cases {
+		err := ValidateParams("search", specs, c.params)
+		if c.issues == nil {
+			if err != nil {
+				t.Errorf("%s: 期望校验通过，实际 %v", c.name, err)
+			}
+			continue
+		}
+		var pe *ParamError
+		if !errors.As(err, &pe) {
+			t.Errorf("%s: 期望 *ParamError，实际 %v", c.name, err)
+			continue
+		}
+		if pe.Tool != "search" || len(pe.Issues) != len(c.issues) {
+			t.Errorf("%s: 校验错误 = %+v，期望 %+v", c.name, pe, c.issues)
+			continue
+		}
+		for i := range c.issues {
+			if pe.Issues[i] != c.issues[i] {
+				t.Errorf("%s: 第 %d 个问题 = %+v，期望 %+v", c.name, i, pe.Issues[i], c.issues[i])
+			}
+		}
+	}
+}
+
+// plainTool 未实现 ParameterizedTool 的工具
+type plainTool struct{ calls int }
+
+func (t *plainTool) Name() string        { return "plain" }
+func (t *plainTool) Description() string { return "没有参数定义的工具" }
+func (t *plainTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	t.calls++
+	return "ok", nil
+}
+
+func TestExecuteToolValidatesDeclaredParams(t *testing.T) {
+	captureLogs(t)
+	executed := 0
+	tm := NewToolManager()
+	tm.RegisterTool("typed", &stubTool{
+		name:   "typed",
+		params: map[string]ParamSpec{"city": {Type: ParamTypeString, Required: true}},
+		fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+			executed++
+			return "ok", nil
+		},
+	})
+	plain := &plainTool{}
+	tm.RegisterTool("plain", plain)
+
+	_, err := tm.ExecuteTool(context.Background(), "typed", map[string]interface{}{"city": 42})
+	var pe *ParamError
+	if !errors.As(err, &pe) || pe.Issues[0].Param != "city" {
+		t.Errorf("类型不符时应返回 *ParamError，实际 %v", err)
+	}
+	if executed != 0 {
+		t.Error("参数校验失败时不应执行工具")
+	}
+	if _, err := tm.ExecuteTool(context.Background(), "typed", map[string]interface{}{"city": "北京"}); err != nil || executed != 1 {
+		t.Errorf("参数合法时应执行工具: err=%v executed=%d", err, executed)
+	}
+
+	// 未声明参数定义的工具保持原有行为，任意参数都直接执行
+	if _, err := tm.ExecuteTool(context.Background(), "plain", map[string]interface{}{"anything": []int{1}}); err != nil || plain.calls != 1 {
+		t.Errorf("未声明参数的工具应直接执行: err=%v calls=%d", err, plain.calls)
+	}
+}
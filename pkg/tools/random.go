@@ -0,0 +1,161 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultTokenLength token 操作未指定 length 时生成的字符数
+	DefaultTokenLength = 32
+	// maxTokenLength token 操作允许的最大字符数
+	maxTokenLength = 1024
+	// maxCustomCharsetLength 自定义字符集允许的最大字符数
+	maxCustomCharsetLength = 256
+)
+
+// tokenCharsets token 操作的预置字符集，charset 不是预置名称时按自定义字符集处理
+var tokenCharsets = map[string]string{
+	"alphanumeric": "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+	"alpha":        "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+	"numeric":      "0123456789",
+	"hex":          "0123456789abcdef",
+	"base64url":    "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_",
+}
+
+// uuidPattern 标准 UUID 文本格式（8-4-4-4-12 位十六进制，大小写均可）
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// RandomTool 使用 crypto/rand 生成 UUID（v4）与随机令牌，并校验 UUID 格式
+type RandomTool struct{}
+
+// NewRandomTool 创建随机值工具
+func NewRandomTool() *RandomTool {
+	return &RandomTool{}
+}
+
+// Name 返回工具名称
+func (t *RandomTool) Name() string {
+	return "random"
+}
+
+// Description 返回工具描述
+func (t *RandomTool) Description() string {
+	return "生成 UUID v4（uuid）、随机令牌（token，可指定长度与字符集）或校验 UUID 格式（validate_uuid）"
+}
+
+// Parameters 返回工具参数定义
+func (t *RandomTool) Parameters() map[string]ParamSpec {
+	return map[string]ParamSpec{
+		"operation": {Type: ParamTypeString, Required: true, Description: "操作类型：uuid/token/validate_uuid"},
+		"length":    {Type: ParamTypeInteger, Description: fmt.Sprintf("token 的字符数（1-%d），默认 %d", maxTokenLength, DefaultTokenLength)},
+		"charset":   {Type: ParamTypeString, Description: "token 的字符集：alphanumeric（默认）/alpha/numeric/hex/base64url，或直接给出自定义字符"},
+		"value":     {Type: ParamTypeString, Description: "validate_uuid 要校验的字符串"},
+	}
+}
+
+// Execute 执行随机值操作
+// 参数: {"operation":"uuid"}、{"operation":"token","length":16,"charset":"hex"}
+// 或 {"operation":"validate_uuid","value":"..."}
+func (t *RandomTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	operation, ok := params["operation"].(string)
+	if !ok {
+		return nil, fmt.Errorf("缺少操作类型参数")
+	}
+
+	switch operation {
+	case "uuid":
+		return newUUIDv4()
+	case "token":
+		length := DefaultTokenLength
+		if raw, ok := params["length"]; ok {
+			n, ok := numberValue(raw)
+			if !ok || n != math.Trunc(n) || n < 1 || n > maxTokenLength {
+				return nil, fmt.Errorf("length 必须是 1 到 %d 之间的整数", maxTokenLength)
+			}
+			length = int(n)
+		}
+		charset, _ := params["charset"].(string)
+		alphabet, err := tokenAlphabet(charset)
+		if err != nil {
+			return nil, err
+		}
+		return randomToken(length, alphabet)
+	case "validate_uuid":
+		value, ok := params["value"].(string)
+		if !ok {
+			return nil, fmt.Errorf("缺少 value 参数")
+		}
+		return validateUUID(value), nil
+	default:
+		return nil, fmt.Errorf("不支持的操作类型: %s", operation)
+	}
+}
+
+// newUUIDv4 按 RFC 4122 生成随机 UUID（版本 4、变体 10）
+func newUUIDv4() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// tokenAlphabet 解析字符集：空值使用 alphanumeric，预置名称不区分大小写，其余按自定义字符处理（去重后至少 2 个字符）
+func tokenAlphabet(charset string) ([]rune, error) {
+	if charset == "" {
+		charset = "alphanumeric"
+	}
+	if preset, ok := tokenCharsets[strings.ToLower(charset)]; ok {
+		return []rune(preset), nil
+	}
+
+	seen := make(map[rune]bool)
+	var alphabet []rune
+	for _, r := range charset {
+		if !seen[r] {
+			seen[r] = true
+			alphabet = append(alphabet, r)
+		}
+	}
+	if len(alphabet) < 2 || len(alphabet) > maxCustomCharsetLength {
+		return nil, fmt.Errorf("自定义字符集需包含 2 到 %d 个不同字符，实际 %d 个", maxCustomCharsetLength, len(alphabet))
+	}
+	return alphabet, nil
+}
+
+// randomToken 从字符集中均匀随机选取 length 个字符
+func randomToken(length int, alphabet []rune) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+	var sb strings.Builder
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("生成随机数失败: %w", err)
+		}
+		sb.WriteRune(alphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// validateUUID 校验 UUID 文本格式，有效时返回版本号以及是否为 RFC 4122 变体
+func validateUUID(value string) map[string]interface{} {
+	value = strings.TrimSpace(value)
+	if !uuidPattern.MatchString(value) {
+		return map[string]interface{}{"valid": false, "error": "格式应为 8-4-4-4-12 位十六进制，如 123e4567-e89b-42d3-a456-426614174000"}
+	}
+	version := strings.IndexByte("0123456789abcdef", strings.ToLower(value)[14])
+	variant := strings.ToLower(value)[19]
+	return map[string]interface{}{
+		"valid":   true,
+		"version": version,
+		"rfc4122": strings.IndexByte("89ab", variant) >= 0,
+	}
+}
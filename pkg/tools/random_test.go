@@ -0,0 +1,110 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// runRandom 执行随机值工具
+func runRandom(t *testing.T, params map[string]interface{}) (interface{}, error) {
+	t.Helper()
+	return NewRandomTool().Execute(context.Background(), params)
+}
+
+func TestRandomToolUUIDsAreUniqueV4(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		res, err := runRandom(t, map[string]interface{}{"operation": "uuid"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := res.(string)
+		if seen[id] {
+			t.Fatalf("生成了重复的 UUID: %s", id)
+		}
+		seen[id] = true
+
+		got := validateUUID(id)
+		if got["valid"] != true || got["version"] != 4 || got["rfc4122"] != true {
+			t.Fatalf("生成的 UUID %s 校验结果 = %v，期望 v4 且为 RFC 4122 变体", id, got)
+		}
+	}
+}
+
+func TestRandomToolTokens(t *testing.T) {
+	res, err := runRandom(t, map[string]interface{}{"operation": "token"})
+	if err != nil || len(res.(string)) != DefaultTokenLength {
+		t.Fatalf("默认令牌 = %v, %v，期望 %d 个字符", res, err, DefaultTokenLength)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 500; i++ {
+		res, err := runRandom(t, map[string]interface{}{"operation": "token", "length": float64(16), "charset": "HEX"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		token := res.(string)
+		if len(token) != 16 || strings.Trim(token, "0123456789abcdef") != "" {
+			t.Fatalf("hex 令牌 = %q", token)
+		}
+		if seen[token] {
+			t.Fatalf("生成了重复的令牌: %s", token)
+		}
+		seen[token] = true
+	}
+
+	// 自定义字符集按字符（而非字节）选取
+	res, err = runRandom(t, map[string]interface{}{"operation": "token", "length": 200, "charset": "甲乙甲"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := res.(string)
+	if n := len([]rune(token)); n != 200 || strings.Trim(token, "甲乙") != "" {
+		t.Errorf("自定义字符集令牌 = %q（%d 个字符）", token, n)
+	}
+	if !strings.Contains(token, "甲") || !strings.Contains(token, "乙") {
+		t.Errorf("200 个字符中应同时出现字符集中的两个字符: %q", token)
+	}
+
+	for _, params := range []map[string]interface{}{
+		{"operation": "token", "length": 0},
+		{"operation": "token", "length": 2.5},
+		{"operation": "token", "length": maxTokenLength + 1},
+		{"operation": "token", "length": "8"},
+		{"operation": "token", "charset": "aaaa"},
+		{"operation": "shuffle"},
+	} {
+		if _, err := runRandom(t, params); err == nil {
+			t.Errorf("参数 %v 应返回错误", params)
+		}
+	}
+}
+
+func TestRandomToolValidateUUID(t *testing.T) {
+	cases := []struct {
+		value   string
+		valid   bool
+		version int
+	}{
+		{"123e4567-e89b-42d3-a456-426614174000", true, 4},
+		{"  123E4567-E89B-12D3-A456-426614174000 ", true, 1},
+		{"123e4567e89b42d3a456426614174000", false, 0},
+		{"123e4567-e89b-42d3-a456-42661417400g", false, 0},
+		{"123e4567-e89b-42d3-a456", false, 0},
+		{"", false, 0},
+	}
+	for _, c := range cases {
+		res, err := runRandom(t, map[string]interface{}{"operation": "validate_uuid", "value": c.value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := res.(map[string]interface{})
+		if got["valid"] != c.valid || (c.valid && got["version"] != c.version) {
+			t.Errorf("validate_uuid(%q) = %v，期望 valid=%v version=%d", c.value, got, c.valid, c.version)
+		}
+	}
+	if _, err := runRandom(t, map[string]interface{}{"operation": "validate_uuid"}); err == nil {
+		t.Error("缺少 value 应返回错误")
+	}
+}
@@ -0,0 +1,82 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"agentEino/pkg/logger"
+)
+
+// DefaultSearchAuthDisableAfter 默认连续多少次密钥无效后停用需要密钥的引擎，直接使用备用引擎
+const DefaultSearchAuthDisableAfter = 3
+
+// authFallback 需要密钥的引擎返回 401/403 时的备用搜索配置与状态，可被并发执行的搜索共享
+type authFallback struct {
+	fallbackEngine   SearchEngineType // 备用引擎，为空时不回退
+	fallbackURL      string           // 备用引擎为 DuckDuckGo 时的接口地址
+	authDisableAfter int              // 连续密钥无效达到该次数后停用主引擎，<=0 不停用
+	authFailures     atomic.Int32     // 主引擎连续密钥无效的次数
+	keyDisabled      atomic.Bool      // 主引擎已因密钥无效停用
+}
+
+// ParseSearchFallback 解析密钥无效时的备用搜索引擎：duckduckgo、mock，none 或空字符串表示不回退
+func ParseSearchFallback(name string) (SearchEngineType, error) {
+	switch engine := SearchEngineType(strings.ToLower(strings.TrimSpace(name))); engine {
+	case "", "none":
+		return "", nil
+	case DuckDuckGo, Mock:
+		return engine, nil
+	default:
+		return "", fmt.Errorf("不支持的备用搜索引擎: %q（可选 duckduckgo/mock/none）", name)
+	}
+}
+
+// SetAuthFallback 设置需要密钥的引擎返回 401/403（ErrSearchAPIKeyInvalid）时的处理：
+// fallback 不为空时本次搜索改用该引擎（DuckDuckGo 或 Mock）并记录警告，为空时照常返回错误；
+// 连续 disableAfter 次密钥无效后停用主引擎，之后的搜索直接使用备用引擎，<=0 表示不停用
+func (t *WebSearchTool) SetAuthFallback(fallback SearchEngineType, disableAfter int) {
+	t.fallbackEngine = fallback
+	t.fallbackURL = duckDuckGoEndpoint
+	t.authDisableAfter = disableAfter
+	t.authFailures.Store(0)
+	t.keyDisabled.Store(false)
+}
+
+// searchWithFallback 使用配置的引擎搜索，需要密钥的引擎密钥无效且配置了备用引擎时改用备用引擎
+func (t *WebSearchTool) searchWithFallback(ctx context.Context, query string) (interface{}, error) {
+	canFallback := t.engineType.RequiresAPIKey() && t.fallbackEngine != ""
+	if canFallback && t.keyDisabled.Load() {
+		return t.search(ctx, t.fallbackEngine, query)
+	}
+
+	result, err := t.search(ctx, t.engineType, query)
+	if !canFallback {
+		return result, err
+	}
+	if !errors.Is(err, ErrSearchAPIKeyInvalid) {
+		if err == nil {
+			t.authFailures.Store(0)
+		}
+		return result, err
+	}
+
+	failures := int(t.authFailures.Add(1))
+	log := logger.FromContext(ctx)
+	log.Warn("搜索API密钥无效，本次改用备用搜索引擎，请检查 SEARCH_API_KEY", map[string]interface{}{
+		"engine":   t.engineType,
+		"fallback": t.fallbackEngine,
+		"failures": failures,
+		"error":    err.Error(),
+	})
+	if t.authDisableAfter > 0 && failures >= t.authDisableAfter && t.keyDisabled.CompareAndSwap(false, true) {
+		log.Warn("搜索API密钥连续无效，已停用该引擎，之后的搜索直接使用备用引擎（重启后恢复）", map[string]interface{}{
+			"engine":   t.engineType,
+			"fallback": t.fallbackEngine,
+			"failures": failures,
+		})
+	}
+	return t.search(ctx, t.fallbackEngine, query)
+}
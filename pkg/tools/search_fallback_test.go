@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// unauthorizedServer 返回 401 的搜索服务，hits 记录收到的请求数
+func unauthorizedServer(t *testing.T, hits *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"Invalid API key."}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSearchAPIUnauthorizedFallsBackToDuckDuckGo(t *testing.T) {
+	var primaryHits, fallbackHits atomic.Int32
+	primary := unauthorizedServer(t, &primaryHits)
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackHits.Add(1)
+		w.Write([]byte(`{"AbstractText":"Go 是一门编程语言","AbstractURL":"https://go.dev"}`))
+	}))
+	defer fallback.Close()
+
+	tool := NewWebSearchToolWithEngine(SearchAPI, "bad-key")
+	tool.searchAPIURL = primary.URL
+	tool.SetAuthFallback(DuckDuckGo, 0)
+	tool.fallbackURL = fallback.URL
+
+	result, err := tool.Execute(context.Background(), map[string]interface{}{"query": "golang"})
+	if err != nil {
+		t.Fatalf("密钥无效时应回退到 DuckDuckGo，实际错误: %v", err)
+	}
+	results, ok := result.([]map[string]string)
+	if !ok || len(results) != 1 || results[0]["link"] != "https://go.dev" {
+		t.Fatalf("应返回备用引擎的结果，实际 %v", result)
+	}
+	if primaryHits.Load() != 1 || fallbackHits.Load() != 1 {
+		t.Errorf("主引擎与备用引擎应各请求 1 次，实际 %d、%d", primaryHits.Load(), fallbackHits.Load())
+	}
+}
+
+func TestSearchAuthFailuresDisablePrimaryEngine(t *testing.T) {
+	var hits atomic.Int32
+	tool := NewWebSearchToolWithEngine(SerpAPI, "bad-key")
+	tool.searchAPIURL = unauthorizedServer(t, &hits).URL
+	tool.SetAuthFallback(Mock, 2)
+
+	for i := 0; i < 4; i++ {
+		result, err := tool.Execute(context.Background(), map[string]interface{}{"query": "go"})
+		if err != nil {
+			t.Fatalf("第 %d 次搜索应回退到 mock: %v", i+1, err)
+		}
+		if results, ok := result.([]map[string]string); !ok || len(results) == 0 {
+			t.Fatalf("第 %d 次搜索应返回 mock 结果，实际 %v", i+1, result)
+		}
+	}
+	if hits.Load() != 2 {
+		t.Errorf("连续 2 次密钥无效后应停用主引擎，实际请求主引擎 %d 次", hits.Load())
+	}
+}
+
+func TestSearchAuthFallbackDisabledReturnsError(t *testing.T) {
+	var hits atomic.Int32
+	tool := NewWebSearchToolWithEngine(SearchAPI, "bad-key")
+	tool.searchAPIURL = unauthorizedServer(t, &hits).URL
+	tool.SetAuthFallback("", 1)
+
+	for i := 0; i < 2; i++ {
+		if _, err := tool.Execute(context.Background(), map[string]interface{}{"query": "go"}); !errors.Is(err, ErrSearchAPIKeyInvalid) {
+			t.Fatalf("未配置备用引擎时应返回 ErrSearchAPIKeyInvalid，实际 %v", err)
+		}
+	}
+	if hits.Load() != 2 {
+		t.Errorf("未配置备用引擎时不应停用主引擎，实际请求 %d 次", hits.Load())
+	}
+}
+
+func TestParseSearchFallback(t *testing.T) {
+	for name, want := range map[string]SearchEngineType{"": "", "none": "", "DuckDuckGo": DuckDuckGo, "mock": Mock} {
+		if got, err := ParseSearchFallback(name); err != nil || got != want {
+			t.Errorf("ParseSearchFallback(%q) = %q, %v，期望 %q", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"searchapi", "google"} {
+		if _, err := ParseSearchFallback(name); err == nil {
+			t.Errorf("ParseSearchFallback(%q) 应返回错误", name)
+		}
+	}
+}
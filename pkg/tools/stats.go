@@ -0,0 +1,191 @@
+package tools
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// StatsTool 对一组数值计算基础统计量（均值、中位数、最值、标准差、数量）
+// 数据可以直接以数组传入，也可以引用知识库中 CSV/TSV 文件的某一列
+type StatsTool struct {
+	basePath string
+}
+
+// NewStatsTool 创建统计工具，basePath 为知识库目录，用于解析 CSV 列引用
+func NewStatsTool(basePath string) *StatsTool {
+	return &StatsTool{
+		basePath: basePath,
+	}
+}
+
+// Name 返回工具名称
+func (t *StatsTool) Name() string {
+	return "stats"
+}
+
+// Description 返回工具描述
+func (t *StatsTool) Description() string {
+	return "对数值数组或知识库CSV列计算 mean/median/min/max/stddev/count"
+}
+
+// Parameters 返回工具参数定义；numbers 与 document/column 二选一，由 Execute 检查
+func (t *StatsTool) Parameters() map[string]ParamSpec {
+	return map[string]ParamSpec{
+		"numbers":  {Type: ParamTypeArray, Description: "数值数组"},
+		"document": {Type: ParamTypeString, Description: "知识库中的 CSV/TSV 文档名"},
+		"column":   {Type: ParamTypeString, Description: "要统计的列名（按表头匹配）"},
+	}
+}
+
+// Execute 执行统计计算
+// 参数: {"numbers":[1,2,3]} 或 {"document":"data.csv","column":"price"}
+func (t *StatsTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	var values []float64
+	var err error
+
+	if raw, ok := params["numbers"]; ok {
+		values, err = parseNumbers(raw)
+	} else if doc, ok := params["document"].(string); ok {
+		column, ok := params["column"].(string)
+		if !ok || column == "" {
+			return nil, fmt.Errorf("缺少列名参数")
+		}
+		values, err = t.readColumn(doc, column)
+	} else {
+		return nil, fmt.Errorf("缺少 numbers 参数或 document/column 参数")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return computeStats(values)
+}
+
+// computeStats 计算统计量；stddev 为总体标准差
+func computeStats(values []float64) (map[string]float64, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("数据为空，无法计算统计量")
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	n := float64(len(sorted))
+	mean := sum / n
+
+	var median float64
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		median = (sorted[mid-1] + sorted[mid]) / 2
+	} else {
+		median = sorted[mid]
+	}
+
+	var variance float64
+	for _, v := range sorted {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= n
+
+	return map[string]float64{
+		"count":  n,
+		"mean":   mean,
+		"median": median,
+		"min":    sorted[0],
+		"max":    sorted[len(sorted)-1],
+		"stddev": math.Sqrt(variance),
+	}, nil
+}
+
+// parseNumbers 将参数中的数组转换为数值，遇到非数值元素时报告其位置
+func parseNumbers(raw interface{}) ([]float64, error) {
+	items, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("numbers 参数必须是数组")
+	}
+
+	values := make([]float64, 0, len(items))
+	for i, item := range items {
+		switch v := item.(type) {
+		case float64:
+			values = append(values, v)
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("第 %d 个元素不是数值: %q", i+1, v)
+			}
+			values = append(values, f)
+		default:
+			return nil, fmt.Errorf("第 %d 个元素不是数值: %v", i+1, item)
+		}
+	}
+	return values, nil
+}
+
+// readColumn 读取知识库中 CSV/TSV 文件指定列（按表头匹配）的数值
+func (t *StatsTool) readColumn(docName, column string) ([]float64, error) {
+	lower := strings.ToLower(docName)
+	if !strings.HasSuffix(lower, ".csv") && !strings.HasSuffix(lower, ".tsv") {
+		return nil, fmt.Errorf("仅支持 CSV/TSV 文档: %s", docName)
+	}
+
+	filePath := filepath.Join(t.basePath, filepath.Base(docName))
+	f, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("文档不存在: %s", docName)
+		}
+		return nil, fmt.Errorf("读取文档失败: %w", err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	if strings.HasSuffix(lower, ".tsv") {
+		reader.Comma = '\t'
+	}
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("解析表格失败: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("文档为空: %s", docName)
+	}
+
+	index := -1
+	for i, name := range records[0] {
+		if strings.EqualFold(strings.TrimSpace(name), column) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("列不存在: %s", column)
+	}
+
+	values := make([]float64, 0, len(records)-1)
+	for row, record := range records[1:] {
+		if index >= len(record) || strings.TrimSpace(record[index]) == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(record[index]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行的 %s 列不是数值: %q", row+2, column, record[index])
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
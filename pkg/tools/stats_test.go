@@ -0,0 +1,113 @@
+package tools
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStatsToolComputesEachStatistic(t *testing.T) {
+	tool := NewStatsTool(t.TempDir())
+	result, err := tool.Execute(context.Background(), map[string]interface{}{
+		"numbers": []interface{}{2.0, 4.0, 4.0, 4.0, 5.0, 5.0, 7.0, "9"},
+	})
+	if err != nil {
+		t.Fatalf("统计失败: %v", err)
+	}
+	stats := result.(map[string]float64)
+	want := map[string]float64{
+		"count":  8,
+		"mean":   5,
+		"median": 4.5,
+		"min":    2,
+		"max":    9,
+		"stddev": 2,
+	}
+	for name, v := range want {
+		if math.Abs(stats[name]-v) > 1e-9 {
+			t.Errorf("%s = %v，期望 %v", name, stats[name], v)
+		}
+	}
+}
+
+func TestStatsToolOddCountAndSingleValue(t *testing.T) {
+	tool := NewStatsTool(t.TempDir())
+	cases := []struct {
+		numbers []interface{}
+		median  float64
+		stddev  float64
+	}{
+		{[]interface{}{3.0, 1.0, 2.0}, 2, math.Sqrt(2.0 / 3)},
+		{[]interface{}{-1.5}, -1.5, 0},
+	}
+	for _, c := range cases {
+		result, err := tool.Execute(context.Background(), map[string]interface{}{"numbers": c.numbers})
+		if err != nil {
+			t.Fatalf("%v: 统计失败: %v", c.numbers, err)
+		}
+		stats := result.(map[string]float64)
+		if stats["median"] != c.median || math.Abs(stats["stddev"]-c.stddev) > 1e-9 {
+			t.Errorf("%v: median=%v stddev=%v", c.numbers, stats["median"], stats["stddev"])
+		}
+	}
+}
+
+func TestStatsToolRejectsInvalidInput(t *testing.T) {
+	tool := NewStatsTool(t.TempDir())
+	cases := []struct {
+		params map[string]interface{}
+		want   string
+	}{
+		{map[string]interface{}{"numbers": []interface{}{}}, "数据为空"},
+		{map[string]interface{}{"numbers": []interface{}{1.0, "abc"}}, "第 2 个元素不是数值"},
+		{map[string]interface{}{"numbers": []interface{}{1.0, true}}, "第 2 个元素不是数值"},
+		{map[string]interface{}{"numbers": "1,2,3"}, "必须是数组"},
+		{map[string]interface{}{}, "缺少 numbers 参数"},
+		{map[string]interface{}{"document": "data.csv"}, "缺少列名参数"},
+	}
+	for _, c := range cases {
+		_, err := tool.Execute(context.Background(), c.params)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%v: 错误 = %v，期望包含 %q", c.params, err, c.want)
+		}
+	}
+}
+
+func TestStatsToolReadsKnowledgeBaseColumn(t *testing.T) {
+	dir := t.TempDir()
+	csvData := "name,price\napple,1.5\npear,\nplum,4.5\n"
+	if err := os.WriteFile(filepath.Join(dir, "fruit.csv"), []byte(csvData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bad.csv"), []byte("price\n1\nn/a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tool := NewStatsTool(dir)
+
+	result, err := tool.Execute(context.Background(), map[string]interface{}{"document": "fruit.csv", "column": "Price"})
+	if err != nil {
+		t.Fatalf("统计 CSV 列失败: %v", err)
+	}
+	stats := result.(map[string]float64)
+	if stats["count"] != 2 || stats["mean"] != 3 {
+		t.Errorf("空单元格应被跳过: %v", stats)
+	}
+
+	errCases := []struct {
+		doc, column, want string
+	}{
+		{"fruit.csv", "weight", "列不存在"},
+		{"missing.csv", "price", "文档不存在"},
+		{"notes.txt", "price", "仅支持 CSV/TSV"},
+		{"bad.csv", "price", "第 3 行的 price 列不是数值"},
+	}
+	for _, c := range errCases {
+		_, err := tool.Execute(context.Background(), map[string]interface{}{"document": c.doc, "column": c.column})
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s/%s: 错误 = %v，期望包含 %q", c.doc, c.column, err, c.want)
+		}
+	}
+}
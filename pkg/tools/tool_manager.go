@@ -1,9 +1,15 @@
 package tools
 
 import (
+	"agentEino/pkg/logger"
+	"agentEino/pkg/tracing"
 	"context"
 	"errors"
+	"fmt"
 	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Tool 是工具的接口
@@ -13,19 +19,113 @@ type Tool interface {
 	Execute(ctx context.Context, params map[string]interface{}) (interface{}, error)
 }
 
+// SequentialTool 可选接口：有副作用的工具返回 true，批量执行时不与其他调用并发
+type SequentialTool interface {
+	Sequential() bool
+}
+
+// isSequential 判断工具是否只能顺序执行
+func isSequential(tool Tool) bool {
+	st, ok := tool.(SequentialTool)
+	return ok && st.Sequential()
+}
+
+// ErrToolNotFound 指定名称的工具未注册
+var ErrToolNotFound = errors.New("tool not found")
+
+// ErrToolDisabled 工具已注册但不在启用列表中
+var ErrToolDisabled = errors.New("tool disabled")
+
+// DefaultMaxConcurrency 批量执行工具调用时的默认最大并发数
+const DefaultMaxConcurrency = 4
+
+// ToolCall 批量执行中的一次工具调用
+type ToolCall struct {
+	Name   string
+	Params map[string]interface{}
+}
+
+// ToolResult 工具调用的结果，与 ToolCall 按下标一一对应
+type ToolResult struct {
+	Result interface{}
+	Err    error
+}
+
 // ToolManager 管理可用的工具
 type ToolManager struct {
 	tools map[string]Tool
-	mu    sync.RWMutex
+	// 启用的工具名称，nil 表示全部启用；未启用的工具不出现在 GetTool/ListTools 中，执行时返回 ErrToolDisabled
+	enabled map[string]bool
+	// 按工具配置的参数默认值，优先于工具自身声明的默认值
+	defaults map[string][]ParamDefault
+	// 批量执行的最大并发数，<=1 表示全部顺序执行
+	maxConcurrency int
+	mu             sync.RWMutex
 }
 
 // NewToolManager 创建一个新的工具管理器
 func NewToolManager() *ToolManager {
 	return &ToolManager{
-		tools: make(map[string]Tool),
+		tools:          make(map[string]Tool),
+		maxConcurrency: DefaultMaxConcurrency,
 	}
 }
 
+// SetMaxConcurrency 设置批量执行的最大并发数，<=1 表示全部顺序执行
+func (tm *ToolManager) SetMaxConcurrency(n int) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.maxConcurrency = n
+}
+
+// SetEnabledTools 设置启用的工具名称，为空表示全部启用
+func (tm *ToolManager) SetEnabledTools(names []string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if len(names) == 0 {
+		tm.enabled = nil
+		return
+	}
+	tm.enabled = make(map[string]bool, len(names))
+	for _, name := range names {
+		tm.enabled[name] = true
+	}
+}
+
+// SetParamDefaults 设置工具的参数默认值，替换之前为该工具设置的默认值
+// 执行时先应用这里设置的默认值，再应用工具通过 DefaultingTool 声明的默认值
+func (tm *ToolManager) SetParamDefaults(name string, defaults ...ParamDefault) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if tm.defaults == nil {
+		tm.defaults = make(map[string][]ParamDefault)
+	}
+	if len(defaults) == 0 {
+		delete(tm.defaults, name)
+		return
+	}
+	tm.defaults[name] = defaults
+}
+
+// paramDefaults 返回工具生效的全部参数默认值
+func (tm *ToolManager) paramDefaults(name string, tool Tool) []ParamDefault {
+	tm.mu.RLock()
+	defaults := append([]ParamDefault(nil), tm.defaults[name]...)
+	tm.mu.RUnlock()
+
+	if dt, ok := tool.(DefaultingTool); ok {
+		defaults = append(defaults, dt.ParamDefaults()...)
+	}
+	return defaults
+}
+
+// isEnabled 判断工具是否启用，调用方需持有锁
+func (tm *ToolManager) isEnabled(name string) bool {
+	return tm.enabled == nil || tm.enabled[name]
+}
+
 // RegisterTool 注册一个工具
 func (tm *ToolManager) RegisterTool(name string, tool Tool) error {
 	tm.mu.Lock()
@@ -39,33 +139,176 @@ func (tm *ToolManager) RegisterTool(name string, tool Tool) error {
 	return nil
 }
 
-// GetTool 获取一个工具
+// UnregisterTool 移除一个已注册的工具，工具不存在时返回 ErrToolNotFound
+func (tm *ToolManager) UnregisterTool(name string) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if _, exists := tm.tools[name]; !exists {
+		return fmt.Errorf("%w: %s", ErrToolNotFound, name)
+	}
+
+	delete(tm.tools, name)
+	return nil
+}
+
+// ReplaceTool 用新的实现替换已注册的工具，工具不存在时返回 ErrToolNotFound
+func (tm *ToolManager) ReplaceTool(name string, tool Tool) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if _, exists := tm.tools[name]; !exists {
+		return fmt.Errorf("%w: %s", ErrToolNotFound, name)
+	}
+
+	tm.tools[name] = tool
+	return nil
+}
+
+// GetTool 获取一个已启用的工具
 func (tm *ToolManager) GetTool(name string) (Tool, bool) {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
 
 	tool, exists := tm.tools[name]
-	return tool, exists
+	if !exists || !tm.isEnabled(name) {
+		return nil, false
+	}
+	return tool, true
 }
 
-// ListTools 列出所有工具
+// ListTools 列出所有已启用的工具
 func (tm *ToolManager) ListTools() []string {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
 
 	tools := make([]string, 0, len(tm.tools))
 	for name := range tm.tools {
-		tools = append(tools, name)
+		if tm.isEnabled(name) {
+			tools = append(tools, name)
+		}
 	}
 	return tools
 }
 
-// ExecuteTool 执行指定的工具
-func (tm *ToolManager) ExecuteTool(ctx context.Context, name string, params map[string]interface{}) (interface{}, error) {
-	tool, exists := tm.GetTool(name)
+// DisabledTools 列出已注册但未启用的工具
+func (tm *ToolManager) DisabledTools() []string {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	var disabled []string
+	for name := range tm.tools {
+		if !tm.isEnabled(name) {
+			disabled = append(disabled, name)
+		}
+	}
+	return disabled
+}
+
+// lookup 获取工具，未注册返回 ErrToolNotFound，未启用返回 ErrToolDisabled
+func (tm *ToolManager) lookup(name string) (Tool, error) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	tool, exists := tm.tools[name]
 	if !exists {
-		return nil, errors.New("tool not found")
+		return nil, ErrToolNotFound
+	}
+	if !tm.isEnabled(name) {
+		return nil, fmt.Errorf("%w: %s", ErrToolDisabled, name)
 	}
+	return tool, nil
+}
+
+// ExecuteTool 执行指定的工具
+func (tm *ToolManager) ExecuteTool(ctx context.Context, name string, params map[string]interface{}) (result interface{}, err error) {
+	ctx, span := tracing.StartSpan(ctx, "tool.execute")
+	span.SetAttributes(attribute.String("tool.name", name))
+	defer func() { tracing.EndSpan(span, err) }()
 
-	return tool.Execute(ctx, params)
+	tool, err := tm.lookup(name)
+	if err != nil {
+		logger.FromContext(ctx).Warn("工具不可用", map[string]interface{}{"tool": name, "error": err.Error()})
+		return nil, err
+	}
+
+	// 补全模型遗漏的参数，减少因参数不全导致的失败调用
+	params, filled := applyParamDefaults(params, tm.paramDefaults(name, tool))
+	if len(filled) > 0 {
+		logger.FromContext(ctx).Debug("已补全工具参数默认值", map[string]interface{}{"tool": name, "params": filled})
+	}
+
+	if err = ValidateParams(name, toolParameters(tool), params); err != nil {
+		logger.FromContext(ctx).Warn("工具参数校验失败", map[string]interface{}{
+			"tool":   name,
+			"error":  err.Error(),
+			"params": params,
+		})
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Debug("开始执行工具", map[string]interface{}{
+		"tool":   name,
+		"params": params,
+	})
+	start := time.Now()
+	result, err = tool.Execute(ctx, params)
+	fields := map[string]interface{}{
+		"tool":        name,
+		"duration_ms": time.Since(start).Milliseconds(),
+		"success":     err == nil,
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+		fields["params"] = params
+		logger.FromContext(ctx).Warn("工具执行完成", fields)
+	} else {
+		logger.FromContext(ctx).Info("工具执行完成", fields)
+	}
+	return result, err
+}
+
+// ExecuteBatch 执行一批相互独立的工具调用，结果顺序与 calls 一致
+// 可并发的调用在并发上限内并行执行；标记为顺序执行的工具会等待之前的调用全部完成后单独执行，
+// 之后的调用在它完成后才开始，因此顺序执行的工具与其前后调用的先后关系与 calls 一致
+// ctx 取消后尚未开始的调用不再执行，其结果为 ctx.Err()
+func (tm *ToolManager) ExecuteBatch(ctx context.Context, calls []ToolCall) []ToolResult {
+	results := make([]ToolResult, len(calls))
+
+	tm.mu.RLock()
+	limit := tm.maxConcurrency
+	tm.mu.RUnlock()
+	if limit < 1 {
+		limit = 1
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, limit)
+	for i, call := range calls {
+		if tool, ok := tm.GetTool(call.Name); ok && isSequential(tool) {
+			wg.Wait()
+			if err := ctx.Err(); err != nil {
+				results[i] = ToolResult{Err: err}
+				continue
+			}
+			result, err := tm.ExecuteTool(ctx, call.Name, call.Params)
+			results[i] = ToolResult{Result: result, Err: err}
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i] = ToolResult{Err: ctx.Err()}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, call ToolCall) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result, err := tm.ExecuteTool(ctx, call.Name, call.Params)
+			results[i] = ToolResult{Result: result, Err: err}
+		}(i, call)
+	}
+	wg.Wait()
+	return results
 }
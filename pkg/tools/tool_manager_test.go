@@ -0,0 +1,276 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"agentEino/pkg/logger"
+)
+
+// stubTool 以函数实现的测试工具
+type stubTool struct {
+	name       string
+	sequential bool
+	params     map[string]ParamSpec
+	fn         func(ctx context.Context, params map[string]interface{}) (interface{}, error)
+}
+
+func (t *stubTool) Name() string                     { return t.name }
+func (t *stubTool) Description() string              { return "测试工具" }
+func (t *stubTool) Sequential() bool                 { return t.sequential }
+func (t *stubTool) Parameters() map[string]ParamSpec { return t.params }
+func (t *stubTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	return t.fn(ctx, params)
+}
+
+// captureLogs 将默认日志输出重定向到缓冲区，测试结束时恢复
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	logger.SetOutput(&buf)
+	t.Cleanup(func() { logger.SetOutput(os.Stdout) })
+	return &buf
+}
+
+func TestExecuteToolLogsEachExecution(t *testing.T) {
+	logs := captureLogs(t)
+	tm := NewToolManager()
+	tm.RegisterTool("ok", &stubTool{name: "ok", fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return "done", nil
+	}})
+	tm.RegisterTool("fail", &stubTool{name: "fail", fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return nil, errors.New("boom")
+	}})
+
+	tm.ExecuteTool(context.Background(), "ok", map[string]interface{}{"q": "a"})
+	tm.ExecuteTool(context.Background(), "ok", map[string]interface{}{"q": "b"})
+	tm.ExecuteTool(context.Background(), "fail", map[string]interface{}{"q": "c"})
+
+	var done []string
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		if strings.Contains(line, "工具执行完成") {
+			done = append(done, line)
+		}
+	}
+	if len(done) != 3 {
+		t.Fatalf("期望每次执行一条日志，共 3 条，实际 %d 条:\n%s", len(done), logs.String())
+	}
+	for i, line := range done {
+		if !strings.Contains(line, "duration_ms=") {
+			t.Errorf("第 %d 条日志缺少耗时: %s", i+1, line)
+		}
+	}
+	if !strings.Contains(done[0], "[INFO]") || !strings.Contains(done[0], "tool=ok") || !strings.Contains(done[0], "success=true") {
+		t.Errorf("成功执行的日志不正确: %s", done[0])
+	}
+	if !strings.Contains(done[2], "[WARN]") || !strings.Contains(done[2], "success=false") ||
+		!strings.Contains(done[2], "error=boom") || !strings.Contains(done[2], "params=map[q:c]") {
+		t.Errorf("失败执行的日志应包含错误与参数: %s", done[2])
+	}
+}
+
+// sleepTool 休眠 d 后返回工具名，并按开始顺序记录到 started
+func sleepTool(name string, d time.Duration, sequential bool, mu *sync.Mutex, started *[]string) *stubTool {
+	return &stubTool{name: name, sequential: sequential, fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		mu.Lock()
+		*started = append(*started, name)
+		mu.Unlock()
+		select {
+		case <-time.After(d):
+			return name, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}}
+}
+
+func TestExecuteBatchRunsIndependentToolsConcurrently(t *testing.T) {
+	captureLogs(t)
+	var mu sync.Mutex
+	var started []string
+	tm := NewToolManager()
+	tm.RegisterTool("slow_a", sleepTool("slow_a", 200*time.Millisecond, false, &mu, &started))
+	tm.RegisterTool("slow_b", sleepTool("slow_b", 200*time.Millisecond, false, &mu, &started))
+
+	start := time.Now()
+	results := tm.ExecuteBatch(context.Background(), []ToolCall{{Name: "slow_a"}, {Name: "slow_b"}})
+	elapsed := time.Since(start)
+
+	if elapsed >= 400*time.Millisecond {
+		t.Errorf("两个独立工具应并发执行，总耗时 %s 不应达到两者之和", elapsed)
+	}
+	if results[0].Result != "slow_a" || results[1].Result != "slow_b" {
+		t.Errorf("结果顺序应与调用顺序一致: %+v", results)
+	}
+
+	// 并发上限为 1 时顺序执行
+	tm.SetMaxConcurrency(1)
+	start = time.Now()
+	tm.ExecuteBatch(context.Background(), []ToolCall{{Name: "slow_a"}, {Name: "slow_b"}})
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("并发上限为 1 时应顺序执行，实际耗时 %s", elapsed)
+	}
+}
+
+func TestExecuteBatchKeepsOrderAroundSequentialTools(t *testing.T) {
+	captureLogs(t)
+	var mu sync.Mutex
+	var started []string
+	tm := NewToolManager()
+	tm.RegisterTool("read_a", sleepTool("read_a", 50*time.Millisecond, false, &mu, &started))
+	tm.RegisterTool("write", sleepTool("write", 10*time.Millisecond, true, &mu, &started))
+	tm.RegisterTool("read_b", sleepTool("read_b", 10*time.Millisecond, false, &mu, &started))
+
+	results := tm.ExecuteBatch(context.Background(), []ToolCall{{Name: "read_a"}, {Name: "write"}, {Name: "read_b"}})
+	if got := strings.Join(started, ","); got != "read_a,write,read_b" {
+		t.Errorf("顺序执行的工具应在之前的调用完成后执行、之后的调用之前执行，实际开始顺序 %s", got)
+	}
+	for i, want := range []string{"read_a", "write", "read_b"} {
+		if results[i].Result != want {
+			t.Errorf("第 %d 个结果 = %v，期望 %s", i+1, results[i].Result, want)
+		}
+	}
+}
+
+func TestExecuteBatchStopsWaitingWhenContextCancelled(t *testing.T) {
+	captureLogs(t)
+	var mu sync.Mutex
+	var started []string
+	tm := NewToolManager()
+	tm.SetMaxConcurrency(1)
+	tm.RegisterTool("slow", sleepTool("slow", time.Minute, false, &mu, &started))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan []ToolResult)
+	go func() {
+		done <- tm.ExecuteBatch(ctx, []ToolCall{{Name: "slow"}, {Name: "slow", Params: map[string]interface{}{"n": 2}}})
+	}()
+
+	select {
+	case results := <-done:
+		for i, r := range results {
+			if !errors.Is(r.Err, context.DeadlineExceeded) {
+				t.Errorf("第 %d 个结果应为超时错误，实际 %v", i+1, r.Err)
+			}
+		}
+		if len(started) != 1 {
+			t.Errorf("等待并发名额的调用在取消后不应执行，实际开始了 %d 个", len(started))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("上下文取消后 ExecuteBatch 应尽快返回")
+	}
+}
+
+func TestUnregisterAndReplaceTool(t *testing.T) {
+	tm := NewToolManager()
+	constant := func(v string) *stubTool {
+		return &stubTool{name: "echo", fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+			return v, nil
+		}}
+	}
+	if err := tm.RegisterTool("echo", constant("mock")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tm.ReplaceTool("echo", constant("real")); err != nil {
+		t.Fatalf("替换已注册的工具失败: %v", err)
+	}
+	if got, err := tm.ExecuteTool(context.Background(), "echo", nil); err != nil || got != "real" {
+		t.Errorf("替换后应执行新工具，实际 %v, %v", got, err)
+	}
+
+	if err := tm.UnregisterTool("echo"); err != nil {
+		t.Fatalf("移除工具失败: %v", err)
+	}
+	if _, ok := tm.GetTool("echo"); ok || len(tm.ListTools()) != 0 {
+		t.Errorf("移除后工具仍然存在: %v", tm.ListTools())
+	}
+	if _, err := tm.ExecuteTool(context.Background(), "echo", nil); !errors.Is(err, ErrToolNotFound) {
+		t.Errorf("执行已移除的工具应返回 ErrToolNotFound，实际 %v", err)
+	}
+
+	if err := tm.UnregisterTool("echo"); !errors.Is(err, ErrToolNotFound) {
+		t.Errorf("移除不存在的工具应返回 ErrToolNotFound，实际 %v", err)
+	}
+	if err := tm.ReplaceTool("echo", constant("x")); !errors.Is(err, ErrToolNotFound) {
+		t.Errorf("替换不存在的工具应返回 ErrToolNotFound，实际 %v", err)
+	}
+
+	// 移除后可以重新注册同名工具
+	if err := tm.RegisterTool("echo", constant("again")); err != nil {
+		t.Errorf("移除后重新注册失败: %v", err)
+	}
+}
+
+func TestEnabledToolsRestrictsAvailableTools(t *testing.T) {
+	tm := NewToolManager()
+	for _, name := range []string{"calculator", "web_search"} {
+		name := name
+		tm.RegisterTool(name, &stubTool{name: name, fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+			return name, nil
+		}})
+	}
+
+	tm.SetEnabledTools([]string{"calculator"})
+	if got := tm.ListTools(); len(got) != 1 || got[0] != "calculator" {
+		t.Errorf("ListTools 应只返回启用的工具，实际 %v", got)
+	}
+	if got := tm.DisabledTools(); len(got) != 1 || got[0] != "web_search" {
+		t.Errorf("DisabledTools = %v", got)
+	}
+	if _, ok := tm.GetTool("web_search"); ok {
+		t.Error("GetTool 不应返回未启用的工具")
+	}
+	if got, err := tm.ExecuteTool(context.Background(), "calculator", nil); err != nil || got != "calculator" {
+		t.Errorf("启用的工具应正常执行: %v, %v", got, err)
+	}
+	_, err := tm.ExecuteTool(context.Background(), "web_search", nil)
+	if !errors.Is(err, ErrToolDisabled) || !strings.Contains(err.Error(), "web_search") {
+		t.Errorf("执行未启用的工具应返回 ErrToolDisabled，实际 %v", err)
+	}
+	if _, err := tm.ExecuteTool(context.Background(), "missing", nil); !errors.Is(err, ErrToolNotFound) {
+		t.Errorf("未注册的工具应返回 ErrToolNotFound，实际 %v", err)
+	}
+
+	// 空列表恢复为全部启用
+	tm.SetEnabledTools(nil)
+	if got := tm.ListTools(); len(got) != 2 {
+		t.Errorf("空列表应启用全部工具，实际 %v", got)
+	}
+}
+
+func TestSetParamDefaultsFillsMissingParams(t *testing.T) {
+	var got map[string]interface{}
+	tm := NewToolManager()
+	tm.RegisterTool("web_search", &stubTool{
+		name:   "web_search",
+		params: map[string]ParamSpec{"query": {Type: ParamTypeString, Required: true}, "num": {Type: ParamTypeInteger}},
+		fn: func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+			got = params
+			return nil, nil
+		},
+	})
+	tm.SetParamDefaults("web_search", ParamDefault{Param: "num", Value: float64(5)})
+
+	tm.ExecuteTool(context.Background(), "web_search", map[string]interface{}{"query": "天气"})
+	if got["num"] != float64(5) {
+		t.Errorf("缺少 num 时应填入默认值，实际 %v", got)
+	}
+	tm.ExecuteTool(context.Background(), "web_search", map[string]interface{}{"query": "天气", "num": 2})
+	if got["num"] != 2 {
+		t.Errorf("已提供的参数不应被默认值覆盖，实际 %v", got)
+	}
+
+	tm.SetParamDefaults("web_search")
+	tm.ExecuteTool(context.Background(), "web_search", map[string]interface{}{"query": "天气"})
+	if _, ok := got["num"]; ok {
+		t.Errorf("清除默认值后不应再补全，实际 %v", got)
+	}
+}
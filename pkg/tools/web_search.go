@@ -3,11 +3,16 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
+
+	"agentEino/pkg/logger"
 )
 
 // SearchEngineType 表示搜索引擎类型
@@ -20,15 +25,87 @@ const (
 	DuckDuckGo SearchEngineType = "duckduckgo"
 	// Mock 使用模拟数据
 	Mock SearchEngineType = "mock"
+	// SerpAPI 使用SerpAPI.com获取Google搜索结果
+	SerpAPI SearchEngineType = "serpapi"
+	// Bing 使用Bing Web Search API
+	Bing SearchEngineType = "bing"
+)
+
+// supportedSearchEngines 所有支持的搜索引擎类型
+var supportedSearchEngines = []SearchEngineType{SearchAPI, DuckDuckGo, Mock, SerpAPI, Bing}
+
+// 各搜索引擎的默认接口地址
+const (
+	searchAPIEndpoint  = "https://api.searchapi.com/v1/search"
+	duckDuckGoEndpoint = "https://api.duckduckgo.com/"
+	serpAPIEndpoint    = "https://serpapi.com/search.json"
+	bingEndpoint       = "https://api.bing.microsoft.com/v7.0/search"
 )
 
+var (
+	// ErrSearchAPIKeyMissing 所选搜索引擎需要API密钥但未配置
+	ErrSearchAPIKeyMissing = errors.New("搜索引擎需要API密钥，请配置 tools.search_api_key（SEARCH_API_KEY）")
+	// ErrSearchAPIKeyInvalid 搜索服务拒绝了API密钥（无效、过期或无权限）
+	ErrSearchAPIKeyInvalid = errors.New("搜索API密钥无效或无权限")
+)
+
+// RequiresAPIKey 判断搜索引擎是否需要API密钥
+func (e SearchEngineType) RequiresAPIKey() bool {
+	switch e {
+	case SearchAPI, SerpAPI, Bing:
+		return true
+	}
+	return false
+}
+
+// ParseSearchEngineType 解析搜索引擎名称（不区分大小写），未知名称返回错误
+func ParseSearchEngineType(name string) (SearchEngineType, error) {
+	engine := SearchEngineType(strings.ToLower(strings.TrimSpace(name)))
+	for _, e := range supportedSearchEngines {
+		if engine == e {
+			return e, nil
+		}
+	}
+	names := make([]string, 0, len(supportedSearchEngines))
+	for _, e := range supportedSearchEngines {
+		names = append(names, string(e))
+	}
+	return "", fmt.Errorf("未知的搜索引擎: %q，支持的引擎: %s", name, strings.Join(names, ", "))
+}
+
 // WebSearchTool 实现了联网搜索功能
 type WebSearchTool struct {
 	engineType   SearchEngineType
 	searchAPIURL string
 	apiKey       string
+	client       *http.Client // 发送搜索请求的客户端，默认超时 DefaultSearchTimeout
+	maxResults   int          // 默认返回的最大结果数，可通过 num 参数按次覆盖
+
+	// 密钥无效时的备用引擎，见 SetAuthFallback
+	authFallback
+
+	// 结果增强：抓取首条结果页面并提取摘录（默认关闭）
+	enrichEnabled  bool
+	enrichTimeout  time.Duration
+	enrichMaxChars int
+	fetchPage      func(ctx context.Context, pageURL string) (string, error)
 }
 
+const (
+	// DefaultSearchTimeout 默认的搜索请求超时
+	DefaultSearchTimeout = 10 * time.Second
+	// DefaultSearchMaxResults 默认返回的最大结果数
+	DefaultSearchMaxResults = 10
+	// maxSearchResultsLimit num 参数允许的最大值
+	maxSearchResultsLimit = 50
+	// DefaultEnrichTimeout 默认的结果增强抓取超时
+	DefaultEnrichTimeout = 5 * time.Second
+	// DefaultEnrichMaxChars 默认的摘录最大字符数
+	DefaultEnrichMaxChars = 500
+	// enrichMaxBytes 抓取页面时最多读取的字节数
+	enrichMaxBytes = 512 * 1024
+)
+
 // SearchResult 表示搜索结果
 type SearchResult struct {
 	Title       string `json:"title"`
@@ -45,49 +122,67 @@ type SearchResponse struct {
 func NewWebSearchTool(apiKey string) *WebSearchTool {
 	// 如果没有提供API密钥，默认使用DuckDuckGo
 	if apiKey == "" {
-		return &WebSearchTool{
-			engineType:   DuckDuckGo,
-			searchAPIURL: "https://api.duckduckgo.com/",
-			apiKey:       "",
-		}
+		return NewWebSearchToolWithEngine(DuckDuckGo, "")
 	}
 
 	// 有API密钥则使用SearchAPI
-	return &WebSearchTool{
-		engineType:   SearchAPI,
-		searchAPIURL: "https://api.searchapi.com/v1/search",
-		apiKey:       apiKey,
-	}
+	return NewWebSearchToolWithEngine(SearchAPI, apiKey)
 }
 
 // NewWebSearchToolWithEngine 创建指定搜索引擎的网络搜索工具
+// 需要API密钥的引擎（SearchAPI、SerpAPI、Bing）在密钥为空时仍会创建，执行搜索时返回 ErrSearchAPIKeyMissing
 func NewWebSearchToolWithEngine(engineType SearchEngineType, apiKey string) *WebSearchTool {
+	t := &WebSearchTool{
+		client:     &http.Client{Timeout: DefaultSearchTimeout},
+		maxResults: DefaultSearchMaxResults,
+	}
 	switch engineType {
 	case SearchAPI:
-		return &WebSearchTool{
-			engineType:   SearchAPI,
-			searchAPIURL: "https://api.searchapi.com/v1/search",
-			apiKey:       apiKey,
-		}
-	case DuckDuckGo:
-		return &WebSearchTool{
-			engineType:   DuckDuckGo,
-			searchAPIURL: "https://api.duckduckgo.com/",
-			apiKey:       "",
-		}
+		t.engineType, t.searchAPIURL, t.apiKey = SearchAPI, searchAPIEndpoint, apiKey
+	case SerpAPI:
+		t.engineType, t.searchAPIURL, t.apiKey = SerpAPI, serpAPIEndpoint, apiKey
+	case Bing:
+		t.engineType, t.searchAPIURL, t.apiKey = Bing, bingEndpoint, apiKey
 	case Mock:
-		return &WebSearchTool{
-			engineType: Mock,
-			apiKey:     "",
-		}
+		t.engineType = Mock
 	default:
 		// 默认使用DuckDuckGo
-		return &WebSearchTool{
-			engineType:   DuckDuckGo,
-			searchAPIURL: "https://api.duckduckgo.com/",
-			apiKey:       "",
-		}
+		t.engineType, t.searchAPIURL = DuckDuckGo, duckDuckGoEndpoint
+	}
+	return t
+}
+
+// SetHTTPClient 设置发送搜索请求的客户端，nil 时恢复为默认超时的客户端
+func (t *WebSearchTool) SetHTTPClient(client *http.Client) {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultSearchTimeout}
+	}
+	t.client = client
+}
+
+// SetLimits 设置搜索请求超时与默认返回的最大结果数，<=0 时使用默认值
+func (t *WebSearchTool) SetLimits(timeout time.Duration, maxResults int) {
+	if timeout <= 0 {
+		timeout = DefaultSearchTimeout
 	}
+	if maxResults <= 0 {
+		maxResults = DefaultSearchMaxResults
+	}
+	t.client = &http.Client{Timeout: timeout}
+	t.maxResults = maxResults
+}
+
+// SetEnrichment 开启或关闭搜索结果增强，timeout/maxChars <=0 时使用默认值
+func (t *WebSearchTool) SetEnrichment(enabled bool, timeout time.Duration, maxChars int) {
+	if timeout <= 0 {
+		timeout = DefaultEnrichTimeout
+	}
+	if maxChars <= 0 {
+		maxChars = DefaultEnrichMaxChars
+	}
+	t.enrichEnabled = enabled
+	t.enrichTimeout = timeout
+	t.enrichMaxChars = maxChars
 }
 
 // Name 返回工具名称
@@ -100,6 +195,14 @@ func (t *WebSearchTool) Description() string {
 	return "搜索互联网获取信息"
 }
 
+// Parameters 返回工具参数定义
+func (t *WebSearchTool) Parameters() map[string]ParamSpec {
+	return map[string]ParamSpec{
+		"query": {Type: ParamTypeString, Required: true, Description: "搜索关键词"},
+		"num":   {Type: ParamTypeNumber, Description: fmt.Sprintf("返回的结果数（1-%d），默认 %d", maxSearchResultsLimit, t.maxResults)},
+	}
+}
+
 // Execute 执行搜索
 func (t *WebSearchTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
 	query, ok := params["query"].(string)
@@ -107,20 +210,90 @@ func (t *WebSearchTool) Execute(ctx context.Context, params map[string]interface
 		return nil, fmt.Errorf("搜索查询不能为空")
 	}
 
-	switch t.engineType {
+	limit := t.maxResults
+	if raw, ok := params["num"]; ok {
+		n, ok := numberValue(raw)
+		if !ok || n != math.Trunc(n) || n < 1 || n > maxSearchResultsLimit {
+			return nil, fmt.Errorf("num 必须是 1 到 %d 之间的整数", maxSearchResultsLimit)
+		}
+		limit = int(n)
+	}
+
+	if t.engineType.RequiresAPIKey() && strings.TrimSpace(t.apiKey) == "" {
+		return nil, fmt.Errorf("%w（引擎 %s）", ErrSearchAPIKeyMissing, t.engineType)
+	}
+
+	result, err := t.searchWithFallback(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	results, ok := result.([]map[string]string)
+	if !ok {
+		return result, nil
+	}
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	if t.enrichEnabled {
+		t.enrichTopResult(ctx, results)
+	}
+	return results, nil
+}
+
+// search 使用指定的搜索引擎搜索
+func (t *WebSearchTool) search(ctx context.Context, engine SearchEngineType, query string) (interface{}, error) {
+	switch engine {
 	case SearchAPI:
 		return t.searchWithSearchAPI(ctx, query)
-	case DuckDuckGo:
-		return t.searchWithDuckDuckGo(ctx, query)
+	case SerpAPI:
+		return t.searchWithSerpAPI(ctx, query)
+	case Bing:
+		return t.searchWithBing(ctx, query)
 	case Mock:
-		results := t.mockSearch(query)
-		return t.formatResults(results), nil
+		return t.formatResults(t.mockSearch(query)), nil
+	case DuckDuckGo:
+		if engine != t.engineType {
+			// 作为备用引擎时 searchAPIURL 是主引擎的地址
+			return t.searchWithDuckDuckGo(ctx, t.fallbackURL, query)
+		}
+		return t.searchWithDuckDuckGo(ctx, t.searchAPIURL, query)
 	default:
 		// 默认使用DuckDuckGo
-		return t.searchWithDuckDuckGo(ctx, query)
+		return t.searchWithDuckDuckGo(ctx, t.searchAPIURL, query)
 	}
 }
 
+// enrichTopResult 抓取首条结果页面，提取摘录写入 excerpt 字段；失败时将原因写入 excerpt_error 字段而不影响搜索
+func (t *WebSearchTool) enrichTopResult(ctx context.Context, results []map[string]string) {
+	if len(results) == 0 || results[0]["link"] == "" {
+		return
+	}
+
+	fetch := t.fetchPage
+	if fetch == nil {
+		fetch = func(ctx context.Context, pageURL string) (string, error) {
+			return fetchPageText(ctx, pageURL, enrichMaxBytes)
+		}
+	}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, t.enrichTimeout)
+	defer cancel()
+	text, err := fetch(fetchCtx, results[0]["link"])
+	if err == nil && text == "" {
+		err = errors.New("页面没有可提取的正文")
+	}
+	if err != nil {
+		logger.FromContext(ctx).Debug("抓取搜索结果页面失败", map[string]interface{}{
+			"url":   results[0]["link"],
+			"error": err.Error(),
+		})
+		results[0]["excerpt_error"] = err.Error()
+		return
+	}
+	results[0]["excerpt"] = truncateRunes(text, t.enrichMaxChars)
+}
+
 // searchWithSearchAPI 使用SearchAPI进行搜索
 func (t *WebSearchTool) searchWithSearchAPI(ctx context.Context, query string) (interface{}, error) {
 	// 构建请求URL
@@ -135,9 +308,8 @@ func (t *WebSearchTool) searchWithSearchAPI(ctx context.Context, query string) (
 		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
 
-	// 发送请求
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// 发送请求（超时由 t.client 控制，取消由 ctx 控制）
+	resp, err := t.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("发送请求失败: %w", err)
 	}
@@ -146,7 +318,7 @@ func (t *WebSearchTool) searchWithSearchAPI(ctx context.Context, query string) (
 	// 检查响应状态
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API请求失败，状态码: %d, 响应: %s", resp.StatusCode, string(bodyBytes))
+		return nil, searchStatusError(resp.StatusCode, bodyBytes)
 	}
 
 	// 解析响应
@@ -163,11 +335,138 @@ func (t *WebSearchTool) searchWithSearchAPI(ctx context.Context, query string) (
 	return t.formatResults(searchResp.Results), nil
 }
 
+// searchWithSerpAPI 使用SerpAPI获取Google搜索结果
+func (t *WebSearchTool) searchWithSerpAPI(ctx context.Context, query string) (interface{}, error) {
+	reqURL := fmt.Sprintf("%s?engine=google&q=%s&api_key=%s",
+		t.searchAPIURL,
+		url.QueryEscape(query),
+		url.QueryEscape(t.apiKey))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	body, err := t.doSearchRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var serpResp struct {
+		Error          string `json:"error"`
+		OrganicResults []struct {
+			Title   string `json:"title"`
+			Link    string `json:"link"`
+			Snippet string `json:"snippet"`
+		} `json:"organic_results"`
+	}
+	if err := json.Unmarshal(body, &serpResp); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+	// 没有结果时SerpAPI以200状态码在 error 字段中说明，不视为错误
+	if serpResp.Error != "" && !strings.Contains(serpResp.Error, "hasn't returned any results") {
+		return nil, fmt.Errorf("SerpAPI返回错误: %s", serpResp.Error)
+	}
+
+	var results []SearchResult
+	for _, r := range serpResp.OrganicResults {
+		if r.Link != "" {
+			results = append(results, SearchResult{Title: r.Title, Link: r.Link, Description: r.Snippet})
+		}
+	}
+	if len(results) == 0 {
+		return "没有找到相关结果", nil
+	}
+	return t.formatResults(results), nil
+}
+
+// searchWithBing 使用Bing Web Search API进行搜索，API密钥通过请求头传递
+func (t *WebSearchTool) searchWithBing(ctx context.Context, query string) (interface{}, error) {
+	reqURL := fmt.Sprintf("%s?q=%s", t.searchAPIURL, url.QueryEscape(query))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Ocp-Apim-Subscription-Key", t.apiKey)
+	body, err := t.doSearchRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var bingResp struct {
+		WebPages struct {
+			Value []struct {
+				Name    string `json:"name"`
+				URL     string `json:"url"`
+				Snippet string `json:"snippet"`
+			} `json:"value"`
+		} `json:"webPages"`
+	}
+	if err := json.Unmarshal(body, &bingResp); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+
+	var results []SearchResult
+	for _, r := range bingResp.WebPages.Value {
+		if r.URL != "" {
+			results = append(results, SearchResult{Title: r.Name, Link: r.URL, Description: r.Snippet})
+		}
+	}
+	if len(results) == 0 {
+		return "没有找到相关结果", nil
+	}
+	return t.formatResults(results), nil
+}
+
+// doSearchRequest 发送搜索请求并返回响应体，非200状态码转换为 searchStatusError
+func (t *WebSearchTool) doSearchRequest(req *http.Request) ([]byte, error) {
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("发送请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, searchStatusError(resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+// searchStatusError 将搜索服务的非200响应转换为错误，401/403 返回 ErrSearchAPIKeyInvalid
+// 响应体为 {"error":"..."} 或 {"error":{"message":"..."}} 时只保留其中的错误信息
+func searchStatusError(statusCode int, body []byte) error {
+	message := strings.TrimSpace(string(body))
+	var payload struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) == nil && len(payload.Error) > 0 {
+		var text string
+		var detail struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(payload.Error, &text) == nil && text != "" {
+			message = text
+		} else if json.Unmarshal(payload.Error, &detail) == nil && detail.Message != "" {
+			message = detail.Message
+		}
+	}
+	message = truncateRunes(message, 300)
+
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		return fmt.Errorf("%w（状态码 %d）: %s", ErrSearchAPIKeyInvalid, statusCode, message)
+	}
+	return fmt.Errorf("API请求失败，状态码: %d, 响应: %s", statusCode, message)
+}
+
 // searchWithDuckDuckGo 使用DuckDuckGo进行搜索
-func (t *WebSearchTool) searchWithDuckDuckGo(ctx context.Context, query string) (interface{}, error) {
+func (t *WebSearchTool) searchWithDuckDuckGo(ctx context.Context, endpoint, query string) (interface{}, error) {
 	// 构建请求URL
 	reqURL := fmt.Sprintf("%s?q=%s&format=json&no_html=1&no_redirect=1",
-		t.searchAPIURL,
+		endpoint,
 		url.QueryEscape(query))
 
 	// 创建HTTP请求
@@ -176,9 +475,8 @@ func (t *WebSearchTool) searchWithDuckDuckGo(ctx context.Context, query string)
 		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
 
-	// 发送请求
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// 发送请求（超时由 t.client 控制，取消由 ctx 控制）
+	resp, err := t.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("发送请求失败: %w", err)
 	}
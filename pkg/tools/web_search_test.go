@@ -0,0 +1,325 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSearchEngineType(t *testing.T) {
+	cases := map[string]SearchEngineType{
+		"searchapi":    SearchAPI,
+		"DuckDuckGo":   DuckDuckGo,
+		" mock ":       Mock,
+		"SEARCHAPI":    SearchAPI,
+		"duckduckgo\n": DuckDuckGo,
+		"SerpAPI":      SerpAPI,
+		"bing":         Bing,
+	}
+	for name, want := range cases {
+		got, err := ParseSearchEngineType(name)
+		if err != nil || got != want {
+			t.Errorf("ParseSearchEngineType(%q) = %q, %v，期望 %q", name, got, err, want)
+		}
+	}
+
+	_, err := ParseSearchEngineType("yahoo")
+	if err == nil {
+		t.Fatal("未知引擎应返回错误")
+	}
+	for _, e := range supportedSearchEngines {
+		if !strings.Contains(err.Error(), string(e)) {
+			t.Errorf("错误信息应列出支持的引擎 %q: %v", e, err)
+		}
+	}
+}
+
+func TestNewWebSearchToolSelectsEngineByAPIKey(t *testing.T) {
+	if got := NewWebSearchTool("").engineType; got != DuckDuckGo {
+		t.Errorf("无 API Key 时引擎 = %q，期望 duckduckgo", got)
+	}
+	if got := NewWebSearchTool("key").engineType; got != SearchAPI {
+		t.Errorf("有 API Key 时引擎 = %q，期望 searchapi", got)
+	}
+}
+
+func TestNewWebSearchToolWithEngine(t *testing.T) {
+	cases := []struct {
+		engine  SearchEngineType
+		wantURL string
+		wantKey string
+	}{
+		{SearchAPI, "https://api.searchapi.com/v1/search", "key"},
+		{SerpAPI, "https://serpapi.com/search.json", "key"},
+		{Bing, "https://api.bing.microsoft.com/v7.0/search", "key"},
+		// 即使配置了 API Key 也可以强制使用 DuckDuckGo 或 mock
+		{DuckDuckGo, "https://api.duckduckgo.com/", ""},
+		{Mock, "", ""},
+	}
+	for _, c := range cases {
+		tool := NewWebSearchToolWithEngine(c.engine, "key")
+		if tool.engineType != c.engine || tool.searchAPIURL != c.wantURL || tool.apiKey != c.wantKey {
+			t.Errorf("引擎 %q: got engine=%q url=%q key=%q", c.engine, tool.engineType, tool.searchAPIURL, tool.apiKey)
+		}
+	}
+}
+
+func TestMockEngineReturnsResultsWithoutNetwork(t *testing.T) {
+	tool := NewWebSearchToolWithEngine(Mock, "")
+	result, err := tool.Execute(context.Background(), map[string]interface{}{"query": "golang"})
+	if err != nil {
+		t.Fatalf("mock 搜索失败: %v", err)
+	}
+	results, ok := result.([]map[string]string)
+	if !ok || len(results) == 0 {
+		t.Fatalf("mock 搜索结果 = %#v", result)
+	}
+	if !strings.Contains(results[0]["title"], "golang") {
+		t.Errorf("结果标题应包含查询词: %q", results[0]["title"])
+	}
+}
+
+func TestSearchEnginesQueryConfiguredEndpoint(t *testing.T) {
+	cases := []struct {
+		engine SearchEngineType
+		body   interface{}
+		check  func(r *http.Request) bool
+	}{
+		{
+			engine: SearchAPI,
+			body:   SearchResponse{Results: []SearchResult{{Title: "t", Link: "https://a.example", Description: "d"}}},
+			check:  func(r *http.Request) bool { return r.URL.Query().Get("api_key") == "key" },
+		},
+		{
+			engine: SerpAPI,
+			body: map[string]interface{}{"organic_results": []map[string]string{
+				{"title": "t", "link": "https://a.example", "snippet": "d"},
+			}},
+			check: func(r *http.Request) bool {
+				return r.URL.Query().Get("engine") == "google" && r.URL.Query().Get("api_key") == "key"
+			},
+		},
+		{
+			engine: Bing,
+			body: map[string]interface{}{"webPages": map[string]interface{}{"value": []map[string]string{
+				{"name": "t", "url": "https://a.example", "snippet": "d"},
+			}}},
+			check: func(r *http.Request) bool {
+				// 密钥通过请求头传递，不出现在URL中
+				return r.Header.Get("Ocp-Apim-Subscription-Key") == "key" && r.URL.Query().Get("api_key") == ""
+			},
+		},
+		{
+			engine: DuckDuckGo,
+			body:   map[string]string{"AbstractText": "d", "AbstractURL": "https://a.example"},
+			check: func(r *http.Request) bool {
+				return r.URL.Query().Get("format") == "json" && r.URL.Query().Get("api_key") == ""
+			},
+		},
+	}
+	for _, c := range cases {
+		var called bool
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			if r.URL.Query().Get("q") != "go" || !c.check(r) {
+				t.Errorf("引擎 %q 的请求参数不正确: %s", c.engine, r.URL.RawQuery)
+			}
+			json.NewEncoder(w).Encode(c.body)
+		}))
+		tool := NewWebSearchToolWithEngine(c.engine, "key")
+		tool.searchAPIURL = srv.URL
+		result, err := tool.Execute(context.Background(), map[string]interface{}{"query": "go"})
+		srv.Close()
+		if err != nil || !called {
+			t.Fatalf("引擎 %q: err=%v called=%v", c.engine, err, called)
+		}
+		results, ok := result.([]map[string]string)
+		if !ok || len(results) != 1 || results[0]["link"] != "https://a.example" {
+			t.Errorf("引擎 %q 结果 = %#v", c.engine, result)
+		}
+	}
+}
+
+func TestEnrichmentAddsExcerptFromStubFetcher(t *testing.T) {
+	tool := NewWebSearchToolWithEngine(Mock, "")
+	tool.SetEnrichment(true, time.Second, 10)
+	var fetched []string
+	tool.fetchPage = func(ctx context.Context, pageURL string) (string, error) {
+		fetched = append(fetched, pageURL)
+		return "这是首条结果页面的正文内容，较长的部分会被截断", nil
+	}
+
+	result, err := tool.Execute(context.Background(), map[string]interface{}{"query": "golang"})
+	if err != nil {
+		t.Fatalf("搜索失败: %v", err)
+	}
+	results := result.([]map[string]string)
+	if len(fetched) != 1 || fetched[0] != results[0]["link"] {
+		t.Fatalf("应只抓取首条结果页面，实际 %v", fetched)
+	}
+	if got := results[0]["excerpt"]; got != "这是首条结果页面的正..." {
+		t.Errorf("摘录 = %q", got)
+	}
+	for _, r := range results[1:] {
+		if r["excerpt"] != "" {
+			t.Errorf("只有首条结果应包含摘录: %v", r)
+		}
+	}
+}
+
+func TestEnrichmentFailureIsRecordedInResult(t *testing.T) {
+	tool := NewWebSearchToolWithEngine(Mock, "")
+	tool.SetEnrichment(true, time.Second, 100)
+	tool.fetchPage = func(ctx context.Context, pageURL string) (string, error) {
+		return "", errors.New("连接被拒绝")
+	}
+
+	result, err := tool.Execute(context.Background(), map[string]interface{}{"query": "golang"})
+	if err != nil {
+		t.Fatalf("抓取失败不应影响搜索: %v", err)
+	}
+	top := result.([]map[string]string)[0]
+	if top["excerpt"] != "" || !strings.Contains(top["excerpt_error"], "连接被拒绝") {
+		t.Errorf("失败原因应写入 excerpt_error: %v", top)
+	}
+
+	// 关闭增强时不抓取页面
+	tool.SetEnrichment(false, time.Second, 100)
+	tool.fetchPage = func(ctx context.Context, pageURL string) (string, error) {
+		t.Error("关闭增强时不应抓取页面")
+		return "", nil
+	}
+	tool.Execute(context.Background(), map[string]interface{}{"query": "golang"})
+}
+
+func TestKeyedSearchEnginesReportMissingOrInvalidKey(t *testing.T) {
+	for _, engine := range []SearchEngineType{SearchAPI, SerpAPI, Bing} {
+		tool := NewWebSearchToolWithEngine(engine, " ")
+		tool.searchAPIURL = "http://127.0.0.1:0" // 不应发出请求
+		if _, err := tool.Execute(context.Background(), map[string]interface{}{"query": "go"}); !errors.Is(err, ErrSearchAPIKeyMissing) {
+			t.Errorf("引擎 %q 缺少密钥: 错误 = %v，期望 ErrSearchAPIKeyMissing", engine, err)
+		}
+	}
+
+	bodies := map[SearchEngineType]string{
+		SearchAPI: `{"error":"Invalid API key."}`,
+		SerpAPI:   `{"error":"Invalid API key. Your API key should be here: https://serpapi.com/manage-api-key"}`,
+		Bing:      `{"error":{"code":"401","message":"Access denied due to invalid subscription key."}}`,
+	}
+	for engine, body := range bodies {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(body))
+		}))
+		tool := NewWebSearchToolWithEngine(engine, "bad-key")
+		tool.searchAPIURL = srv.URL
+		result, err := tool.Execute(context.Background(), map[string]interface{}{"query": "go"})
+		srv.Close()
+		if !errors.Is(err, ErrSearchAPIKeyInvalid) {
+			t.Errorf("引擎 %q 密钥无效: result=%v err=%v，期望 ErrSearchAPIKeyInvalid", engine, result, err)
+			continue
+		}
+		if strings.Contains(err.Error(), `{"error"`) || !strings.Contains(strings.ToLower(err.Error()), "invalid") {
+			t.Errorf("引擎 %q: 错误信息应只包含服务返回的说明: %v", engine, err)
+		}
+	}
+}
+
+func TestSerpAPINoResultsIsNotAnError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error":"Google hasn't returned any results for this query."}`))
+	}))
+	defer srv.Close()
+	tool := NewWebSearchToolWithEngine(SerpAPI, "key")
+	tool.searchAPIURL = srv.URL
+	result, err := tool.Execute(context.Background(), map[string]interface{}{"query": "xyzzy"})
+	if err != nil || result != "没有找到相关结果" {
+		t.Errorf("无结果时 = %v, %v，期望提示没有结果", result, err)
+	}
+}
+
+// manyResultsServer 返回 n 条 SearchAPI 格式结果的测试服务
+func manyResultsServer(t *testing.T, n int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp SearchResponse
+		for i := 0; i < n; i++ {
+			resp.Results = append(resp.Results, SearchResult{Title: "t", Link: "https://a.example/" + strings.Repeat("x", i+1)})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSearchResultCountDefaultAndNumOverride(t *testing.T) {
+	tool := NewWebSearchToolWithEngine(SearchAPI, "key")
+	tool.searchAPIURL = manyResultsServer(t, 20).URL
+
+	count := func(params map[string]interface{}) int {
+		t.Helper()
+		params["query"] = "go"
+		result, err := tool.Execute(context.Background(), params)
+		if err != nil {
+			t.Fatalf("搜索失败: %v", err)
+		}
+		return len(result.([]map[string]string))
+	}
+	if n := count(map[string]interface{}{}); n != DefaultSearchMaxResults {
+		t.Errorf("默认结果数 = %d，期望 %d", n, DefaultSearchMaxResults)
+	}
+	tool.SetLimits(0, 3)
+	if n := count(map[string]interface{}{}); n != 3 {
+		t.Errorf("配置后结果数 = %d，期望 3", n)
+	}
+	if n := count(map[string]interface{}{"num": float64(15)}); n != 15 {
+		t.Errorf("num=15 时结果数 = %d", n)
+	}
+
+	for _, bad := range []interface{}{0, 1.5, maxSearchResultsLimit + 1, "many"} {
+		if _, err := tool.Execute(context.Background(), map[string]interface{}{"query": "go", "num": bad}); err == nil {
+			t.Errorf("num=%v 应返回错误", bad)
+		}
+	}
+}
+
+func TestSearchRequestTimesOutAndHonorsCancellation(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	for _, engine := range []SearchEngineType{SearchAPI, DuckDuckGo, Bing} {
+		tool := NewWebSearchToolWithEngine(engine, "key")
+		tool.searchAPIURL = srv.URL
+		tool.SetLimits(50*time.Millisecond, 0)
+
+		start := time.Now()
+		if _, err := tool.Execute(context.Background(), map[string]interface{}{"query": "go"}); err == nil {
+			t.Errorf("引擎 %q: 慢速搜索服务应超时", engine)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("引擎 %q: 超时未生效，耗时 %v", engine, elapsed)
+		}
+	}
+
+	// 客户端未设置超时时，取消 ctx 也能中断请求
+	tool := NewWebSearchToolWithEngine(DuckDuckGo, "")
+	tool.searchAPIURL = srv.URL
+	tool.SetHTTPClient(&http.Client{})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := tool.Execute(ctx, map[string]interface{}{"query": "go"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("取消后的错误 = %v，期望 context.DeadlineExceeded", err)
+	}
+}
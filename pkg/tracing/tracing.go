@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName 本项目使用的 Tracer 名称
+const instrumentationName = "agentEino"
+
+// ShutdownFunc 用于在程序退出前刷新并关闭追踪导出器
+type ShutdownFunc func(ctx context.Context) error
+
+// Init 根据导出器名称初始化全局 TracerProvider
+// 未配置导出器（空字符串或 "none"）时保持 OpenTelemetry 默认的 no-op 实现
+func Init(exporter string) (ShutdownFunc, error) {
+	noop := func(ctx context.Context) error { return nil }
+
+	switch strings.ToLower(strings.TrimSpace(exporter)) {
+	case "", "none":
+		return noop, nil
+	case "stdout":
+		exp, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return noop, fmt.Errorf("创建stdout导出器失败: %w", err)
+		}
+		tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp))
+		otel.SetTracerProvider(tp)
+		return tp.Shutdown, nil
+	default:
+		return noop, fmt.Errorf("不支持的追踪导出器: %q，支持: stdout, none", exporter)
+	}
+}
+
+// Tracer 返回本项目的 Tracer（始终从全局 TracerProvider 获取，便于测试中替换）
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// StartSpan 创建子 span
+func StartSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// RecordError 在 span 上记录错误状态（不结束 span），err 为空时忽略
+func RecordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// EndSpan 结束 span，err 非空时记录错误状态
+func EndSpan(span trace.Span, err error) {
+	RecordError(span, err)
+	span.End()
+}
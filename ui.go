@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"agentEino/pkg/agent"
+)
+
+// uiText 命令行界面的状态提示文本
+type uiText struct {
+	Welcome   string
+	Goodbye   string
+	Thinking  string
+	Cancelled string
+	Error     string // 错误前缀
+}
+
+// uiTexts 按语言区分的状态提示，-cli 模式使用英文避免终端中文编码问题
+var uiTexts = map[string]uiText{
+	"en": {
+		Welcome:   "Welcome to Eino AI Assistant (type 'exit' to quit)\n------------------------------",
+		Goodbye:   "Goodbye!",
+		Thinking:  "Thinking...",
+		Cancelled: "Cancelled",
+		Error:     "Error",
+	},
+	"zh": {
+		Welcome:   "欢迎使用 Eino AI 助手 (输入 'exit' 退出)\n------------------------------",
+		Goodbye:   "再见!",
+		Thinking:  "思考中...",
+		Cancelled: "已取消",
+		Error:     "错误",
+	},
+}
+
+// terminalUI 统一输出命令行的状态提示与回复内容
+// quiet 时不输出欢迎语、思考中等状态行，只保留输入提示符、回复与错误；
+// 状态行总是从新的一行开始，不会插在流式回复的中间
+type terminalUI struct {
+	out        io.Writer
+	text       uiText
+	quiet      bool
+	inLine     bool // 最近输出的回复内容尚未换行
+	responding bool // 本次流式回复已输出过正文
+}
+
+// newTerminalUI 创建命令行界面，lang 不支持时使用中文
+func newTerminalUI(out io.Writer, lang string, quiet bool) *terminalUI {
+	text, ok := uiTexts[lang]
+	if !ok {
+		text = uiTexts["zh"]
+	}
+	return &terminalUI{out: out, text: text, quiet: quiet}
+}
+
+// status 输出一行状态提示，quiet 时忽略
+func (u *terminalUI) status(msg string) {
+	if u.quiet {
+		return
+	}
+	u.endLine()
+	fmt.Fprintln(u.out, msg)
+}
+
+// endLine 回复内容未换行时先换行
+func (u *terminalUI) endLine() {
+	if u.inLine {
+		fmt.Fprintln(u.out)
+		u.inLine = false
+	}
+}
+
+func (u *terminalUI) Welcome()   { u.status(u.text.Welcome) }
+func (u *terminalUI) Goodbye()   { u.status(u.text.Goodbye) }
+func (u *terminalUI) Thinking()  { u.status(u.text.Thinking) }
+func (u *terminalUI) Cancelled() { u.status(u.text.Cancelled) }
+
+// Prompt 输出输入提示符
+func (u *terminalUI) Prompt() {
+	u.endLine()
+	fmt.Fprint(u.out, "\n> ")
+}
+
+// Error 输出错误，quiet 时同样输出
+func (u *terminalUI) Error(err error) {
+	u.endLine()
+	fmt.Fprintf(u.out, "%s: %v\n", u.text.Error, err)
+}
+
+// Response 输出一次完整的回复
+func (u *terminalUI) Response(response string) {
+	u.endLine()
+	fmt.Fprintln(u.out, "\n"+response)
+}
+
+// Event 输出流式回复中的一个事件：正文直接输出，思维链事件作为状态行单独输出
+func (u *terminalUI) Event(ev agent.StreamEvent) {
+	if !ev.IsContent() {
+		u.status(fmt.Sprintf("[%s] %s", ev.Kind, ev.Data))
+		return
+	}
+	if ev.Data == "" {
+		return
+	}
+	if !u.responding {
+		fmt.Fprintln(u.out)
+		u.responding = true
+	}
+	fmt.Fprint(u.out, ev.Data)
+	u.inLine = true
+}
+
+// EndResponse 结束一次流式回复
+func (u *terminalUI) EndResponse() {
+	u.endLine()
+	u.responding = false
+}
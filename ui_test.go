@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"agentEino/pkg/agent"
+)
+
+// runSession 模拟一轮流式对话的界面输出
+func runSession(ui *terminalUI) {
+	ui.Welcome()
+	ui.Prompt()
+	ui.Thinking()
+	ui.Event(agent.StreamEvent{Kind: "tool_call", Data: "调用 weather"})
+	ui.Event(agent.StreamEvent{Kind: agent.StreamEventContent, Data: "今天"})
+	ui.Event(agent.StreamEvent{Kind: "citation_missing", Data: "未标注来源"})
+	ui.Event(agent.StreamEvent{Kind: agent.StreamEventContent, Data: "晴"})
+	ui.EndResponse()
+	ui.Error(errors.New("超时"))
+	ui.Goodbye()
+}
+
+func TestQuietSuppressesStatusLines(t *testing.T) {
+	var buf bytes.Buffer
+	runSession(newTerminalUI(&buf, "zh", true))
+	out := buf.String()
+
+	for _, status := range []string{"欢迎使用", "思考中", "再见", "[tool_call]", "[citation_missing]"} {
+		if strings.Contains(out, status) {
+			t.Errorf("quiet 模式不应输出 %q，实际:\n%s", status, out)
+		}
+	}
+	if !strings.Contains(out, "今天晴") || !strings.Contains(out, "错误: 超时") {
+		t.Errorf("quiet 模式仍应输出回复与错误，实际:\n%s", out)
+	}
+}
+
+func TestStatusLinesDoNotInterleaveWithResponse(t *testing.T) {
+	var buf bytes.Buffer
+	runSession(newTerminalUI(&buf, "en", false))
+	out := buf.String()
+
+	for _, status := range []string{"Welcome to Eino", "Thinking...", "Goodbye!", "Error: 超时"} {
+		if !strings.Contains(out, status) {
+			t.Errorf("应输出英文状态 %q，实际:\n%s", status, out)
+		}
+	}
+	// 流式回复中途的状态行单独成行，不拼接在正文后面
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Contains(line, "[citation_missing]") && line != "[citation_missing] 未标注来源" {
+			t.Errorf("状态行应单独成行，实际 %q", line)
+		}
+	}
+	if !strings.Contains(out, "今天\n[citation_missing] 未标注来源\n晴\n") {
+		t.Errorf("输出顺序不符合预期:\n%s", out)
+	}
+}
+
+func TestUnknownLanguageFallsBackToChinese(t *testing.T) {
+	var buf bytes.Buffer
+	newTerminalUI(&buf, "fr", false).Thinking()
+	if buf.String() != "思考中...\n" {
+		t.Errorf("未知语言应使用中文提示，实际 %q", buf.String())
+	}
+}